@@ -0,0 +1,651 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generator writes the Go types of the event types of a network
+// schema, as encoded by the avro factory (see EncodeNetwork), with
+// their conversions from and to the avro native values, and the
+// typed client wrapper
+type generator struct {
+	pkg string
+	vsn uint64
+
+	decls bytes.Buffer
+	// the converters written, by their key
+	convs map[string]conv
+	// the Go names taken, and the ones of the
+	// records and enums by their definition
+	names map[string]bool
+	named map[string]string
+	// the named types by their avro name,
+	// as they can be referred once defined
+	defs    map[string]map[string]interface{}
+	imports map[string]bool
+}
+
+// conv is the Go type of an avro type. The converters of its
+// values are fromNative<key> and toNative<key>
+type conv struct {
+	key    string
+	goType string
+}
+
+// eventType is an event type of an entity type, at a version
+type eventType struct {
+	name string
+	vsn  uint64
+	data interface{}
+}
+
+func newGenerator(pkg string, vsn uint64) *generator {
+	g := &generator{
+		pkg:     pkg,
+		vsn:     vsn,
+		convs:   map[string]conv{},
+		names:   map[string]bool{"Client": true, "NewClient": true, "SchemaVSN": true, "NegotiateSchema": true},
+		named:   map[string]string{},
+		defs:    map[string]map[string]interface{}{},
+		imports: map[string]bool{},
+	}
+	return g
+}
+
+// Generate returns the formatted Go source of the event types
+// of the JSON network schema
+func (g *generator) Generate(network []byte) ([]byte, error) {
+	var wrapper map[string]interface{}
+	if err := json.Unmarshal(network, &wrapper); err != nil {
+		return nil, err
+	}
+	entities, err := entityEvents(wrapper)
+	if err != nil {
+		return nil, err
+	}
+	var client bytes.Buffer
+	for _, entName := range sortedKeys(entities) {
+		if err = g.entity(&client, entName, entities[entName]); err != nil {
+			return nil, fmt.Errorf("%s: %s", entName, err)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by eventino-gen. DO NOT EDIT.\n\n")
+	if g.vsn > 0 {
+		fmt.Fprintf(&out, "// Generated from the schema version %d\n\n", g.vsn)
+	}
+	fmt.Fprintf(&out, "package %s\n\nimport (\n\t\"fmt\"\n", g.pkg)
+	if g.imports["math/big"] {
+		fmt.Fprintf(&out, "\t\"math/big\"\n")
+	}
+	fmt.Fprintf(&out, "\t\"time\"\n\n")
+	fmt.Fprintf(&out, "\t\"github.com/cheng81/eventino/pkg/eventino\"\n")
+	fmt.Fprintf(&out, "\t\"github.com/cheng81/eventino/pkg/eventino/client\"\n)\n\n")
+	out.WriteString(clientSource)
+	if g.vsn > 0 {
+		fmt.Fprintf(&out, negotiateSource, g.vsn)
+	}
+	out.Write(client.Bytes())
+	out.Write(g.decls.Bytes())
+	out.WriteString(helpersSource)
+	if g.imports["math/big"] {
+		out.WriteString(decimalSource)
+	}
+	return format.Source(out.Bytes())
+}
+
+// entityEvents returns the event types of each entity type,
+// from the entity_event field of the network schema
+func entityEvents(wrapper map[string]interface{}) (map[string][]eventType, error) {
+	out := map[string][]eventType{}
+	for _, f := range fieldsOf(wrapper) {
+		if f["name"] != "entity_event" {
+			continue
+		}
+		branches, _ := f["type"].([]interface{})
+		for _, branch := range branches {
+			ent, _ := branch.(map[string]interface{})
+			if ent["type"] != "record" {
+				continue
+			}
+			var evts []eventType
+			for _, ef := range fieldsOf(ent) {
+				if ef["name"] != "event" {
+					continue
+				}
+				records, _ := ef["type"].([]interface{})
+				for _, r := range records {
+					record, _ := r.(map[string]interface{})
+					id, _ := record["name"].(string)
+					sep := strings.LastIndex(id, "_")
+					vsn, err := strconv.ParseUint(id[sep+1:], 10, 64)
+					if sep < 0 || err != nil {
+						return nil, fmt.Errorf("invalid event type %s", id)
+					}
+					evt := eventType{name: id[:sep], vsn: vsn}
+					for _, df := range fieldsOf(record) {
+						if df["name"] == "data" {
+							evt.data = df["type"]
+						}
+					}
+					evts = append(evts, evt)
+				}
+			}
+			sort.Slice(evts, func(i, j int) bool {
+				if evts[i].name != evts[j].name {
+					return evts[i].name < evts[j].name
+				}
+				return evts[i].vsn < evts[j].vsn
+			})
+			out[ent["name"].(string)] = evts
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("not a network schema")
+}
+
+// entity writes the event types of the entity, its typed
+// entity and event, and the client methods to put and get them
+func (g *generator) entity(client *bytes.Buffer, entName string, evts []eventType) error {
+	entType := g.name(goName(entName))
+	evtType := g.name(entType + "Event")
+	var evtTypes []string
+	for _, evt := range evts {
+		typ := g.name(fmt.Sprintf("%s%sV%d", entType, goName(evt.name), evt.vsn))
+		id := fmt.Sprintf("%s_%d", evt.name, evt.vsn)
+		c, err := g.eventData(typ, fmt.Sprintf("the data of the %s %s event, version %d", entName, evt.name, evt.vsn), evt.data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", id, err)
+		}
+		evtTypes = append(evtTypes, typ)
+		fmt.Fprintf(client, "// Put%s puts a %s event on the %s entity id\n", typ, id, entName)
+		fmt.Fprintf(client, "func (c Client) Put%s(id []byte, expected eventino.ExpectedVSN, evt %s) (uint64, eventino.EventID, error) {\n", typ, typ)
+		fmt.Fprintf(client, "\treturn c.Eventino().Put(%q, id, expected, %q, toNative%s(evt))\n}\n\n", entName, id, c.key)
+	}
+
+	fmt.Fprintf(client, "// %s is an entity of type %s, with its typed events\n", entType, entName)
+	fmt.Fprintf(client, "type %s struct {\n\tID []byte\n\tVSN uint64\n\tLatestVSN uint64\n\tEvents []%s\n}\n\n", entType, evtType)
+	fmt.Fprintf(client, "// %s is an event of %s. Data is one of %s,\n", evtType, entType, strings.Join(evtTypes, ", "))
+	fmt.Fprintf(client, "// or the avro native value of the event types not generated\n")
+	fmt.Fprintf(client, "type %s struct {\n\tTimestamp time.Time\n\t// Type is the event type and version, e.g. %s_%d\n\tType string\n\tData interface{}\n}\n\n", evtType, evts[0].name, evts[0].vsn)
+
+	fmt.Fprintf(client, "// Get%s gets the %s entity id, see eventino.Eventino.GetEntity\n", entType, entName)
+	fmt.Fprintf(client, "func (c Client) Get%s(id []byte, vsn uint64, minPos eventino.EventID) (out %s, err error) {\n", entType, entType)
+	fmt.Fprintf(client, "\tent, err := c.Eventino().GetEntity(%q, id, vsn, minPos)\n\tif err != nil {\n\t\treturn\n\t}\n", entName)
+	fmt.Fprintf(client, "\tout = %s{ID: ent.ID, VSN: ent.VSN, LatestVSN: ent.LatestVSN, Events: make([]%s, len(ent.Events))}\n", entType, evtType)
+	fmt.Fprintf(client, "\tfor i, evt := range ent.Events {\n\t\tout.Events[i] = %s{Timestamp: evt.Timestamp, Type: evt.Type.ToString(), Data: evt.Payload}\n", evtType)
+	fmt.Fprintf(client, "\t\tswitch out.Events[i].Type {\n")
+	for i, evt := range evts {
+		fmt.Fprintf(client, "\t\tcase \"%s_%d\":\n\t\t\tout.Events[i].Data, err = fromNative%s(evt.Payload)\n", evt.name, evt.vsn, g.convs[evtTypes[i]].key)
+	}
+	fmt.Fprintf(client, "\t\t}\n\t\tif err != nil {\n\t\t\treturn out, fmt.Errorf(\"%%s: %%s\", out.Events[i].Type, err)\n\t\t}\n\t}\n\treturn\n}\n\n")
+	return nil
+}
+
+// eventData writes the Go type of the event data: a struct if it is a
+// record, or a named type of the Go type of the data otherwise
+func (g *generator) eventData(typ, doc string, data interface{}) (c conv, err error) {
+	if m, ok := data.(map[string]interface{}); ok && m["type"] == "record" {
+		if c, err = g.record(typ, doc, m); err == nil {
+			g.convs[typ] = c
+		}
+		return
+	}
+	var inner conv
+	if inner, err = g.conv(data); err != nil {
+		return
+	}
+	fmt.Fprintf(&g.decls, "// %s is %s\ntype %s %s\n\n", typ, doc, typ, inner.goType)
+	c = conv{key: typ, goType: typ}
+	g.convs[typ] = c
+	g.convFuncs(c, "n", fmt.Sprintf("x, err := fromNative%s(n)\n\treturn %s(x), err", inner.key, typ),
+		fmt.Sprintf("return toNative%s(%s(v))", inner.key, inner.goType))
+	return
+}
+
+// conv returns the Go type of the avro type, writing
+// its converters and named types if not written yet
+func (g *generator) conv(t interface{}) (conv, error) {
+	switch typ := t.(type) {
+	case string:
+		if def, ok := g.defs[typ]; ok {
+			return g.conv(def)
+		}
+		return g.simple(typ, "")
+	case []interface{}:
+		return g.union(typ)
+	case map[string]interface{}:
+		name, ok := typ["type"].(string)
+		if !ok {
+			// e.g. {"type": ["null", "string"]}
+			return g.conv(typ["type"])
+		}
+		switch name {
+		case "record":
+			return g.namedRecord(typ)
+		case "enum":
+			return g.enum(typ)
+		case "array":
+			return g.array(typ)
+		}
+		logical, _ := typ["logicalType"].(string)
+		if logical == "decimal" {
+			return g.decimal(typ)
+		}
+		return g.simple(name, logical)
+	}
+	return conv{}, fmt.Errorf("unsupported type %v", t)
+}
+
+// the Go types of the avro types, and their native types
+var simpleTypes = map[string][2]string{
+	"boolean": {"bool", "bool"},
+	"int":     {"int32", "int32"},
+	"long":    {"int64", "int64"},
+	"float":   {"float32", "float32"},
+	"double":  {"float64", "float64"},
+	"string":  {"string", "string"},
+	"bytes":   {"[]byte", "[]byte"},
+}
+
+// the logical types converted with the eventino functions
+var logicalTypes = map[string][2]string{
+	"timestamp-millis": {"TimestampMillis", "int64"},
+	"timestamp-micros": {"TimestampMicros", "int64"},
+	"date":             {"DateDays", "int32"},
+}
+
+func (g *generator) simple(name, logical string) (conv, error) {
+	if name == "null" {
+		c := conv{key: "Null", goType: "interface{}"}
+		g.convFuncs(c, "n", "if n != nil {\n\t\treturn nil, fmt.Errorf(\"expected null, got %T\", n)\n\t}\n\treturn nil, nil", "return v")
+		return c, nil
+	}
+	if lt, ok := logicalTypes[logical]; ok {
+		c := conv{key: lt[0], goType: "time.Time"}
+		if logical == "date" {
+			c.key = "Date"
+		}
+		g.convFuncs(c, "n", fmt.Sprintf("x, ok := n.(%s)\n\tif !ok {\n\t\treturn time.Time{}, fmt.Errorf(\"expected %s, got %%T\", n)\n\t}\n\treturn eventino.From%s(x), nil", lt[1], logical, lt[0]),
+			fmt.Sprintf("return eventino.To%s(v)", lt[0]))
+		return c, nil
+	}
+	st, ok := simpleTypes[name]
+	if !ok {
+		return conv{}, fmt.Errorf("unsupported type %s", name)
+	}
+	// uuids are strings
+	c := conv{key: goName(name), goType: st[0]}
+	g.convFuncs(c, "n", fmt.Sprintf("x, ok := n.(%s)\n\tif !ok {\n\t\treturn x, fmt.Errorf(\"expected %s, got %%T\", n)\n\t}\n\treturn x, nil", st[1], name), "return v")
+	return c, nil
+}
+
+func (g *generator) decimal(typ map[string]interface{}) (conv, error) {
+	precision, ok := typ["precision"].(float64)
+	scale, ok2 := typ["scale"].(float64)
+	if !ok || !ok2 {
+		return conv{}, fmt.Errorf("invalid decimal %v", typ)
+	}
+	g.imports["math/big"] = true
+	c := conv{key: fmt.Sprintf("Decimal%d_%d", int(precision), int(scale)), goType: "*big.Rat"}
+	g.convFuncs(c, "n", fmt.Sprintf("x, ok := n.([]byte)\n\tif !ok {\n\t\treturn nil, fmt.Errorf(\"expected decimal(%d,%d), got %%T\", n)\n\t}\n\treturn eventino.FromDecimalBytes(x, %d), nil", int(precision), int(scale), int(scale)),
+		fmt.Sprintf("return decimalBytes(v, %d, %d)", int(precision), int(scale)))
+	return c, nil
+}
+
+func (g *generator) enum(typ map[string]interface{}) (conv, error) {
+	typName, written := g.namedType(typ)
+	c := conv{key: typName, goType: typName}
+	if written {
+		return c, nil
+	}
+	symbols, _ := typ["symbols"].([]interface{})
+	fmt.Fprintf(&g.decls, "// %s is the enum %s\ntype %s string\n\n// the symbols of %s\nconst (\n", typName, typ["name"], typName, typName)
+	for _, sym := range symbols {
+		fmt.Fprintf(&g.decls, "\t%s%s %s = %q\n", typName, goName(sym.(string)), typName, sym)
+	}
+	fmt.Fprintf(&g.decls, ")\n\n")
+	g.convFuncs(c, "n", fmt.Sprintf("x, ok := n.(string)\n\tif !ok {\n\t\treturn \"\", fmt.Errorf(\"expected enum %s, got %%T\", n)\n\t}\n\treturn %s(x), nil", typ["name"], typName),
+		"return string(v)")
+	return c, nil
+}
+
+func (g *generator) array(typ map[string]interface{}) (conv, error) {
+	items, err := g.conv(typ["items"])
+	if err != nil {
+		return items, err
+	}
+	c := conv{key: "ArrayOf" + items.key, goType: "[]" + items.goType}
+	g.convFuncs(c, "n", fmt.Sprintf(`items, ok := n.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected array, got %%T", n)
+	}
+	v := make(%s, len(items))
+	for i, item := range items {
+		x, err := fromNative%s(item)
+		if err != nil {
+			return nil, fmt.Errorf("[%%d]: %%s", i, err)
+		}
+		v[i] = x
+	}
+	return v, nil`, c.goType, items.key),
+		fmt.Sprintf(`items := make([]interface{}, len(v))
+	for i, item := range v {
+		items[i] = toNative%s(item)
+	}
+	return items`, items.key))
+	return c, nil
+}
+
+// union returns a pointer (or a nil-able type) for the optionals,
+// union(null, T), and an interface{} for the other unions: one of
+// the Go types of the branches
+func (g *generator) union(branches []interface{}) (conv, error) {
+	convs := make([]conv, len(branches))
+	names := make([]string, len(branches))
+	keys := make([]string, len(branches))
+	for i, branch := range branches {
+		c, err := g.conv(branch)
+		if err != nil {
+			return c, err
+		}
+		convs[i], names[i], keys[i] = c, branchName(branch), c.key
+	}
+	if len(branches) == 2 && names[0] == "null" {
+		return g.optional(convs[1], names[1])
+	}
+
+	c := conv{key: "UnionOf" + strings.Join(keys, "Or"), goType: "interface{}"}
+	var from, to bytes.Buffer
+	fmt.Fprintf(&from, "if n == nil {\n\t\treturn nil, nil\n\t}\n\tm, ok := n.(map[string]interface{})\n\tif !ok || len(m) != 1 {\n\t\treturn nil, fmt.Errorf(\"expected union, got %%T\", n)\n\t}\n\tfor branch, x := range m {\n\t\tswitch branch {\n")
+	fmt.Fprintf(&to, "switch x := v.(type) {\n\tcase nil:\n\t\treturn nil\n")
+	goTypes := map[string]bool{"interface{}": true}
+	for i, bc := range convs {
+		fmt.Fprintf(&from, "\t\tcase %q:\n\t\t\treturn fromNative%s(x)\n", names[i], bc.key)
+		if goTypes[bc.goType] {
+			continue
+		}
+		goTypes[bc.goType] = true
+		fmt.Fprintf(&to, "\tcase %s:\n\t\treturn map[string]interface{}{%q: toNative%s(x)}\n", bc.goType, names[i], bc.key)
+	}
+	fmt.Fprintf(&from, "\t\t}\n\t\treturn nil, fmt.Errorf(\"unknown branch %%s\", branch)\n\t}\n\treturn nil, nil")
+	fmt.Fprintf(&to, "\t}\n\treturn v")
+	g.convFuncs(c, "n", from.String(), to.String())
+	return c, nil
+}
+
+func (g *generator) optional(inner conv, branch string) (conv, error) {
+	if nilable(inner.goType) {
+		c := conv{key: "OptionalOf" + inner.key, goType: inner.goType}
+		g.convFuncs(c, "n", fmt.Sprintf("if n == nil {\n\t\treturn nil, nil\n\t}\n\treturn fromNative%s(unwrap(n, %q))", inner.key, branch),
+			fmt.Sprintf("if v == nil {\n\t\treturn nil\n\t}\n\treturn map[string]interface{}{%q: toNative%s(v)}", branch, inner.key))
+		return c, nil
+	}
+	c := conv{key: "OptionalOf" + inner.key, goType: "*" + inner.goType}
+	g.convFuncs(c, "n", fmt.Sprintf("if n == nil {\n\t\treturn nil, nil\n\t}\n\tx, err := fromNative%s(unwrap(n, %q))\n\treturn &x, err", inner.key, branch),
+		fmt.Sprintf("if v == nil {\n\t\treturn nil\n\t}\n\treturn map[string]interface{}{%q: toNative%s(*v)}", branch, inner.key))
+	return c, nil
+}
+
+// pointer returns the pointer type of the fields with a
+// default, omitted from the native values when nil
+func (g *generator) pointer(inner conv) conv {
+	if nilable(inner.goType) {
+		return inner
+	}
+	c := conv{key: "PointerTo" + inner.key, goType: "*" + inner.goType}
+	g.convFuncs(c, "n", fmt.Sprintf("if n == nil {\n\t\treturn nil, nil\n\t}\n\tx, err := fromNative%s(n)\n\treturn &x, err", inner.key),
+		fmt.Sprintf("return toNative%s(*v)", inner.key))
+	return c
+}
+
+func (g *generator) namedRecord(typ map[string]interface{}) (conv, error) {
+	typName, written := g.namedType(typ)
+	if written {
+		return conv{key: typName, goType: typName}, nil
+	}
+	return g.record(typName, fmt.Sprintf("the record %s", typ["name"]), typ)
+}
+
+// record writes the struct of the record, with the
+// ToNative and FromNative methods
+func (g *generator) record(typName, doc string, typ map[string]interface{}) (conv, error) {
+	c := conv{key: typName, goType: typName}
+	canonical := canonicalJSON(typ)
+	if other, ok := g.named[canonical]; ok && other != typName {
+		// the same record, e.g. the same event data at two versions
+		fmt.Fprintf(&g.decls, "// %s is %s\ntype %s = %s\n\n", typName, doc, typName, other)
+		g.convFuncs(c, "n", fmt.Sprintf("return fromNative%s(n)", other), fmt.Sprintf("return toNative%s(v)", other))
+		return c, nil
+	}
+	g.named[canonical] = typName
+	g.defs[typ["name"].(string)] = typ
+
+	type field struct {
+		name, goName, doc string
+		conv              conv
+		defaulted         bool
+	}
+	var fields []field
+	used := map[string]bool{}
+	for _, f := range fieldsOf(typ) {
+		fc, err := g.conv(f["type"])
+		if err != nil {
+			return c, fmt.Errorf("%s: %s", f["name"], err)
+		}
+		_, defaulted := f["default"]
+		if defaulted {
+			fc = g.pointer(fc)
+		}
+		name := f["name"].(string)
+		fName := goName(name)
+		for i := 2; used[fName]; i++ {
+			fName = fmt.Sprintf("%s%d", goName(name), i)
+		}
+		used[fName] = true
+		doc, _ := f["doc"].(string)
+		fields = append(fields, field{name: name, goName: fName, doc: doc, conv: fc, defaulted: defaulted})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+
+	fmt.Fprintf(&g.decls, "// %s is %s\ntype %s struct {\n", typName, doc, typName)
+	for _, f := range fields {
+		if f.doc != "" {
+			fmt.Fprintf(&g.decls, "\t// %s\n", strings.Replace(f.doc, "\n", "\n\t// ", -1))
+		}
+		if f.defaulted {
+			fmt.Fprintf(&g.decls, "\t// %s defaults to the schema default when nil\n", f.goName)
+		}
+		fmt.Fprintf(&g.decls, "\t%s %s\n", f.goName, f.conv.goType)
+	}
+	fmt.Fprintf(&g.decls, "}\n\n")
+
+	fmt.Fprintf(&g.decls, "// ToNative returns the avro native value of v\nfunc (v %s) ToNative() map[string]interface{} {\n\tn := map[string]interface{}{\n", typName)
+	for _, f := range fields {
+		if !f.defaulted {
+			fmt.Fprintf(&g.decls, "\t\t%q: toNative%s(v.%s),\n", f.name, f.conv.key, f.goName)
+		}
+	}
+	fmt.Fprintf(&g.decls, "\t}\n")
+	for _, f := range fields {
+		if f.defaulted {
+			fmt.Fprintf(&g.decls, "\tif v.%s != nil {\n\t\tn[%q] = toNative%s(v.%s)\n\t}\n", f.goName, f.name, f.conv.key, f.goName)
+		}
+	}
+	fmt.Fprintf(&g.decls, "\treturn n\n}\n\n")
+
+	fmt.Fprintf(&g.decls, "// FromNative sets v from its avro native value\nfunc (v *%s) FromNative(n interface{}) (err error) {\n", typName)
+	fmt.Fprintf(&g.decls, "\tm, ok := n.(map[string]interface{})\n\tif !ok {\n\t\treturn fmt.Errorf(\"expected record %s, got %%T\", n)\n\t}\n", typ["name"])
+	for _, f := range fields {
+		fmt.Fprintf(&g.decls, "\tif v.%s, err = fromNative%s(m[%q]); err != nil {\n\t\treturn fmt.Errorf(\"%s: %%s\", err)\n\t}\n", f.goName, f.conv.key, f.name, f.name)
+	}
+	fmt.Fprintf(&g.decls, "\treturn nil\n}\n\n")
+
+	g.convFuncs(c, "n", fmt.Sprintf("var v %s\n\terr := v.FromNative(n)\n\treturn v, err", typName), "return v.ToNative()")
+	return c, nil
+}
+
+// namedType returns the Go name of a record or enum, and
+// whether it is already written, by its definition
+func (g *generator) namedType(typ map[string]interface{}) (string, bool) {
+	canonical := canonicalJSON(typ)
+	if typName, ok := g.named[canonical]; ok {
+		return typName, true
+	}
+	typName := g.name(goName(unversioned(typ["name"].(string))))
+	g.named[canonical] = typName
+	g.defs[typ["name"].(string)] = typ
+	return typName, false
+}
+
+// convFuncs writes the converters of c, if not written yet
+func (g *generator) convFuncs(c conv, arg, from, to string) {
+	if _, ok := g.convs["func:"+c.key]; ok {
+		return
+	}
+	g.convs["func:"+c.key] = c
+	fmt.Fprintf(&g.decls, "func fromNative%s(%s interface{}) (%s, error) {\n\t%s\n}\n\n", c.key, arg, c.goType, from)
+	fmt.Fprintf(&g.decls, "func toNative%s(v %s) interface{} {\n\t%s\n}\n\n", c.key, c.goType, to)
+}
+
+// name returns an unused Go name, numbering it if taken
+func (g *generator) name(base string) string {
+	name := base
+	for i := 2; g.names[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.names[name] = true
+	return name
+}
+
+// unversioned strips the version of a referenced type name, e.g. address_1 -> address
+func unversioned(name string) string {
+	i := strings.LastIndex(name, "_")
+	if i <= 0 || i == len(name)-1 {
+		return name
+	}
+	if _, err := strconv.ParseUint(name[i+1:], 10, 64); err != nil {
+		return name
+	}
+	return name[:i]
+}
+
+// goName is the exported Go name of an avro name, e.g. expected_vsn -> ExpectedVsn
+func goName(name string) string {
+	var out string
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			out += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	if out == "" {
+		return "X"
+	}
+	return out
+}
+
+// branchName is the name goavro uses for a union branch:
+// the name of named types, the type otherwise
+func branchName(t interface{}) string {
+	switch typ := t.(type) {
+	case string:
+		return typ
+	case map[string]interface{}:
+		switch name := typ["type"].(type) {
+		case string:
+			if name == "record" || name == "enum" || name == "fixed" {
+				return typ["name"].(string)
+			}
+			return name
+		default:
+			return branchName(name)
+		}
+	}
+	return "union"
+}
+
+func nilable(goType string) bool {
+	return goType == "interface{}" || strings.HasPrefix(goType, "*") || strings.HasPrefix(goType, "[]")
+}
+
+func fieldsOf(record map[string]interface{}) []map[string]interface{} {
+	fields, _ := record["fields"].([]interface{})
+	out := make([]map[string]interface{}, 0, len(fields))
+	for _, f := range fields {
+		if m, ok := f.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func canonicalJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func sortedKeys(m map[string][]eventType) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+const clientSource = `// Client wraps a client.Client, to put and get the typed events.
+// The schema must be loaded first, see eventino.Eventino.LoadSchema,
+// or negotiated, see client.Client.Negotiate
+type Client struct {
+	client.Client
+}
+
+// NewClient returns the typed wrapper of c
+func NewClient(c client.Client) Client {
+	return Client{c}
+}
+
+`
+
+const negotiateSource = `// SchemaVSN is the schema version the code is generated from
+const SchemaVSN = %d
+
+// NegotiateSchema negotiates SchemaVSN, the events of the later
+// versions are not sent
+func (c Client) NegotiateSchema() (client.Negotiated, error) {
+	return c.Negotiate(SchemaVSN, 0)
+}
+
+`
+
+const helpersSource = `// unwrap returns the value of a union branch
+func unwrap(n interface{}, branch string) interface{} {
+	if m, ok := n.(map[string]interface{}); ok && len(m) == 1 {
+		if x, ok := m[branch]; ok {
+			return x
+		}
+	}
+	return n
+}
+`
+
+const decimalSource = `
+// decimalBytes returns the bytes of the unscaled r, or r if it does
+// not fit the decimal, for the client to fail encoding it
+func decimalBytes(r *big.Rat, precision, scale int) interface{} {
+	if r == nil {
+		return r
+	}
+	if b, ok := eventino.ToDecimalBytes(r, precision, scale); ok {
+		return b
+	}
+	return r
+}
+`
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/cheng81/eventino/internal/eventino/schema/schemaavro"
+)
+
+const spec = `{
+	"records": {
+		"address": {"Complex": {"type": {"RECORD_FIELDS": {"name": "address", "fields": {
+			"street": {"type": {"Simple": "STRING"}, "doc": {"string": "the street"}, "default": null, "optional": false, "aliases": []},
+			"country": {"type": {"Simple": "STRING"}, "doc": null, "default": {"string": "\"DK\""}, "optional": false, "aliases": []}
+		}}}}}
+	},
+	"enums": {"color": {"Enum": {"name": "color", "values": ["RED", "GREEN"]}}},
+	"entities": {
+		"user": {
+			"events": {
+				"created": {"Complex": {"type": {"RECORD": {"name": "created", "fields": {
+					"Name": {"Simple": "STRING"},
+					"Home": {"Ref": {"typename": "address_0"}},
+					"Tags": {"Complex": {"type": {"ARRAY": {"items": {"Simple": "STRING"}}}}},
+					"Nick": {"Complex": {"type": {"OPTIONAL": {"type": {"Simple": "STRING"}}}}},
+					"Extra": {"Complex": {"type": {"UNION": {"types": [{"Simple": "LONG"}, {"Simple": "STRING"}]}}}},
+					"At": {"Simple": "TIMESTAMP_MILLIS"},
+					"Balance": {"Decimal": {"precision": 10, "scale": 2}}
+				}}}}},
+				"painted": {"Ref": {"typename": "color_0"}}
+			}
+		}
+	}
+}`
+
+func TestGenerate(t *testing.T) {
+	parsed, err := schema.ParseSchemaSpec([]byte(spec))
+	if err != nil {
+		t.Fatal("cannot parse spec", err)
+	}
+	f := schemaavro.Factory()
+	scm, err := parsed.ToSchema(f.Decoder())
+	if err != nil {
+		t.Fatal("cannot build schema", err)
+	}
+	src, err := newGenerator("events", 3).Generate(f.EncodeNetwork(&scm))
+	if err != nil {
+		t.Fatal("cannot generate", err)
+	}
+	if _, err = parser.ParseFile(token.NewFileSet(), "events.go", src, 0); err != nil {
+		t.Fatal("invalid source", err, string(src))
+	}
+	for _, expected := range []string{
+		"// Generated from the schema version 3",
+		"package events",
+		"const SchemaVSN = 3",
+		"func (c Client) NegotiateSchema() (client.Negotiated, error)",
+		`"math/big"`,
+		"func (c Client) PutUserCreatedV0(id []byte, expected eventino.ExpectedVSN, evt UserCreatedV0) (uint64, eventino.EventID, error)",
+		"func (c Client) GetUser(id []byte, vsn uint64, minPos eventino.EventID) (out User, err error)",
+		"type UserPaintedV0 Color",
+		"ColorGREEN Color = \"GREEN\"",
+		"Balance *big.Rat",
+		"At      time.Time",
+		"Extra   interface{}",
+		"Home    Address",
+		"Nick    *string",
+		"Tags    []string",
+		"// the street\n\tStreet string",
+		"Country *string",
+		`n["country"] = toNativePointerToString(v.Country)`,
+		`return map[string]interface{}{"string": toNativeString(*v)}`,
+		`case int64:`,
+		"return eventino.FromTimestampMillis(x), nil",
+		"return decimalBytes(v, 10, 2)",
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Fatal("missing", expected, string(src))
+		}
+	}
+}
+
+func TestGenerateNames(t *testing.T) {
+	for name, expected := range map[string]string{
+		"created":      "Created",
+		"expected_vsn": "ExpectedVsn",
+		"_":            "X",
+	} {
+		if goName(name) != expected {
+			t.Fatal("wrong name", name, goName(name))
+		}
+	}
+	g := newGenerator("events", 0)
+	if g.name("Client") != "Client2" || g.name("User") != "User" || g.name("User") != "User2" {
+		t.Fatal("names should not clash")
+	}
+}
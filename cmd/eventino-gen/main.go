@@ -0,0 +1,91 @@
+// eventino-gen generates the typed Go structs of the event types of
+// the latest schema of a server, or of a schema spec file, with their
+// avro native conversions and a typed wrapper of client.Client:
+//
+//	eventino-gen [-addr localhost] [-port 7890] [-schema schema.json] [-pkg events] [-o events.go]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/cheng81/eventino/internal/eventino/schema/schemaavro"
+	"github.com/cheng81/eventino/pkg/eventino/client"
+	"github.com/cheng81/eventino/pkg/eventino/common"
+)
+
+func main() {
+	var defPort int
+	fmt.Sscanf(common.Getenv("EVENTINO_PORT", "7890"), "%d", &defPort)
+
+	addr := flag.String("addr", common.Getenv("EVENTINO_ADDR", "localhost"), "the server address")
+	port := flag.Int("port", defPort, "the server port")
+	specPath := flag.String("schema", "", "the schema spec file, instead of the server schema")
+	pkg := flag.String("pkg", "events", "the package of the generated code")
+	out := flag.String("o", "events.go", "the generated file")
+	flag.Parse()
+
+	var (
+		vsn     uint64
+		network []byte
+		err     error
+	)
+	if *specPath != "" {
+		network, err = specNetwork(*specPath)
+	} else {
+		vsn, network, err = serverNetwork(*addr, *port)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR>", err)
+		os.Exit(1)
+	}
+	src, err := newGenerator(*pkg, vsn).Generate(network)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR>", err)
+		os.Exit(1)
+	}
+	if err = ioutil.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR>", err)
+		os.Exit(1)
+	}
+}
+
+// serverNetwork loads the latest schema of the server
+func serverNetwork(addr string, port int) (vsn uint64, network []byte, err error) {
+	c := client.NewClient()
+	if err = c.Start(addr, port); err != nil {
+		return
+	}
+	defer c.Stop()
+	if vsn, err = c.Eventino().SchemaVSN(); err != nil {
+		return
+	}
+	vsn, network, err = c.Eventino().LoadSchema(vsn)
+	return
+}
+
+// specNetwork encodes the schema declared by the spec file
+func specNetwork(path string) (network []byte, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	var spec schema.SchemaSpec
+	if spec, err = schema.ParseSchemaSpec(b); err != nil {
+		return
+	}
+	f := schemaavro.Factory()
+	var scm schema.Schema
+	if scm, err = spec.ToSchema(f.Decoder()); err != nil {
+		return
+	}
+	network = f.EncodeNetwork(&scm)
+	if !json.Valid(network) {
+		err = fmt.Errorf("invalid network schema")
+	}
+	return
+}
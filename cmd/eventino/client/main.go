@@ -1,14 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/linkedin/goavro"
 
 	"github.com/robertkrimen/otto"
 	"github.com/robertkrimen/otto/repl"
 
+	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	evtino "github.com/cheng81/eventino/pkg/eventino"
 	"github.com/cheng81/eventino/pkg/eventino/client"
 	"github.com/cheng81/eventino/pkg/eventino/common"
 )
@@ -23,6 +32,15 @@ func main() {
 	client := client.NewClient()
 	eventino := client.Eventino()
 
+	// eventino-client apply [-dry-run] schema.json
+	if len(os.Args) > 1 && os.Args[1] == "apply" {
+		os.Exit(applyCmd(client, os.Args[2:]))
+	}
+	// eventino-client export [-vsn 0] [-dir .]
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(exportCmd(client, os.Args[2:]))
+	}
+
 	// err := client.Start()
 	// if err != nil {
 	// 	panic(err)
@@ -56,39 +74,81 @@ func main() {
 		}
 		entName, _ := call.ArgumentList[0].Export()
 		id, _ := call.ArgumentList[1].Export()
-		err := eventino.NewEntity(entName.(string), []byte(id.(string)))
+		pos, err := eventino.NewEntity(entName.(string), []byte(id.(string)))
 		if err != nil {
 			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
 		}
-		return otto.UndefinedValue()
+		out, _ := vm.ToValue(jsPosition(pos))
+		return out
 	})
 	vm.Set("storeEvent", func(call otto.FunctionCall) otto.Value {
-		if len(call.ArgumentList) != 4 {
-			fmt.Println("storeEvent expects 4 argument")
+		if len(call.ArgumentList) != 4 && len(call.ArgumentList) != 5 {
+			fmt.Println("storeEvent expects 4 or 5 argument")
 			return otto.UndefinedValue()
 		}
 		entName, _ := call.ArgumentList[0].Export()
 		id, _ := call.ArgumentList[1].Export()
 		evtName, _ := call.ArgumentList[2].Export()
 		evt, _ := call.ArgumentList[3].Export()
-		vsn, err := eventino.Put(entName.(string), []byte(id.(string)), evtName.(string), evt)
+		expected := evtino.AnyVSN
+		if len(call.ArgumentList) == 5 {
+			e, _ := call.ArgumentList[4].ToInteger()
+			expected = evtino.ExpectedVSN(e)
+		}
+		vsn, pos, err := eventino.Put(entName.(string), []byte(id.(string)), expected, evtName.(string), evt)
 		if err != nil {
 			fmt.Println("ERROR>", err.Error())
 			return otto.UndefinedValue()
 		}
+		fmt.Println("position:", jsPosition(pos))
 		out, _ := otto.ToValue(vsn)
 		return out
 	})
+	vm.Set("storeEvents", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 3 && len(call.ArgumentList) != 4 {
+			fmt.Println("storeEvents expects 3 or 4 argument")
+			return otto.UndefinedValue()
+		}
+		entName, _ := call.ArgumentList[0].Export()
+		id, _ := call.ArgumentList[1].Export()
+		pairs, _ := call.ArgumentList[2].Export()
+		expected := evtino.AnyVSN
+		if len(call.ArgumentList) == 4 {
+			e, _ := call.ArgumentList[3].ToInteger()
+			expected = evtino.ExpectedVSN(e)
+		}
+		var evts []entity.EntityEvent
+		for _, pair := range pairs.([]interface{}) {
+			p := pair.([]interface{})
+			evts = append(evts, entity.EntityEvent{
+				Type:    entity.EventNameIDFromString(p[0].(string)),
+				Payload: p[1],
+			})
+		}
+		vsns, pos, err := eventino.PutMany(entName.(string), []byte(id.(string)), expected, evts)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		fmt.Println("position:", jsPosition(pos))
+		out, _ := vm.ToValue(vsns)
+		return out
+	})
 	vm.Set("getEntity", func(call otto.FunctionCall) otto.Value {
-		if len(call.ArgumentList) != 3 {
-			fmt.Println("getEntity expects 3 argument")
+		if len(call.ArgumentList) < 3 || len(call.ArgumentList) > 5 {
+			fmt.Println("getEntity expects 3 to 5 arguments")
 			return otto.UndefinedValue()
 		}
 		entName, _ := call.ArgumentList[0].Export()
 		id, _ := call.ArgumentList[1].Export()
 		vsn, _ := call.ArgumentList[2].Export()
+		// min position: [ts, index, partition], as returned by the writes
+		minPos := jsEventID(call.Argument(3))
+		// versions: true for the latest ones, or {"<event>": vsn}
+		versions := jsVersions(call.Argument(4))
 
-		ent, err := eventino.GetEntity(entName.(string), []byte(id.(string)), uint64(vsn.(int64)))
+		ent, err := eventino.GetEntityAt(entName.(string), []byte(id.(string)), uint64(vsn.(int64)), minPos, versions)
 		if err != nil {
 			fmt.Println("ERROR>", err.Error())
 			return otto.UndefinedValue()
@@ -115,6 +175,249 @@ func main() {
 		out := obj.Value()
 		return out
 	})
+	vm.Set("registerUpcaster", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 4 {
+			fmt.Println("registerUpcaster expects 4 arguments: entity type, event type, version and upcaster")
+			return otto.UndefinedValue()
+		}
+		entName, _ := call.ArgumentList[0].Export()
+		evtName, _ := call.ArgumentList[1].Export()
+		vsn, _ := call.ArgumentList[2].Export()
+		// the upcaster can be given as a function, or as its source
+		up := call.ArgumentList[3]
+		src := up.String()
+		if up.IsFunction() {
+			src = "(" + src + ")"
+		} else if !up.IsString() {
+			fmt.Println("registerUpcaster expects a function or a source string")
+			return otto.UndefinedValue()
+		}
+		if err := eventino.RegisterScriptUpcaster(entName.(string), evtName.(string), uint64(vsn.(int64)), src); err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.FalseValue()
+		}
+		return otto.TrueValue()
+	})
+	vm.Set("registerView", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 3 {
+			fmt.Println("registerView expects 3 argument")
+			return otto.UndefinedValue()
+		}
+		entName, _ := call.ArgumentList[0].Export()
+		name, _ := call.ArgumentList[1].Export()
+		// the view can be given as a function, or as its source
+		view := call.ArgumentList[2]
+		src := view.String()
+		if view.IsFunction() {
+			src = "(" + src + ")"
+		} else if !view.IsString() {
+			fmt.Println("registerView expects a function or a source string")
+			return otto.UndefinedValue()
+		}
+		if err := eventino.RegisterScriptView(entName.(string), name.(string), src); err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.FalseValue()
+		}
+		return otto.TrueValue()
+	})
+	vm.Set("getView", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 3 && len(call.ArgumentList) != 4 {
+			fmt.Println("getView expects 3 or 4 argument")
+			return otto.UndefinedValue()
+		}
+		entName, _ := call.ArgumentList[0].Export()
+		id, _ := call.ArgumentList[1].Export()
+		name, _ := call.ArgumentList[2].Export()
+		minPos := jsEventID(call.Argument(3))
+		vsn, state, err := eventino.GetView(entName.(string), []byte(id.(string)), name.(string), minPos)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		obj, _ := vm.Object("({})")
+		obj.Set("vsn", int64(vsn))
+		obj.Set("state", state)
+		return obj.Value()
+	})
+	// subscriptions print their events in the background
+	subs := map[int64]evtino.Subscription{}
+	var lastSub int64
+	printSub := func(sub evtino.Subscription) int64 {
+		lastSub++
+		subID := lastSub
+		subs[subID] = sub
+		go func() {
+			for evt := range sub.Events() {
+				b, _ := json.Marshal(evt.Event.Payload)
+				fmt.Printf("\nSUB %d> %s %s vsn %d %s %s (after: [%d, %d])\n", subID, evt.EntityType, evt.ID, evt.VSN,
+					evt.Event.Type.ToString(), b, evt.Position.Timestamp, evt.Position.Index)
+			}
+		}()
+		return subID
+	}
+	vm.Set("subscribeEntity", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 3 {
+			fmt.Println("subscribeEntity expects 3 argument")
+			return otto.UndefinedValue()
+		}
+		entName, _ := call.ArgumentList[0].Export()
+		id, _ := call.ArgumentList[1].Export()
+		vsn, _ := call.ArgumentList[2].ToInteger()
+		sub, err := eventino.SubscribeEntity(entName.(string), []byte(id.(string)), uint64(vsn))
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(printSub(sub))
+		return out
+	})
+	vm.Set("subscribeType", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 && len(call.ArgumentList) != 2 {
+			fmt.Println("subscribeType expects 1 or 2 argument")
+			return otto.UndefinedValue()
+		}
+		entName, _ := call.ArgumentList[0].Export()
+		// filter: {event, vsn, since, until (unix ms), predicate, after: [ts, index]}
+		var filter evtino.SubscriptionFilter
+		var after evtino.EventID
+		if len(call.ArgumentList) == 2 {
+			filter, after = jsFilter(call.ArgumentList[1].Object())
+		}
+		sub, err := eventino.SubscribeType(entName.(string), filter, after)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(printSub(sub))
+		return out
+	})
+	vm.Set("unsubscribe", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 {
+			fmt.Println("unsubscribe expects 1 argument")
+			return otto.UndefinedValue()
+		}
+		subID, _ := call.ArgumentList[0].ToInteger()
+		sub, ok := subs[subID]
+		if !ok {
+			fmt.Println("ERROR> subscription not found")
+			return otto.FalseValue()
+		}
+		delete(subs, subID)
+		if err := sub.Close(); err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.FalseValue()
+		}
+		return otto.TrueValue()
+	})
+	vm.Set("createConsumer", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 2 && len(call.ArgumentList) != 3 {
+			fmt.Println("createConsumer expects 2 or 3 argument")
+			return otto.UndefinedValue()
+		}
+		name, _ := call.ArgumentList[0].Export()
+		entName, _ := call.ArgumentList[1].Export()
+		// same filter as subscribeType, without after
+		var filter evtino.SubscriptionFilter
+		if len(call.ArgumentList) == 3 {
+			filter, _ = jsFilter(call.ArgumentList[2].Object())
+		}
+		if err := eventino.CreateConsumer(name.(string), entName.(string), filter); err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.FalseValue()
+		}
+		return otto.TrueValue()
+	})
+	vm.Set("listConsumers", func(call otto.FunctionCall) otto.Value {
+		consumers, err := eventino.ListConsumers()
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		for _, c := range consumers {
+			fmt.Printf("%s> %s %+v (offset: [%d, %d])\n", c.Name, c.EntityType, c.Filter, c.Offset.Timestamp, c.Offset.Index)
+		}
+		out, _ := otto.ToValue(len(consumers))
+		return out
+	})
+	vm.Set("resetConsumer", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 && len(call.ArgumentList) != 2 {
+			fmt.Println("resetConsumer expects 1 or 2 argument")
+			return otto.UndefinedValue()
+		}
+		name, _ := call.ArgumentList[0].Export()
+		// offset: [ts, index], the whole log if missing
+		var offset evtino.EventID
+		if len(call.ArgumentList) == 2 {
+			offset = jsEventID(call.ArgumentList[1])
+		}
+		if err := eventino.ResetConsumer(name.(string), offset); err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.FalseValue()
+		}
+		return otto.TrueValue()
+	})
+	vm.Set("deleteConsumer", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 {
+			fmt.Println("deleteConsumer expects 1 argument")
+			return otto.UndefinedValue()
+		}
+		name, _ := call.ArgumentList[0].Export()
+		if err := eventino.DeleteConsumer(name.(string)); err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.FalseValue()
+		}
+		return otto.TrueValue()
+	})
+	vm.Set("consume", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 {
+			fmt.Println("consume expects 1 argument")
+			return otto.UndefinedValue()
+		}
+		name, _ := call.ArgumentList[0].Export()
+		sub, err := eventino.Consume(name.(string))
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(printSub(sub))
+		return out
+	})
+	vm.Set("ack", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 2 {
+			fmt.Println("ack expects 2 argument")
+			return otto.UndefinedValue()
+		}
+		subID, _ := call.ArgumentList[0].ToInteger()
+		sub, ok := subs[subID].(evtino.ConsumerSubscription)
+		if !ok {
+			fmt.Println("ERROR> consumer subscription not found")
+			return otto.FalseValue()
+		}
+		if err := sub.Ack(jsEventID(call.ArgumentList[1])); err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.FalseValue()
+		}
+		return otto.TrueValue()
+	})
+	vm.Set("commit", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 {
+			fmt.Println("commit expects 1 argument")
+			return otto.UndefinedValue()
+		}
+		subID, _ := call.ArgumentList[0].ToInteger()
+		sub, ok := subs[subID].(evtino.ConsumerSubscription)
+		if !ok {
+			fmt.Println("ERROR> consumer subscription not found")
+			return otto.UndefinedValue()
+		}
+		offset, err := sub.Commit()
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := vm.ToValue([]int64{int64(offset.Timestamp), int64(offset.Index)})
+		return out
+	})
 	vm.Set("createEntityType", func(call otto.FunctionCall) otto.Value {
 		if len(call.ArgumentList) != 1 {
 			fmt.Println("createEntityType expects 1 argument")
@@ -145,6 +448,143 @@ func main() {
 		out, _ := otto.ToValue(vsn)
 		return out
 	})
+	vm.Set("updateEventType", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 3 {
+			fmt.Println("updateEventType expects 3 arguments")
+			return otto.UndefinedValue()
+		}
+		entName, _ := call.ArgumentList[0].Export()
+		evtName, _ := call.ArgumentList[1].Export()
+		specs, _ := call.ArgumentList[2].Export()
+		_, evtVsn, err := eventino.UpdateEventType(entName.(string), evtName.(string), specs)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(evtVsn)
+		return out
+	})
+	vm.Set("setCompatibility", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 3 {
+			fmt.Println("setCompatibility expects 3 arguments: entity type, event type (or \"\") and NONE|BACKWARD|FORWARD|FULL")
+			return otto.UndefinedValue()
+		}
+		entName, _ := call.ArgumentList[0].Export()
+		evtName, _ := call.ArgumentList[1].Export()
+		compatName, _ := call.ArgumentList[2].Export()
+		compat, err := schema.ParseCompatibility(compatName.(string))
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		vsn, err := eventino.SetCompatibility(entName.(string), evtName.(string), compat)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(vsn)
+		return out
+	})
+	vm.Set("createType", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 2 {
+			fmt.Println("createType expects 2 arguments")
+			return otto.UndefinedValue()
+		}
+		name, _ := call.ArgumentList[0].Export()
+		specs, _ := call.ArgumentList[1].Export()
+		vsn, err := eventino.CreateType(name.(string), specs)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(vsn)
+		return out
+	})
+	vm.Set("updateType", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 2 {
+			fmt.Println("updateType expects 2 arguments")
+			return otto.UndefinedValue()
+		}
+		name, _ := call.ArgumentList[0].Export()
+		specs, _ := call.ArgumentList[1].Export()
+		_, vsn, err := eventino.UpdateType(name.(string), specs)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(vsn)
+		return out
+	})
+	vm.Set("deleteType", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 {
+			fmt.Println("deleteType expects 1 argument")
+			return otto.UndefinedValue()
+		}
+		name, _ := call.ArgumentList[0].Export()
+		vsn, err := eventino.DeleteType(name.(string))
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(vsn)
+		return out
+	})
+	vm.Set("applySchema", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 && len(call.ArgumentList) != 2 {
+			fmt.Println("applySchema expects 1 or 2 arguments")
+			return otto.UndefinedValue()
+		}
+		path, _ := call.ArgumentList[0].Export()
+		dryRun, _ := call.Argument(1).ToBoolean()
+		vsn, err := applySchema(eventino, path.(string), dryRun)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(vsn)
+		return out
+	})
+	vm.Set("schemaHistory", func(call otto.FunctionCall) otto.Value {
+		from, to := jsSchemaRange(call)
+		changes, err := eventino.SchemaHistory(from, to)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		return otto.UndefinedValue()
+	})
+	vm.Set("diffSchema", func(call otto.FunctionCall) otto.Value {
+		from, to := jsSchemaRange(call)
+		diff, err := eventino.DiffSchema(from, to)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		fmt.Println(diff)
+		return otto.UndefinedValue()
+	})
+	vm.Set("exportSchema", func(call otto.FunctionCall) otto.Value {
+		if len(call.ArgumentList) != 1 && len(call.ArgumentList) != 2 {
+			fmt.Println("exportSchema expects 1 or 2 arguments")
+			return otto.UndefinedValue()
+		}
+		dir, _ := call.ArgumentList[0].Export()
+		var vsn uint64
+		if v := call.Argument(1); v.IsNumber() {
+			n, _ := v.ToInteger()
+			vsn = uint64(n)
+		}
+		vsn, err := exportSchema(eventino, dir.(string), vsn)
+		if err != nil {
+			fmt.Println("ERROR>", err.Error())
+			return otto.UndefinedValue()
+		}
+		out, _ := otto.ToValue(vsn)
+		return out
+	})
 	vm.Set("loadSchema", func(call otto.FunctionCall) otto.Value {
 		if len(call.ArgumentList) != 1 {
 			fmt.Println("createEventType expects 1 argument")
@@ -205,3 +645,168 @@ func main() {
 
 	repl.RunWithOptions(vm, repl.Options{Prompt: "eventino> ", Autocomplete: true})
 }
+
+// applyCmd connects to EVENTINO_ADDR:EVENTINO_PORT and applies
+// a schema spec file, exiting with 1 if it cannot be applied
+func applyCmd(c client.Client, args []string) int {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only print the planned changes")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: apply [-dry-run] schema.json")
+		return 2
+	}
+	if err := c.Start(def_addr, def_port); err != nil {
+		fmt.Fprintln(os.Stderr, "CONNECT FAILED", err)
+		return 1
+	}
+	defer c.Stop()
+	if _, err := applySchema(c.Eventino(), flags.Arg(0), *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR>", err)
+		return 1
+	}
+	return 0
+}
+
+// applySchema applies the schema spec file, printing the plan
+func applySchema(e evtino.Eventino, path string, dryRun bool) (uint64, error) {
+	spec, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	vsn, plan, err := e.ApplySchema(spec, dryRun)
+	if err != nil {
+		return 0, err
+	}
+	for _, change := range plan {
+		fmt.Println(change)
+	}
+	if len(plan) == 0 {
+		fmt.Println("no changes")
+	}
+	fmt.Println("schema version:", vsn)
+	return vsn, nil
+}
+
+func exportCmd(c client.Client, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	vsn := flags.Uint64("vsn", 0, "the schema version, the latest if 0")
+	dir := flags.String("dir", ".", "the directory of the .avsc files")
+	flags.Parse(args)
+	if err := c.Start(def_addr, def_port); err != nil {
+		fmt.Fprintln(os.Stderr, "CONNECT FAILED", err)
+		return 1
+	}
+	defer c.Stop()
+	if _, err := exportSchema(c.Eventino(), *dir, *vsn); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR>", err)
+		return 1
+	}
+	return 0
+}
+
+// exportSchema writes the avro schemas of the protocol at the schema
+// version (the latest if 0) in dir, with their fingerprints in
+// fingerprints.txt, as hexadecimal 64 bits values
+func exportSchema(e evtino.Eventino, dir string, vsn uint64) (uint64, error) {
+	var err error
+	if vsn == 0 {
+		if vsn, err = e.SchemaVSN(); err != nil {
+			return 0, err
+		}
+	}
+	vsn, files, err := e.ExportSchema(vsn)
+	if err != nil {
+		return 0, err
+	}
+	var fingerprints bytes.Buffer
+	for _, f := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, f.Name), f.Schema, 0644); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(&fingerprints, "%016x  %s\n", f.Fingerprint, f.Name)
+	}
+	fmt.Print(fingerprints.String())
+	fmt.Println("schema version:", vsn)
+	return vsn, ioutil.WriteFile(filepath.Join(dir, "fingerprints.txt"), fingerprints.Bytes(), 0644)
+}
+
+// jsSchemaRange reads the (from, to) schema versions, to being the latest if missing
+func jsSchemaRange(call otto.FunctionCall) (from, to uint64) {
+	if v := call.Argument(0); v.IsNumber() {
+		n, _ := v.ToInteger()
+		from = uint64(n)
+	}
+	if v := call.Argument(1); v.IsNumber() {
+		n, _ := v.ToInteger()
+		to = uint64(n)
+	}
+	return
+}
+
+// jsFilter reads a subscription filter:
+// {event, vsn, since, until (unix ms), predicate, after: [ts, index]}
+func jsFilter(f *otto.Object) (filter evtino.SubscriptionFilter, after evtino.EventID) {
+	if v, _ := f.Get("event"); v.IsString() {
+		filter.EventName = v.String()
+	}
+	if v, _ := f.Get("vsn"); v.IsNumber() {
+		vsn, _ := v.ToInteger()
+		filter.MatchVSN, filter.EventVSN = true, uint64(vsn)
+	}
+	if v, _ := f.Get("since"); v.IsNumber() {
+		ms, _ := v.ToInteger()
+		filter.Since = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	if v, _ := f.Get("until"); v.IsNumber() {
+		ms, _ := v.ToInteger()
+		filter.Until = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	if v, _ := f.Get("predicate"); v.IsFunction() {
+		filter.Predicate = "(" + v.String() + ")"
+	} else if v.IsString() {
+		filter.Predicate = v.String()
+	}
+	if v, _ := f.Get("after"); v.IsObject() {
+		after = jsEventID(v)
+	}
+	return
+}
+
+// jsEventID reads a log position as [ts, index] or [ts, index, partition]
+func jsEventID(v otto.Value) evtino.EventID {
+	if !v.IsObject() {
+		return evtino.EventID{}
+	}
+	ts, _ := v.Object().Get("0")
+	idx, _ := v.Object().Get("1")
+	pfx, _ := v.Object().Get("2")
+	t, _ := ts.ToInteger()
+	i, _ := idx.ToInteger()
+	p, _ := pfx.ToInteger()
+	return evtino.EventID{Prefix: uint8(p), Timestamp: uint64(t), Index: uint16(i)}
+}
+
+// jsPosition is the [ts, index, partition] form of a log position
+func jsPosition(pos evtino.EventID) []int64 {
+	return []int64{int64(pos.Timestamp), int64(pos.Index), int64(pos.Prefix)}
+}
+
+// jsVersions reads the versions to present the events at:
+// true for the latest ones, or {"<event>": vsn}
+func jsVersions(v otto.Value) evtino.Versions {
+	if v.IsBoolean() {
+		latest, _ := v.ToBoolean()
+		return evtino.Versions{Latest: latest}
+	}
+	if !v.IsObject() {
+		return evtino.Versions{}
+	}
+	out := evtino.Versions{ByEvent: map[string]uint64{}}
+	for _, name := range v.Object().Keys() {
+		vsn, _ := v.Object().Get(name)
+		i, _ := vsn.ToInteger()
+		out.ByEvent[name] = uint64(i)
+	}
+	return out
+}
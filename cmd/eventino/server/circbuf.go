@@ -0,0 +1,11 @@
+package server
+
+import "github.com/cheng81/eventino/pkg/eventino/common"
+
+// circbuf frames the messages read from a connection, see common.Circbuf
+type circbuf = common.Circbuf
+
+// NewCircbuf returns a circbuf with the given initial capacity
+func NewCircbuf(size int, cb func(*circbuf) error) *circbuf {
+	return common.NewCircbuf(size, cb)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
 
 	"github.com/cheng81/eventino/cmd/eventino/server"
@@ -25,7 +26,22 @@ func main() {
 	var port int
 	fmt.Sscanf(common.Getenv("EVENTINO_PORT", "7890"), "%d", &port)
 
-	srv, err := server.NewServer(port, opts)
+	var srv server.Server
+	var err error
+	if common.Envset("EVENTINO_LEADER") {
+		// follower mode, e.g. EVENTINO_LEADER=leader-host:7890
+		var leaderAddr string
+		var leaderPort int
+		leader := common.Getenv("EVENTINO_LEADER", "")
+		if leaderAddr, leaderPort, err = splitAddr(leader); err != nil {
+			fmt.Println("invalid EVENTINO_LEADER", leader, err)
+			panic(err)
+		}
+		fmt.Printf("Eventino following %s:%d\n", leaderAddr, leaderPort)
+		srv, err = server.NewFollowerServer(port, opts, leaderAddr, leaderPort)
+	} else {
+		srv, err = server.NewServer(port, opts)
+	}
 	if err != nil {
 		fmt.Println("cannot start eventino server", err)
 		panic(err)
@@ -43,3 +59,12 @@ func main() {
 func getdir() string {
 	return common.Getenv("EVENTINO_DATADIR", "/tmp/eventino")
 }
+
+func splitAddr(hostport string) (host string, port int, err error) {
+	var p string
+	if host, p, err = net.SplitHostPort(hostport); err != nil {
+		return
+	}
+	_, err = fmt.Sscanf(p, "%d", &port)
+	return
+}
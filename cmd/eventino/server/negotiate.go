@@ -0,0 +1,192 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/cheng81/eventino/pkg/eventino"
+	"github.com/cheng81/eventino/pkg/eventino/common"
+	"github.com/cheng81/eventino/pkg/eventino/common/command"
+	"github.com/linkedin/goavro"
+)
+
+// fingerprints caches the fingerprint of the exported protocol
+// schema of each schema version (see eventino.ExportSchema),
+// to find the version a client states the fingerprint of.
+// The schemas are exported outside of the lock
+type fingerprints struct {
+	mu    sync.Mutex
+	byVsn map[uint64]uint64
+	// the latest version of each fingerprint,
+	// indexed from version 0 up to (not including) indexed
+	byFp    map[uint64]uint64
+	indexed uint64
+}
+
+func newFingerprints() *fingerprints {
+	return &fingerprints{byVsn: map[uint64]uint64{}, byFp: map[uint64]uint64{}}
+}
+
+// of returns the fingerprint of the schema version
+func (f *fingerprints) of(svc eventino.Eventino, vsn uint64) (uint64, error) {
+	f.mu.Lock()
+	fp, ok := f.byVsn[vsn]
+	f.mu.Unlock()
+	if ok {
+		return fp, nil
+	}
+	_, files, err := svc.ExportSchema(vsn)
+	if err != nil {
+		return 0, err
+	}
+	fp = files[len(files)-1].Fingerprint
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.byVsn[vsn] = fp
+	if found, ok := f.byFp[fp]; !ok || vsn > found {
+		f.byFp[fp] = vsn
+	}
+	return fp, nil
+}
+
+// find returns the latest schema version of the fingerprint,
+// indexing the versions created since the last find
+func (f *fingerprints) find(svc eventino.Eventino, fp uint64) (uint64, error) {
+	latest, err := svc.SchemaVSN()
+	if err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	from := f.indexed
+	f.mu.Unlock()
+	for vsn := from; vsn <= latest; vsn++ {
+		if _, err = f.of(svc, vsn); err != nil {
+			return 0, err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if latest+1 > f.indexed {
+		f.indexed = latest + 1
+	}
+	if vsn, ok := f.byFp[fp]; ok {
+		return vsn, nil
+	}
+	return 0, errors.New("unknown-schema-fingerprint")
+}
+
+// negotiate switches the session to the schema version the client
+// states, by version or fingerprint, and replies with the new codec
+func (s *session) negotiate(c *command.Negotiate) (rsp []byte, err error) {
+	vsn := c.VSN
+	if c.Fingerprint != 0 {
+		if vsn, err = s.fingerprints.find(s.svc, c.Fingerprint); err != nil {
+			return wrapErr(err)
+		}
+	}
+	reply := &command.NegotiateReply{}
+	if reply.LatestVSN, err = s.svc.SchemaVSN(); err != nil {
+		return wrapErr(err)
+	}
+	if reply.VSN, reply.Encoded, err = s.svc.LoadSchema(vsn); err != nil {
+		return wrapErr(err)
+	}
+	if reply.Fingerprint, err = s.fingerprints.of(s.svc, reply.VSN); err != nil {
+		return wrapErr(err)
+	}
+	return nil, s.useSchema(reply.Encoded, reply.Encode())
+}
+
+// useSchema switches the session to the network schema, then writes the
+// reply with its codec. No subscription event can be encoded with the
+// new codec before the client gets the reply and switches too
+func (s *session) useSchema(encoded []byte, reply map[string]interface{}) (err error) {
+	var dataSchema map[string]interface{}
+	if err = json.Unmarshal(encoded, &dataSchema); err != nil {
+		return s.writeErr(err)
+	}
+	var cdc *goavro.Codec
+	if cdc, err = common.NetCodecWithSchema(dataSchema); err != nil {
+		return s.writeErr(err)
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.codec, s.known = cdc, knownEvents(dataSchema)
+	var rsp []byte
+	if rsp, err = s.codec.BinaryFromNative(nil, reply); err != nil {
+		return
+	}
+	_, err = s.conn.Write(rsp)
+	return
+}
+
+func (s *session) writeErr(err error) error {
+	rsp, err := wrapErr(err)
+	if err != nil {
+		return err
+	}
+	return s.write(rsp)
+}
+
+// knownEvents returns the event types (e.g. created_0) of each
+// entity type of the network schema, see EncodeNetwork
+func knownEvents(dataSchema map[string]interface{}) map[string]map[string]bool {
+	known := map[string]map[string]bool{}
+	fields, _ := dataSchema["fields"].([]interface{})
+	for _, field := range fields {
+		f, _ := field.(map[string]interface{})
+		if f["name"] != "entity_event" {
+			continue
+		}
+		entities, _ := f["type"].([]interface{})
+		for _, ent := range entities {
+			record, _ := ent.(map[string]interface{})
+			name, ok := record["name"].(string)
+			if !ok {
+				continue
+			}
+			known[name] = map[string]bool{}
+			entFields, _ := record["fields"].([]interface{})
+			for _, entField := range entFields {
+				ef, _ := entField.(map[string]interface{})
+				if ef["name"] != "event" {
+					continue
+				}
+				evts, _ := ef["type"].([]interface{})
+				for _, evt := range evts {
+					if evtName, ok := evt.(map[string]interface{})["name"].(string); ok {
+						known[name][evtName] = true
+					}
+				}
+			}
+		}
+	}
+	return known
+}
+
+// knows is true if the event type is in the schema of the session,
+// or if the session has no schema yet
+func (s *session) knows(entName, evtID string) bool {
+	return s.known == nil || s.known[entName][evtID]
+}
+
+// sessionVersions presents the events at the latest versions of the
+// schema of the session, rather than the latest ones, if asked
+func (s *session) sessionVersions(entName string, versions eventino.Versions) eventino.Versions {
+	if !versions.Latest || s.known == nil {
+		return versions
+	}
+	out := eventino.Versions{ByEvent: map[string]uint64{}}
+	for evtIDenc := range s.known[entName] {
+		evtID := schema.EventSchemaIDFromString(evtIDenc)
+		if vsn, ok := out.ByEvent[evtID.Name]; !ok || evtID.VSN > vsn {
+			out.ByEvent[evtID.Name] = evtID.VSN
+		}
+	}
+	for name, vsn := range versions.ByEvent {
+		out.ByEvent[name] = vsn
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/cheng81/eventino/internal/eventino/log"
+	"github.com/cheng81/eventino/pkg/eventino"
+	"github.com/cheng81/eventino/pkg/eventino/common"
+	"github.com/cheng81/eventino/pkg/eventino/common/command"
+)
+
+// followRetry is the delay before reconnecting to the leader
+const followRetry = time.Second
+
+// follow replicates the log of the leader,
+// reconnecting whenever the connection drops
+func (s *srv) follow() {
+	for {
+		err := s.replicate()
+		if s.stopped() {
+			return
+		}
+		fmt.Println("follow.replication failed", err)
+		time.Sleep(followRetry)
+	}
+}
+
+func (s *srv) stopped() bool {
+	s.leaderMu.Lock()
+	defer s.leaderMu.Unlock()
+	return s.closed
+}
+
+// replicate streams the log of the leader after the
+// latest replicated event of each partition
+func (s *srv) replicate() (err error) {
+	var conn net.Conn
+	if conn, err = net.Dial("tcp", net.JoinHostPort(s.leaderAddr, strconv.Itoa(s.leaderPort))); err != nil {
+		return
+	}
+	defer conn.Close()
+	s.leaderMu.Lock()
+	if s.closed {
+		s.leaderMu.Unlock()
+		return
+	}
+	s.leaderConn = conn
+	s.leaderMu.Unlock()
+
+	positions, err := s.follower.Positions()
+	if err != nil {
+		return
+	}
+	cmd := &command.Replicate{Positions: make([][]byte, len(positions))}
+	for i, position := range positions {
+		cmd.Positions[i] = eventino.EncodeOffset(position)
+	}
+	var b []byte
+	if b, err = common.NetCodec.BinaryFromNative(nil, cmd.Encode()); err != nil {
+		return
+	}
+	if _, err = conn.Write(b); err != nil {
+		return
+	}
+	fmt.Println("follow.replicating from", s.leaderAddr, s.leaderPort)
+
+	buf := NewCircbuf(256*1024, s.onReplicaData)
+	if _, err = io.Copy(buf, conn); err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+// onReplicaData applies the events pushed by the leader
+func (s *srv) onReplicaData(buf *circbuf) error {
+	b, err := buf.ReadAll()
+	if err != nil {
+		return err
+	}
+	var msg interface{}
+	var rest []byte
+	if msg, rest, err = common.NetCodec.NativeFromBinary(b); err != nil {
+		if common.Incomplete(err) {
+			// wait for the rest of the message
+			return nil
+		}
+		// nothing can be read after a malformed message,
+		// replicate closes the connection and reconnects
+		return fmt.Errorf("malformed replica event: %s", err)
+	}
+	buf.Consume(len(b) - len(rest))
+	m := msg.(map[string]interface{})
+	evt := &command.ReplicaEvent{}
+	if !evt.Is(m) {
+		errorMsg := &command.ErrorResponse{}
+		errorMsg.Decode(m)
+		return fmt.Errorf("leader refused replication: %s", errorMsg.Message)
+	}
+	evt.Decode(m)
+	lEvt := log.Event{Meta: evt.Meta, Payload: evt.Payload}
+	if err = log.DecodeEventID(evt.ID, &lEvt.ID); err != nil {
+		return err
+	}
+	return s.follower.Replicate(lEvt)
+}
@@ -2,12 +2,18 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/cheng81/eventino/pkg/eventino/common/command"
 	"github.com/linkedin/goavro"
 
+	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/internal/eventino/schema"
 	"github.com/cheng81/eventino/internal/eventino/schema/schemaavro"
 	"github.com/cheng81/eventino/pkg/eventino"
 	"github.com/cheng81/eventino/pkg/eventino/common"
@@ -26,11 +32,49 @@ type srv struct {
 
 	db *badger.DB
 
+	svc eventino.Eventino
+	// the fingerprints of the schema versions, shared by the sessions
+	fingerprints *fingerprints
+
+	// follower mode: the log is replicated from the leader
+	follower   eventino.Follower
+	leaderAddr string
+	leaderPort int
+	// leaderMu guards the connection to the leader, and
+	// closed for the replication goroutine
+	leaderMu   sync.Mutex
+	leaderConn net.Conn
+}
+
+// session is the state of a client connection
+type session struct {
 	svc   eventino.Eventino
+	conn  net.Conn
 	codec *goavro.Codec
+	// known are the event types of the schema of the session, by
+	// entity type: the events of the other types are not sent
+	known        map[string]map[string]bool
+	fingerprints *fingerprints
+
+	// wmu serializes the writes on the connection: replies,
+	// subscription events and codec switches
+	wmu sync.Mutex
+
+	subs    map[int64]pushing
+	lastSub int64
+
+	// replica is the log streamed to a follower, if any
+	replica     eventino.LogStream
+	replicaDone chan struct{}
 }
 
-func (s *srv) handleCommand(cmd map[string]interface{}) (rsp []byte, err error) {
+// pushing is a subscription whose events are pushed to the client
+type pushing struct {
+	sub  eventino.Subscription
+	done chan struct{}
+}
+
+func (s *session) handleCommand(cmd map[string]interface{}) (rsp []byte, err error) {
 	if (&command.CreateEntityType{}).Is(cmd) {
 		c := new(command.CreateEntityType)
 		c.Decode(cmd)
@@ -47,6 +91,88 @@ func (s *srv) handleCommand(cmd map[string]interface{}) (rsp []byte, err error)
 			return wrapErr(err)
 		}
 		return s.codec.BinaryFromNative(nil, (&command.SchemaResponse{Operation: "createEventType", VSN: vsn}).Encode())
+	} else if (&command.UpdateEntityEventType{}).Is(cmd) {
+		c := new(command.UpdateEntityEventType)
+		c.Decode(cmd)
+		var vsn, evtVsn uint64
+		if vsn, evtVsn, err = s.svc.UpdateEventType(c.EntityType, c.EventName, c.MetaSchema); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.UpdateEventTypeReply{SchemaVSN: vsn, VSN: evtVsn}).Encode())
+	} else if (&command.SetCompatibility{}).Is(cmd) {
+		c := new(command.SetCompatibility)
+		c.Decode(cmd)
+		var compat eventino.Compatibility
+		if compat, err = schema.ParseCompatibility(c.Compatibility); err != nil {
+			return wrapErr(err)
+		}
+		var vsn uint64
+		if vsn, err = s.svc.SetCompatibility(c.EntityType, c.EventName, compat); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.SchemaResponse{Operation: "setCompatibility", VSN: vsn}).Encode())
+	} else if (&command.CreateType{}).Is(cmd) {
+		c := new(command.CreateType)
+		c.Decode(cmd)
+		var vsn uint64
+		if vsn, err = s.svc.CreateType(c.Name, c.MetaSchema); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.SchemaResponse{Operation: "createType", VSN: vsn}).Encode())
+	} else if (&command.UpdateType{}).Is(cmd) {
+		c := new(command.UpdateType)
+		c.Decode(cmd)
+		var vsn, typeVsn uint64
+		if vsn, typeVsn, err = s.svc.UpdateType(c.Name, c.MetaSchema); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.UpdateTypeReply{SchemaVSN: vsn, VSN: typeVsn}).Encode())
+	} else if (&command.DeleteType{}).Is(cmd) {
+		c := new(command.DeleteType)
+		c.Decode(cmd)
+		var vsn uint64
+		if vsn, err = s.svc.DeleteType(c.Name); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.SchemaResponse{Operation: "deleteType", VSN: vsn}).Encode())
+	} else if (&command.ApplySchema{}).Is(cmd) {
+		c := new(command.ApplySchema)
+		c.Decode(cmd)
+		var vsn uint64
+		var plan []string
+		if vsn, plan, err = s.svc.ApplySchema(c.Spec, c.DryRun); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.ApplySchemaReply{SchemaVSN: vsn, Plan: plan}).Encode())
+	} else if (&command.SchemaHistory{}).Is(cmd) {
+		c := new(command.SchemaHistory)
+		c.Decode(cmd)
+		var data interface{}
+		if c.Diff {
+			data, err = s.svc.DiffSchema(c.From, c.To)
+		} else {
+			data, err = s.svc.SchemaHistory(c.From, c.To)
+		}
+		if err != nil {
+			return wrapErr(err)
+		}
+		var encoded []byte
+		if encoded, err = json.Marshal(data); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.SchemaHistoryReply{Data: encoded}).Encode())
+	} else if (&command.ExportSchema{}).Is(cmd) {
+		c := new(command.ExportSchema)
+		c.Decode(cmd)
+		vsn, files, err := s.svc.ExportSchema(c.VSN)
+		if err != nil {
+			return wrapErr(err)
+		}
+		reply := &command.ExportSchemaReply{SchemaVSN: vsn, Files: make([]command.ExportedSchema, len(files))}
+		for i, f := range files {
+			reply.Files[i] = command.ExportedSchema{Name: f.Name, Schema: f.Schema, Fingerprint: f.Fingerprint}
+		}
+		return s.codec.BinaryFromNative(nil, reply.Encode())
 	} else if (&command.LoadSchema{}).Is(cmd) {
 		c := new(command.LoadSchema)
 		c.Decode(cmd)
@@ -56,41 +182,45 @@ func (s *srv) handleCommand(cmd map[string]interface{}) (rsp []byte, err error)
 			return wrapErr(err)
 		}
 		// switch network codec
-		var dataSchema map[string]interface{}
-		if err = json.Unmarshal(encoded, &dataSchema); err != nil {
-			return wrapErr(err)
-		}
-		var cdc *goavro.Codec
-		if cdc, err = common.NetCodecWithSchema(dataSchema); err != nil {
-			return wrapErr(err)
-		}
-		s.codec = cdc
-		fmt.Println("loadSchema, new codec", s.codec.Schema())
-		return s.codec.BinaryFromNative(nil, (&command.LoadSchemaReply{VSN: loadedVsn, Encoded: encoded}).Encode())
+		return nil, s.useSchema(encoded, (&command.LoadSchemaReply{VSN: loadedVsn, Encoded: encoded}).Encode())
+	} else if (&command.Negotiate{}).Is(cmd) {
+		c := new(command.Negotiate)
+		c.Decode(cmd)
+		return s.negotiate(c)
 	} else if (&command.CreateEntity{}).Is(cmd) {
 		c := new(command.CreateEntity)
 		c.Decode(cmd)
-		if err = s.svc.NewEntity(c.Type, c.ID); err != nil {
+		pos, err := s.svc.NewEntity(c.Type, c.ID)
+		if err != nil {
 			return wrapErr(err)
 		}
-		return s.codec.BinaryFromNative(nil, map[string]interface{}{"boolean": true})
+		return s.codec.BinaryFromNative(nil, (&command.CreateEntityReply{Position: eventino.EncodeOffset(pos)}).Encode())
 	} else if (&command.LoadEntity{}).Is(cmd) {
 		c := new(command.LoadEntity)
 		c.Decode(cmd)
-		ent, err := s.svc.GetEntity(c.Type, c.ID, c.VSN)
+		var minPos eventino.EventID
+		if minPos, err = eventino.DecodeOffset(c.MinPos); err != nil {
+			return wrapErr(err)
+		}
+		versions := s.sessionVersions(c.Type, eventino.Versions{Latest: c.Latest, ByEvent: c.Versions})
+		ent, err := s.svc.GetEntityAt(c.Type, c.ID, c.VSN, minPos, versions)
 		if err != nil {
 			return wrapErr(err)
 		}
-		evts := make([]map[string]interface{}, len(ent.Events))
-		for i, evt := range ent.Events {
+		evts := make([]map[string]interface{}, 0, len(ent.Events))
+		for _, evt := range ent.Events {
 			evtTypeID := evt.Type.ToString()
+			if !s.knows(c.Type, evtTypeID) {
+				// written after the schema of the session
+				return wrapErr(errors.New("unknown-event-type"))
+			}
 			evtNat := map[string]interface{}{
 				evtTypeID: map[string]interface{}{
 					"ts":   evt.Timestamp.UnixNano(),
 					"data": evt.Payload,
 				},
 			}
-			evts[i] = evtNat
+			evts = append(evts, evtNat)
 		}
 		entNative := map[string]interface{}{
 			"id":         ent.ID,
@@ -101,7 +231,8 @@ func (s *srv) handleCommand(cmd map[string]interface{}) (rsp []byte, err error)
 		}
 
 		reply := map[string]interface{}{"data": map[string]interface{}{
-			"entity_event": nil,
+			"entity_event":  nil,
+			"entity_events": nil,
 			"entity_load": map[string]interface{}{
 				c.Type: entNative,
 			},
@@ -109,6 +240,158 @@ func (s *srv) handleCommand(cmd map[string]interface{}) (rsp []byte, err error)
 		//replyDbg, _ := json.Marshal(reply)
 		//fmt.Println("get.entity", string(replyDbg))
 		return s.codec.BinaryFromNative(nil, reply) //map[string]interface{}{"null": nil}
+	} else if (&command.RegisterView{}).Is(cmd) {
+		c := new(command.RegisterView)
+		c.Decode(cmd)
+		if err = s.svc.RegisterScriptView(c.Type, c.Name, c.Script); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, map[string]interface{}{"boolean": true})
+	} else if (&command.RegisterUpcaster{}).Is(cmd) {
+		c := new(command.RegisterUpcaster)
+		c.Decode(cmd)
+		if err = s.svc.RegisterScriptUpcaster(c.Type, c.Event, c.VSN, c.Script); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, map[string]interface{}{"boolean": true})
+	} else if (&command.LoadView{}).Is(cmd) {
+		c := new(command.LoadView)
+		c.Decode(cmd)
+		var minPos eventino.EventID
+		if minPos, err = eventino.DecodeOffset(c.MinPos); err != nil {
+			return wrapErr(err)
+		}
+		vsn, state, err := s.svc.GetView(c.Type, c.ID, c.Name, minPos)
+		if err != nil {
+			return wrapErr(err)
+		}
+		encoded, err := json.Marshal(state)
+		if err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.LoadViewReply{VSN: vsn, State: encoded}).Encode())
+	} else if (&command.SubscribeEntity{}).Is(cmd) {
+		c := new(command.SubscribeEntity)
+		c.Decode(cmd)
+		sub, err := s.svc.SubscribeEntity(c.Type, c.ID, c.VSN)
+		if err != nil {
+			return wrapErr(err)
+		}
+		return nil, s.subscribe(sub)
+	} else if (&command.SubscribeType{}).Is(cmd) {
+		c := new(command.SubscribeType)
+		c.Decode(cmd)
+		filter := decodeFilter(c.EventName, c.MatchVSN, c.EventVSN, c.Since, c.Until, c.Predicate)
+		var after eventino.EventID
+		if after, err = eventino.DecodeOffset(c.After); err != nil {
+			return wrapErr(err)
+		}
+		sub, err := s.svc.SubscribeType(c.Type, filter, after)
+		if err != nil {
+			return wrapErr(err)
+		}
+		return nil, s.subscribe(sub)
+	} else if (&command.Unsubscribe{}).Is(cmd) {
+		c := new(command.Unsubscribe)
+		c.Decode(cmd)
+		s.unsubscribe(c.Subscription)
+		return s.codec.BinaryFromNative(nil, map[string]interface{}{"boolean": true})
+	} else if (&command.CreateConsumer{}).Is(cmd) {
+		c := new(command.CreateConsumer)
+		c.Decode(cmd)
+		filter := decodeFilter(c.EventName, c.MatchVSN, c.EventVSN, c.Since, c.Until, c.Predicate)
+		if err = s.svc.CreateConsumer(c.Name, c.Type, filter); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, map[string]interface{}{"boolean": true})
+	} else if (&command.ResetConsumer{}).Is(cmd) {
+		c := new(command.ResetConsumer)
+		c.Decode(cmd)
+		var offset eventino.EventID
+		if offset, err = eventino.DecodeOffset(c.Offset); err != nil {
+			return wrapErr(err)
+		}
+		if err = s.svc.ResetConsumer(c.Name, offset); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, map[string]interface{}{"boolean": true})
+	} else if (&command.DeleteConsumer{}).Is(cmd) {
+		c := new(command.DeleteConsumer)
+		c.Decode(cmd)
+		if err = s.svc.DeleteConsumer(c.Name); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, map[string]interface{}{"boolean": true})
+	} else if (&command.Consume{}).Is(cmd) {
+		c := new(command.Consume)
+		c.Decode(cmd)
+		sub, err := s.svc.Consume(c.Name)
+		if err != nil {
+			return wrapErr(err)
+		}
+		return nil, s.subscribe(sub)
+	} else if (&command.Ack{}).Is(cmd) {
+		c := new(command.Ack)
+		c.Decode(cmd)
+		var sub eventino.ConsumerSubscription
+		if sub, err = s.consumerSubscription(c.Subscription); err != nil {
+			return wrapErr(err)
+		}
+		var position eventino.EventID
+		if position, err = eventino.DecodeOffset(c.Position); err != nil {
+			return wrapErr(err)
+		}
+		if err = sub.Ack(position); err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, map[string]interface{}{"boolean": true})
+	} else if (&command.Commit{}).Is(cmd) {
+		c := new(command.Commit)
+		c.Decode(cmd)
+		var sub eventino.ConsumerSubscription
+		if sub, err = s.consumerSubscription(c.Subscription); err != nil {
+			return wrapErr(err)
+		}
+		offset, err := sub.Commit()
+		if err != nil {
+			return wrapErr(err)
+		}
+		return s.codec.BinaryFromNative(nil, (&command.CommitReply{Offset: eventino.EncodeOffset(offset)}).Encode())
+	} else if (&command.Replicate{}).Is(cmd) {
+		c := new(command.Replicate)
+		c.Decode(cmd)
+		positions := make([]eventino.EventID, len(c.Positions))
+		for i, b := range c.Positions {
+			if positions[i], err = eventino.DecodeOffset(b); err != nil {
+				return wrapErr(err)
+			}
+		}
+		leader, ok := s.svc.(eventino.Leader)
+		if !ok || s.replica != nil {
+			return wrapErr(errors.New("cannot-replicate"))
+		}
+		s.replica = leader.StreamLog(positions)
+		s.replicaDone = make(chan struct{})
+		go s.stream()
+		return nil, nil
+	} else if command.IsCommand("string", cmd) && cmd["string"].(string) == "list_consumers" {
+		consumers, err := s.svc.ListConsumers()
+		if err != nil {
+			return wrapErr(err)
+		}
+		rsp := &command.ListConsumersReply{Consumers: make([]command.ConsumerInfo, len(consumers))}
+		for i, c := range consumers {
+			info := command.ConsumerInfo{Offset: eventino.EncodeOffset(c.Offset)}
+			info.Name = c.Name
+			info.Type = c.EntityType
+			info.EventName = c.Filter.EventName
+			info.MatchVSN = c.Filter.MatchVSN
+			info.EventVSN = c.Filter.EventVSN
+			info.Since, info.Until = eventino.EncodeFilterTimes(c.Filter)
+			info.Predicate = c.Filter.Predicate
+			rsp.Consumers[i] = info
+		}
+		return s.codec.BinaryFromNative(nil, rsp.Encode())
 	} else if command.IsCommand("string", cmd) && cmd["string"].(string) == "schema_vsn" {
 		// load latest schema vsn
 		v, err := s.svc.SchemaVSN()
@@ -117,6 +400,9 @@ func (s *srv) handleCommand(cmd map[string]interface{}) (rsp []byte, err error)
 		}
 		return s.codec.BinaryFromNative(nil, map[string]interface{}{"long": int64(v)})
 	} else if command.IsData(cmd) {
+		if evts, ok := cmd["data"].(map[string]interface{})["entity_events"].(map[string]interface{}); ok {
+			return s.handlePutMany(evts)
+		}
 		// put
 		// get only key in map, to get the entity
 		// get first non-nil fields in entity map
@@ -130,6 +416,7 @@ func (s *srv) handleCommand(cmd map[string]interface{}) (rsp []byte, err error)
 		}
 		var entID []byte
 		entID = entMap["id"].([]byte)
+		expected := eventino.ExpectedVSN(entMap["expected_vsn"].(int64))
 
 		evtMap := entMap["event"].(map[string]interface{})
 		var evtIDenc string
@@ -139,19 +426,51 @@ func (s *srv) handleCommand(cmd map[string]interface{}) (rsp []byte, err error)
 			evt = v.(map[string]interface{})["data"]
 			break
 		}
-		vsn, err := s.svc.Put(entName, entID, evtIDenc, evt)
+		vsn, pos, err := s.svc.Put(entName, entID, expected, evtIDenc, evt)
 		if err != nil {
 			return wrapErr(err)
 		}
-		return s.codec.BinaryFromNative(nil, map[string]interface{}{"long": int64(vsn)})
+		return s.codec.BinaryFromNative(nil, (&command.PutReply{VSN: vsn, Position: eventino.EncodeOffset(pos)}).Encode())
 	}
 	return
 }
 
+func (s *session) handlePutMany(cmd map[string]interface{}) (rsp []byte, err error) {
+	var entName string
+	var entMap map[string]interface{}
+	for k, v := range cmd {
+		entName = k
+		entMap = v.(map[string]interface{})
+		break
+	}
+	entID := entMap["id"].([]byte)
+	expected := eventino.ExpectedVSN(entMap["expected_vsn"].(int64))
+
+	evtsNative := entMap["events"].([]interface{})
+	evts := make([]entity.EntityEvent, len(evtsNative))
+	for i, evtNative := range evtsNative {
+		for k, v := range evtNative.(map[string]interface{}) {
+			evts[i] = entity.EntityEvent{
+				Type:    entity.EventNameIDFromString(k),
+				Payload: v.(map[string]interface{})["data"],
+			}
+			break
+		}
+	}
+	vsns, pos, err := s.svc.PutMany(entName, entID, expected, evts)
+	if err != nil {
+		return wrapErr(err)
+	}
+	return s.codec.BinaryFromNative(nil, (&command.PutManyReply{VSNs: vsns, Position: eventino.EncodeOffset(pos)}).Encode())
+}
+
 func (s *srv) Start() (err error) {
 	if s.lst, err = net.Listen("tcp", fmt.Sprintf(":%d", s.port)); err != nil {
 		return
 	}
+	if s.follower != nil {
+		go s.follow()
+	}
 	s.accept()
 	return
 }
@@ -175,37 +494,209 @@ func (s *srv) handle(conn net.Conn) {
 	fmt.Println("handle conn")
 	defer conn.Close()
 
-	buf := make([]byte, 256*1024)
-	for {
-		var err error
-		var wrote int
-		fmt.Println("handle.wait conn read")
-		if wrote, err = conn.Read(buf); err != nil {
-			fmt.Println("handle.error reading", err)
-			break
+	sess := &session{svc: s.svc, conn: conn, codec: common.NetCodec, fingerprints: s.fingerprints, subs: map[int64]pushing{}}
+	defer sess.close()
+	buf := NewCircbuf(256*1024, sess.onData)
+	if _, err := io.Copy(buf, conn); err != nil {
+		fmt.Println("handle.error reading", err)
+	}
+	fmt.Println("closing connection")
+}
+
+// onData handles the commands read so far
+func (s *session) onData(buf *circbuf) error {
+	b, err := buf.ReadAll()
+	if err != nil {
+		return err
+	}
+	var cmd interface{}
+	var rest, rsp []byte
+	if cmd, rest, err = s.codec.NativeFromBinary(b); err != nil {
+		if common.Incomplete(err) {
+			// wait for the rest of the command
+			return nil
 		}
-		fmt.Println("handle.read", wrote, buf[0:wrote])
-		var rsp []byte
-		var cmd interface{}
-		if cmd, _, err = s.codec.NativeFromBinary(buf[0:wrote]); err != nil {
-			fmt.Println("handle.cannot decode", err)
-			break
+		return fmt.Errorf("malformed command: %s", err)
+	}
+	buf.Consume(len(b) - len(rest))
+	if rsp, err = s.handleCommand(cmd.(map[string]interface{})); err != nil {
+		fmt.Println("handle.exec failed", err)
+		return err
+	}
+	if rsp == nil {
+		// already replied
+		return nil
+	}
+	fmt.Println("handle.write response")
+	return s.write(rsp)
+}
+
+func (s *session) write(b []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// subscribe replies with the subscription ID, then pushes the events
+func (s *session) subscribe(sub eventino.Subscription) error {
+	s.lastSub++
+	id := s.lastSub
+	rsp, err := s.codec.BinaryFromNative(nil, (&command.Subscribed{Subscription: id}).Encode())
+	if err == nil {
+		err = s.write(rsp)
+	}
+	if err != nil {
+		sub.Close()
+		return err
+	}
+	done := make(chan struct{})
+	s.subs[id] = pushing{sub: sub, done: done}
+	go s.push(id, sub, done)
+	return nil
+}
+
+// unsubscribe returns once no more events of the subscription are sent
+func (s *session) unsubscribe(id int64) {
+	if p, ok := s.subs[id]; ok {
+		p.sub.Close()
+		<-p.done
+		delete(s.subs, id)
+	}
+}
+
+func (s *session) close() {
+	for id := range s.subs {
+		s.unsubscribe(id)
+	}
+	if s.replica != nil {
+		s.replica.Close()
+		<-s.replicaDone
+	}
+}
+
+// stream pushes the log events to a follower
+func (s *session) stream() {
+	defer close(s.replicaDone)
+	for evt := range s.replica.Events() {
+		msg := (&command.ReplicaEvent{Meta: evt.Meta, ID: evt.ID.Encode(), Payload: evt.Payload}).Encode()
+		if err := s.pushEvent(msg); err != nil {
+			fmt.Println("stream.failed", err)
+			s.replica.Close()
+			return
 		}
-		if rsp, err = s.handleCommand(cmd.(map[string]interface{})); err != nil {
-			fmt.Println("handle.exec failed", err)
-			break
+	}
+	if err := s.replica.Err(); err != nil {
+		fmt.Println("stream.replication failed", err)
+	}
+}
+
+func (s *session) push(id int64, sub eventino.Subscription, done chan struct{}) {
+	defer close(done)
+	for evt := range sub.Events() {
+		msg := map[string]interface{}{"data": map[string]interface{}{
+			"entity_event": map[string]interface{}{
+				evt.EntityType: map[string]interface{}{
+					"id":           evt.ID,
+					"expected_vsn": int64(0),
+					"subscription": id,
+					"vsn":          int64(evt.VSN),
+					"ts":           evt.Event.Timestamp.UnixNano(),
+					"position":     eventino.EncodeOffset(evt.Position),
+					"event": map[string]interface{}{
+						evt.Event.Type.ToString(): map[string]interface{}{
+							"data": evt.Event.Payload,
+						},
+					},
+				},
+			},
+			"entity_events": nil,
+			"entity_load":   nil,
+		}}
+		sent, err := s.pushEntityEvent(evt.EntityType, evt.Event.Type.ToString(), msg)
+		if err == nil && !sent {
+			// not acked: a consumer gets the event again once
+			// consumed by a client with a schema having its type
+			err = s.pushEvent((&command.SubscriptionEnded{Subscription: id, Error: "unknown-event-type"}).Encode())
+			if err == nil {
+				sub.Close()
+				return
+			}
 		}
-		fmt.Println("DBG - schema", s.codec.Schema())
-		fmt.Println("handle.write response")
-		if _, err = conn.Write(rsp); err != nil {
-			break
+		if err != nil {
+			fmt.Println("push.failed", id, err)
+			sub.Close()
+			return
 		}
 	}
-	fmt.Println("closing connection")
+	if err := sub.Err(); err != nil {
+		fmt.Println("push.subscription failed", id, err)
+	}
+}
+
+// pushEvent encodes and writes a subscription event under
+// the write lock, so that it is encoded with the codec of the client
+func (s *session) pushEvent(msg map[string]interface{}) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.writeNative(msg)
+}
+
+// pushEntityEvent is pushEvent for an entity event, which is not sent
+// if its type is not in the schema of the client, see SubscriptionEnded
+func (s *session) pushEntityEvent(entName, evtID string, msg map[string]interface{}) (bool, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if !s.knows(entName, evtID) {
+		return false, nil
+	}
+	return true, s.writeNative(msg)
+}
+
+func (s *session) writeNative(msg map[string]interface{}) error {
+	b, err := s.codec.BinaryFromNative(nil, msg)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(b)
+	return err
+}
+
+// consumerSubscription returns the Consume subscription with the given ID
+func (s *session) consumerSubscription(id int64) (eventino.ConsumerSubscription, error) {
+	if p, ok := s.subs[id]; ok {
+		if sub, ok := p.sub.(eventino.ConsumerSubscription); ok {
+			return sub, nil
+		}
+	}
+	return nil, errors.New("consumer-subscription-not-found")
+}
+
+// decodeFilter builds the filter of a subscribeType or createConsumer
+// command, Since and Until are unix nanoseconds, 0 when unset
+func decodeFilter(eventName string, matchVSN bool, eventVSN uint64, since, until int64, predicate string) eventino.SubscriptionFilter {
+	filter := eventino.SubscriptionFilter{
+		EventName: eventName,
+		MatchVSN:  matchVSN,
+		EventVSN:  eventVSN,
+		Predicate: predicate,
+	}
+	if since != 0 {
+		filter.Since = time.Unix(0, since)
+	}
+	if until != 0 {
+		filter.Until = time.Unix(0, until)
+	}
+	return filter
 }
 
 func (s *srv) Stop() (err error) {
+	s.leaderMu.Lock()
 	s.closed = true
+	if s.leaderConn != nil {
+		s.leaderConn.Close()
+	}
+	s.leaderMu.Unlock()
 	s.lst.Close()
 	s.db.Close()
 	return
@@ -217,14 +708,47 @@ func NewServer(port int, opts badger.Options) (Server, error) {
 	if db, err = badger.Open(opts); err != nil {
 		return nil, err
 	}
+	var svc eventino.Eventino
+	if svc, err = eventino.NewEventino(db, schemaavro.Factory()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &srv{
+		port:         port,
+		db:           db,
+		svc:          svc,
+		fingerprints: newFingerprints(),
+	}, nil
+}
+
+// NewFollowerServer returns a Server replicating the log of the
+// leader at the given address. It serves reads and rejects writes
+func NewFollowerServer(port int, opts badger.Options, leaderAddr string, leaderPort int) (Server, error) {
+	var db *badger.DB
+	var err error
+	if db, err = badger.Open(opts); err != nil {
+		return nil, err
+	}
+	var follower eventino.Follower
+	if follower, err = eventino.NewFollower(db, schemaavro.Factory()); err != nil {
+		db.Close()
+		return nil, err
+	}
 	return &srv{
-		port:  port,
-		db:    db,
-		svc:   eventino.NewEventino(db, schemaavro.Factory()),
-		codec: common.NetCodec,
+		port:         port,
+		db:           db,
+		svc:          follower,
+		follower:     follower,
+		leaderAddr:   leaderAddr,
+		leaderPort:   leaderPort,
+		fingerprints: newFingerprints(),
 	}, nil
 }
 
 func wrapErr(err error) ([]byte, error) {
+	if conflict, ok := err.(eventino.VersionConflictError); ok {
+		rsp := &command.VersionConflictResponse{Expected: int64(conflict.Expected), Actual: int64(conflict.Actual)}
+		return common.NetCodec.BinaryFromNative(nil, rsp.Encode())
+	}
 	return common.NetCodec.BinaryFromNative(nil, command.NewErrorMessage(err).Encode())
 }
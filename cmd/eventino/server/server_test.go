@@ -4,9 +4,16 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/cheng81/eventino/internal/eventino/schema/schemaavro"
+	"github.com/cheng81/eventino/pkg/eventino"
+	eventinoclient "github.com/cheng81/eventino/pkg/eventino/client"
+	"github.com/dgraph-io/badger"
 	"github.com/linkedin/goavro"
 )
 
@@ -150,3 +157,263 @@ func server(t *testing.T) {
 	}
 
 }
+
+// withServer runs fn with a server on a temp db, listening on port
+func withServer(t *testing.T, port int, fn func()) {
+	dbDir := fmt.Sprintf("/tmp/badger-%d", time.Now().UnixNano())
+	defer os.RemoveAll(dbDir)
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	srv, err := NewServer(port, opts)
+	if err != nil {
+		t.Fatal("cannot create server", err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+	time.Sleep(200 * time.Millisecond)
+	fn()
+}
+
+func TestPutMany(t *testing.T) {
+	withServer(t, 7895, func() {
+		c := eventinoclient.NewClient()
+		if err := c.Start("localhost", 7895); err != nil {
+			t.Fatal("cannot connect", err)
+		}
+		defer c.Stop()
+		e := c.Eventino()
+		f := schemaavro.Factory()
+		rec := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err := e.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		if _, err := e.CreateEventType("user", "created", rec.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, _, err := e.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		created := func(name string) entity.EntityEvent {
+			return entity.EntityEvent{Type: entity.EntityEventType{Name: "created", VSN: 0}, Payload: map[string]interface{}{"Name": name}}
+		}
+		vsns, pos, err := e.PutMany("user", []byte("u1"), eventino.NotExistsVSN, []entity.EntityEvent{created("a"), created("b"), created("c")})
+		if err != nil {
+			t.Fatal("cannot put many", err)
+		}
+		if len(vsns) != 3 || vsns[0] != 1 || vsns[2] != 3 {
+			t.Fatal("wrong versions", vsns)
+		}
+		// a conflicting batch stores none of its events
+		_, _, err = e.PutMany("user", []byte("u1"), eventino.ExactVSN(1), []entity.EntityEvent{created("d"), created("e")})
+		if _, ok := err.(eventino.VersionConflictError); !ok {
+			t.Fatal("should be a version conflict", err)
+		}
+		ent, err := e.GetEntity("user", []byte("u1"), 100, pos)
+		if err != nil {
+			t.Fatal("cannot get entity", err)
+		}
+		if ent.VSN != 3 || len(ent.Events) != 3 {
+			t.Fatal("only the first batch should be stored", ent.VSN, ent.Events)
+		}
+		for i, name := range []string{"a", "b", "c"} {
+			if ent.Events[i].Payload.(map[string]interface{})["Name"] != name || !ent.Events[i].Timestamp.Equal(ent.Events[0].Timestamp) {
+				t.Fatal("wrong event", i, ent.Events)
+			}
+		}
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	withServer(t, 7894, func() {
+		c := eventinoclient.NewClient()
+		err := c.Start("localhost", 7894)
+		if err != nil {
+			t.Fatal("cannot connect", err)
+		}
+		defer c.Stop()
+		e := c.Eventino()
+		f := schemaavro.Factory()
+		record := func(name string) interface{} {
+			return f.NewRecord().SetName(name).SetField("Name", f.SimpleType(schema.String)).ToDataSchema().EncodeSchemaNative()
+		}
+		if _, err = e.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		var oldVsn uint64
+		if oldVsn, err = e.CreateEventType("user", "created", record("created")); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, err = e.CreateEventType("user", "deleted", record("deleted")); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		var latest eventinoclient.Negotiated
+		if latest, err = c.Negotiate(100, 0); err != nil {
+			t.Fatal("cannot negotiate", err)
+		}
+		if latest.VSN != latest.LatestVSN || latest.VSN <= oldVsn {
+			t.Fatal("wrong latest version", latest, oldVsn)
+		}
+		if _, _, err = e.Put("user", []byte("u1"), eventino.NotExistsVSN, "created_0", map[string]interface{}{"Name": "a"}); err != nil {
+			t.Fatal("cannot put", err)
+		}
+		if _, _, err = e.Put("user", []byte("u1"), eventino.AnyVSN, "deleted_0", map[string]interface{}{"Name": "a"}); err != nil {
+			t.Fatal("cannot put", err)
+		}
+
+		old := eventinoclient.NewClient()
+		if err = old.Start("localhost", 7894); err != nil {
+			t.Fatal("cannot connect", err)
+		}
+		defer old.Stop()
+		var negotiated eventinoclient.Negotiated
+		if negotiated, err = old.Negotiate(oldVsn, 0); err != nil {
+			t.Fatal("cannot negotiate", err)
+		}
+		if negotiated.VSN != oldVsn || negotiated.LatestVSN != latest.VSN || negotiated.Fingerprint == latest.Fingerprint {
+			t.Fatal("wrong negotiated version", negotiated, latest)
+		}
+		if _, err = old.Eventino().GetEntity("user", []byte("u1"), 100, eventino.EventID{}); err == nil || err.Error() != "unknown-event-type" {
+			t.Fatal("the events of later versions should be rejected", err)
+		}
+		if _, _, err = e.Put("user", []byte("u2"), eventino.NotExistsVSN, "created_0", map[string]interface{}{"Name": "a"}); err != nil {
+			t.Fatal("cannot put", err)
+		}
+		ent, err := old.Eventino().GetEntity("user", []byte("u2"), 100, eventino.EventID{})
+		if err != nil {
+			t.Fatal("cannot get entity", err)
+		}
+		if len(ent.Events) != 1 || ent.Events[0].Type.ToString() != "created_0" {
+			t.Fatal("wrong events", ent.Events)
+		}
+
+		sub, err := old.Eventino().SubscribeEntity("user", []byte("u1"), 3)
+		if err != nil {
+			t.Fatal("cannot subscribe", err)
+		}
+		// the older session does not change the schema of the writes
+		if _, _, err = e.Put("user", []byte("u1"), eventino.AnyVSN, "created_0", map[string]interface{}{"Name": "b"}); err != nil {
+			t.Fatal("cannot put after an older version is negotiated", err)
+		}
+		if _, _, err = e.Put("user", []byte("u1"), eventino.AnyVSN, "deleted_0", map[string]interface{}{"Name": "c"}); err != nil {
+			t.Fatal("cannot put", err)
+		}
+		select {
+		case evt := <-sub.Events():
+			if evt.Event.Type.ToString() != "created_0" || evt.VSN != 3 {
+				t.Fatal("wrong event pushed", evt)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no event pushed")
+		}
+		// the events of later versions end the subscription
+		select {
+		case evt, ok := <-sub.Events():
+			if ok {
+				t.Fatal("the events of later versions should not be pushed", evt)
+			}
+			if sub.Err() == nil || sub.Err().Error() != "unknown-event-type" {
+				t.Fatal("the subscription should end with an error", sub.Err())
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("the subscription did not end")
+		}
+		sub.Close()
+
+		var byFingerprint eventinoclient.Negotiated
+		if byFingerprint, err = old.Negotiate(0, latest.Fingerprint); err != nil {
+			t.Fatal("cannot negotiate by fingerprint", err)
+		}
+		if byFingerprint != latest {
+			t.Fatal("wrong version of the fingerprint", byFingerprint, latest)
+		}
+		if _, err = old.Negotiate(0, 42); err == nil {
+			t.Fatal("an unknown fingerprint should be rejected")
+		}
+	})
+}
+
+func TestMalformed(t *testing.T) {
+	// a union index out of the protocol schema
+	malformed := []byte{0xd0, 0x0f}
+	withServer(t, 7896, func() {
+		conn, err := net.Dial("tcp", "localhost:7896")
+		if err != nil {
+			t.Fatal("cannot connect", err)
+		}
+		defer conn.Close()
+		if _, err = conn.Write(malformed); err != nil {
+			t.Fatal("cannot write", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatal("the server should close the connection", err)
+		}
+	})
+
+	// the client too closes the connection of a malformed reply
+	l, err := net.Listen("tcp", "localhost:7897")
+	if err != nil {
+		t.Fatal("cannot listen", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 1024))
+		conn.Write(malformed)
+		conn.Read(make([]byte, 1024))
+	}()
+	c := eventinoclient.NewClient()
+	if err = c.Start("localhost", 7897); err != nil {
+		t.Fatal("cannot connect", err)
+	}
+	defer c.Stop()
+	done := make(chan error)
+	go func() {
+		_, err := c.Eventino().SchemaVSN()
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Fatal("a malformed reply should fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the client should not wait on a malformed reply")
+	}
+
+	// and a follower, the connection of a malformed replica event
+	leader, err := net.Listen("tcp", "localhost:7898")
+	if err != nil {
+		t.Fatal("cannot listen", err)
+	}
+	defer leader.Close()
+	dbDir := fmt.Sprintf("/tmp/badger-%d", time.Now().UnixNano())
+	defer os.RemoveAll(dbDir)
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	follower, err := NewFollowerServer(7899, opts, "localhost", 7898)
+	if err != nil {
+		t.Fatal("cannot create follower", err)
+	}
+	go follower.Start()
+	defer follower.Stop()
+	conn, err := leader.Accept()
+	if err != nil {
+		t.Fatal("cannot accept the follower", err)
+	}
+	defer conn.Close()
+	conn.Read(make([]byte, 1024))
+	if _, err = conn.Write(malformed); err != nil {
+		t.Fatal("cannot write", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal("the follower should close the connection", err)
+	}
+}
@@ -16,4 +16,17 @@ const (
 	EventKindSchema byte = 4
 	// EventKindEntity is a log.Event Kind that identifies entity events
 	EventKindEntity byte = 8
+	// EventKindConsumer is a log.Event Kind that identifies consumer events
+	EventKindConsumer byte = 16
+	// EventKindScript is a log.Event Kind that identifies script events
+	EventKindScript byte = 20
+)
+
+// item types - the ItemID.Type of the items.
+// 0 is the schema, 1 are entities and 2 is reserved for aliases
+const (
+	// ItemTypeConsumer is the ItemID.Type of the consumers
+	ItemTypeConsumer uint8 = 3
+	// ItemTypeScript is the ItemID.Type of the scripts
+	ItemTypeScript uint8 = 4
 )
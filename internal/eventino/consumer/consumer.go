@@ -0,0 +1,118 @@
+package consumer
+
+import (
+	"github.com/cheng81/eventino/internal/eventino"
+	"github.com/cheng81/eventino/internal/eventino/entity/script"
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/cheng81/eventino/internal/eventino/log"
+	"github.com/dgraph-io/badger"
+)
+
+// Consumer is a named, durable reader of the events of an entity type.
+// It remembers the position of the last committed event, so that a reader
+// can resume from it (and be re-delivered the events it did not commit)
+type Consumer struct {
+	Name       string
+	EntityType string
+	Filter     script.Filter
+	// Offset is the log position of the last committed event,
+	// the zero EventID if nothing was committed yet
+	Offset log.EventID
+}
+
+// Create stores a new consumer, returns ConsumerExists
+// if a consumer with the same name exists
+func Create(txn *badger.Txn, c Consumer) (err error) {
+	ID := consumerID(c.Name)
+	if err = item.Create(txn, ID); err != nil {
+		if err == item.ItemExistsError {
+			err = ConsumerExists
+		}
+		return
+	}
+	var evt item.Event
+	if evt, err = newCreated(c); err != nil {
+		return
+	}
+	if _, err = item.Put(txn, ID, evt); err != nil {
+		return
+	}
+	return Sync(txn, ID)
+}
+
+// Get returns the consumer, or ConsumerNotFound
+func Get(txn *badger.Txn, name string) (Consumer, error) {
+	_, state, err := item.GetView(txn, consumerID(name), stateView, consumerState{})
+	if err == badger.ErrKeyNotFound {
+		return Consumer{}, ConsumerNotFound
+	}
+	if err != nil {
+		return Consumer{}, err
+	}
+	return state.(Consumer), nil
+}
+
+// List returns all consumers, sorted by name
+func List(txn *badger.Txn) (out []Consumer, err error) {
+	var IDs []item.ItemID
+	if IDs, err = item.List(txn, eventino.ItemTypeConsumer, nil); err != nil {
+		return
+	}
+	out = make([]Consumer, 0, len(IDs))
+	for _, ID := range IDs {
+		var c Consumer
+		if c, err = Get(txn, string(ID.ID)); err != nil {
+			return
+		}
+		out = append(out, c)
+	}
+	return
+}
+
+// Commit moves the consumer offset to the given position.
+// Offsets only move forward: committing a position before
+// the current offset leaves the consumer unchanged
+func Commit(txn *badger.Txn, name string, offset log.EventID) (c Consumer, err error) {
+	if c, err = Get(txn, name); err != nil {
+		return
+	}
+	if !c.Offset.Before(offset) {
+		return
+	}
+	if err = putOffset(txn, name, consumerCommitted, offset); err != nil {
+		return
+	}
+	c.Offset = offset
+	return
+}
+
+// Reset moves the consumer offset to the given position, backward or forward.
+// The zero EventID replays the whole log
+func Reset(txn *badger.Txn, name string, offset log.EventID) (err error) {
+	if _, err = Get(txn, name); err != nil {
+		return
+	}
+	return putOffset(txn, name, consumerReset, offset)
+}
+
+// Delete removes the consumer
+func Delete(txn *badger.Txn, name string) (err error) {
+	if _, err = Get(txn, name); err != nil {
+		return
+	}
+	return item.Delete(txn, consumerID(name))
+}
+
+func putOffset(txn *badger.Txn, name string, eType string, offset log.EventID) (err error) {
+	ID := consumerID(name)
+	if _, err = item.Put(txn, ID, newOffsetEvent(eType, offset)); err != nil {
+		return
+	}
+	return Sync(txn, ID)
+}
+
+// Sync updates the stored state of the consumer with its events,
+// e.g. after replicating them
+func Sync(txn *badger.Txn, ID item.ItemID) error {
+	return item.SyncPersistentView(txn, ID, stateView, consumerState{}, Consumer{})
+}
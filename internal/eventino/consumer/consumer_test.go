@@ -0,0 +1,99 @@
+package consumer
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cheng81/eventino/internal/eventino/entity/script"
+	"github.com/cheng81/eventino/internal/eventino/log"
+	"github.com/dgraph-io/badger"
+)
+
+func withTempDB(fn func(*badger.DB) error) error {
+	dbDir := fmt.Sprintf("/tmp/badger-%d", time.Now().UnixNano())
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	db, err := badger.Open(opts)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	defer os.RemoveAll(dbDir)
+	defer db.Close()
+	return fn(db)
+}
+
+func TestConsumer(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			if err = Create(txn, Consumer{Name: "b", EntityType: "User", Filter: script.Filter{EventName: "Tags"}}); err != nil {
+				return
+			}
+			if err = Create(txn, Consumer{Name: "a", EntityType: "User"}); err != nil {
+				return
+			}
+			// the IDs starting with v share the prefix of the item versions
+			return Create(txn, Consumer{Name: "views", EntityType: "User"})
+		})
+		if err != nil {
+			t.Fatal("cannot create", err)
+		}
+
+		first := log.NewEventID(1, 10, 0)
+		second := log.NewEventID(1, 20, 0)
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			if _, err = Commit(txn, "b", second); err != nil {
+				return
+			}
+			// offsets only move forward
+			var c Consumer
+			if c, err = Commit(txn, "b", first); err != nil {
+				return
+			}
+			if c.Offset != second {
+				t.Fatal("commit should not move the offset backward", c.Offset)
+			}
+			return Reset(txn, "a", first)
+		})
+		if err != nil {
+			t.Fatal("cannot commit", err)
+		}
+
+		err = db.View(func(txn *badger.Txn) (err error) {
+			var consumers []Consumer
+			if consumers, err = List(txn); err != nil {
+				return
+			}
+			if len(consumers) != 3 || consumers[0].Name != "a" || consumers[1].Name != "b" || consumers[2].Name != "views" {
+				t.Fatal("wrong consumers", consumers)
+			}
+			if consumers[0].Offset != first || consumers[1].Offset != second {
+				t.Fatal("wrong offsets", consumers)
+			}
+			if consumers[1].Filter.EventName != "Tags" {
+				t.Fatal("wrong filter", consumers[1])
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot list", err)
+		}
+
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			if err = Delete(txn, "a"); err != nil {
+				return
+			}
+			if _, err = Get(txn, "a"); err != ConsumerNotFound {
+				t.Fatal("consumer should be deleted", err)
+			}
+			return Create(txn, Consumer{Name: "b"})
+		})
+		if err != ConsumerExists {
+			t.Fatal("should not create a consumer twice", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,94 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+
+	"github.com/cheng81/eventino/internal/eventino"
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/cheng81/eventino/internal/eventino/log"
+)
+
+const (
+	consumerCreated   string = "CONSUMER:CREATED"
+	consumerCommitted string = "CONSUMER:COMMITTED"
+	consumerReset     string = "CONSUMER:RESET"
+)
+
+var stateView []byte
+
+// ConsumerNotFound is returned when the consumer does not exist
+var ConsumerNotFound error
+
+// ConsumerExists is returned when creating a consumer that already exists
+var ConsumerExists error
+
+func init() {
+	stateView = []byte("state")
+	ConsumerNotFound = errors.New("Consumer not found")
+	ConsumerExists = errors.New("Consumer exists")
+}
+
+func consumerID(name string) item.ItemID {
+	return item.NewItemID(eventino.ItemTypeConsumer, []byte(name))
+}
+
+func newCreated(c Consumer) (out item.Event, err error) {
+	var b []byte
+	if b, err = encode(c); err != nil {
+		return
+	}
+	out = item.NewEvent(eventino.EventKindConsumer, []byte(consumerCreated), b)
+	return
+}
+
+func newOffsetEvent(eType string, offset log.EventID) item.Event {
+	return item.NewEvent(eventino.EventKindConsumer, []byte(eType), offset.Encode())
+}
+
+// consumerState folds the consumer events into a Consumer
+type consumerState struct{}
+
+func (consumerState) DecodeState(b []byte) (interface{}, error) {
+	var c Consumer
+	err := decode(b, &c)
+	return c, err
+}
+
+func (consumerState) EncodeState(s interface{}) ([]byte, error) {
+	return encode(s.(Consumer))
+}
+
+func (consumerState) Fold(acc interface{}, evt item.Event, vsn uint64) (interface{}, bool, error) {
+	if evt.Kind != eventino.EventKindConsumer {
+		return acc, false, nil
+	}
+	c := acc.(Consumer)
+	switch string(evt.Type) {
+	case consumerCreated:
+		if err := decode(evt.Payload, &c); err != nil {
+			return nil, true, err
+		}
+	case consumerCommitted, consumerReset:
+		if err := log.DecodeEventID(evt.Payload, &c.Offset); err != nil {
+			return nil, true, err
+		}
+	}
+	return c, false, nil
+}
+
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(b []byte, v interface{}) error {
+	buf := bytes.NewBuffer(b)
+	dec := gob.NewDecoder(buf)
+	return dec.Decode(v)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/cheng81/eventino/internal/eventino"
 	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/cheng81/eventino/internal/eventino/log"
 	"github.com/cheng81/eventino/internal/eventino/schema"
 	"github.com/dgraph-io/badger"
 )
@@ -31,22 +32,57 @@ func NewEntity(txn *badger.Txn, entType schema.EntityType, ID []byte) (err error
 	return
 }
 
-// Put adds the given event to the entity
-func Put(txn *badger.Txn, entType schema.EntityType, ID []byte, evtID schema.EventSchemaID, evt interface{}) (vsn uint64, err error) {
+// Put adds the given event to the entity, if the entity is at the
+// expected version. Expecting item.NotExistsVSN creates the entity
+func Put(txn *badger.Txn, entType schema.EntityType, ID []byte, expected item.ExpectedVSN, evtID schema.EventSchemaID, evt interface{}) (vsn uint64, err error) {
 	var itemEvt item.Event
 	entID := entType.EntityID(ID)
 
 	if itemEvt, err = entityEvt(entType, evtID, evt); err != nil {
 		return
 	}
-	if vsn, err = item.Put(txn, entID, itemEvt); err != nil {
+	if err = expect(txn, entType, ID, expected); err != nil {
 		return
 	}
+	vsn, err = item.Put(txn, entID, itemEvt)
 	return
 }
 
+// PutMany atomically adds the given events to the entity, if the
+// entity is at the expected version. The Timestamp of the events is ignored
+func PutMany(txn *badger.Txn, entType schema.EntityType, ID []byte, expected item.ExpectedVSN, evts []EntityEvent) (vsns []uint64, logEventIDs []log.EventID, err error) {
+	itemEvts := make([]item.Event, len(evts))
+	for i, evt := range evts {
+		evtID := schema.NewEventSchemaID(evt.Type.Name, evt.Type.VSN)
+		if itemEvts[i], err = entityEvt(entType, evtID, evt.Payload); err != nil {
+			return
+		}
+	}
+	if err = expect(txn, entType, ID, expected); err != nil {
+		return
+	}
+	vsns, logEventIDs, err = item.PutMany(txn, entType.EntityID(ID), itemEvts)
+	return
+}
+
+func expect(txn *badger.Txn, entType schema.EntityType, ID []byte, expected item.ExpectedVSN) error {
+	if err := item.Expect(txn, entType.EntityID(ID), expected); err != nil {
+		return err
+	}
+	if expected == item.NotExistsVSN {
+		return NewEntity(txn, entType, ID)
+	}
+	return nil
+}
+
 // Get retrieves an entity
 func Get(txn *badger.Txn, entType schema.EntityType, ID []byte, vsn uint64) (ent Entity, err error) {
+	return GetAt(txn, nil, entType, ID, vsn, Versions{})
+}
+
+// GetAt retrieves an entity, presenting its events
+// at the given versions with the upcasters
+func GetAt(txn *badger.Txn, ups *Upcasters, entType schema.EntityType, ID []byte, vsn uint64, versions Versions) (ent Entity, err error) {
 	var itm item.Item
 	var mappedEvts []EntityEvent
 	if itm, err = item.Get(txn, entType.EntityID(ID), 0, vsn); err != nil {
@@ -55,6 +91,9 @@ func Get(txn *badger.Txn, entType schema.EntityType, ID []byte, vsn uint64) (ent
 	if mappedEvts, err = mapEvents(entType, itm.Events); err != nil {
 		return
 	}
+	if err = ups.upcastAll(entType, mappedEvts, versions); err != nil {
+		return
+	}
 	ent = Entity{
 		Type:      EntityType{entType.Name, entType.VSN},
 		ID:        ID,
@@ -76,20 +115,42 @@ func View(txn *badger.Txn,
 	fromVsn uint64,
 	fold ViewFoldFunc,
 	initial interface{}) (interface{}, uint64, error) {
-	itemFold := func(acc interface{}, evt item.Event, vsn uint64) (interface{}, bool, error) {
+	return ViewAt(txn, nil, entType, ID, fromVsn, Versions{}, fold, initial)
+}
+
+// ViewAt folds the entity events, presented
+// at the given versions with the upcasters
+func ViewAt(txn *badger.Txn,
+	ups *Upcasters,
+	entType schema.EntityType,
+	ID []byte,
+	fromVsn uint64,
+	versions Versions,
+	fold ViewFoldFunc,
+	initial interface{}) (interface{}, uint64, error) {
+	fmt.Println("about to call item.View")
+	return item.View(txn, entType.EntityID(ID), fromVsn, itemFold(entType, ups, versions, fold), initial)
+}
+
+// itemFold adapts a fold on the entity events to the item events
+func itemFold(entType schema.EntityType, ups *Upcasters, versions Versions, fold ViewFoldFunc) item.ViewFoldFunc {
+	return func(acc interface{}, evt item.Event, vsn uint64) (interface{}, bool, error) {
 		fmt.Println("entity.View", acc, evt)
 		if evt.Kind == eventino.EventKindEntity {
 			entEvt, err := mapEvent(entType, evt)
-			if err != nil && err != EventVSNNotFound {
+			if err == EventVSNNotFound {
+				// written at a version the schema does not know yet
+				return acc, false, nil
+			} else if err != nil {
 				return nil, true, err
-			} else if err == nil {
-				return fold(acc, entEvt, vsn)
 			}
-			return acc, false, nil
+			// unlike the written one, a missing target version is an error
+			if entEvt, err = ups.Upcast(entType, entEvt, versions.target(entType, entEvt.Type)); err != nil {
+				return nil, true, err
+			}
+			return fold(acc, entEvt, vsn)
 		}
 		// TODO: perhaps handle system events too
 		return acc, false, nil
 	}
-	fmt.Println("about to call item.View")
-	return item.View(txn, entType.EntityID(ID), fromVsn, itemFold, initial)
 }
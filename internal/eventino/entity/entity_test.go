@@ -8,6 +8,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cheng81/eventino/internal/eventino/item"
+	elog "github.com/cheng81/eventino/internal/eventino/log"
 	"github.com/cheng81/eventino/internal/eventino/schema"
 	"github.com/cheng81/eventino/internal/eventino/schema/schemaavro"
 
@@ -68,12 +70,12 @@ func TestCreate(t *testing.T) {
 				"Paying": true,
 			}
 
-			if _, err = Put(txn, entTyp, entID, schema.NewEventSchemaID("Created", 0), createdRec); err != nil {
+			if _, err = Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Created", 0), createdRec); err != nil {
 				return
 			}
 
 			tags := []string{"awesome", "slice", "of", "tags"}
-			if _, err = Put(txn, entTyp, entID, schema.NewEventSchemaID("Tags", 0), tags); err != nil {
+			if _, err = Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Tags", 0), tags); err != nil {
 				return
 			}
 			return
@@ -159,7 +161,7 @@ func TestCreateUpdate(t *testing.T) {
 				"Name":   "daCheng",
 				"Paying": true,
 			}
-			if _, err = Put(txn, entTyp, entID, schema.NewEventSchemaID("Created", 0), createdRec); err != nil {
+			if _, err = Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Created", 0), createdRec); err != nil {
 				return
 			}
 			updatedRec := map[string]interface{}{
@@ -167,7 +169,7 @@ func TestCreateUpdate(t *testing.T) {
 				"Username": "daCheng",
 				"Useful":   nil,
 			}
-			if _, err = Put(txn, entTyp, entID, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
+			if _, err = Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
 				return
 			}
 			updatedRec = map[string]interface{}{
@@ -175,7 +177,7 @@ func TestCreateUpdate(t *testing.T) {
 				"Username": "daddaCheng",
 				"Useful":   nil,
 			}
-			if _, err = Put(txn, entTyp, entID, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
+			if _, err = Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
 				return
 			}
 			return
@@ -280,3 +282,494 @@ func mkSchema(db *badger.DB) error {
 		return
 	})
 }
+
+func TestPutMany(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		entID := []byte("cheng")
+		if err = mkSchema(db); err != nil {
+			t.Fatal("cannot create schema", err)
+		}
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			var entTyp schema.EntityType
+			if entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100); err != nil {
+				return
+			}
+			if err = NewEntity(txn, entTyp, entID); err != nil {
+				return
+			}
+			evts := []EntityEvent{
+				EntityEvent{Type: EntityEventType{"Created", 0}, Payload: map[string]interface{}{"Name": "daCheng", "Paying": true}},
+				EntityEvent{Type: EntityEventType{"Tags", 0}, Payload: []string{"some", "tags"}},
+			}
+			var vsns []uint64
+			if vsns, _, err = PutMany(txn, entTyp, entID, item.AnyVSN, evts); err != nil {
+				return
+			}
+			if len(vsns) != 2 || vsns[0] != 1 || vsns[1] != 2 {
+				t.Fatal("vsns should be [1 2]", vsns)
+			}
+
+			// invalid events are not written
+			evts = append(evts, EntityEvent{Type: EntityEventType{"Tags", 0}, Payload: "not tags"})
+			if _, _, err = PutMany(txn, entTyp, entID, item.AnyVSN, evts); err == nil {
+				t.Fatal("should not put invalid events")
+			}
+
+			var ent Entity
+			if ent, err = Get(txn, entTyp, entID, 100); err != nil {
+				return
+			}
+			if len(ent.Events) != 2 {
+				t.Fatal("entity should have 2 events", len(ent.Events))
+			}
+			if !ent.Events[0].Timestamp.Equal(ent.Events[1].Timestamp) {
+				t.Fatal("events should share the timestamp", ent.Events)
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot write", err)
+		}
+		return
+	})
+}
+
+func TestExpectedVSN(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		entID := []byte("cheng")
+		if err = mkSchema(db); err != nil {
+			t.Fatal("cannot create schema", err)
+		}
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			var entTyp schema.EntityType
+			if entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100); err != nil {
+				return
+			}
+			tags := []string{"some", "tags"}
+			tagsID := schema.NewEventSchemaID("Tags", 0)
+			// NotExistsVSN creates the entity
+			var vsn uint64
+			if vsn, err = Put(txn, entTyp, entID, item.NotExistsVSN, tagsID, tags); err != nil {
+				return
+			}
+			if vsn != 1 {
+				t.Fatal("vsn should be 1", vsn)
+			}
+			if _, err = Put(txn, entTyp, entID, item.NotExistsVSN, tagsID, tags); err == nil {
+				t.Fatal("should not create an existing entity")
+			}
+			if vsn, err = Put(txn, entTyp, entID, item.ExactVSN(1), tagsID, tags); err != nil {
+				return
+			}
+			if vsn != 2 {
+				t.Fatal("vsn should be 2", vsn)
+			}
+			// a writer that loaded version 1 conflicts
+			_, err = Put(txn, entTyp, entID, item.ExactVSN(1), tagsID, tags)
+			conflict, ok := err.(item.VersionConflictError)
+			if !ok {
+				t.Fatal("should fail with a version conflict", err)
+			}
+			if conflict.Expected != item.ExactVSN(1) || conflict.Actual != item.ExactVSN(2) {
+				t.Fatal("conflict should be expected 1, actual 2", conflict)
+			}
+			_, _, err = PutMany(txn, entTyp, []byte("nope"), item.ExactVSN(0), []EntityEvent{EntityEvent{Type: EntityEventType{"Tags", 0}, Payload: tags}})
+			if conflict, ok = err.(item.VersionConflictError); !ok || conflict.Actual != item.NotExistsVSN {
+				t.Fatal("should fail with a not exists version conflict", err)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal("cannot write", err)
+		}
+		return
+	})
+}
+
+// tagCount counts the tags added to an entity
+type tagCount struct{}
+
+func (tagCount) DecodeState(b []byte) (interface{}, error) {
+	var n int
+	err := decode(b, &n)
+	return n, err
+}
+
+func (tagCount) EncodeState(state interface{}) ([]byte, error) {
+	return encode(state.(int))
+}
+
+func (tagCount) Fold(acc interface{}, evt EntityEvent, vsn uint64) (interface{}, bool, error) {
+	if evt.Type.Name == "Tags" {
+		return acc.(int) + len(evt.Payload.([]interface{})), false, nil
+	}
+	return acc, false, nil
+}
+
+func TestPersistentView(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		entID := []byte("cheng")
+		if err = mkSchema(db); err != nil {
+			t.Fatal("cannot create schema", err)
+		}
+		tagsID := schema.NewEventSchemaID("Tags", 0)
+		views := NewViews()
+		put := func(tags ...string) error {
+			return db.Update(func(txn *badger.Txn) (err error) {
+				var entTyp schema.EntityType
+				if entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100); err != nil {
+					return
+				}
+				if _, err = Put(txn, entTyp, entID, item.AnyVSN, tagsID, tags); err != nil {
+					return
+				}
+				return views.Sync(txn, entTyp, entID)
+			})
+		}
+		count := func() (vsn uint64, n int) {
+			err := db.View(func(txn *badger.Txn) (err error) {
+				var entTyp schema.EntityType
+				if entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100); err != nil {
+					return
+				}
+				var state interface{}
+				if vsn, state, err = views.Get(txn, entTyp, entID, "tags"); err != nil {
+					return
+				}
+				n = state.(int)
+				return
+			})
+			if err != nil {
+				t.Fatal("cannot read view", err)
+			}
+			return
+		}
+
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			var entTyp schema.EntityType
+			if entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100); err != nil {
+				return
+			}
+			return NewEntity(txn, entTyp, entID)
+		})
+		if err != nil {
+			t.Fatal("cannot create entity", err)
+		}
+		if err = put("a", "b"); err != nil {
+			t.Fatal("cannot put", err)
+		}
+
+		// registered after the entity was written: computed from the events
+		views.Register("User", "tags", tagCount{}, 0)
+		if vsn, n := count(); vsn != 1 || n != 2 {
+			t.Fatal("view should be at vsn 1 with 2 tags", vsn, n)
+		}
+
+		if err = put("c"); err != nil {
+			t.Fatal("cannot put", err)
+		}
+		if err = put("d", "e", "f"); err != nil {
+			t.Fatal("cannot put", err)
+		}
+		if vsn, n := count(); vsn != 3 || n != 6 {
+			t.Fatal("view should be at vsn 3 with 6 tags", vsn, n)
+		}
+		return
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		entID := []byte("cheng")
+		if err = mkSchema(db); err != nil {
+			t.Fatal("cannot create schema", err)
+		}
+		hub := elog.NewHub(db)
+		var entTyp schema.EntityType
+		err = db.View(func(txn *badger.Txn) (err error) {
+			entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100)
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot load entity type", err)
+		}
+		tagsID := schema.NewEventSchemaID("Tags", 0)
+		put := func(ID []byte, tag string) {
+			err := hub.Update(func(txn *badger.Txn) (err error) {
+				_, err = Put(txn, entTyp, ID, item.AnyVSN, tagsID, []string{tag})
+				return
+			})
+			if err != nil {
+				t.Fatal("cannot put", err)
+			}
+		}
+		next := func(sub *Subscription) SubscriptionEvent {
+			select {
+			case evt := <-sub.Events():
+				return evt
+			case <-time.After(2 * time.Second):
+				t.Fatal("no event delivered", sub.Err())
+			}
+			return SubscriptionEvent{}
+		}
+
+		// subscribe before the entity exists
+		early, err := Subscribe(hub, entTyp, entID, 0, 2)
+		if err != nil {
+			t.Fatal("cannot subscribe", err)
+		}
+		defer early.Close()
+
+		err = hub.Update(func(txn *badger.Txn) error {
+			return NewEntity(txn, entTyp, entID)
+		})
+		if err != nil {
+			t.Fatal("cannot create entity", err)
+		}
+		put(entID, "a")
+		put(entID, "b")
+
+		late, err := Subscribe(hub, entTyp, entID, 2, 2)
+		if err != nil {
+			t.Fatal("cannot subscribe", err)
+		}
+		defer late.Close()
+		put([]byte("other"), "nope")
+		put(entID, "c")
+
+		for i, tag := range []string{"a", "b", "c"} {
+			evt := next(early)
+			if evt.VSN != uint64(i+1) || evt.Event.Payload.([]interface{})[0] != tag {
+				t.Fatal("wrong event", i, evt)
+			}
+		}
+		for i, tag := range []string{"b", "c"} {
+			evt := next(late)
+			if evt.VSN != uint64(i+2) || evt.Event.Payload.([]interface{})[0] != tag || string(evt.ID) != "cheng" {
+				t.Fatal("wrong event", i, evt)
+			}
+		}
+
+		late.Close()
+		if _, ok := <-late.Events(); ok {
+			t.Fatal("closed subscription should not deliver events")
+		}
+		return
+	})
+}
+
+func TestSubscribeType(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		if err = mkSchema(db); err != nil {
+			t.Fatal("cannot create schema", err)
+		}
+		hub := elog.NewHub(db)
+		var entTyp schema.EntityType
+		err = db.View(func(txn *badger.Txn) (err error) {
+			entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100)
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot load entity type", err)
+		}
+		tagsID := schema.NewEventSchemaID("Tags", 0)
+		put := func(ID string, tag string) {
+			err := hub.Update(func(txn *badger.Txn) (err error) {
+				_, err = Put(txn, entTyp, []byte(ID), item.AnyVSN, tagsID, []string{tag})
+				return
+			})
+			if err != nil {
+				t.Fatal("cannot put", err)
+			}
+		}
+		next := func(sub *Subscription) SubscriptionEvent {
+			select {
+			case evt := <-sub.Events():
+				return evt
+			case <-time.After(2 * time.Second):
+				t.Fatal("no event delivered", sub.Err())
+			}
+			return SubscriptionEvent{}
+		}
+		tag := func(evt SubscriptionEvent) string {
+			return evt.Event.Payload.([]interface{})[0].(string)
+		}
+
+		put("a", "a0")
+		put("b", "b0")
+		put("a", "a1")
+		until := time.Now()
+		time.Sleep(time.Millisecond)
+
+		all := SubscribeType(hub, entTyp, Filter{}, elog.EventID{}, 2)
+		defer all.Close()
+		onlyB := SubscribeType(hub, entTyp, Filter{
+			EventName: "Tags",
+			Predicate: func(evt SubscriptionEvent) (bool, error) {
+				return string(evt.ID) == "b", nil
+			},
+		}, elog.EventID{}, 2)
+		defer onlyB.Close()
+		none := SubscribeType(hub, entTyp, Filter{EventName: "Created"}, elog.EventID{}, 2)
+		defer none.Close()
+		bounded := SubscribeType(hub, entTyp, Filter{Until: until}, elog.EventID{}, 2)
+		defer bounded.Close()
+
+		put("b", "b1")
+
+		var last SubscriptionEvent
+		for i, expected := range []string{"a0", "b0", "a1"} {
+			last = next(all)
+			if tag(last) != expected {
+				t.Fatal("wrong event", i, last)
+			}
+		}
+		if last.VSN != 1 || string(last.ID) != "a" {
+			t.Fatal("wrong entity version", last)
+		}
+		for _, expected := range []string{"b0", "b1"} {
+			if evt := next(onlyB); tag(evt) != expected {
+				t.Fatal("wrong filtered event", evt)
+			}
+		}
+
+		for i, expected := range []string{"a0", "b0", "a1"} {
+			if evt := next(bounded); tag(evt) != expected {
+				t.Fatal("wrong bounded event", i, evt)
+			}
+		}
+		// b1 is past the bound, the subscription ends
+		select {
+		case evt, ok := <-bounded.Events():
+			if ok {
+				t.Fatal("the subscription should end after until", evt)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("the subscription should end after until")
+		}
+		if err := bounded.Err(); err != nil {
+			t.Fatal("the subscription should end without error", err)
+		}
+
+		// resume after the last received event
+		all.Close()
+		resumed := SubscribeType(hub, entTyp, Filter{}, last.Position, 2)
+		defer resumed.Close()
+		if evt := next(resumed); tag(evt) != "b1" {
+			t.Fatal("should resume from b1", evt)
+		}
+
+		select {
+		case evt := <-none.Events():
+			t.Fatal("no event should match", evt)
+		default:
+		}
+		return
+	})
+}
+
+func TestUpcast(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		entID := []byte("cheng")
+		if err = mkSchema(db); err != nil {
+			t.Fatal("cannot create schema", err)
+		}
+		factory := schemaavro.Factory()
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			created1 := factory.NewRecord().
+				SetName("UserCreatedRecord").
+				SetField("Name", factory.SimpleType(schema.String)).
+				SetField("Plan", factory.SimpleType(schema.String))
+			_, err = schema.UpdateEventType(txn, "User", "Created", created1.ToDataSchema())
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot update schema", err)
+		}
+
+		var entTyp schema.EntityType
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			if entTyp, err = schema.GetEntityType(txn, factory.Decoder(), "User", 100); err != nil {
+				return
+			}
+			_, err = Put(txn, entTyp, entID, item.NotExistsVSN, schema.NewEventSchemaID("Created", 0), map[string]interface{}{"Name": "daCheng", "Paying": true})
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot put", err)
+		}
+
+		ups := NewUpcasters()
+		get := func(versions Versions) (ent Entity, err error) {
+			err = db.View(func(txn *badger.Txn) (err error) {
+				ent, err = GetAt(txn, ups, entTyp, entID, 0, versions)
+				return
+			})
+			return
+		}
+		if _, err = get(Versions{Latest: true}); err != UpcasterNotFound {
+			t.Fatal("should not upcast without upcasters", err)
+		}
+
+		ups.Register("User", "Created", 0, func(payload interface{}) (interface{}, error) {
+			p := payload.(map[string]interface{})
+			plan := "free"
+			if p["Paying"].(bool) {
+				plan = "paying"
+			}
+			return map[string]interface{}{"Name": p["Name"], "Plan": plan}, nil
+		})
+
+		ent, err := get(Versions{Latest: true})
+		if err != nil {
+			t.Fatal("cannot get upcasted", err)
+		}
+		if ent.Events[0].Type.VSN != 1 || ent.Events[0].Payload.(map[string]interface{})["Plan"] != "paying" {
+			t.Fatal("event should be upcasted", ent.Events[0])
+		}
+		if ent, err = get(Versions{Latest: true, ByEvent: map[string]uint64{"Created": 0}}); err != nil || ent.Events[0].Type.VSN != 0 {
+			t.Fatal("event should be presented at version 0", ent.Events, err)
+		}
+		if ent, err = get(Versions{}); err != nil || ent.Events[0].Type.VSN != 0 {
+			t.Fatal("event should be presented as written", ent.Events, err)
+		}
+
+		err = db.View(func(txn *badger.Txn) (err error) {
+			var plan interface{}
+			plan, _, err = ViewAt(txn, ups, entTyp, entID, 0, Versions{Latest: true}, func(acc interface{}, evt EntityEvent, _ uint64) (interface{}, bool, error) {
+				return evt.Payload.(map[string]interface{})["Plan"], false, nil
+			}, nil)
+			if plan != "paying" {
+				t.Fatal("view should fold upcasted events", plan)
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot view", err)
+		}
+
+		// the events are never dropped for a missing target version
+		ups.Register("User", "Created", 1, func(payload interface{}) (interface{}, error) {
+			return payload, nil
+		})
+		err = db.View(func(txn *badger.Txn) (err error) {
+			_, _, err = ViewAt(txn, ups, entTyp, entID, 0, Versions{ByEvent: map[string]uint64{"Created": 2}}, func(acc interface{}, evt EntityEvent, _ uint64) (interface{}, bool, error) {
+				return acc, false, nil
+			}, nil)
+			return
+		})
+		if err != EventVSNNotFound {
+			t.Fatal("view should fail on a missing version", err)
+		}
+
+		ups.Register("User", "Created", 0, func(payload interface{}) (interface{}, error) {
+			return map[string]interface{}{"Name": "daCheng", "Plan": 42}, nil
+		})
+		_, err = get(Versions{Latest: true})
+		invalid, ok := err.(InvalidUpcastError)
+		if !ok || len(invalid.Errors) != 1 || invalid.Errors[0].Path != "Plan" {
+			t.Fatal("upcasted payload should be valid", err)
+		}
+		return nil
+	})
+}
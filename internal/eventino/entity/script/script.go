@@ -1,7 +1,11 @@
 package script
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/cheng81/eventino/internal/eventino/entity"
 	"github.com/cheng81/eventino/internal/eventino/schema"
@@ -44,6 +48,10 @@ func buildViewFun(vm *otto.Otto, handler otto.Value) entity.ViewFoldFunc {
 				}
 				return val.Export()
 			}
+			// no handler for the event, the state is unchanged
+			if jsAcc, ok := acc.(otto.Value); ok {
+				return jsAcc.Export()
+			}
 			return acc, nil
 		}
 	}
@@ -68,3 +76,135 @@ func View(txn *badger.Txn, src string, entType schema.EntityType, ID []byte, fro
 	fmt.Println(">>>>>>>>> about to call entity.view")
 	return entity.View(txn, entType, ID, fromVsn, buildViewFun(vm, handler), initial)
 }
+
+// NewView compiles a javascript view into a persistent view.
+// The state is encoded as JSON, the initial state is an empty object
+func NewView(src string) (entity.PersistentViewFold, interface{}, error) {
+	vm := otto.New()
+	handler, err := vm.Run(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &scriptView{vm: vm, fold: buildViewFun(vm, handler)}, map[string]interface{}{}, nil
+}
+
+// scriptView is a persistent view running a javascript fold.
+// The otto vm is not safe for concurrent use
+type scriptView struct {
+	mu   sync.Mutex
+	vm   *otto.Otto
+	fold entity.ViewFoldFunc
+}
+
+func (v *scriptView) DecodeState(b []byte) (interface{}, error) {
+	var state interface{}
+	err := json.Unmarshal(b, &state)
+	return state, err
+}
+
+func (v *scriptView) EncodeState(state interface{}) ([]byte, error) {
+	return json.Marshal(state)
+}
+
+func (v *scriptView) Fold(acc interface{}, evt entity.EntityEvent, vsn uint64) (interface{}, bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	// the state must be a javascript value: values set
+	// by the script on a Go map are not exported
+	b, err := json.Marshal(acc)
+	if err != nil {
+		return nil, true, err
+	}
+	jsAcc, err := v.vm.Call("JSON.parse", nil, string(b))
+	if err != nil {
+		return nil, true, err
+	}
+	return v.fold(jsAcc, evt, vsn)
+}
+
+// NewPredicate compiles a javascript function into a subscription predicate.
+// The function is called with the event name, version and payload, the
+// entity ID and version, and should return true for the events to deliver
+func NewPredicate(src string) (entity.Predicate, error) {
+	vm := otto.New()
+	fn, err := vm.Run(src)
+	if err != nil {
+		return nil, err
+	}
+	if !fn.IsFunction() {
+		return nil, errors.New("Predicate is not a function")
+	}
+	var mu sync.Mutex
+	nullVal := otto.NullValue()
+	return func(evt entity.SubscriptionEvent) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		val, err := fn.Call(nullVal, evt.Event.Type.Name, evt.Event.Type.VSN, evt.Event.Payload, string(evt.ID), evt.VSN)
+		if err != nil {
+			return false, err
+		}
+		return val.ToBoolean()
+	}, nil
+}
+
+// NewUpcaster compiles a javascript function into an upcaster.
+// The function is called with the event payload, and returns the
+// payload of the next event version. Note that javascript arithmetic
+// yields floats, e.g. long fields should be set from integer literals
+func NewUpcaster(src string) (entity.Upcaster, error) {
+	vm := otto.New()
+	fn, err := vm.Run(src)
+	if err != nil {
+		return nil, err
+	}
+	if !fn.IsFunction() {
+		return nil, errors.New("Upcaster is not a function")
+	}
+	var mu sync.Mutex
+	nullVal := otto.NullValue()
+	return func(payload interface{}) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		jsPayload, err := vm.ToValue(payload)
+		if err != nil {
+			return nil, err
+		}
+		val, err := fn.Call(nullVal, jsPayload)
+		if err != nil {
+			return nil, err
+		}
+		return val.Export()
+	}, nil
+}
+
+// Filter is an entity.Filter whose predicate is javascript source,
+// see NewPredicate. Unlike entity.Filter, it can be stored and sent over the wire
+type Filter struct {
+	// EventName matches the event name, if set
+	EventName string
+	// EventVSN matches the event version, if MatchVSN is set
+	MatchVSN bool
+	EventVSN uint64
+	// Since and Until bound the event timestamp, if set
+	Since time.Time
+	Until time.Time
+	// Predicate is the source of a javascript function, called with the
+	// event name, version and payload, the entity ID and version.
+	// If set, only the events for which it returns true are delivered
+	Predicate string
+}
+
+// Compile returns the entity.Filter, compiling the predicate
+func (f Filter) Compile() (out entity.Filter, err error) {
+	out = entity.Filter{
+		EventName: f.EventName,
+		MatchVSN:  f.MatchVSN,
+		EventVSN:  f.EventVSN,
+		Since:     f.Since,
+		Until:     f.Until,
+	}
+	if f.Predicate != "" {
+		out.Predicate, err = NewPredicate(f.Predicate)
+	}
+	return
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/internal/eventino/item"
 	"github.com/cheng81/eventino/internal/eventino/schema"
 	"github.com/cheng81/eventino/internal/eventino/schema/schemaavro"
 	"github.com/dgraph-io/badger"
@@ -236,7 +237,7 @@ func TestView(t *testing.T) {
 				"Name":   "daCheng",
 				"Paying": true,
 			}
-			if _, err = entity.Put(txn, entTyp, entID, schema.NewEventSchemaID("Created", 0), createdRec); err != nil {
+			if _, err = entity.Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Created", 0), createdRec); err != nil {
 				return
 			}
 			updatedRec := map[string]interface{}{
@@ -244,7 +245,7 @@ func TestView(t *testing.T) {
 				"Username": "daCheng",
 				"Useful":   nil,
 			}
-			if _, err = entity.Put(txn, entTyp, entID, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
+			if _, err = entity.Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
 				return
 			}
 			updatedRec = map[string]interface{}{
@@ -252,7 +253,7 @@ func TestView(t *testing.T) {
 				"Username": "daddaCheng",
 				"Useful":   nil,
 			}
-			if _, err = entity.Put(txn, entTyp, entID, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
+			if _, err = entity.Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
 				return
 			}
 
@@ -262,7 +263,7 @@ func TestView(t *testing.T) {
 				"Phone":    "555-5555-55",
 			}
 
-			if _, err = entity.Put(txn, entTyp, entID, schema.NewEventSchemaID("Updated", 1), updatedRec); err != nil {
+			if _, err = entity.Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Updated", 1), updatedRec); err != nil {
 				return
 			}
 
@@ -359,3 +360,111 @@ func mkSchema(db *badger.DB) error {
 		return updateSchema(txn)
 	})
 }
+
+func TestPersistentView(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		entID := []byte("chengg")
+		if err = mkSchema(db); err != nil {
+			t.Fatal("cannot create schema", err)
+		}
+		view, initial, err := NewView(testObj)
+		if err != nil {
+			t.Fatal("cannot compile view", err)
+		}
+		views := entity.NewViews()
+		views.Register("User", "profile", view, initial)
+
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			var entTyp schema.EntityType
+			if entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100); err != nil {
+				return
+			}
+			createdRec := map[string]interface{}{
+				"Name":   "daCheng",
+				"Paying": true,
+			}
+			if _, err = entity.Put(txn, entTyp, entID, item.NotExistsVSN, schema.NewEventSchemaID("Created", 0), createdRec); err != nil {
+				return
+			}
+			updatedRec := map[string]interface{}{
+				"Email":    "daCheng@daCheng.com",
+				"Username": "daCheng",
+				"Useful":   nil,
+			}
+			if _, err = entity.Put(txn, entTyp, entID, item.AnyVSN, schema.NewEventSchemaID("Updated", 0), updatedRec); err != nil {
+				return
+			}
+			return views.Sync(txn, entTyp, entID)
+		})
+		if err != nil {
+			t.Fatal("cannot write", err)
+		}
+
+		err = db.View(func(txn *badger.Txn) (err error) {
+			var entTyp schema.EntityType
+			if entTyp, err = schema.GetEntityType(txn, schemaavro.Factory().Decoder(), "User", 100); err != nil {
+				return
+			}
+			var vsn uint64
+			var state interface{}
+			if vsn, state, err = views.Get(txn, entTyp, entID, "profile"); err != nil {
+				return
+			}
+			if vsn != 2 {
+				t.Fatal("view should be at vsn 2", vsn)
+			}
+			stateMap := state.(map[string]interface{})
+			if stateMap["name"] != "daCheng" {
+				t.Fatal("name not right", stateMap)
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot read", err)
+		}
+		return
+	})
+}
+
+func TestPredicate(t *testing.T) {
+	pred, err := NewPredicate(`(function(name, vsn, payload, id, entVsn) { return name === "Created" && payload.Paying && id === "cheng"; })`)
+	if err != nil {
+		t.Fatal("cannot compile predicate", err)
+	}
+	evt := entity.SubscriptionEvent{
+		EntityType: "User",
+		ID:         []byte("cheng"),
+		Event: entity.EntityEvent{
+			Type:    entity.EntityEventType{Name: "Created", VSN: 0},
+			Payload: map[string]interface{}{"Name": "daCheng", "Paying": true},
+		},
+	}
+	if ok, err := pred(evt); err != nil || !ok {
+		t.Fatal("predicate should match", ok, err)
+	}
+	evt.ID = []byte("other")
+	if ok, err := pred(evt); err != nil || ok {
+		t.Fatal("predicate should not match", ok, err)
+	}
+	if _, err = NewPredicate(`42`); err == nil {
+		t.Fatal("predicate should be a function")
+	}
+}
+
+func TestUpcaster(t *testing.T) {
+	up, err := NewUpcaster(`(function(payload) { return {Name: payload.Name, Plan: payload.Paying ? "paying" : "free", Seats: 1}; })`)
+	if err != nil {
+		t.Fatal("cannot compile upcaster", err)
+	}
+	out, err := up(map[string]interface{}{"Name": "daCheng", "Paying": true})
+	if err != nil {
+		t.Fatal("cannot upcast", err)
+	}
+	outMap := out.(map[string]interface{})
+	if outMap["Name"] != "daCheng" || outMap["Plan"] != "paying" || outMap["Seats"] != int64(1) {
+		t.Fatal("wrong upcasted payload", outMap)
+	}
+	if _, err = NewUpcaster(`42`); err == nil {
+		t.Fatal("upcaster should be a function")
+	}
+}
@@ -0,0 +1,279 @@
+package entity
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cheng81/eventino/internal/eventino"
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/cheng81/eventino/internal/eventino/log"
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/dgraph-io/badger"
+)
+
+// SubscriptionEvent is an entity event delivered by a Subscription
+type SubscriptionEvent struct {
+	EntityType string
+	ID         []byte
+	VSN        uint64
+	Event      EntityEvent
+	// Position is the log EventID of the event, to resume
+	// a subscription after it
+	Position log.EventID
+}
+
+// Predicate is a custom Filter on the events
+type Predicate func(SubscriptionEvent) (bool, error)
+
+// Filter selects the events delivered by SubscribeType.
+// The zero Filter matches every event
+type Filter struct {
+	// EventName matches the event name, if set
+	EventName string
+	// EventVSN matches the event version, if MatchVSN is set
+	MatchVSN bool
+	EventVSN uint64
+	// Since and Until bound the event timestamp, if set.
+	// The subscription ends once the log passes Until
+	Since time.Time
+	Until time.Time
+	// Predicate is called on the events matching the rest of the filter
+	Predicate Predicate
+}
+
+// Match tells whether the event matches the filter
+func (f Filter) Match(evt SubscriptionEvent) (bool, error) {
+	if f.EventName != "" && evt.Event.Type.Name != f.EventName {
+		return false, nil
+	}
+	if f.MatchVSN && evt.Event.Type.VSN != f.EventVSN {
+		return false, nil
+	}
+	if !f.Since.IsZero() && evt.Event.Timestamp.Before(f.Since) {
+		return false, nil
+	}
+	if !f.Until.IsZero() && evt.Event.Timestamp.After(f.Until) {
+		return false, nil
+	}
+	if f.Predicate != nil {
+		return f.Predicate(evt)
+	}
+	return true, nil
+}
+
+// Subscription delivers entity events over a channel,
+// see Subscribe and SubscribeType
+type Subscription struct {
+	watcher *log.Watcher
+	out     chan SubscriptionEvent
+	done    chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// matcher maps the log events to the subscribed entity
+// events, returning false for the events to skip.
+// It returns subscriptionEnded to stop the subscription
+type matcher func(lEvt log.Event) (SubscriptionEvent, bool, error)
+
+// subscriptionEnded stops a Subscription without error
+var subscriptionEnded error
+
+func init() {
+	subscriptionEnded = errors.New("Subscription ended")
+}
+
+// Subscribe returns a Subscription delivering the events of the entity,
+// starting from version fromVsn: the events already in the store first,
+// then the new ones as they are committed through the hub.
+// The entity does not need to exist yet
+func Subscribe(hub *log.Hub, entType schema.EntityType, ID []byte, fromVsn uint64, buffer int) (*Subscription, error) {
+	entID := entType.EntityID(ID)
+	var past []SubscriptionEvent
+	var nextVsn uint64
+	watcher, err := hub.ViewWatch(entID.Type, buffer, func(txn *badger.Txn) (err error) {
+		if nextVsn, err = item.LatestVSN(txn, entID); err == badger.ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return
+		}
+		var itm item.Item
+		if itm, err = item.Get(txn, entID, fromVsn, 0); err != nil {
+			return
+		}
+		for i, evt := range itm.Events {
+			if evt.Kind != eventino.EventKindEntity {
+				continue
+			}
+			entEvt, err := mapEvent(entType, evt)
+			if err == EventVSNNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			past = append(past, SubscriptionEvent{entType.Name, ID, fromVsn + uint64(i), entEvt, evt.LogID})
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	match := func(lEvt log.Event) (out SubscriptionEvent, ok bool, err error) {
+		var evt item.IDEvent
+		if evt, err = item.FromLogEvent(lEvt); err != nil {
+			return
+		}
+		if evt.ID.Type != entID.Type || !bytes.Equal(evt.ID.ID, entID.ID) {
+			return
+		}
+		// every event of the item gets the next version
+		vsn := nextVsn
+		nextVsn++
+		if vsn < fromVsn {
+			return
+		}
+		return subscriptionEvent(entType, ID, vsn, evt.Event)
+	}
+	return newSubscription(watcher, buffer, past, match), nil
+}
+
+// SubscribeType returns a Subscription delivering the events of every
+// entity of the given type matching the filter, after the given log position
+// (e.g. the Position of the last event received by a previous subscription).
+// The events already in the store are delivered first, then the new ones
+// as they are committed through the hub
+func SubscribeType(hub *log.Hub, entType schema.EntityType, filter Filter, after log.EventID, buffer int) *Subscription {
+	pfx := append([]byte(entType.Name), ':')
+	from := log.NewEventID(entType.EntityID(nil).Type, after.Timestamp, after.Index)
+	if !filter.Since.IsZero() && filter.Since.UnixNano() > 0 {
+		since := uint64(filter.Since.UnixNano())
+		if since > from.Timestamp {
+			from = log.NewEventID(from.Prefix, since-1, math.MaxUint16)
+		}
+	}
+	var until uint64
+	if !filter.Until.IsZero() && filter.Until.UnixNano() > 0 {
+		until = uint64(filter.Until.UnixNano())
+	}
+	watcher := hub.Watch(from, buffer)
+
+	match := func(lEvt log.Event) (out SubscriptionEvent, ok bool, err error) {
+		// the log is in timestamp order, no later event can match
+		if until > 0 && lEvt.ID.Timestamp > until {
+			err = subscriptionEnded
+			return
+		}
+		var evt item.IDEvent
+		if evt, err = item.FromLogEvent(lEvt); err != nil {
+			return
+		}
+		if evt.ID.Type != from.Prefix || !bytes.HasPrefix(evt.ID.ID, pfx) {
+			return
+		}
+		// the version is read from the item, the event is committed
+		err = hub.View(func(txn *badger.Txn) (err error) {
+			evt.VSN, err = item.EventVSN(txn, evt.ID, lEvt.ID)
+			return
+		})
+		if err != nil {
+			return
+		}
+		if out, ok, err = subscriptionEvent(entType, evt.ID.ID[len(pfx):], evt.VSN, evt.Event); !ok || err != nil {
+			return
+		}
+		ok, err = filter.Match(out)
+		return
+	}
+	return newSubscription(watcher, buffer, nil, match)
+}
+
+func subscriptionEvent(entType schema.EntityType, ID []byte, vsn uint64, evt item.Event) (SubscriptionEvent, bool, error) {
+	if evt.Kind != eventino.EventKindEntity {
+		return SubscriptionEvent{}, false, nil
+	}
+	entEvt, err := mapEvent(entType, evt)
+	if err == EventVSNNotFound {
+		return SubscriptionEvent{}, false, nil
+	} else if err != nil {
+		return SubscriptionEvent{}, false, err
+	}
+	return SubscriptionEvent{entType.Name, ID, vsn, entEvt, evt.LogID}, true, nil
+}
+
+func newSubscription(watcher *log.Watcher, buffer int, past []SubscriptionEvent, match matcher) *Subscription {
+	s := &Subscription{
+		watcher: watcher,
+		out:     make(chan SubscriptionEvent, buffer),
+		done:    make(chan struct{}),
+	}
+	go s.run(past, match)
+	return s
+}
+
+// Events returns the channel the events are delivered on.
+// The channel is closed when the subscription stops
+func (s *Subscription) Events() <-chan SubscriptionEvent {
+	return s.out
+}
+
+// Err returns the reason the subscription stopped, if any
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.watcher.Close()
+	})
+}
+
+func (s *Subscription) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	s.Close()
+}
+
+func (s *Subscription) run(past []SubscriptionEvent, match matcher) {
+	defer close(s.out)
+	for _, evt := range past {
+		if !s.send(evt) {
+			return
+		}
+	}
+	for lEvt := range s.watcher.Events() {
+		evt, ok, err := match(lEvt)
+		if err == subscriptionEnded {
+			s.Close()
+			return
+		} else if err != nil {
+			s.fail(err)
+			return
+		}
+		if ok && !s.send(evt) {
+			return
+		}
+	}
+	if err := s.watcher.Err(); err != nil && err != log.WatcherClosedError {
+		s.fail(err)
+	}
+}
+
+func (s *Subscription) send(evt SubscriptionEvent) bool {
+	select {
+	case s.out <- evt:
+		return true
+	case <-s.done:
+		return false
+	}
+}
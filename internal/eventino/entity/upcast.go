@@ -0,0 +1,146 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// UpcasterNotFound is returned when presenting an event at a version
+// with no upcaster registered for one of the versions in between
+var UpcasterNotFound error
+
+func init() {
+	UpcasterNotFound = errors.New("Upcaster not found")
+}
+
+// InvalidUpcastError is returned when an upcaster
+// payload is not valid for the next version schema
+type InvalidUpcastError struct {
+	Entity string
+	Event  schema.EventSchemaID
+	Errors []schema.ValidationError
+}
+
+func (e InvalidUpcastError) Error() string {
+	report := make([]string, len(e.Errors))
+	for i, v := range e.Errors {
+		report[i] = v.String()
+	}
+	return fmt.Sprintf("Upcasted payload not valid for event schema %s.%s: %s", e.Entity, e.Event.ToString(), strings.Join(report, "; "))
+}
+
+// Upcaster transforms the payload of an event type
+// version into the payload of the next version
+type Upcaster func(payload interface{}) (interface{}, error)
+
+// Versions selects the versions the events are presented at. ByEvent
+// maps the event names to their version; with Latest, the other
+// events are presented at the latest version of their type.
+// The zero Versions presents the events as they were written
+type Versions struct {
+	Latest  bool
+	ByEvent map[string]uint64
+}
+
+// target returns the version the event should be presented at
+func (v Versions) target(typ schema.EntityType, evtType EntityEventType) uint64 {
+	if vsn, ok := v.ByEvent[evtType.Name]; ok {
+		return vsn
+	}
+	if v.Latest {
+		if latest, ok := typ.LatestEvent(evtType.Name); ok {
+			return latest.VSN
+		}
+	}
+	return evtType.VSN
+}
+
+// Upcasters are the upcasters registered on the entity
+// types, by entity type name, then source event version
+type Upcasters struct {
+	mu     sync.RWMutex
+	byType map[string]map[schema.EventSchemaID]Upcaster
+}
+
+// NewUpcasters returns an empty Upcasters
+func NewUpcasters() *Upcasters {
+	return &Upcasters{byType: map[string]map[schema.EventSchemaID]Upcaster{}}
+}
+
+// Register registers the upcaster of the event type from
+// version vsn to vsn+1. An upcaster already registered is replaced
+func (ups *Upcasters) Register(entTypeName, evtName string, vsn uint64, up Upcaster) {
+	ups.mu.Lock()
+	defer ups.mu.Unlock()
+	byEvent, ok := ups.byType[entTypeName]
+	if !ok {
+		byEvent = map[schema.EventSchemaID]Upcaster{}
+		ups.byType[entTypeName] = byEvent
+	}
+	byEvent[schema.NewEventSchemaID(evtName, vsn)] = up
+}
+
+// Unregister removes the upcaster of the event type from version vsn
+func (ups *Upcasters) Unregister(entTypeName, evtName string, vsn uint64) {
+	ups.mu.Lock()
+	defer ups.mu.Unlock()
+	delete(ups.byType[entTypeName], schema.NewEventSchemaID(evtName, vsn))
+}
+
+func (ups *Upcasters) get(entTypeName string, evtID schema.EventSchemaID) (Upcaster, bool) {
+	if ups == nil {
+		return nil, false
+	}
+	ups.mu.RLock()
+	defer ups.mu.RUnlock()
+	up, ok := ups.byType[entTypeName][evtID]
+	return up, ok
+}
+
+// Upcast presents the event at the given version, applying the upcasters
+// registered from its version on. Events are never downcasted.
+// The upcasted payloads are decoded as if written at their version
+func (ups *Upcasters) Upcast(typ schema.EntityType, evt EntityEvent, vsn uint64) (EntityEvent, error) {
+	for evt.Type.VSN < vsn {
+		evtID := schema.NewEventSchemaID(evt.Type.Name, evt.Type.VSN)
+		up, ok := ups.get(typ.Name, evtID)
+		if !ok {
+			return evt, UpcasterNotFound
+		}
+		next := schema.NewEventSchemaID(evt.Type.Name, evt.Type.VSN+1)
+		scm, ok := typ.Events[next]
+		if !ok {
+			return evt, EventVSNNotFound
+		}
+		payload, err := up(evt.Payload)
+		if err != nil {
+			return evt, err
+		}
+		if errs := scm.Validate(payload); len(errs) > 0 {
+			return evt, InvalidUpcastError{Entity: typ.Name, Event: next, Errors: errs}
+		}
+		// presented as the events written at the next version
+		var b []byte
+		if b, err = scm.Encoder().Encode(payload); err != nil {
+			return evt, err
+		}
+		if payload, err = scm.Decoder().Decode(b); err != nil {
+			return evt, err
+		}
+		evt.Type.VSN, evt.Payload = next.VSN, payload
+	}
+	return evt, nil
+}
+
+func (ups *Upcasters) upcastAll(typ schema.EntityType, evts []EntityEvent, versions Versions) (err error) {
+	for i, evt := range evts {
+		if evts[i], err = ups.Upcast(typ, evt, versions.target(typ, evt.Type)); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -23,8 +23,8 @@ func entityEvt(typ schema.EntityType, evtID schema.EventSchemaID, payload interf
 		err = errors.New("Event not found in Entity schema")
 		return
 	}
-	if !scm.Valid(payload) {
-		err = errors.New("Wrong payload for event schema")
+	if errs := scm.Validate(payload); len(errs) > 0 {
+		err = schema.InvalidPayloadError{Entity: typ.Name, Event: evtID, Errors: errs}
 		return
 	}
 
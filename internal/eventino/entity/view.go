@@ -0,0 +1,152 @@
+package entity
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/dgraph-io/badger"
+)
+
+// ViewNotFound is returned when reading a view
+// not registered on the entity type
+var ViewNotFound error
+
+func init() {
+	ViewNotFound = errors.New("View not found")
+}
+
+// PersistentViewFold is a view on the events of an entity,
+// whose state is stored along the entity
+type PersistentViewFold interface {
+	DecodeState([]byte) (interface{}, error)
+	EncodeState(interface{}) ([]byte, error)
+	Fold(interface{}, EntityEvent, uint64) (interface{}, bool, error)
+}
+
+type registeredView struct {
+	view    PersistentViewFold
+	initial interface{}
+}
+
+// Views are the persistent views registered on the
+// entity types, by entity type name, then view name
+type Views struct {
+	mu     sync.RWMutex
+	byType map[string]map[string]registeredView
+}
+
+// NewViews returns an empty Views
+func NewViews() *Views {
+	return &Views{byType: map[string]map[string]registeredView{}}
+}
+
+// Register registers a persistent view on the entities of the given
+// type, updated by Sync. A view registered with the same name is replaced
+func (vs *Views) Register(entTypeName, name string, view PersistentViewFold, initial interface{}) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	byName, ok := vs.byType[entTypeName]
+	if !ok {
+		byName = map[string]registeredView{}
+		vs.byType[entTypeName] = byName
+	}
+	byName[name] = registeredView{view: view, initial: initial}
+}
+
+// Unregister removes a persistent view. The stored states
+// are kept, and updated again if the view is registered back
+func (vs *Views) Unregister(entTypeName, name string) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	delete(vs.byType[entTypeName], name)
+}
+
+// Names returns the names of the views registered on the entity type
+func (vs *Views) Names(entTypeName string) []string {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	out := make([]string, 0, len(vs.byType[entTypeName]))
+	for name := range vs.byType[entTypeName] {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (vs *Views) get(entTypeName, name string) (registeredView, bool) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	v, ok := vs.byType[entTypeName][name]
+	return v, ok
+}
+
+// Get returns the state of a persistent view of the entity,
+// and the version of the latest event folded into it.
+// If the entity has not been written since the view was registered,
+// the state is computed from the entity events
+func (vs *Views) Get(txn *badger.Txn, entType schema.EntityType, ID []byte, name string) (vsn uint64, state interface{}, err error) {
+	v, ok := vs.get(entType.Name, name)
+	if !ok {
+		err = ViewNotFound
+		return
+	}
+	entID := entType.EntityID(ID)
+	iv := itemView{entType, v.view}
+	if vsn, state, err = item.GetView(txn, entID, []byte(name), iv); err != badger.ErrKeyNotFound {
+		return
+	}
+	if _, err = item.LatestVSN(txn, entID); err != nil {
+		return
+	}
+	if state, vsn, err = item.View(txn, entID, 0, iv.Fold, v.initial); err != nil {
+		return
+	}
+	// the state as if it was stored
+	var b []byte
+	if b, err = v.view.EncodeState(state); err != nil {
+		return
+	}
+	state, err = v.view.DecodeState(b)
+	return
+}
+
+// Sync updates the persistent views registered on the entity type
+// with the events of the entity. It is meant to be called in the
+// transaction of every Put and PutMany
+func (vs *Views) Sync(txn *badger.Txn, entType schema.EntityType, ID []byte) error {
+	vs.mu.RLock()
+	byName := make(map[string]registeredView, len(vs.byType[entType.Name]))
+	for name, v := range vs.byType[entType.Name] {
+		byName[name] = v
+	}
+	vs.mu.RUnlock()
+
+	entID := entType.EntityID(ID)
+	for name, v := range byName {
+		if err := item.SyncPersistentView(txn, entID, []byte(name), itemView{entType, v.view}, v.initial); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// itemView adapts a PersistentViewFold to the item events
+type itemView struct {
+	entType schema.EntityType
+	view    PersistentViewFold
+}
+
+func (v itemView) DecodeState(b []byte) (interface{}, error) {
+	return v.view.DecodeState(b)
+}
+
+func (v itemView) EncodeState(state interface{}) ([]byte, error) {
+	return v.view.EncodeState(state)
+}
+
+func (v itemView) Fold(acc interface{}, evt item.Event, vsn uint64) (interface{}, bool, error) {
+	return itemFold(v.entType, nil, Versions{}, v.view.Fold)(acc, evt, vsn)
+}
@@ -31,6 +31,30 @@ func Create(txn *badger.Txn, ID ItemID) (err error) {
 	return
 }
 
+// Expect checks whether the item is at the expected version,
+// returns a VersionConflictError if it is not
+func Expect(txn *badger.Txn, ID ItemID, expected ExpectedVSN) error {
+	if expected == AnyVSN {
+		return nil
+	}
+	actual := NotExistsVSN
+	exists, err := itemExists(txn, ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		var nextVsn uint64
+		if nextVsn, err = itemVsn(txn, ID); err != nil {
+			return err
+		}
+		actual = ExactVSN(nextVsn - 1)
+	}
+	if actual != expected {
+		return VersionConflictError{ID: ID, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
 // Put adds an event to the item
 func Put(txn *badger.Txn, ID ItemID, evt Event) (vsn uint64, err error) {
 	// wrap event into log.Event
@@ -47,6 +71,25 @@ func Put(txn *badger.Txn, ID ItemID, evt Event) (vsn uint64, err error) {
 	return putItem(txn, ID, logEventID)
 }
 
+// PutMany atomically adds the events to the item. The events share
+// the same log timestamp, and get contiguous versions
+func PutMany(txn *badger.Txn, ID ItemID, evts []Event) (vsns []uint64, logEventIDs []log.EventID, err error) {
+	logEvents := make([]log.Event, len(evts))
+	for i, evt := range evts {
+		// wrap event into log.Event
+		if logEvents[i], err = wrapLogEvent(ID, evt); err != nil {
+			return
+		}
+	}
+	// store in log
+	if logEventIDs, err = log.PutBatch(txn, ID.Type, logEvents); err != nil {
+		return
+	}
+	// add events ptrs
+	vsns, err = putItemMany(txn, ID, logEventIDs)
+	return
+}
+
 // Get retrieves an item matching from-to versions
 func Get(txn *badger.Txn, ID ItemID, fromVsn uint64, toVsn uint64) (out Item, err error) {
 	out = Item{
@@ -212,6 +255,45 @@ func LatestVSN(txn *badger.Txn, ID ItemID) (out uint64, err error) {
 	return itemVsn(txn, ID)
 }
 
+// EventLogID returns the log event ID of the item event at the given
+// version, badger.ErrKeyNotFound if there is no such event
+func EventLogID(txn *badger.Txn, ID ItemID, vsn uint64) (out log.EventID, err error) {
+	var item *badger.Item
+	if item, err = txn.Get(ID.KeyEventVsn(vsn)); err != nil {
+		return
+	}
+	var val []byte
+	if val, err = item.Value(); err != nil {
+		return
+	}
+	err = log.DecodeEventID(val, &out)
+	return
+}
+
+// List returns the IDs of the items of the given type
+// whose ID starts with idPrefix
+func List(txn *badger.Txn, itemType uint8, idPrefix []byte) (out []ItemID, err error) {
+	pfx := NewItemID(itemType, idPrefix).KeyVSN()
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	iter := txn.NewIterator(opts)
+	defer iter.Close()
+	for iter.Seek(pfx); iter.ValidForPrefix(pfx); iter.Next() {
+		// KeyVSN is [PfxItem][type][itemKeyVSN][ID], the other keys of the
+		// items whose ID starts with itemKeyVSN share the prefix: an item
+		// has the event at version 0
+		k := iter.Item().Key()
+		ID := NewItemID(itemType, append([]byte{}, k[3:]...))
+		if _, err = txn.Get(ID.KeyEventVsn(0)); err == badger.ErrKeyNotFound {
+			continue
+		} else if err != nil {
+			return
+		}
+		out = append(out, ID)
+	}
+	return out, nil
+}
+
 // GetByAlias retrieves an item from the given aliasID
 func GetByAlias(txn *badger.Txn, aliasID ItemID, fromVsn uint64, toVsn uint64) (out Item, err error) {
 	var srcID ItemID
@@ -250,7 +332,8 @@ func SyncPersistentView(txn *badger.Txn, ID ItemID, stateName []byte,
 	var item *badger.Item
 	var val []byte
 	var state interface{}
-	var vsn uint64
+	var from, vsn uint64
+	var folded bool
 	var wire viewWire
 
 	k = ID.KeyView(stateName)
@@ -258,16 +341,19 @@ func SyncPersistentView(txn *badger.Txn, ID ItemID, stateName []byte,
 		return
 	}
 	if err == badger.ErrKeyNotFound {
-		if item, err = txn.Get(ID.KeyViews()); err != nil {
-			return
-		}
-		if val, err = item.Value(); err != nil {
-			return
-		}
+		// the items put without Create have no views yet
 		var views [][]byte
-		if err = decode(val, &views); err != nil {
+		if item, err = txn.Get(ID.KeyViews()); err != nil && err != badger.ErrKeyNotFound {
 			return
 		}
+		if err == nil {
+			if val, err = item.Value(); err != nil {
+				return
+			}
+			if err = decode(val, &views); err != nil {
+				return
+			}
+		}
 		views = append(views, stateName)
 		if val, err = encode(views); err != nil {
 			return
@@ -276,7 +362,9 @@ func SyncPersistentView(txn *badger.Txn, ID ItemID, stateName []byte,
 			return
 		}
 		wire.Vsn = 0
-		wire.View = view.EncodeState(initial)
+		if wire.View, err = view.EncodeState(initial); err != nil {
+			return
+		}
 	} else {
 		if val, err = item.Value(); err != nil {
 			return
@@ -284,21 +372,29 @@ func SyncPersistentView(txn *badger.Txn, ID ItemID, stateName []byte,
 		if err = decode(val, &wire); err != nil {
 			return
 		}
-		wire.Vsn++
+		from = wire.Vsn + 1
 	}
 
 	fmt.Println("loading state")
-	vsn = wire.Vsn
 	if state, err = view.DecodeState(wire.View); err != nil {
 		return
 	}
 
-	if state, vsn, err = View(txn, ID, vsn, view.Fold, state); err != nil {
+	fold := func(acc interface{}, evt Event, v uint64) (interface{}, bool, error) {
+		folded = true
+		return view.Fold(acc, evt, v)
+	}
+	if state, vsn, err = View(txn, ID, from, fold, state); err != nil {
 		return
 	}
 
-	wire.Vsn = vsn
-	wire.View = view.EncodeState(state)
+	// keep the version of the last folded event
+	if folded {
+		wire.Vsn = vsn
+	}
+	if wire.View, err = view.EncodeState(state); err != nil {
+		return
+	}
 	if val, err = encode(wire); err != nil {
 		return
 	}
@@ -350,7 +446,8 @@ func View(txn *badger.Txn, ID ItemID, fromVsn uint64, fold ViewFoldFunc, initial
 	return
 }
 
-// RangePrefix loads from the log a chunk of item events, matching a given item prefix
+// RangePrefix loads from the log a chunk of item events, matching a given item prefix.
+// Only the log partition of the item type is read
 func RangePrefix(txn *badger.Txn, itemPfx ItemID, from, to log.EventID, max int) ([]IDEvent, *log.EventID, error) {
 	// make a filter & map function
 	folder := log.EventFolder(func(acc interface{}, lEvtID log.EventID, lEvt log.Event) (interface{}, error) {
@@ -360,8 +457,13 @@ func RangePrefix(txn *badger.Txn, itemPfx ItemID, from, to log.EventID, max int)
 		}
 		id := evt.ID
 		if id.Type == itemPfx.Type && bytes.HasPrefix(id.ID, itemPfx.ID) {
+			vsn, err := EventVSN(txn, id, lEvt.ID)
+			if err != nil {
+				return nil, err
+			}
 			elm := IDEvent{
 				ID:    evt.ID,
+				VSN:   vsn,
 				Event: Event{LogID: lEvt.ID, Kind: lEvt.Meta, Type: evt.EventType, Payload: evt.Payload},
 			}
 			return append(acc.([]IDEvent), elm), nil
@@ -369,13 +471,55 @@ func RangePrefix(txn *badger.Txn, itemPfx ItemID, from, to log.EventID, max int)
 		return acc, nil
 	})
 
-	acc, lastEvtID, err := log.Fold(txn, from, to, max, folder, []IDEvent{})
+	acc, lastEvtID, err := log.FoldScope(txn, log.Partition(itemPfx.Type), from, to, max, folder, []IDEvent{})
 	if err != nil {
 		return nil, nil, err
 	}
 	return acc.([]IDEvent), lastEvtID, err
 }
 
+// FromLogEvent decodes an item event read from the log,
+// e.g. by a log.Watcher. The log event does not carry the item version:
+// IDEvent.VSN is left to 0, see EventVSN
+func FromLogEvent(lEvt log.Event) (IDEvent, error) {
+	evt, err := unwrapLogEventWire(lEvt)
+	if err != nil {
+		return IDEvent{}, err
+	}
+	return IDEvent{
+		ID:    evt.ID,
+		Event: Event{LogID: lEvt.ID, Kind: lEvt.Meta, Type: evt.EventType, Payload: evt.Payload},
+	}, nil
+}
+
+// EventVSN returns the version of the item event stored in the log
+// at the given position. The versions of an item point to increasing
+// log positions, hence the binary search on the item event keys
+func EventVSN(txn *badger.Txn, ID ItemID, logID log.EventID) (vsn uint64, err error) {
+	var next uint64
+	if next, err = itemVsn(txn, ID); err != nil {
+		return
+	}
+	lo, hi := uint64(0), next
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		var eid log.EventID
+		if eid, err = EventLogID(txn, ID, mid); err != nil {
+			return
+		}
+		if eid == logID {
+			return mid, nil
+		}
+		if eid.Before(logID) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	err = ItemNotFoundError
+	return
+}
+
 // Replicate applies the changes specified in the log.EventReplica
 // to the item layer. It will not add the event to the log,
 // caller should ensure to write the event to the log.
@@ -296,9 +296,9 @@ func TestView(t *testing.T) {
 
 type testView struct{}
 
-func (tv testView) EncodeState(v interface{}) []byte {
+func (tv testView) EncodeState(v interface{}) ([]byte, error) {
 	fmt.Println("ENCODING", v)
-	return []byte(fmt.Sprintf("%d", v.(int)))
+	return []byte(fmt.Sprintf("%d", v.(int))), nil
 }
 func (tv testView) DecodeState(v []byte) (interface{}, error) {
 	var out int
@@ -468,3 +468,62 @@ func createItem(txn *badger.Txn, id ItemID, events [][]string) (err error) {
 	}
 	return
 }
+
+func TestPutMany(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		id := NewItemID(0, []byte("foobar"))
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			if err = Create(txn, id); err != nil {
+				return
+			}
+			evts := []Event{
+				NewEvent(0, []byte("evt.0"), []byte("0")),
+				NewEvent(0, []byte("evt.1"), []byte("1")),
+				NewEvent(0, []byte("evt.2"), []byte("2")),
+			}
+			var vsns []uint64
+			var eids []log.EventID
+			if vsns, eids, err = PutMany(txn, id, evts); err != nil {
+				return
+			}
+			for i := range evts {
+				if vsns[i] != uint64(i+1) {
+					t.Fatal("wrong vsn", i, vsns[i])
+				}
+				if eids[i].Timestamp != eids[0].Timestamp {
+					t.Fatal("events should share the timestamp", eids)
+				}
+				if eids[i].Index != eids[0].Index+uint16(i) {
+					t.Fatal("events should have contiguous indices", eids)
+				}
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("Cannot write", err)
+		}
+
+		err = db.View(func(txn *badger.Txn) (err error) {
+			var item Item
+			if item, err = Get(txn, id, 0, 0); err != nil {
+				return
+			}
+			if item.LatestVsn != 3 {
+				t.Fatal("latest vsn should be 3", item.LatestVsn)
+			}
+			if len(item.Events) != 4 {
+				t.Fatal("item should have 4 events", len(item.Events))
+			}
+			for i := 1; i < 4; i++ {
+				if string(item.Events[i].Payload) != fmt.Sprintf("%d", i-1) {
+					t.Fatal("wrong event payload", i, string(item.Events[i].Payload))
+				}
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("Cannot read", err)
+		}
+		return
+	})
+}
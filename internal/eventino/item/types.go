@@ -2,6 +2,7 @@ package item
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/cheng81/eventino/internal/eventino"
 	"github.com/cheng81/eventino/internal/eventino/log"
@@ -29,9 +30,46 @@ type Item struct {
 	Events    []Event
 }
 
+// ExpectedVSN is the version an item is expected to be at
+// when writing to it: either an exact version (the version of
+// its latest event), AnyVSN or NotExistsVSN
+type ExpectedVSN int64
+
+const (
+	// AnyVSN skips the version check
+	AnyVSN ExpectedVSN = -1
+	// NotExistsVSN expects the item not to exist
+	NotExistsVSN ExpectedVSN = -2
+)
+
+// VersionConflictError is returned when an item is not
+// at the expected version
+type VersionConflictError struct {
+	ID       ItemID
+	Expected ExpectedVSN
+	// Actual is the version of the item, NotExistsVSN if it does not exist
+	Actual ExpectedVSN
+}
+
+func (e VersionConflictError) Error() string {
+	return fmt.Sprintf("Version conflict on item %s: expected %s, got %s", string(e.ID.ID), e.Expected, e.Actual)
+}
+
+func (v ExpectedVSN) String() string {
+	switch v {
+	case AnyVSN:
+		return "any version"
+	case NotExistsVSN:
+		return "not exists"
+	}
+	return fmt.Sprintf("version %d", int64(v))
+}
+
 // IDEvent is an event in a Range* query
 type IDEvent struct {
-	ID    ItemID
+	ID ItemID
+	// VSN is the item version of the event
+	VSN   uint64
 	Event Event
 }
 
@@ -42,7 +80,7 @@ type ViewFoldFunc func(interface{}, Event, uint64) (interface{}, bool, error)
 
 type PersistentViewFold interface {
 	DecodeState([]byte) (interface{}, error)
-	EncodeState(interface{}) []byte
+	EncodeState(interface{}) ([]byte, error)
 	Fold(interface{}, Event, uint64) (interface{}, bool, error)
 }
 
@@ -54,6 +54,11 @@ func NewItemID(itemType uint8, id []byte) ItemID {
 	return ItemID{Type: itemType, ID: id}
 }
 
+// ExactVSN expects the item latest event to be at the given version
+func ExactVSN(vsn uint64) ExpectedVSN {
+	return ExpectedVSN(vsn)
+}
+
 func NewEvent(kind byte, eType []byte, payload []byte) Event {
 	return Event{Kind: kind, Type: eType, Payload: payload}
 }
@@ -206,6 +211,25 @@ func putItem(txn *badger.Txn, ID ItemID, eid log.EventID) (vsn uint64, err error
 	return
 }
 
+func putItemMany(txn *badger.Txn, ID ItemID, eids []log.EventID) (vsns []uint64, err error) {
+	// get the vsn
+	var vsn uint64
+	if vsn, err = itemVsn(txn, ID); err != nil {
+		return
+	}
+	// set the versions to the event pointers
+	vsns = make([]uint64, len(eids))
+	for i, eid := range eids {
+		vsns[i] = vsn + uint64(i)
+		if err = txn.Set(ID.KeyEventVsn(vsns[i]), eid.Encode()); err != nil {
+			return
+		}
+	}
+	// set next version
+	err = setUint64(txn, ID.KeyVSN(), vsn+uint64(len(eids)))
+	return
+}
+
 func itemVsn(txn *badger.Txn, ID ItemID) (out uint64, err error) {
 	k := ID.KeyVSN()
 
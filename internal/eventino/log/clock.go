@@ -0,0 +1,159 @@
+package log
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+// Clock assigns the timestamp of new events
+type Clock interface {
+	// Now returns a timestamp
+	Now() uint64
+	// Read returns the current timestamp, without advancing the
+	// clock: for read bounds, which are not event timestamps
+	Read() uint64
+	// Observe notifies the clock of a timestamp found in the log,
+	// e.g. when replicating or importing an event
+	Observe(ts uint64)
+}
+
+// clock is used by Put to timestamp events, guarded by clockMu
+var (
+	clockMu sync.RWMutex
+	clock   Clock
+)
+
+func init() {
+	clock = NewHybridClock(wallClock)
+}
+
+func currentClock() Clock {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return clock
+}
+
+func wallClock() uint64 {
+	return uint64(time.Now().UnixNano())
+}
+
+// SetClock replaces the clock used to timestamp events,
+// and returns the previous one
+func SetClock(c Clock) Clock {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	prev := clock
+	clock = c
+	return prev
+}
+
+// SeedClock makes the clock observe the latest event in the log,
+// so that new events are put after every event already in the store
+func SeedClock(txn *badger.Txn) error {
+	eid, found, err := Latest(txn)
+	if err != nil || !found {
+		return err
+	}
+	currentClock().Observe(eid.Timestamp)
+	return nil
+}
+
+// Latest returns the EventID of the latest event in the log, across all partitions
+func Latest(txn *badger.Txn) (EventID, bool, error) {
+	evts, _, err := RangeScope(txn, AllPartitions().Reversed(),
+		NewEventID(0, 0, 0), NewEventID(math.MaxUint8, math.MaxUint64, math.MaxUint16), 1)
+	if err != nil || len(evts) == 0 {
+		return EventID{}, false, err
+	}
+	return evts[0].ID, true, nil
+}
+
+// HybridClock follows the physical clock, but never goes
+// back: if the physical clock is behind the latest returned
+// or observed timestamp, the latter is increased instead
+type HybridClock struct {
+	mu       sync.Mutex
+	last     uint64
+	physical func() uint64
+}
+
+// NewHybridClock returns a HybridClock on top of the given physical clock
+func NewHybridClock(physical func() uint64) *HybridClock {
+	return &HybridClock{physical: physical}
+}
+
+// Now returns a timestamp bigger than any previously returned or observed one
+func (c *HybridClock) Now() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts := c.physical()
+	if ts <= c.last {
+		ts = c.last + 1
+	}
+	c.last = ts
+	return ts
+}
+
+// Read returns the physical time, or the latest returned
+// or observed timestamp if the physical clock is behind
+func (c *HybridClock) Read() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ts := c.physical(); ts > c.last {
+		return ts
+	}
+	return c.last
+}
+
+// Observe ensures the next timestamps are bigger than ts
+func (c *HybridClock) Observe(ts uint64) {
+	c.mu.Lock()
+	if ts > c.last {
+		c.last = ts
+	}
+	c.mu.Unlock()
+}
+
+// FakeClock is a manually driven clock, for tests.
+// It can be used directly, or as physical clock of a HybridClock
+type FakeClock struct {
+	mu sync.Mutex
+	ts uint64
+}
+
+// NewFakeClock returns a FakeClock set at ts
+func NewFakeClock(ts uint64) *FakeClock {
+	return &FakeClock{ts: ts}
+}
+
+// Now returns the current fake time
+func (c *FakeClock) Now() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ts
+}
+
+// Read returns the current fake time
+func (c *FakeClock) Read() uint64 {
+	return c.Now()
+}
+
+// Observe is a no-op: the fake time only changes with Set and Advance
+func (c *FakeClock) Observe(uint64) {}
+
+// Set sets the fake time
+func (c *FakeClock) Set(ts uint64) {
+	c.mu.Lock()
+	c.ts = ts
+	c.mu.Unlock()
+}
+
+// Advance moves the fake time forward
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.ts += uint64(d)
+	c.mu.Unlock()
+}
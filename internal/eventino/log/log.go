@@ -1,20 +1,24 @@
 package log
 
 import (
-	"time"
+	"math"
 
-	"github.com/cheng81/eventino/internal/eventino"
 	"github.com/dgraph-io/badger"
 )
 
-// Put inserts an event in the log
+// Put inserts an event in the log, timestamped by the log Clock
 func Put(txn *badger.Txn, eventIDPrefix uint8, event Event) (out EventID, err error) {
-	return PutUnsafe(txn, eventIDPrefix, uint64(time.Now().UnixNano()), event)
+	return putAt(txn, eventIDPrefix, currentClock().Now(), event)
 }
 
 // PutUnsafe inserts an event in the log at ts timestamp.
 // Only use for initial data dump
 func PutUnsafe(txn *badger.Txn, prefix uint8, ts uint64, event Event) (out EventID, err error) {
+	currentClock().Observe(ts)
+	return putAt(txn, prefix, ts, event)
+}
+
+func putAt(txn *badger.Txn, prefix uint8, ts uint64, event Event) (out EventID, err error) {
 	// instantiate the key
 	out = NewEventID(prefix, ts, 0)
 	// search for a free spot
@@ -32,15 +36,60 @@ func PutUnsafe(txn *badger.Txn, prefix uint8, ts uint64, event Event) (out Event
 		return out, err
 	}
 	// set the event
-	err = txn.SetWithMeta(key, event.Payload, event.Meta)
+	if err = txn.SetWithMeta(key, event.Payload, event.Meta); err != nil {
+		return
+	}
+	event.ID = out
+	record(txn, event)
 	return
 }
 
+// PutBatch inserts the events in the log at the same timestamp,
+// with contiguous indices
+func PutBatch(txn *badger.Txn, prefix uint8, events []Event) (out []EventID, err error) {
+	if len(events) > math.MaxUint16+1 {
+		return nil, BatchTooBigError
+	}
+	ts := currentClock().Now()
+	// search for a free spot, large enough for the batch
+	var start uint16
+	for i := 0; i < len(events); i++ {
+		idx := int(start) + i
+		if idx > math.MaxUint16 {
+			return nil, BatchTooBigError
+		}
+		_, err = txn.Get(NewEventID(prefix, ts, uint16(idx)).Encode())
+		if err == nil {
+			start = uint16(idx + 1)
+			i = -1
+			continue
+		}
+		if err != badger.ErrKeyNotFound {
+			return nil, err
+		}
+	}
+	out = make([]EventID, len(events))
+	for i, event := range events {
+		out[i] = NewEventID(prefix, ts, start+uint16(i))
+		if err = txn.SetWithMeta(out[i].Encode(), event.Payload, event.Meta); err != nil {
+			return nil, err
+		}
+		event.ID = out[i]
+		record(txn, event)
+	}
+	return out, nil
+}
+
 // Replicate should only be used when the eventino instance is in
 // replica mode - it inserts the event at the precise timestamp/index
 // parameters
 func Replicate(txn *badger.Txn, event Event) error {
-	return txn.SetWithMeta(event.ID.Encode(), event.Payload, event.Meta)
+	currentClock().Observe(event.ID.Timestamp)
+	if err := txn.SetWithMeta(event.ID.Encode(), event.Payload, event.Meta); err != nil {
+		return err
+	}
+	record(txn, event)
+	return nil
 }
 
 // Get retrieve the event at the specified index
@@ -53,17 +102,18 @@ func Get(txn *badger.Txn, eid EventID) (out Event, err error) {
 	return decodeEvent(item)
 }
 
-// Range retrieve a chunk of events from the log
+// Range retrieve a chunk of events from the log partition of from,
+// the Prefix of to is ignored. See RangeScope to read more partitions
 func Range(txn *badger.Txn, from EventID, to EventID, max int) ([]Event, *EventID, error) {
 	// out := make([]Event, max)
 	var out []Event
 	var nextEventID *EventID
 	var err error
 
-	pfx := from.Encode()
+	pfx, part := from.Encode(), partitionKey(from.Prefix)
 	iter := txn.NewIterator(badger.DefaultIteratorOptions)
 	defer iter.Close()
-	for iter.Seek(pfx); iter.ValidForPrefix([]byte{eventino.PfxLog}); iter.Next() {
+	for iter.Seek(pfx); iter.ValidForPrefix(part); iter.Next() {
 		item := iter.Item()
 		eid := EventID{}
 		err = DecodeEventID(item.Key(), &eid)
@@ -90,8 +140,8 @@ func Range(txn *badger.Txn, from EventID, to EventID, max int) ([]Event, *EventI
 	return out, nextEventID, err
 }
 
-// Fold applies a function to a chunk of events, returning the latest output, and a next EventID in case
-// a maximum amount of events is read
+// Fold applies a function to a chunk of events of the log partition of from, returning the latest output,
+// and a next EventID in case a maximum amount of events is read. See FoldScope to fold more partitions
 func Fold(txn *badger.Txn, from EventID, to EventID, max int, f EventFolder, init interface{}) (interface{}, *EventID, error) {
 	var nextEventID *EventID
 	var err error
@@ -99,11 +149,11 @@ func Fold(txn *badger.Txn, from EventID, to EventID, max int, f EventFolder, ini
 	var out interface{} = init
 	var ctr int
 
-	pfx := from.Encode()
+	pfx, part := from.Encode(), partitionKey(from.Prefix)
 	iter := txn.NewIterator(badger.DefaultIteratorOptions)
 	defer iter.Close()
 
-	for iter.Seek(pfx); iter.ValidForPrefix([]byte{eventino.PfxLog}); iter.Next() {
+	for iter.Seek(pfx); iter.ValidForPrefix(part); iter.Next() {
 		item := iter.Item()
 		eid := EventID{}
 		if err = DecodeEventID(item.Key(), &eid); err != nil {
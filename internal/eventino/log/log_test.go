@@ -141,8 +141,8 @@ func TestReplicate(t *testing.T) {
 
 		err = db.View(func(txn *badger.Txn) (err error) {
 			var nextID *EventID
-			from := NewEventID(0, ts, 0)
-			to := NewEventIDNow(0)
+			from := NewEventID(1, ts, 0)
+			to := NewEventIDNow(1)
 			events, nextID, err := Range(txn, from, to, 100)
 			if nextID != nil {
 				t.Fatal("nextID should be nil", nextID)
@@ -150,6 +150,9 @@ func TestReplicate(t *testing.T) {
 			if err != nil {
 				return
 			}
+			if len(events) != 10 {
+				t.Fatal("not loaded enough events", len(events))
+			}
 			for idx, event := range events {
 				if event.ID.Prefix != 1 {
 					t.Fatal("wrong ID prefix", event.ID.Prefix, 1)
@@ -269,6 +272,7 @@ func TestOrderPrefix(t *testing.T) {
 		if err != nil {
 			t.Fatal("cannot write", err)
 		}
+		// a range never reads past its partition
 		var events []Event
 		err = db.View(func(txn *badger.Txn) (err error) {
 			events, _, err = Range(txn,
@@ -279,14 +283,26 @@ func TestOrderPrefix(t *testing.T) {
 		if err != nil {
 			t.Fatal("cannot read", err)
 		}
-		if len(events) != 2 {
-			t.Fatal("loaded != 2 events", len(events))
+		if len(events) != 1 {
+			t.Fatal("loaded != 1 events", len(events))
 		}
 		if string(events[0].Payload) != "second" {
 			t.Fatal("0.payload is not 'second'", string(events[0].Payload))
 		}
-		if string(events[1].Payload) != "first" {
-			t.Fatal("1.payload is not 'first'", string(events[1].Payload))
+		err = db.View(func(txn *badger.Txn) (err error) {
+			events, _, err = Range(txn,
+				NewEventID(1, ts, 0),
+				NewEventID(1, uint64(time.Now().UnixNano()), 0), 100)
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot read", err)
+		}
+		if len(events) != 1 {
+			t.Fatal("loaded != 1 events", len(events))
+		}
+		if string(events[0].Payload) != "first" {
+			t.Fatal("0.payload is not 'first'", string(events[0].Payload))
 		}
 
 		return
@@ -344,3 +360,344 @@ func TestMatch(t *testing.T) {
 		return
 	})
 }
+
+func TestWatch(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		hub := NewHub(db)
+		put := func(from, to int) {
+			err := hub.Update(func(txn *badger.Txn) (err error) {
+				for i := from; i < to; i++ {
+					if _, err = Put(txn, 1, Event{Meta: 2, Payload: []byte(fmt.Sprintf("%d", i))}); err != nil {
+						return
+					}
+				}
+				// other partitions are not delivered
+				_, err = Put(txn, 0, Event{Meta: 2, Payload: []byte("other")})
+				return
+			})
+			if err != nil {
+				t.Fatal("cannot write", err)
+			}
+		}
+		expect := func(w *Watcher, from, to int) {
+			for i := from; i < to; i++ {
+				select {
+				case evt := <-w.Events():
+					if string(evt.Payload) != fmt.Sprintf("%d", i) {
+						t.Fatalf("expected %d but got %s instead", i, string(evt.Payload))
+					}
+				case <-time.After(time.Second):
+					t.Fatal("timeout waiting for event", i)
+				}
+			}
+		}
+
+		put(0, 5)
+		w := hub.Watch(NewEventID(1, 0, 0), 100)
+		// catch up
+		expect(w, 0, 5)
+		// live
+		put(5, 10)
+		expect(w, 5, 10)
+
+		// a slow consumer re-reads from the log
+		slow := hub.Watch(NewEventID(1, 0, 0), 1)
+		put(10, 50)
+		expect(slow, 0, 50)
+		expect(w, 10, 50)
+
+		w.Close()
+		slow.Close()
+		if _, ok := <-w.Events(); ok {
+			t.Fatal("events channel should be closed")
+		}
+		if w.Err() != WatcherClosedError {
+			t.Fatal("watcher should be closed", w.Err())
+		}
+		return
+	})
+}
+
+func TestWatchCommitOrder(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		hub := NewHub(db)
+		w := hub.Watch(NewEventID(1, 0, 0), 10)
+		defer w.Close()
+
+		// the second writer starts once the first one has its timestamp
+		stamped := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- hub.Update(func(txn *badger.Txn) (err error) {
+				_, err = Put(txn, 1, Event{Meta: 2, Payload: []byte("first")})
+				close(stamped)
+				time.Sleep(50 * time.Millisecond)
+				return
+			})
+		}()
+		<-stamped
+		go func() {
+			done <- hub.Update(func(txn *badger.Txn) (err error) {
+				_, err = Put(txn, 1, Event{Meta: 2, Payload: []byte("second")})
+				return
+			})
+		}()
+		for i := 0; i < 2; i++ {
+			if err = <-done; err != nil {
+				t.Fatal("cannot write", err)
+			}
+		}
+
+		var prev EventID
+		for _, expected := range []string{"first", "second"} {
+			select {
+			case evt := <-w.Events():
+				if string(evt.Payload) != expected || evt.ID.Before(prev) {
+					t.Fatalf("expected %s after %+v, got %s at %+v", expected, prev, string(evt.Payload), evt.ID)
+				}
+				prev = evt.ID
+			case <-time.After(time.Second):
+				t.Fatal("timeout waiting for", expected)
+			}
+		}
+		return
+	})
+}
+
+func TestViewWatchAll(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		hub := NewHub(db)
+		put := func(prefix uint8, from, to int) {
+			err := hub.Update(func(txn *badger.Txn) (err error) {
+				for i := from; i < to; i++ {
+					if _, err = Put(txn, prefix, Event{Meta: 2, Payload: []byte(fmt.Sprintf("%d", i))}); err != nil {
+						return
+					}
+				}
+				return
+			})
+			if err != nil {
+				t.Fatal("cannot write", err)
+			}
+		}
+		expect := func(w *Watcher, from, to int) {
+			for i := from; i < to; i++ {
+				select {
+				case evt := <-w.Events():
+					if string(evt.Payload) != fmt.Sprintf("%d", i) {
+						t.Fatalf("expected %d but got %s instead", i, string(evt.Payload))
+					}
+				case <-time.After(time.Second):
+					t.Fatal("timeout waiting for event", i)
+				}
+			}
+		}
+
+		put(0, 0, 5)
+		var seen int
+		w, err := hub.ViewWatchAll(1, func(txn *badger.Txn) (err error) {
+			var positions []EventID
+			positions, err = Positions(txn)
+			seen = len(positions)
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot watch", err)
+		}
+		defer w.Close()
+		if seen != 1 {
+			t.Fatal("snapshot should hold a single partition", seen)
+		}
+		// live events of every partition, re-read from the log when lagging
+		put(1, 5, 10)
+		put(0, 10, 20)
+		put(7, 20, 25)
+		expect(w, 5, 25)
+		return
+	})
+}
+
+func TestWaitFor(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		hub := NewHub(db)
+		var pos EventID
+		pos, err = hub.UpdatePosition(func(txn *badger.Txn) (err error) {
+			for i := 0; i < 3; i++ {
+				if _, err = Put(txn, 1, Event{Meta: 2, Payload: []byte(fmt.Sprintf("%d", i))}); err != nil {
+					return
+				}
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot write", err)
+		}
+		err = db.View(func(txn *badger.Txn) error {
+			latest, _, err := Position(txn, 1)
+			if latest != pos {
+				t.Fatal("position should be the last event written", pos, latest)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal("cannot read", err)
+		}
+		if err = hub.WaitFor(pos, 0); err != nil {
+			t.Fatal("committed position should be reached", err)
+		}
+
+		// a position replicated later on
+		next := NewEventID(1, pos.Timestamp+10, 0)
+		if err = hub.WaitFor(next, 10*time.Millisecond); err != PositionTimeoutError {
+			t.Fatal("missing position should time out", err)
+		}
+		replicate := func(ts uint64) {
+			time.Sleep(50 * time.Millisecond)
+			hub.Update(func(txn *badger.Txn) error {
+				return Replicate(txn, Event{Meta: 2, ID: NewEventID(1, ts, 0), Payload: []byte("x")})
+			})
+		}
+		go replicate(pos.Timestamp + 20)
+		if err = hub.WaitFor(next, 200*time.Millisecond); err != PositionTimeoutError {
+			t.Fatal("a later event should not reach the position", err)
+		}
+		go replicate(pos.Timestamp + 10)
+		if err = hub.WaitFor(next, time.Second); err != nil {
+			t.Fatal("the event should reach the position", err)
+		}
+		return
+	})
+}
+
+func TestRangeScope(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		// events alternate between partition 0 and 1
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			for i := 0; i < 10; i++ {
+				if _, err = PutUnsafe(txn, uint8(i%2), uint64(100+i), Event{Meta: 2, Payload: []byte(fmt.Sprintf("%d", i))}); err != nil {
+					return
+				}
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot write", err)
+		}
+		payloads := func(evts []Event) (out string) {
+			for _, evt := range evts {
+				out += string(evt.Payload)
+			}
+			return
+		}
+		from := NewEventID(0, 100, 0)
+		to := NewEventID(0, 200, 0)
+		err = db.View(func(txn *badger.Txn) (err error) {
+			var prefixes []uint8
+			if prefixes, err = Partitions(txn); err != nil {
+				return
+			}
+			if len(prefixes) != 2 || prefixes[0] != 0 || prefixes[1] != 1 {
+				t.Fatal("partitions should be [0 1]", prefixes)
+			}
+
+			var evts []Event
+			var next *EventID
+			if evts, _, err = RangeScope(txn, Partition(0), from, to, 100); err != nil {
+				return
+			}
+			if p := payloads(evts); p != "02468" {
+				t.Fatal("partition 0 should be 02468", p)
+			}
+			if evts, _, err = RangeScope(txn, Partition(1).Reversed(), from, to, 100); err != nil {
+				return
+			}
+			if p := payloads(evts); p != "97531" {
+				t.Fatal("reversed partition 1 should be 97531", p)
+			}
+			if evts, next, err = RangeScope(txn, AllPartitions(), from, to, 4); err != nil {
+				return
+			}
+			if p := payloads(evts); p != "0123" {
+				t.Fatal("all partitions should be 0123", p)
+			}
+			if next == nil || next.Timestamp != 104 {
+				t.Fatal("next should be at ts 104", next)
+			}
+			if evts, _, err = RangeScope(txn, AllPartitions(), *next, to, 100); err != nil {
+				return
+			}
+			if p := payloads(evts); p != "456789" {
+				t.Fatal("all partitions from next should be 456789", p)
+			}
+			if evts, _, err = RangeScope(txn, AllPartitions().Reversed(), NewEventID(0, 103, 0), NewEventID(0, 106, 0), 100); err != nil {
+				return
+			}
+			if p := payloads(evts); p != "6543" {
+				t.Fatal("reversed all partitions should be 6543", p)
+			}
+			m := func(eid EventID, evt Event) bool { return eid.Timestamp%3 == 0 }
+			if evts, _, err = RangeMatchScope(txn, AllPartitions(), from, to, 100, m); err != nil {
+				return
+			}
+			if p := payloads(evts); p != "258" {
+				t.Fatal("matching all partitions should be 258", p)
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot read", err)
+		}
+		return
+	})
+}
+
+func TestHybridClock(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		fake := NewFakeClock(1000)
+		prev := SetClock(NewHybridClock(fake.Now))
+		defer SetClock(prev)
+
+		var ids []EventID
+		put := func() {
+			err := db.Update(func(txn *badger.Txn) (err error) {
+				var eid EventID
+				eid, err = Put(txn, 1, Event{Meta: 2, Payload: []byte("x")})
+				ids = append(ids, eid)
+				return
+			})
+			if err != nil {
+				t.Fatal("cannot write", err)
+			}
+		}
+		put()
+		// physical clock steps backwards
+		fake.Set(500)
+		put()
+		if ids[0].Timestamp != 1000 {
+			t.Fatal("1st event should be at 1000", ids[0])
+		}
+		if ids[1].Timestamp != 1001 {
+			t.Fatal("2nd event should be at 1001", ids[1])
+		}
+
+		// restart: a new clock is seeded with the latest event in the log
+		SetClock(NewHybridClock(fake.Now))
+		if err = db.View(SeedClock); err != nil {
+			t.Fatal("cannot seed clock", err)
+		}
+		put()
+		if ids[2].Timestamp != 1002 {
+			t.Fatal("3rd event should be at 1002", ids[2])
+		}
+
+		// read bounds do not advance the clock
+		if to := NewEventIDNow(0); to.Timestamp != 1002 {
+			t.Fatal("read bound should be at 1002", to)
+		}
+		put()
+		if ids[3].Timestamp != 1003 {
+			t.Fatal("4th event should be at 1003", ids[3])
+		}
+		return
+	})
+}
@@ -0,0 +1,225 @@
+package log
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/cheng81/eventino/internal/eventino"
+	"github.com/dgraph-io/badger"
+)
+
+// Scope selects the partitions (EventID.Prefix) read by
+// the *Scope range functions, and the order of the events
+type Scope struct {
+	// All reads every partition, merging the events by timestamp
+	All bool
+	// Prefix is the partition to read when All is false
+	Prefix uint8
+	// Reverse returns the newest events first
+	Reverse bool
+}
+
+// Partition returns a Scope reading only the given partition
+func Partition(prefix uint8) Scope {
+	return Scope{Prefix: prefix}
+}
+
+// AllPartitions returns a Scope reading every partition,
+// merged by timestamp
+func AllPartitions() Scope {
+	return Scope{All: true}
+}
+
+// Reversed returns the same Scope, iterating newest events first
+func (s Scope) Reversed() Scope {
+	s.Reverse = true
+	return s
+}
+
+// Partitions returns the prefixes of the partitions present in the log
+func Partitions(txn *badger.Txn) ([]uint8, error) {
+	var out []uint8
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	iter := txn.NewIterator(opts)
+	defer iter.Close()
+	for iter.Seek([]byte{eventino.PfxLog}); iter.ValidForPrefix([]byte{eventino.PfxLog}); {
+		eid := EventID{}
+		if err := DecodeEventID(iter.Item().Key(), &eid); err != nil {
+			return nil, err
+		}
+		out = append(out, eid.Prefix)
+		// skip to the next partition
+		next := make([]byte, 3)
+		next[0] = eventino.PfxLog
+		binary.BigEndian.PutUint16(next[1:3], uint16(eid.Prefix)+1)
+		iter.Seek(next)
+	}
+	return out, nil
+}
+
+// Positions returns the EventID of the latest event of every partition
+func Positions(txn *badger.Txn) ([]EventID, error) {
+	prefixes, err := Partitions(txn)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]EventID, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		eid, ok, err := Position(txn, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, eid)
+		}
+	}
+	return out, nil
+}
+
+// Position returns the EventID of the latest event of the partition,
+// false if the partition is empty
+func Position(txn *badger.Txn, prefix uint8) (EventID, bool, error) {
+	evts, _, err := RangeScope(txn, Partition(prefix).Reversed(),
+		NewEventID(prefix, 0, 0), NewEventID(prefix, math.MaxUint64, math.MaxUint16), 1)
+	if err != nil || len(evts) == 0 {
+		return EventID{}, false, err
+	}
+	return evts[0].ID, true, nil
+}
+
+// RangeScope retrieve a chunk of events from the log partitions selected by the scope.
+// Events between from and to (included) are returned, in timestamp order - or reverse
+// timestamp order if scope.Reverse is set. When reading a single partition, the Prefix of
+// from and to is ignored. The returned EventID is the next event to read, to be used as
+// the new from (or the new to, when reversed).
+func RangeScope(txn *badger.Txn, scope Scope, from, to EventID, max int) ([]Event, *EventID, error) {
+	f := EventFolder(func(acc interface{}, eid EventID, evt Event) (interface{}, error) {
+		return append(acc.([]Event), evt), nil
+	})
+	acc, nextEventID, err := FoldScope(txn, scope, from, to, max, f, []Event{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return acc.([]Event), nextEventID, err
+}
+
+// RangeMatchScope retrieve a chunk of events from the log partitions selected by the scope,
+// satisfying the given matcher. See RangeScope
+func RangeMatchScope(txn *badger.Txn, scope Scope, from, to EventID, max int, m EventMatcher) ([]Event, *EventID, error) {
+	f := EventFolder(func(acc interface{}, eid EventID, evt Event) (interface{}, error) {
+		if m(eid, evt) {
+			return append(acc.([]Event), evt), nil
+		}
+		return acc, nil
+	})
+	acc, nextEventID, err := FoldScope(txn, scope, from, to, max, f, []Event{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return acc.([]Event), nextEventID, err
+}
+
+// FoldScope applies a function to a chunk of events of the log partitions selected by the scope.
+// See RangeScope
+func FoldScope(txn *badger.Txn, scope Scope, from, to EventID, max int, f EventFolder, init interface{}) (out interface{}, nextEventID *EventID, err error) {
+	var prefixes []uint8
+	if scope.All {
+		if prefixes, err = Partitions(txn); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		prefixes = []uint8{scope.Prefix}
+		from.Prefix = scope.Prefix
+		to.Prefix = scope.Prefix
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = scope.Reverse
+	cursors := make([]*cursor, 0, len(prefixes))
+	defer func() {
+		for _, c := range cursors {
+			c.iter.Close()
+		}
+	}()
+	for _, prefix := range prefixes {
+		c := &cursor{iter: txn.NewIterator(opts), pfx: partitionKey(prefix)}
+		cursors = append(cursors, c)
+		start := NewEventID(prefix, from.Timestamp, from.Index)
+		if scope.Reverse {
+			start = NewEventID(prefix, to.Timestamp, to.Index)
+		}
+		if err = c.seek(start.Encode()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	out = init
+	var ctr int
+	for {
+		// pick the next event across the partitions
+		var c *cursor
+		for _, cc := range cursors {
+			if !cc.valid {
+				continue
+			}
+			if c == nil || (!scope.Reverse && cc.eid.Before(c.eid)) || (scope.Reverse && c.eid.Before(cc.eid)) {
+				c = cc
+			}
+		}
+		if c == nil {
+			break
+		}
+		eid := c.eid
+		// skip events sharing from/to timestamp in a partition out of bounds
+		if (!scope.Reverse && eid.Before(from)) || (scope.Reverse && to.Before(eid)) {
+			c.iter.Next()
+			if err = c.load(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		// can't go past the bounds
+		if (!scope.Reverse && to.Before(eid)) || (scope.Reverse && eid.Before(from)) {
+			break
+		}
+		// folded enough events
+		if ctr >= max {
+			nextEventID = &eid
+			break
+		}
+		var evt Event
+		if evt, err = decodeEvent(c.iter.Item()); err != nil {
+			return nil, nil, err
+		}
+		if out, err = f(out, eid, evt); err != nil {
+			return nil, nil, err
+		}
+		ctr++
+		c.iter.Next()
+		if err = c.load(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, nextEventID, nil
+}
+
+// cursor iterates a single log partition
+type cursor struct {
+	iter  *badger.Iterator
+	pfx   []byte
+	eid   EventID
+	valid bool
+}
+
+func (c *cursor) seek(key []byte) error {
+	c.iter.Seek(key)
+	return c.load()
+}
+
+func (c *cursor) load() error {
+	if c.valid = c.iter.ValidForPrefix(c.pfx); !c.valid {
+		return nil
+	}
+	return DecodeEventID(c.iter.Item().Key(), &c.eid)
+}
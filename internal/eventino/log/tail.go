@@ -0,0 +1,442 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+// WatcherClosedError is returned by Watcher.Err when the watcher
+// has been closed by its consumer
+var WatcherClosedError error
+
+// PositionTimeoutError is returned by Hub.WaitFor when the
+// position is not reached in time
+var PositionTimeoutError error
+
+func init() {
+	WatcherClosedError = errors.New("Watcher closed")
+	PositionTimeoutError = errors.New("Position not reached")
+}
+
+// events put in the log by a transaction run through Hub.Update,
+// published to the watchers once the transaction commits
+var pending = struct {
+	sync.Mutex
+	txns map[*badger.Txn]*[]Event
+}{txns: map[*badger.Txn]*[]Event{}}
+
+func track(txn *badger.Txn) *[]Event {
+	evts := &[]Event{}
+	pending.Lock()
+	pending.txns[txn] = evts
+	pending.Unlock()
+	return evts
+}
+
+func untrack(txn *badger.Txn) {
+	pending.Lock()
+	delete(pending.txns, txn)
+	pending.Unlock()
+}
+
+// record is called by the write path (Put, Replicate): it is a no-op
+// unless the transaction is run by a Hub
+func record(txn *badger.Txn, evt Event) {
+	pending.Lock()
+	if evts, ok := pending.txns[txn]; ok {
+		*evts = append(*evts, evt)
+	}
+	pending.Unlock()
+}
+
+// Hub runs write transactions on the log, and fans out every
+// newly committed event to the registered watchers.
+// Commits and watcher registration are serialized, so that a
+// watcher sees every event exactly once: either while catching up
+// from the store, or live.
+type Hub struct {
+	db       *badger.DB
+	mu       sync.Mutex
+	watchers map[*Watcher]struct{}
+	waiters  map[*waiter]struct{}
+}
+
+// waiter is a WaitFor call, woken up once pos is committed
+type waiter struct {
+	pos  EventID
+	done chan struct{}
+}
+
+// NewHub returns a Hub writing on the given db
+func NewHub(db *badger.DB) *Hub {
+	return &Hub{db: db, watchers: map[*Watcher]struct{}{}, waiters: map[*waiter]struct{}{}}
+}
+
+// Update works like badger.DB.Update, and publishes the events put in
+// the log by fn once the transaction is committed
+func (h *Hub) Update(fn func(txn *badger.Txn) error) error {
+	_, err := h.UpdatePosition(fn)
+	return err
+}
+
+// UpdatePosition works like Update, and returns the EventID of the last
+// event put in the log by fn (the zero EventID if fn puts none):
+// a reader that waited for it observes the transaction writes.
+// fn runs under the commit lock, so that the events are timestamped,
+// committed and published in the same order
+func (h *Hub) UpdatePosition(fn func(txn *badger.Txn) error) (pos EventID, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	txn := h.db.NewTransaction(true)
+	defer txn.Discard()
+	evts := track(txn)
+	defer untrack(txn)
+
+	if err = fn(txn); err != nil {
+		return
+	}
+	if err = txn.Commit(nil); err != nil {
+		return
+	}
+	if n := len(*evts); n > 0 {
+		pos = (*evts)[n-1].ID
+	}
+	h.publish(*evts)
+	return
+}
+
+// WaitFor blocks until the event at pos is committed - e.g. until
+// a replica caught up with a write made on its leader.
+// It returns PositionTimeoutError if that does not happen within timeout
+func (h *Hub) WaitFor(pos EventID, timeout time.Duration) error {
+	h.mu.Lock()
+	var reached bool
+	err := h.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(pos.Encode())
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		reached = err == nil
+		return err
+	})
+	if err != nil || reached {
+		h.mu.Unlock()
+		return err
+	}
+	wt := &waiter{pos: pos, done: make(chan struct{})}
+	h.waiters[wt] = struct{}{}
+	h.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-wt.done:
+		return nil
+	case <-timer.C:
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.waiters, wt)
+	select {
+	case <-wt.done:
+		return nil
+	default:
+		return PositionTimeoutError
+	}
+}
+
+// View works like badger.DB.View
+func (h *Hub) View(fn func(txn *badger.Txn) error) error {
+	return h.db.View(fn)
+}
+
+// Watch returns a Watcher delivering every event committed in the
+// partition of from (i.e. with the same Prefix) whose key comes after from.
+// Events already in the store are delivered first, then the watcher
+// switches to live events. buffer bounds both the delivery channel and
+// the queue of live events waiting for a slow consumer: when the queue
+// overflows the watcher drops it and re-reads the missed events from the log.
+func (h *Hub) Watch(from EventID, buffer int) *Watcher {
+	w := newWatcher(h, from, buffer)
+
+	h.mu.Lock()
+	h.watchers[w] = struct{}{}
+	txn := h.db.NewTransaction(false)
+	h.mu.Unlock()
+
+	go w.run(txn)
+	return w
+}
+
+// ViewWatch runs fn on a snapshot of the store, and returns a Watcher
+// delivering the events committed in the given partition after the snapshot.
+// Together they see every event exactly once, e.g. to load some state
+// and then follow its updates
+func (h *Hub) ViewWatch(prefix uint8, buffer int, fn func(txn *badger.Txn) error) (*Watcher, error) {
+	return h.viewWatch(Partition(prefix), buffer, fn)
+}
+
+// ViewWatchAll works like ViewWatch, on every partition
+// of the log (including the ones created after the snapshot)
+func (h *Hub) ViewWatchAll(buffer int, fn func(txn *badger.Txn) error) (*Watcher, error) {
+	return h.viewWatch(AllPartitions(), buffer, fn)
+}
+
+func (h *Hub) viewWatch(scope Scope, buffer int, fn func(txn *badger.Txn) error) (*Watcher, error) {
+	h.mu.Lock()
+	txn := h.db.NewTransaction(false)
+	// start from the latest event of the scope, in case
+	// the watcher lags and has to re-read the log
+	from := NewEventID(scope.Prefix, 0, 0)
+	evts, _, err := RangeScope(txn, scope.Reversed(),
+		NewEventID(0, 0, 0), NewEventID(math.MaxUint8, math.MaxUint64, math.MaxUint16), 1)
+	if err != nil {
+		h.mu.Unlock()
+		txn.Discard()
+		return nil, err
+	}
+	if len(evts) > 0 {
+		from = evts[0].ID
+	}
+	w := newWatcher(h, from, buffer)
+	w.all = scope.All
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+
+	if err = fn(txn); err != nil {
+		w.stop(err)
+		close(w.out)
+		txn.Discard()
+		return nil, err
+	}
+	go w.run(txn)
+	return w, nil
+}
+
+func newWatcher(h *Hub, from EventID, buffer int) *Watcher {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Watcher{
+		hub:      h,
+		prefix:   from.Prefix,
+		last:     from,
+		maxQueue: buffer,
+		out:      make(chan Event, buffer),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+func (h *Hub) publish(evts []Event) {
+	if len(evts) == 0 {
+		return
+	}
+	for w := range h.watchers {
+		w.push(evts)
+	}
+	for wt := range h.waiters {
+		for _, evt := range evts {
+			if evt.ID == wt.pos {
+				close(wt.done)
+				delete(h.waiters, wt)
+				break
+			}
+		}
+	}
+}
+
+func (h *Hub) unwatch(w *Watcher) {
+	h.mu.Lock()
+	delete(h.watchers, w)
+	h.mu.Unlock()
+}
+
+// resync opens a new snapshot for a lagging watcher. Done under
+// the commit lock, the snapshot holds exactly the events published
+// before the watcher queue was reset.
+func (h *Hub) resync(w *Watcher) *badger.Txn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.mu.Lock()
+	w.queue = nil
+	w.lagged = false
+	w.mu.Unlock()
+	return h.db.NewTransaction(false)
+}
+
+// Watcher delivers log events over a channel,
+// see Hub.Watch
+type Watcher struct {
+	hub    *Hub
+	prefix uint8
+	// all watches every partition, see Hub.ViewWatchAll
+	all      bool
+	last     EventID
+	maxQueue int
+
+	out  chan Event
+	wake chan struct{}
+	done chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	queue  []Event
+	lagged bool
+	err    error
+}
+
+// Events returns the channel the events are delivered on.
+// The channel is closed when the watcher stops
+func (w *Watcher) Events() <-chan Event {
+	return w.out
+}
+
+// Err returns the reason the watcher stopped, if any
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close stops the watcher
+func (w *Watcher) Close() {
+	w.stop(WatcherClosedError)
+}
+
+func (w *Watcher) stop(err error) {
+	w.once.Do(func() {
+		w.mu.Lock()
+		w.err = err
+		w.mu.Unlock()
+		w.hub.unwatch(w)
+		close(w.done)
+	})
+}
+
+func (w *Watcher) push(evts []Event) {
+	w.mu.Lock()
+	if !w.lagged {
+		for _, evt := range evts {
+			if !w.all && evt.ID.Prefix != w.prefix {
+				continue
+			}
+			if len(w.queue) == w.maxQueue {
+				w.queue = nil
+				w.lagged = true
+				break
+			}
+			w.queue = append(w.queue, evt)
+		}
+	}
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) run(txn *badger.Txn) {
+	defer close(w.out)
+	for {
+		err := w.catchUp(txn)
+		txn.Discard()
+		if err != nil {
+			w.stop(err)
+			return
+		}
+		if !w.live() {
+			return
+		}
+		txn = w.hub.resync(w)
+	}
+}
+
+// catchUp delivers the events in the snapshot after the last delivered one
+func (w *Watcher) catchUp(txn *badger.Txn) error {
+	if w.all {
+		return w.catchUpAll(txn)
+	}
+	start := w.last.Encode()
+	pfx := partitionKey(w.prefix)
+	iter := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+	for iter.Seek(start); iter.ValidForPrefix(pfx); iter.Next() {
+		item := iter.Item()
+		if bytes.Equal(item.Key(), start) {
+			continue
+		}
+		evt, err := decodeEvent(item)
+		if err != nil {
+			return err
+		}
+		if !w.send(evt) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// catchUpAll delivers the events of every partition in the snapshot
+// after the last delivered one, in timestamp order
+func (w *Watcher) catchUpAll(txn *badger.Txn) error {
+	from := w.last
+	to := NewEventID(math.MaxUint8, math.MaxUint64, math.MaxUint16)
+	for {
+		evts, next, err := RangeScope(txn, AllPartitions(), from, to, w.maxQueue)
+		if err != nil {
+			return err
+		}
+		for _, evt := range evts {
+			if evt.ID == w.last {
+				continue
+			}
+			if !w.send(evt) {
+				return nil
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		from = *next
+	}
+}
+
+// live delivers the queued events, returns false when the
+// watcher is stopped, true when it is lagging behind
+func (w *Watcher) live() bool {
+	for {
+		select {
+		case <-w.done:
+			return false
+		case <-w.wake:
+		}
+		w.mu.Lock()
+		evts, lagged := w.queue, w.lagged
+		w.queue = nil
+		w.mu.Unlock()
+		if lagged {
+			return true
+		}
+		for _, evt := range evts {
+			if !w.send(evt) {
+				return false
+			}
+		}
+	}
+}
+
+func (w *Watcher) send(evt Event) bool {
+	select {
+	case w.out <- evt:
+		w.last = evt.ID
+		return true
+	case <-w.done:
+		return false
+	}
+}
@@ -39,10 +39,27 @@ func (eid EventID) Encode() (out []byte) {
 	return
 }
 
+// Before reports whether eid comes before other in timestamp order.
+// Events at the same timestamp and index are ordered by Prefix
+func (eid EventID) Before(other EventID) bool {
+	if eid.Timestamp != other.Timestamp {
+		return eid.Timestamp < other.Timestamp
+	}
+	if eid.Index != other.Index {
+		return eid.Index < other.Index
+	}
+	return eid.Prefix < other.Prefix
+}
+
+// partitionKey returns the key prefix shared by all events of a partition
+func partitionKey(prefix uint8) []byte {
+	return NewEventID(prefix, 0, 0).Encode()[0:3]
+}
+
 // DecodeEventID reads the bytes and fills the *EventID.
 // Might return NoLogItemIDError
 func DecodeEventID(b []byte, eid *EventID) error {
-	if b[0] != eventino.PfxLog {
+	if len(b) != 13 || b[0] != eventino.PfxLog {
 		return NoLogEventIDError
 	}
 	eid.Prefix = uint8(binary.BigEndian.Uint16(b[1:3]))
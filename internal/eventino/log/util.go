@@ -2,7 +2,6 @@ package log
 
 import (
 	"errors"
-	"time"
 
 	"github.com/dgraph-io/badger"
 )
@@ -13,8 +12,13 @@ import (
 // a []byte as EventID that does not encode an EventID
 var NoLogEventIDError error
 
+// BatchTooBigError is returned when a batch of events
+// does not fit in a single timestamp
+var BatchTooBigError error
+
 func init() {
 	NoLogEventIDError = errors.New("Not a log item id")
+	BatchTooBigError = errors.New("Batch too big")
 }
 
 // NewEventID produce an EventID from the given prefix,
@@ -28,11 +32,12 @@ func NewEventID(prefix uint8, ts uint64, idx uint16) EventID {
 }
 
 // NewEventIDNow produce an EventID for the gien prefix,
-// with timestamp = `uint64(time.Now().UnixName())` and index 0
+// with timestamp = `clock.Read()` and index 0. It is meant
+// as a read bound, and does not advance the clock
 func NewEventIDNow(prefix uint8) EventID {
 	return EventID{
 		Prefix:    prefix,
-		Timestamp: uint64(time.Now().UnixNano()),
+		Timestamp: currentClock().Read(),
 		Index:     0,
 	}
 }
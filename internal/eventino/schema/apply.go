@@ -0,0 +1,441 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger"
+)
+
+// SchemaSpec declares the schema: the latest version of the named
+// types and of the event types of each entity type, as their native
+// specs, e.g. {"Simple": "STRING"} or {"Ref": {"typename": "address_0"}}
+type SchemaSpec struct {
+	Records  map[string]interface{} `json:"records"`
+	Enums    map[string]interface{} `json:"enums"`
+	Entities map[string]EntitySpec  `json:"entities"`
+}
+
+// EntitySpec declares an entity type. Compatibility is its default
+// (NONE if empty), Compatibilities the ones set per event type
+type EntitySpec struct {
+	Compatibility   string                 `json:"compatibility"`
+	Compatibilities map[string]string      `json:"compatibilities"`
+	Events          map[string]interface{} `json:"events"`
+}
+
+// ParseSchemaSpec parses a JSON schema spec
+func ParseSchemaSpec(b []byte) (spec SchemaSpec, err error) {
+	err = json.Unmarshal(b, &spec)
+	return
+}
+
+// ToSchema returns the schema declared by the spec, without a live
+// one: every type and event type is at version 0, and the references
+// resolve to the declared types by name, whatever their version
+func (spec SchemaSpec) ToSchema(dec SchemaDecoder) (out Schema, err error) {
+	types := &specTypes{spec: spec, types: map[string]DataSchema{}, decoding: map[string]bool{}}
+	types.dec = dec.WithTypes(types)
+	out = Schema{
+		Records:  map[EventSchemaID]DataSchema{},
+		Enums:    map[EventSchemaID]DataSchema{},
+		Entities: map[string]EntityType{},
+	}
+	for _, kind := range []string{KindRecord, KindEnum} {
+		specTypes, outTypes := spec.Records, out.Records
+		if kind == KindEnum {
+			specTypes, outTypes = spec.Enums, out.Enums
+		}
+		for _, name := range sortedKeys(specTypes) {
+			ds, ok := types.ResolveType(NewEventSchemaID(name, 0))
+			if !ok {
+				return out, fmt.Errorf("%s: %s", name, types.errFor(name))
+			}
+			outTypes[NewEventSchemaID(name, 0)] = ds
+		}
+	}
+	for _, entName := range sortedKeys(spec.Entities) {
+		entSpec := spec.Entities[entName]
+		et := EntityType{Name: entName, Events: map[EventSchemaID]DataSchema{}, Compatibilities: map[string]Compatibility{}}
+		if et.Compatibility, err = parseSpecCompatibility(entSpec.Compatibility); err != nil {
+			return out, fmt.Errorf("%s: %s", entName, err)
+		}
+		for evtName, c := range entSpec.Compatibilities {
+			if et.Compatibilities[evtName], err = parseSpecCompatibility(c); err != nil {
+				return out, fmt.Errorf("%s.%s: %s", entName, evtName, err)
+			}
+		}
+		for _, evtName := range sortedKeys(entSpec.Events) {
+			var ds DataSchema
+			if ds, err = decodeSpec(types.dec, entSpec.Events[evtName]); err != nil {
+				return out, fmt.Errorf("%s.%s: %s", entName, evtName, err)
+			}
+			et.Events[NewEventSchemaID(evtName, 0)] = ds
+		}
+		out.Entities[entName] = et
+	}
+	return
+}
+
+// specTypes resolves the named types of a spec by name,
+// decoding them when first referenced
+type specTypes struct {
+	spec     SchemaSpec
+	dec      SchemaDecoder
+	types    map[string]DataSchema
+	decoding map[string]bool
+	err      error
+}
+
+func (t *specTypes) ResolveType(id EventSchemaID) (DataSchema, bool) {
+	if ds, ok := t.types[id.Name]; ok {
+		return ds, true
+	}
+	native, ok := t.spec.Records[id.Name]
+	if !ok {
+		native, ok = t.spec.Enums[id.Name]
+	}
+	// the cycles are left unresolved
+	if !ok || t.decoding[id.Name] {
+		return nil, false
+	}
+	t.decoding[id.Name] = true
+	defer delete(t.decoding, id.Name)
+	ds, err := decodeSpec(t.dec, native)
+	if err != nil {
+		t.err = err
+		return nil, false
+	}
+	t.types[id.Name] = ds
+	return ds, true
+}
+
+// errFor is the error decoding the named type, if any
+func (t *specTypes) errFor(name string) error {
+	if t.err != nil {
+		return t.err
+	}
+	return TypeNotFound
+}
+
+// the changes planned to apply a schema spec
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	ChangeSet    = "set"
+)
+
+// the kinds of the schema elements changed
+const (
+	KindRecord        = "record"
+	KindEnum          = "enum"
+	KindEntity        = "entity"
+	KindEvent         = "event"
+	KindCompatibility = "compatibility"
+)
+
+// Change is a schema change planned to apply a spec.
+// Entity is set for the event types and compatibilities,
+// Name is empty when setting the entity type compatibility
+type Change struct {
+	Action        string
+	Kind          string
+	Entity        string
+	Name          string
+	Spec          interface{}
+	Compatibility Compatibility
+}
+
+func (c Change) String() string {
+	name := c.Name
+	if c.Entity != "" && name != "" {
+		name = c.Entity + "." + name
+	} else if c.Entity != "" {
+		name = c.Entity
+	}
+	if c.Action == ChangeSet {
+		return fmt.Sprintf("%s %s %s %s", c.Action, c.Kind, name, c.Compatibility)
+	}
+	return fmt.Sprintf("%s %s %s", c.Action, c.Kind, name)
+}
+
+// Plan returns the changes to apply to the live schema to match the spec:
+// the named types first, in dependency order, then the entity and event
+// types, and the deletes last. Specs equal to the latest ones are unchanged
+func Plan(live Schema, dec SchemaDecoder, spec SchemaSpec) (out []Change, err error) {
+	var types []Change
+	if types, err = planTypes(live, dec, spec); err != nil {
+		return
+	}
+	out = append(out, types...)
+
+	var deletes []Change
+	for _, entName := range sortedKeys(spec.Entities) {
+		entSpec := spec.Entities[entName]
+		var compat Compatibility
+		if compat, err = parseSpecCompatibility(entSpec.Compatibility); err != nil {
+			return nil, fmt.Errorf("%s: %s", entName, err)
+		}
+		et, exists := live.Entities[entName]
+		if !exists {
+			out = append(out, Change{Action: ChangeCreate, Kind: KindEntity, Entity: entName})
+		}
+		if compat != et.Compatibility {
+			out = append(out, Change{Action: ChangeSet, Kind: KindCompatibility, Entity: entName, Compatibility: compat})
+		}
+
+		for _, evtName := range sortedKeys(entSpec.Events) {
+			native := entSpec.Events[evtName]
+			evtCompat := compat
+			if c, ok := entSpec.Compatibilities[evtName]; ok {
+				if evtCompat, err = parseSpecCompatibility(c); err != nil {
+					return nil, fmt.Errorf("%s.%s: %s", entName, evtName, err)
+				}
+			}
+			// the live one, once the entity type compatibility is set
+			liveCompat := compat
+			if c, ok := et.Compatibilities[evtName]; ok {
+				liveCompat = c
+			}
+			setCompat := Change{Action: ChangeSet, Kind: KindCompatibility, Entity: entName, Name: evtName, Compatibility: evtCompat}
+
+			latestID, ok := et.LatestEvent(evtName)
+			if !ok {
+				if _, err = decodeSpec(dec, native); err != nil {
+					return nil, fmt.Errorf("%s.%s: %s", entName, evtName, err)
+				}
+				out = append(out, Change{Action: ChangeCreate, Kind: KindEvent, Entity: entName, Name: evtName, Spec: native})
+				if evtCompat != liveCompat {
+					out = append(out, setCompat)
+				}
+				continue
+			}
+			// the compatibility applies to the update
+			if evtCompat != liveCompat {
+				out = append(out, setCompat)
+			}
+			var same bool
+			if same, err = sameSpec(dec, et.Events[latestID], native); err != nil {
+				return nil, fmt.Errorf("%s.%s: %s", entName, evtName, err)
+			}
+			if !same {
+				out = append(out, Change{Action: ChangeUpdate, Kind: KindEvent, Entity: entName, Name: evtName, Spec: native})
+			}
+		}
+		for _, evtName := range typeNames(et.Events) {
+			if _, ok := entSpec.Events[evtName]; !ok {
+				deletes = append(deletes, Change{Action: ChangeDelete, Kind: KindEvent, Entity: entName, Name: evtName})
+			}
+		}
+	}
+	for _, entName := range sortedKeys(live.Entities) {
+		if _, ok := spec.Entities[entName]; !ok {
+			deletes = append(deletes, Change{Action: ChangeDelete, Kind: KindEntity, Entity: entName})
+		}
+	}
+	for _, kind := range []string{KindRecord, KindEnum} {
+		liveTypes, specTypes := live.Records, spec.Records
+		if kind == KindEnum {
+			liveTypes, specTypes = live.Enums, spec.Enums
+		}
+		for _, name := range typeNames(liveTypes) {
+			if _, ok := specTypes[name]; !ok {
+				deletes = append(deletes, Change{Action: ChangeDelete, Kind: kind, Name: name})
+			}
+		}
+	}
+	out = append(out, deletes...)
+	return
+}
+
+// planTypes creates or updates the named types, the ones referenced first
+func planTypes(live Schema, dec SchemaDecoder, spec SchemaSpec) (out []Change, err error) {
+	changes := map[string]Change{}
+	for _, kind := range []string{KindRecord, KindEnum} {
+		liveTypes, specTypes, other := live.Records, spec.Records, spec.Enums
+		if kind == KindEnum {
+			liveTypes, specTypes, other = live.Enums, spec.Enums, spec.Records
+		}
+		for name, native := range specTypes {
+			if _, ok := other[name]; ok {
+				return nil, fmt.Errorf("%s: both a record and an enum", name)
+			}
+			vsn, ok := latestTypeVSN(liveTypes, name)
+			if !ok {
+				if _, err = decodeSpec(dec, native); err != nil {
+					return nil, fmt.Errorf("%s: %s", name, err)
+				}
+				changes[name] = Change{Action: ChangeCreate, Kind: kind, Name: name, Spec: native}
+				continue
+			}
+			var same bool
+			if same, err = sameSpec(dec, liveTypes[NewEventSchemaID(name, vsn)], native); err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err)
+			}
+			if !same {
+				changes[name] = Change{Action: ChangeUpdate, Kind: kind, Name: name, Spec: native}
+			}
+		}
+	}
+
+	// depth first on the references, the cycles are
+	// left to fail when applied, as unresolved types
+	visited := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		c, ok := changes[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, ref := range specRefs(c.Spec) {
+			visit(EventSchemaIDFromString(ref).Name)
+		}
+		out = append(out, c)
+	}
+	for _, name := range sortedKeys(changes) {
+		visit(name)
+	}
+	return
+}
+
+// Apply applies the planned changes, each one as its schema event.
+// The specs are decoded with the types of the latest schema
+func Apply(txn *badger.Txn, dec SchemaDecoder, changes []Change) (err error) {
+	for _, c := range changes {
+		if err = applyChange(txn, dec, c); err != nil {
+			return fmt.Errorf("%s: %s", c, err)
+		}
+	}
+	return
+}
+
+func applyChange(txn *badger.Txn, dec SchemaDecoder, c Change) (err error) {
+	var ds DataSchema
+	if c.Spec != nil {
+		var latest Schema
+		if latest, err = LatestSchema(txn, dec); err != nil {
+			return
+		}
+		if ds, err = decodeSpec(dec.WithTypes(latest), c.Spec); err != nil {
+			return
+		}
+	}
+	switch {
+	case c.Kind == KindRecord || c.Kind == KindEnum:
+		switch c.Action {
+		case ChangeCreate:
+			err = CreateType(txn, c.Name, ds)
+		case ChangeUpdate:
+			_, err = UpdateType(txn, c.Name, ds)
+		case ChangeDelete:
+			err = DeleteType(txn, dec, c.Name)
+		}
+	case c.Kind == KindEntity && c.Action == ChangeCreate:
+		err = CreateEntityType(txn, dec, c.Entity)
+	case c.Kind == KindEntity && c.Action == ChangeDelete:
+		err = DeleteEntityType(txn, c.Entity, dec)
+	case c.Kind == KindEvent && c.Action == ChangeCreate:
+		err = CreateEntityEventType(txn, c.Entity, c.Name, ds)
+	case c.Kind == KindEvent && c.Action == ChangeUpdate:
+		_, err = UpdateEventType(txn, c.Entity, c.Name, ds)
+	case c.Kind == KindEvent && c.Action == ChangeDelete:
+		err = DeleteEventType(txn, dec, c.Entity, c.Name)
+	case c.Kind == KindCompatibility:
+		err = SetCompatibility(txn, dec, c.Entity, c.Name, c.Compatibility)
+	default:
+		err = fmt.Errorf("unknown change %s", c)
+	}
+	return
+}
+
+// decodeSpec decodes a native spec, which may come from a file
+func decodeSpec(dec SchemaDecoder, native interface{}) (DataSchema, error) {
+	if _, ok := native.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("invalid spec %v", native)
+	}
+	return dec.DecodeNative(native)
+}
+
+// sameSpec compares the live data schema with the native spec,
+// as JSON, since the native maps are not ordered
+func sameSpec(dec SchemaDecoder, live DataSchema, native interface{}) (same bool, err error) {
+	var ds DataSchema
+	if ds, err = decodeSpec(dec, native); err != nil {
+		return
+	}
+	var a, b []byte
+	if a, err = json.Marshal(live.EncodeSchemaNative()); err != nil {
+		return
+	}
+	if b, err = json.Marshal(ds.EncodeSchemaNative()); err != nil {
+		return
+	}
+	return string(a) == string(b), nil
+}
+
+func parseSpecCompatibility(s string) (Compatibility, error) {
+	if s == "" {
+		return CompatibilityNone, nil
+	}
+	return ParseCompatibility(s)
+}
+
+// specRefs returns the typenames referenced by a native spec
+func specRefs(native interface{}) (out []string) {
+	switch v := native.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["Ref"].(map[string]interface{}); ok {
+			if typename, ok := ref["typename"].(string); ok {
+				out = append(out, typename)
+			}
+		}
+		for _, k := range sortedKeys(v) {
+			out = append(out, specRefs(v[k])...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, specRefs(item)...)
+		}
+	}
+	return
+}
+
+// typeNames returns the names of the versioned types, sorted
+func typeNames(types map[EventSchemaID]DataSchema) (out []string) {
+	seen := map[string]bool{}
+	for id := range types {
+		if !seen[id.Name] {
+			seen[id.Name] = true
+			out = append(out, id.Name)
+		}
+	}
+	sort.Strings(out)
+	return
+}
+
+// sortedKeys returns the keys of a map with string keys, sorted
+func sortedKeys(m interface{}) (out []string) {
+	switch v := m.(type) {
+	case map[string]interface{}:
+		for k := range v {
+			out = append(out, k)
+		}
+	case map[string]EntitySpec:
+		for k := range v {
+			out = append(out, k)
+		}
+	case map[string]EntityType:
+		for k := range v {
+			out = append(out, k)
+		}
+	case map[string]Change:
+		for k := range v {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return
+}
@@ -0,0 +1,260 @@
+package schema
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/cheng81/eventino/internal/eventino/log"
+	"github.com/dgraph-io/badger"
+)
+
+// version is a schema version: the schema item event it is folded
+// from, and its changes to the previous version
+type version struct {
+	itemVsn uint64
+	logID   log.EventID
+	vsn     uint64
+	changes []change
+}
+
+// change sets or deletes an entry of a schema built by replay
+type change func(Schema)
+
+// schemaCache keeps the latest schema, and the changes of every schema
+// version, to rebuild the older ones: memory grows with the schema
+// events, not with the versions times their size. The schema item is
+// append-only, and a version is valid for a transaction as long as it
+// sees the same log event at the version item version: the cached
+// versions are checked against the transaction and the ones not valid
+// (e.g. written by a discarded transaction, or another db) are dropped
+type schemaCache struct {
+	sync.Mutex
+	versions []version
+	latest   Schema
+}
+
+// one cache per schema decoder type, since the cached schemas are decoded
+var schemaCaches = struct {
+	sync.Mutex
+	byDecoder map[reflect.Type]*schemaCache
+}{byDecoder: map[reflect.Type]*schemaCache{}}
+
+func cacheFor(dec SchemaDecoder) *schemaCache {
+	schemaCaches.Lock()
+	defer schemaCaches.Unlock()
+	t := reflect.TypeOf(dec)
+	c, ok := schemaCaches.byDecoder[t]
+	if !ok {
+		c = &schemaCache{}
+		schemaCaches.byDecoder[t] = c
+	}
+	return c
+}
+
+// ResetSchemaCache drops the cached schema versions
+func ResetSchemaCache() {
+	schemaCaches.Lock()
+	defer schemaCaches.Unlock()
+	schemaCaches.byDecoder = map[reflect.Type]*schemaCache{}
+}
+
+// load returns the schema versions seen by the transaction and the latest
+// schema, folding only the schema events not cached yet
+func (c *schemaCache) load(txn *badger.Txn, dec SchemaDecoder) (out []version, latest Schema, err error) {
+	c.Lock()
+	cached, latest := c.versions, c.latest
+	c.Unlock()
+
+	// valid versions are a prefix of the cached ones
+	var invalid error
+	n := sort.Search(len(cached), func(i int) bool {
+		id, err := item.EventLogID(txn, schemaID, cached[i].itemVsn)
+		if err != nil && err != badger.ErrKeyNotFound {
+			invalid = err
+		}
+		return err != nil || id != cached[i].logID
+	})
+	if invalid != nil {
+		return nil, emptySchema(), invalid
+	}
+
+	var fromVsn uint64
+	scm := emptySchema()
+	if n > 0 {
+		fromVsn = cached[n-1].itemVsn + 1
+		if n == len(cached) {
+			scm = latest
+		} else {
+			scm = replay(cached[:n])
+		}
+	}
+	var folded []version
+	fold := schemaFolder(func(_ Schema) bool { return false }, dec)
+	var last interface{}
+	if last, _, err = item.View(txn, schemaID, fromVsn, func(acc interface{}, evt item.Event, vsn uint64) (interface{}, bool, error) {
+		next, stop, err := fold(acc, evt, vsn)
+		if err == nil && next.(Schema).VSN != acc.(Schema).VSN {
+			folded = append(folded, version{itemVsn: vsn, logID: evt.LogID, vsn: next.(Schema).VSN, changes: diffSchema(acc.(Schema), next.(Schema))})
+		}
+		return next, stop, err
+	}, scm); err != nil {
+		return
+	}
+
+	if n == len(cached) && len(folded) == 0 {
+		return cached, scm, nil
+	}
+	// never append to the cached slice, it is shared with the readers
+	out = make([]version, n, n+len(folded))
+	copy(out, cached)
+	out = append(out, folded...)
+	latest = last.(Schema)
+	c.Lock()
+	c.versions, c.latest = out, latest
+	c.Unlock()
+	return
+}
+
+// replay builds the schema at the last of the versions
+func replay(versions []version) Schema {
+	scm := emptySchema()
+	for _, v := range versions {
+		scm = v.apply(scm)
+	}
+	return scm
+}
+
+// apply applies the version changes to a schema built by replay
+func (v version) apply(scm Schema) Schema {
+	for _, c := range v.changes {
+		c(scm)
+	}
+	scm.VSN = v.vsn
+	return scm
+}
+
+// diffSchema returns the changes from a folded schema to the next one.
+// The schema types and entity event types are never replaced: a new
+// version is a new entry, so the entries are compared by key
+func diffSchema(before, after Schema) (changes []change) {
+	for name := range before.Entities {
+		if _, ok := after.Entities[name]; !ok {
+			name := name
+			changes = append(changes, func(s Schema) { delete(s.Entities, name) })
+		}
+	}
+	for name, et := range after.Entities {
+		name := name
+		prev, ok := before.Entities[name]
+		if !ok || prev.VSN != et.VSN || prev.Compatibility != et.Compatibility {
+			vsn, compat := et.VSN, et.Compatibility
+			changes = append(changes, func(s Schema) {
+				cur, ok := s.Entities[name]
+				if !ok {
+					cur = EntityType{Name: name, Events: map[EventSchemaID]DataSchema{}, Compatibilities: map[string]Compatibility{}}
+				}
+				cur.VSN, cur.Compatibility = vsn, compat
+				s.Entities[name] = cur
+			})
+		}
+		// the unchanged entity types share their maps
+		if ok && sameMap(prev.Events, et.Events) && sameMap(prev.Compatibilities, et.Compatibilities) {
+			continue
+		}
+		changes = append(changes, diffTypes(prev.Events, et.Events, func(s Schema) map[EventSchemaID]DataSchema {
+			return s.Entities[name].Events
+		})...)
+		for evtName := range prev.Compatibilities {
+			if _, ok := et.Compatibilities[evtName]; !ok {
+				evtName := evtName
+				changes = append(changes, func(s Schema) { delete(s.Entities[name].Compatibilities, evtName) })
+			}
+		}
+		for evtName, c := range et.Compatibilities {
+			if prevC, ok := prev.Compatibilities[evtName]; !ok || prevC != c {
+				evtName, c := evtName, c
+				changes = append(changes, func(s Schema) { s.Entities[name].Compatibilities[evtName] = c })
+			}
+		}
+	}
+	changes = append(changes, diffTypes(before.Records, after.Records, func(s Schema) map[EventSchemaID]DataSchema { return s.Records })...)
+	changes = append(changes, diffTypes(before.Enums, after.Enums, func(s Schema) map[EventSchemaID]DataSchema { return s.Enums })...)
+	for name := range before.Deleted {
+		if _, ok := after.Deleted[name]; !ok {
+			name := name
+			changes = append(changes, func(s Schema) { delete(s.Deleted, name) })
+		}
+	}
+	for name, vsn := range after.Deleted {
+		if prev, ok := before.Deleted[name]; !ok || prev != vsn {
+			name, vsn := name, vsn
+			changes = append(changes, func(s Schema) { s.Deleted[name] = vsn })
+		}
+	}
+	return
+}
+
+// diffTypes returns the changes from the types to the next ones, in the map selected
+func diffTypes(before, after map[EventSchemaID]DataSchema, types func(Schema) map[EventSchemaID]DataSchema) (changes []change) {
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			id := id
+			changes = append(changes, func(s Schema) { delete(types(s), id) })
+		}
+	}
+	for id, ds := range after {
+		if prev, ok := before[id]; !ok || !sameSchema(prev, ds) {
+			id, ds := id, ds
+			changes = append(changes, func(s Schema) { types(s)[id] = ds })
+		}
+	}
+	return
+}
+
+func sameMap(a, b interface{}) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+func sameSchema(a, b DataSchema) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.TypeOf(a).Comparable() && a == b
+}
+
+func emptySchema() Schema {
+	return Schema{VSN: 0, Entities: map[string]EntityType{}, Records: map[EventSchemaID]DataSchema{}, Enums: map[EventSchemaID]DataSchema{}, Deleted: map[string]uint64{}}
+}
+
+// clone copies the schema maps, not the entity types ones
+func (s Schema) clone() Schema {
+	out := s
+	out.Entities = make(map[string]EntityType, len(s.Entities))
+	for k, v := range s.Entities {
+		out.Entities[k] = v
+	}
+	out.Records = cloneTypes(s.Records)
+	out.Enums = cloneTypes(s.Enums)
+	out.Deleted = make(map[string]uint64, len(s.Deleted))
+	for k, v := range s.Deleted {
+		out.Deleted[k] = v
+	}
+	return out
+}
+
+func (typ EntityType) clone() EntityType {
+	out := typ
+	out.Events = cloneTypes(typ.Events)
+	out.Compatibilities = make(map[string]Compatibility, len(typ.Compatibilities))
+	for k, v := range typ.Compatibilities {
+		out.Compatibilities[k] = v
+	}
+	return out
+}
+
+func cloneTypes(types map[EventSchemaID]DataSchema) map[EventSchemaID]DataSchema {
+	out := make(map[EventSchemaID]DataSchema, len(types))
+	for k, v := range types {
+		out[k] = v
+	}
+	return out
+}
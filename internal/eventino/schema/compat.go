@@ -0,0 +1,137 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/dgraph-io/badger"
+)
+
+// Compatibility is the check applied when updating an event type,
+// between its latest schema and the new one
+type Compatibility uint8
+
+const (
+	// CompatibilityNone accepts any update
+	CompatibilityNone Compatibility = iota
+	// CompatibilityBackward: the new schema reads the data written with the latest one
+	CompatibilityBackward
+	// CompatibilityForward: the latest schema reads the data written with the new one
+	CompatibilityForward
+	// CompatibilityFull is both backward and forward
+	CompatibilityFull
+)
+
+var compatibilityNames = []string{"NONE", "BACKWARD", "FORWARD", "FULL"}
+
+func (c Compatibility) String() string {
+	if int(c) < len(compatibilityNames) {
+		return compatibilityNames[c]
+	}
+	return fmt.Sprintf("Compatibility(%d)", c)
+}
+
+// ParseCompatibility parses NONE, BACKWARD, FORWARD or FULL
+func ParseCompatibility(s string) (Compatibility, error) {
+	for i, name := range compatibilityNames {
+		if strings.EqualFold(s, name) {
+			return Compatibility(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown compatibility %q", s)
+}
+
+// the schema resolution rules, as in avro
+const (
+	// RuleTypeMismatch: the writer type cannot be read (or promoted) as the reader type
+	RuleTypeMismatch = "type mismatch"
+	// RuleNameMismatch: records and enums must have the same name
+	RuleNameMismatch = "name mismatch"
+	// RuleMissingDefault: a reader field missing in the writer needs a default
+	RuleMissingDefault = "missing default"
+	// RuleMissingSymbol: a writer enum symbol missing in the reader
+	RuleMissingSymbol = "missing symbol"
+	// RuleMissingBranch: a writer type with no matching reader union branch
+	RuleMissingBranch = "missing branch"
+)
+
+// Incompatibility is a resolution rule broken between a reader and
+// a writer schema. Path is the broken field, e.g. $.address.street.
+// Compatibility is the direction checked, backward or forward
+type Incompatibility struct {
+	Compatibility Compatibility
+	Path          string
+	Rule          string
+	Detail        string
+}
+
+func (i Incompatibility) String() string {
+	if i.Compatibility == CompatibilityNone {
+		return fmt.Sprintf("%s: %s (%s)", i.Path, i.Rule, i.Detail)
+	}
+	return fmt.Sprintf("%s %s: %s (%s)", i.Compatibility, i.Path, i.Rule, i.Detail)
+}
+
+// IncompatibleSchemaError is returned when an event type
+// update breaks the compatibility of the event type
+type IncompatibleSchemaError struct {
+	Entity            string
+	Event             string
+	Compatibility     Compatibility
+	Incompatibilities []Incompatibility
+}
+
+func (e IncompatibleSchemaError) Error() string {
+	report := make([]string, len(e.Incompatibilities))
+	for i, inc := range e.Incompatibilities {
+		report[i] = inc.String()
+	}
+	return fmt.Sprintf("Incompatible schema for %s.%s (%s): %s", e.Entity, e.Event, e.Compatibility, strings.Join(report, "; "))
+}
+
+// CheckCompatibility returns the rules broken by updating the latest schema
+// to the next one. In full compatibility, the backward ones come first
+func CheckCompatibility(c Compatibility, latest, next DataSchema) []Incompatibility {
+	var out []Incompatibility
+	if c == CompatibilityBackward || c == CompatibilityFull {
+		out = append(out, withCompatibility(CompatibilityBackward, next.CanRead(latest))...)
+	}
+	if c == CompatibilityForward || c == CompatibilityFull {
+		out = append(out, withCompatibility(CompatibilityForward, latest.CanRead(next))...)
+	}
+	return out
+}
+
+func withCompatibility(c Compatibility, incompatibilities []Incompatibility) []Incompatibility {
+	for i := range incompatibilities {
+		incompatibilities[i].Compatibility = c
+	}
+	return incompatibilities
+}
+
+// SetCompatibility sets the compatibility of the event type, or
+// the default one of the entity type if evtName is empty
+func SetCompatibility(txn *badger.Txn, dec SchemaDecoder, entName, evtName string, c Compatibility) (err error) {
+	if int(c) >= len(compatibilityNames) {
+		return fmt.Errorf("unknown compatibility %d", c)
+	}
+	var scm Schema
+	if scm, err = LatestSchema(txn, dec); err != nil {
+		return
+	}
+	et, ok := scm.Entities[entName]
+	if !ok {
+		return EntityTypeNotFound
+	}
+	if _, ok = et.LatestEvent(evtName); evtName != "" && !ok {
+		return EventTypeNotFound
+	}
+
+	var evt item.Event
+	if evt, err = newCompatibilitySet(entName, evtName, c); err != nil {
+		return
+	}
+	_, err = item.Put(txn, schemaID, evt)
+	return
+}
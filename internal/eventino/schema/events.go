@@ -14,6 +14,13 @@ const (
 	evtCreated string = "EVT:CREATED"
 	evtUpdated string = "EVT:UPDATED"
 	evtDeleted string = "EVT:DELETED"
+	recCreated string = "REC:CREATED"
+	recUpdated string = "REC:UPDATED"
+	recDeleted string = "REC:DELETED"
+	enmCreated string = "ENUM:CREATED"
+	enmUpdated string = "ENUM:UPDATED"
+	enmDeleted string = "ENUM:DELETED"
+	compatSet  string = "COMPAT:SET"
 )
 
 func newEntityCreated(name string) (out item.Event, err error) {
@@ -71,6 +78,64 @@ func newEventTypeDeleted(entName, name string) (out item.Event, err error) {
 	return
 }
 
+func newTypeCreated(name string, kind DataType, schema DataSchema) (out item.Event, err error) {
+	var b []byte
+	var schemaBin []byte
+
+	if schemaBin, err = schema.EncodeSchema(); err != nil {
+		return
+	}
+	typ, payload := recCreated, interface{}(recordTypeCreated{Name: name, SchemaBin: schemaBin})
+	if kind == Enum {
+		typ, payload = enmCreated, enumTypeCreated{Name: name, SchemaBin: schemaBin}
+	}
+	if b, err = encode(payload); err != nil {
+		return
+	}
+	out = item.NewEvent(eventino.EventKindSchema, []byte(typ), b)
+	return
+}
+
+func newTypeUpdated(name string, kind DataType, schema DataSchema) (out item.Event, err error) {
+	var b []byte
+	var schemaBin []byte
+
+	if schemaBin, err = schema.EncodeSchema(); err != nil {
+		return
+	}
+	typ, payload := recUpdated, interface{}(recordTypeUpdated{Name: name, SchemaBin: schemaBin})
+	if kind == Enum {
+		typ, payload = enmUpdated, enumTypeUpdated{Name: name, SchemaBin: schemaBin}
+	}
+	if b, err = encode(payload); err != nil {
+		return
+	}
+	out = item.NewEvent(eventino.EventKindSchema, []byte(typ), b)
+	return
+}
+
+func newTypeDeleted(name string, kind DataType) (out item.Event, err error) {
+	var b []byte
+	typ, payload := recDeleted, interface{}(recordTypeDeleted{Name: name})
+	if kind == Enum {
+		typ, payload = enmDeleted, enumTypeDeleted{Name: name}
+	}
+	if b, err = encode(payload); err != nil {
+		return
+	}
+	out = item.NewEvent(eventino.EventKindSchema, []byte(typ), b)
+	return
+}
+
+func newCompatibilitySet(entName, evtName string, c Compatibility) (out item.Event, err error) {
+	var b []byte
+	if b, err = encode(compatibilitySet{Entity: entName, Event: evtName, Compatibility: c}); err != nil {
+		return
+	}
+	out = item.NewEvent(eventino.EventKindSchema, []byte(compatSet), b)
+	return
+}
+
 type entityTypeCreated struct {
 	Name string
 }
@@ -96,6 +161,13 @@ type entityEventTypeDeleted struct {
 	Name   string
 }
 
+// compatibilitySet sets the entity default when Event is empty
+type compatibilitySet struct {
+	Entity        string
+	Event         string
+	Compatibility Compatibility
+}
+
 type recordTypeCreated struct {
 	Name      string
 	SchemaBin []byte
@@ -111,24 +183,42 @@ type recordTypeDeleted struct {
 }
 
 type enumTypeCreated struct {
-	Name   string
-	Values []string
+	Name      string
+	SchemaBin []byte
 }
 
 type enumTypeUpdated struct {
-	Name   string
-	Values []string
+	Name      string
+	SchemaBin []byte
 }
 
 type enumTypeDeleted struct {
 	Name string
 }
 
+// getSchema returns the schema at the first version the stopper
+// matches, or the latest one with a nil stopper. The returned
+// schema is shared with the cache, and must not be modified
 func getSchema(txn *badger.Txn, schemaDec SchemaDecoder, stopper func(Schema) bool) (Schema, error) {
-	scm := Schema{VSN: 0, Entities: map[string]EntityType{}}
-	res, itemVsn, err := item.View(txn, schemaID, 0, schemaFolder(stopper, schemaDec), scm)
-	fmt.Println("getSchema vsn", res.(Schema).VSN, itemVsn)
-	return res.(Schema), err
+	versions, latest, err := cacheFor(schemaDec).load(txn, schemaDec)
+	if err != nil || stopper == nil {
+		return latest, err
+	}
+	// as the fold would, the stopper sees the version
+	// before applying the event, with the next VSN
+	scm := emptySchema()
+	for i, v := range versions {
+		probe := scm
+		probe.VSN = v.vsn
+		if stopper(probe) {
+			if i == len(versions)-1 {
+				return latest, nil
+			}
+			return v.apply(scm), nil
+		}
+		scm = v.apply(scm)
+	}
+	return latest, nil
 }
 
 func schemaFolder(stopper func(Schema) bool, schemaDec SchemaDecoder) item.ViewFoldFunc {
@@ -138,7 +228,8 @@ func schemaFolder(stopper func(Schema) bool, schemaDec SchemaDecoder) item.ViewF
 		if evt.Kind != eventino.EventKindSchema {
 			return acc, false, nil
 		}
-		scm := acc.(Schema)
+		// copy on write, the folded versions are cached
+		scm := acc.(Schema).clone()
 		scm.VSN++
 		fmt.Println("schemaFolder - kind right", scm.VSN, scm)
 		stop = stopper(scm)
@@ -150,7 +241,7 @@ func schemaFolder(stopper func(Schema) bool, schemaDec SchemaDecoder) item.ViewF
 			if err = decode(evt.Payload, e); err != nil {
 				return
 			}
-			scm.Entities[e.Name] = EntityType{Name: e.Name, VSN: 0, Events: map[EventSchemaID]DataSchema{}}
+			scm.Entities[e.Name] = EntityType{Name: e.Name, VSN: 0, Events: map[EventSchemaID]DataSchema{}, Compatibilities: map[string]Compatibility{}}
 		case entDeleted:
 			e := &entityTypeDeleted{}
 			if err = decode(evt.Payload, e); err != nil {
@@ -162,10 +253,10 @@ func schemaFolder(stopper func(Schema) bool, schemaDec SchemaDecoder) item.ViewF
 			if err = decode(evt.Payload, e); err != nil {
 				return
 			}
-			et := scm.Entities[e.Entity]
+			et := scm.Entities[e.Entity].clone()
 			et.VSN++
 			var evtSchema DataSchema
-			if evtSchema, err = schemaDec.Decode(e.SchemaBin); err != nil {
+			if evtSchema, err = schemaDec.WithTypes(scm).Decode(e.SchemaBin); err != nil {
 				return
 			}
 			et.Events[EventSchemaID{Name: e.Name, VSN: 0}] = evtSchema
@@ -175,10 +266,10 @@ func schemaFolder(stopper func(Schema) bool, schemaDec SchemaDecoder) item.ViewF
 			if err = decode(evt.Payload, e); err != nil {
 				return
 			}
-			et := scm.Entities[e.Entity]
+			et := scm.Entities[e.Entity].clone()
 			et.VSN++
 			var evtSchema DataSchema
-			if evtSchema, err = schemaDec.Decode(e.SchemaBin); err != nil {
+			if evtSchema, err = schemaDec.WithTypes(scm).Decode(e.SchemaBin); err != nil {
 				return
 			}
 			latestVsn := uint64(0)
@@ -194,18 +285,87 @@ func schemaFolder(stopper func(Schema) bool, schemaDec SchemaDecoder) item.ViewF
 			if err = decode(evt.Payload, e); err != nil {
 				return
 			}
-			et := scm.Entities[e.Entity]
+			et := scm.Entities[e.Entity].clone()
 			et.VSN++
 			for k := range et.Events {
 				if k.Name == e.Name {
 					delete(et.Events, k)
 				}
 			}
+			delete(et.Compatibilities, e.Name)
 			scm.Entities[e.Entity] = et
+		case compatSet:
+			e := &compatibilitySet{}
+			if err = decode(evt.Payload, e); err != nil {
+				return
+			}
+			et := scm.Entities[e.Entity].clone()
+			et.VSN++
+			if e.Event == "" {
+				et.Compatibility = e.Compatibility
+			} else {
+				et.Compatibilities[e.Event] = e.Compatibility
+			}
+			scm.Entities[e.Entity] = et
+		case recCreated, recUpdated:
+			e := &recordTypeCreated{}
+			if err = decode(evt.Payload, e); err != nil {
+				return
+			}
+			err = foldType(scm, scm.Records, e.Name, e.SchemaBin, string(evt.Type) == recUpdated, schemaDec)
+		case enmCreated, enmUpdated:
+			e := &enumTypeCreated{}
+			if err = decode(evt.Payload, e); err != nil {
+				return
+			}
+			err = foldType(scm, scm.Enums, e.Name, e.SchemaBin, string(evt.Type) == enmUpdated, schemaDec)
+		case recDeleted, enmDeleted:
+			e := &recordTypeDeleted{}
+			if err = decode(evt.Payload, e); err != nil {
+				return
+			}
+			for _, types := range []map[EventSchemaID]DataSchema{scm.Records, scm.Enums} {
+				if vsn, ok := latestTypeVSN(types, e.Name); ok {
+					scm.Deleted[e.Name] = vsn + 1
+				}
+				for k := range types {
+					if k.Name == e.Name {
+						delete(types, k)
+					}
+				}
+			}
 		default:
 		}
 
 		fmt.Println("schemaFolder - out ", scm)
-		return scm, stop, nil
+		return scm, stop, err
 	}
 }
+
+// foldType adds the new version of a named type: 0 when created, or
+// the next one of the deleted type, the latest one plus 1 when updated
+func foldType(scm Schema, types map[EventSchemaID]DataSchema, name string, schemaBin []byte, update bool, schemaDec SchemaDecoder) error {
+	ds, err := schemaDec.WithTypes(scm).Decode(schemaBin)
+	if err != nil {
+		return err
+	}
+	vsn := scm.Deleted[name]
+	if update {
+		vsn, _ = latestTypeVSN(types, name)
+		vsn++
+	} else {
+		delete(scm.Deleted, name)
+	}
+	types[NewEventSchemaID(name, vsn)] = ds
+	return nil
+}
+
+// latestTypeVSN returns the latest version of the named type, false if not found
+func latestTypeVSN(types map[EventSchemaID]DataSchema, name string) (vsn uint64, ok bool) {
+	for k := range types {
+		if k.Name == name && (!ok || k.VSN > vsn) {
+			vsn, ok = k.VSN, true
+		}
+	}
+	return
+}
@@ -0,0 +1,261 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cheng81/eventino/internal/eventino"
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/dgraph-io/badger"
+)
+
+// SchemaChange is a schema event, with the schema version it produced.
+// Entity is set on the entity, event type and compatibility changes
+type SchemaChange struct {
+	VSN       uint64
+	Timestamp time.Time
+	Type      string
+	Entity    string
+	Name      string
+}
+
+func (c SchemaChange) String() string {
+	name := c.Name
+	if c.Entity != "" && name != "" {
+		name = c.Entity + "." + name
+	} else if c.Entity != "" {
+		name = c.Entity
+	}
+	return fmt.Sprintf("%d %s %s %s", c.VSN, c.Timestamp.Format(time.RFC3339Nano), c.Type, name)
+}
+
+// schemaEventNames has the fields naming what the schema events change
+type schemaEventNames struct {
+	Entity string
+	Name   string
+	Event  string
+}
+
+// History returns the schema changes after the from version, up to the
+// to version (the latest one if 0), e.g. 12 and 20 return the changes
+// producing the versions 13 to 20
+func History(txn *badger.Txn, fromVsn, toVsn uint64) (out []SchemaChange, err error) {
+	var vsn uint64
+	_, _, err = item.View(txn, schemaID, 0, func(acc interface{}, evt item.Event, _ uint64) (interface{}, bool, error) {
+		if evt.Kind != eventino.EventKindSchema {
+			return acc, false, nil
+		}
+		vsn++
+		if toVsn > 0 && vsn > toVsn {
+			return acc, true, nil
+		}
+		if vsn <= fromVsn {
+			return acc, false, nil
+		}
+		names := &schemaEventNames{}
+		if err := decode(evt.Payload, names); err != nil {
+			return acc, true, err
+		}
+		change := SchemaChange{
+			VSN:       vsn,
+			Timestamp: time.Unix(0, int64(evt.LogID.Timestamp)),
+			Type:      string(evt.Type),
+			Entity:    names.Entity,
+			Name:      names.Name,
+		}
+		switch change.Type {
+		case entCreated, entDeleted:
+			change.Entity, change.Name = names.Name, ""
+		case compatSet:
+			change.Name = names.Event
+		}
+		out = append(out, change)
+		return acc, false, nil
+	}, nil)
+	return
+}
+
+// the changes of a field, see DataSchema.Diff
+const (
+	FieldAdded   = "added"
+	FieldRemoved = "removed"
+	FieldChanged = "changed"
+	FieldRenamed = "renamed"
+)
+
+// FieldChange is a change of a data schema field, e.g. $.address.street.
+// From and To describe its previous and next type, or its previous
+// and next name if renamed, that is the field has the previous as alias
+type FieldChange struct {
+	Path   string
+	Change string
+	From   string
+	To     string
+}
+
+// SchemaDiff is the difference between two schema versions
+type SchemaDiff struct {
+	From            uint64
+	To              uint64
+	EntitiesAdded   []string
+	EntitiesRemoved []string
+	Entities        []EntityDiff
+	TypesAdded      []EventSchemaID
+	TypesRemoved    []EventSchemaID
+}
+
+// EntityDiff is the difference of an entity type in both schema versions
+type EntityDiff struct {
+	Name          string
+	EventsAdded   []EventSchemaID
+	EventsRemoved []EventSchemaID
+	Events        []EventDiff
+}
+
+// EventDiff is the difference between the latest
+// versions of an event type in both schema versions
+type EventDiff struct {
+	Name    string
+	From    uint64
+	To      uint64
+	Changes []FieldChange
+}
+
+// DiffSchema returns the difference between two schema versions.
+// The from version 0 is the empty schema, the to version 0 the latest one
+func DiffSchema(txn *badger.Txn, dec SchemaDecoder, fromVsn, toVsn uint64) (out SchemaDiff, err error) {
+	from := emptySchema()
+	if fromVsn > 0 {
+		if from, err = GetSchema(txn, fromVsn, dec); err != nil {
+			return
+		}
+	}
+	var to Schema
+	if toVsn > 0 {
+		to, err = GetSchema(txn, toVsn, dec)
+	} else {
+		to, err = LatestSchema(txn, dec)
+	}
+	if err != nil {
+		return
+	}
+	return Diff(from, to), nil
+}
+
+// Diff returns the difference between two schemas
+func Diff(from, to Schema) SchemaDiff {
+	out := SchemaDiff{From: from.VSN, To: to.VSN}
+	for _, name := range sortedKeys(to.Entities) {
+		prev, ok := from.Entities[name]
+		if !ok {
+			out.EntitiesAdded = append(out.EntitiesAdded, name)
+			continue
+		}
+		if d := diffEntity(prev, to.Entities[name]); len(d.EventsAdded)+len(d.EventsRemoved)+len(d.Events) > 0 {
+			out.Entities = append(out.Entities, d)
+		}
+	}
+	for _, name := range sortedKeys(from.Entities) {
+		if _, ok := to.Entities[name]; !ok {
+			out.EntitiesRemoved = append(out.EntitiesRemoved, name)
+		}
+	}
+	for _, types := range [][2]map[EventSchemaID]DataSchema{{from.Records, to.Records}, {from.Enums, to.Enums}} {
+		added, removed := diffIDs(types[0], types[1])
+		out.TypesAdded = append(out.TypesAdded, added...)
+		out.TypesRemoved = append(out.TypesRemoved, removed...)
+	}
+	return out
+}
+
+func diffEntity(from, to EntityType) EntityDiff {
+	out := EntityDiff{Name: to.Name}
+	out.EventsAdded, out.EventsRemoved = diffIDs(from.Events, to.Events)
+	for _, name := range typeNames(to.Events) {
+		prevID, ok := from.LatestEvent(name)
+		if !ok {
+			continue
+		}
+		nextID, _ := to.LatestEvent(name)
+		if prevID == nextID {
+			continue
+		}
+		if changes := to.Events[nextID].Diff(from.Events[prevID]); len(changes) > 0 {
+			out.Events = append(out.Events, EventDiff{Name: name, From: prevID.VSN, To: nextID.VSN, Changes: changes})
+		}
+	}
+	return out
+}
+
+// diffIDs returns the versions added and removed, sorted
+func diffIDs(from, to map[EventSchemaID]DataSchema) (added, removed []EventSchemaID) {
+	for id := range to {
+		if _, ok := from[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	for id := range from {
+		if _, ok := to[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sortIDs(added)
+	sortIDs(removed)
+	return
+}
+
+func sortIDs(ids []EventSchemaID) {
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Name != ids[j].Name {
+			return ids[i].Name < ids[j].Name
+		}
+		return ids[i].VSN < ids[j].VSN
+	})
+}
+
+// String formats the difference, one change per line
+func (d SchemaDiff) String() string {
+	lines := []string{fmt.Sprintf("schema %d -> %d", d.From, d.To)}
+	for _, name := range d.EntitiesAdded {
+		lines = append(lines, "+ entity "+name)
+	}
+	for _, name := range d.EntitiesRemoved {
+		lines = append(lines, "- entity "+name)
+	}
+	for _, ent := range d.Entities {
+		lines = append(lines, "~ entity "+ent.Name)
+		for _, id := range ent.EventsAdded {
+			lines = append(lines, "  + event "+id.ToString())
+		}
+		for _, id := range ent.EventsRemoved {
+			lines = append(lines, "  - event "+id.ToString())
+		}
+		for _, evt := range ent.Events {
+			lines = append(lines, fmt.Sprintf("  ~ event %s %d -> %d", evt.Name, evt.From, evt.To))
+			for _, c := range evt.Changes {
+				lines = append(lines, "    "+c.String())
+			}
+		}
+	}
+	for _, id := range d.TypesAdded {
+		lines = append(lines, "+ type "+id.ToString())
+	}
+	for _, id := range d.TypesRemoved {
+		lines = append(lines, "- type "+id.ToString())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c FieldChange) String() string {
+	switch c.Change {
+	case FieldAdded:
+		return fmt.Sprintf("+ %s %s", c.Path, c.To)
+	case FieldRemoved:
+		return fmt.Sprintf("- %s %s", c.Path, c.From)
+	case FieldRenamed:
+		return fmt.Sprintf("> %s %s -> %s", c.Path, c.From, c.To)
+	}
+	return fmt.Sprintf("~ %s %s -> %s", c.Path, c.From, c.To)
+}
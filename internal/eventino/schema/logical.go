@@ -0,0 +1,93 @@
+package schema
+
+import (
+	"math/big"
+	"regexp"
+	"time"
+)
+
+// the conversions between the Go native values of the logical
+// types and the values they are stored as
+
+// ToTimestampMillis returns the milliseconds since the epoch
+func ToTimestampMillis(t time.Time) int64 {
+	return t.Unix()*1e3 + int64(t.Nanosecond())/1e6
+}
+
+// FromTimestampMillis returns the UTC time of the milliseconds since the epoch
+func FromTimestampMillis(ms int64) time.Time {
+	return time.Unix(ms/1e3, (ms%1e3)*1e6).UTC()
+}
+
+// ToTimestampMicros returns the microseconds since the epoch
+func ToTimestampMicros(t time.Time) int64 {
+	return t.Unix()*1e6 + int64(t.Nanosecond())/1e3
+}
+
+// FromTimestampMicros returns the UTC time of the microseconds since the epoch
+func FromTimestampMicros(us int64) time.Time {
+	return time.Unix(us/1e6, (us%1e6)*1e3).UTC()
+}
+
+// ToDateDays returns the days since the epoch of the UTC date of t
+func ToDateDays(t time.Time) int32 {
+	secs := t.Unix()
+	days := secs / 86400
+	if secs%86400 < 0 {
+		days--
+	}
+	return int32(days)
+}
+
+// FromDateDays returns the UTC midnight of the days since the epoch
+func FromDateDays(days int32) time.Time {
+	return time.Unix(int64(days)*86400, 0).UTC()
+}
+
+// ToDecimalBytes returns the unscaled value of r, as big-endian two's
+// complement bytes. False if r has more than scale decimal digits,
+// or more than precision digits
+func ToDecimalBytes(r *big.Rat, precision, scale int) ([]byte, bool) {
+	unscaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(scale)))
+	if !unscaled.IsInt() {
+		return nil, false
+	}
+	n := unscaled.Num()
+	if len(new(big.Int).Abs(n).String()) > precision {
+		return nil, false
+	}
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b, true
+	}
+	size := (n.BitLen() + 8) / 8
+	b := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), uint(size*8)), n).Bytes()
+	for len(b) < size {
+		b = append([]byte{0xff}, b...)
+	}
+	return b, true
+}
+
+// FromDecimalBytes returns the decimal of the
+// unscaled two's complement bytes, and the scale
+func FromDecimalBytes(b []byte, scale int) *big.Rat {
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return new(big.Rat).SetFrac(n, pow10(scale))
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidUUID is true for the canonical 8-4-4-4-12 hexadecimal form
+func ValidUUID(s string) bool {
+	return uuidRegexp.MatchString(s)
+}
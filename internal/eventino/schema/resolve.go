@@ -0,0 +1,239 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SchemaRules are the parts of the resolution rules and of the
+// diffs specific to a schema backend, see CanReadData and DiffData
+type SchemaRules interface {
+	// Deref returns the type referred by refs, or nil if unresolved
+	Deref(DataSchema) DataSchema
+	// Branches returns the branches of the unions and optionals
+	Branches(DataSchema) ([]DataSchema, bool)
+	// Items returns the type of the array items
+	Items(DataSchema) (DataSchema, bool)
+	// Enum returns the name and the symbols of the enums
+	Enum(DataSchema) (string, []string, bool)
+	// Promotes is true if the data of the writer type, not a record,
+	// enum, array or union, is read as the reader type
+	Promotes(reader, writer DataSchema) bool
+	// HasDefault is true if the record field has a default, or is nullable
+	HasDefault(r RecordSchema, name string) bool
+	// SameBranches is true if the union branches are diffed one by one
+	SameBranches(prev, next DataSchema) bool
+	// Describe is a short description of the type, e.g. optional<long>
+	Describe(DataSchema) string
+}
+
+// CanReadData checks the schema resolution rules reading
+// the data of the writer schema with the reader one
+func CanReadData(rules SchemaRules, reader, writer DataSchema) []Incompatibility {
+	return canRead(rules, "$", reader, writer)
+}
+
+func canRead(rules SchemaRules, path string, reader, writer DataSchema) []Incompatibility {
+	r, w := rules.Deref(reader), rules.Deref(writer)
+	if r == nil || w == nil {
+		return []Incompatibility{{Path: path, Rule: RuleTypeMismatch, Detail: "unresolved type"}}
+	}
+
+	// every writer branch must be readable
+	if branches, ok := rules.Branches(w); ok {
+		var out []Incompatibility
+		for _, branch := range branches {
+			out = append(out, canRead(rules, path, r, branch)...)
+		}
+		return out
+	}
+	// the writer type must match a reader branch
+	if branches, ok := rules.Branches(r); ok {
+		for _, branch := range branches {
+			if len(canRead(rules, path, branch, w)) == 0 {
+				return nil
+			}
+		}
+		return []Incompatibility{{
+			Path:   path,
+			Rule:   RuleMissingBranch,
+			Detail: fmt.Sprintf("writer %s matches no reader branch", rules.Describe(w)),
+		}}
+	}
+
+	if r.Type() == w.Type() {
+		switch r.Type() {
+		case Enum:
+			rName, rSymbols, _ := rules.Enum(r)
+			wName, wSymbols, _ := rules.Enum(w)
+			if wName != rName {
+				return nameMismatch(path, rName, wName)
+			}
+			var out []Incompatibility
+			for _, sym := range wSymbols {
+				if !HasSymbol(rSymbols, sym) {
+					out = append(out, Incompatibility{
+						Path:   path,
+						Rule:   RuleMissingSymbol,
+						Detail: fmt.Sprintf("reader enum %s has no symbol %s", rName, sym),
+					})
+				}
+			}
+			return out
+		case Array:
+			rItems, _ := rules.Items(r)
+			wItems, _ := rules.Items(w)
+			return canRead(rules, path+"[]", rItems, wItems)
+		case Record:
+			rRec, wRec := r.(RecordSchema), w.(RecordSchema)
+			if wRec.Name() != rRec.Name() {
+				return nameMismatch(path, rRec.Name(), wRec.Name())
+			}
+			return canReadFields(rules, path, rRec, wRec)
+		}
+	}
+	if rules.Promotes(r, w) {
+		return nil
+	}
+	return []Incompatibility{{
+		Path:   path,
+		Rule:   RuleTypeMismatch,
+		Detail: fmt.Sprintf("reader %s, writer %s", rules.Describe(r), rules.Describe(w)),
+	}}
+}
+
+// reader fields missing in the writer, by name or by alias, need a
+// default. Optional fields default to null. Writer fields missing in
+// the reader are skipped
+func canReadFields(rules SchemaRules, path string, r, w RecordSchema) []Incompatibility {
+	var out []Incompatibility
+	for _, name := range r.FieldNames() {
+		fieldPath := path + "." + name
+		rField, _, _ := r.Field(name)
+		if wField, ok := writerField(r, w, name); ok {
+			out = append(out, canRead(rules, fieldPath, rField, wField)...)
+		} else if !rules.HasDefault(r, name) {
+			out = append(out, Incompatibility{
+				Path:   fieldPath,
+				Rule:   RuleMissingDefault,
+				Detail: "field missing in the writer, and not optional",
+			})
+		}
+	}
+	return out
+}
+
+// writerField returns the writer field of the reader one,
+// named as it is or as one of its aliases
+func writerField(r, w RecordSchema, name string) (DataSchema, bool) {
+	if f, _, ok := w.Field(name); ok {
+		return f, true
+	}
+	_, options, _ := r.Field(name)
+	for _, alias := range options.Aliases {
+		if f, _, ok := w.Field(alias); ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// DiffData returns the changes from the previous to the next schema,
+// descending into the records, arrays and union branches
+func DiffData(rules SchemaRules, prev, next DataSchema) []FieldChange {
+	return diff(rules, "$", prev, next)
+}
+
+func diff(rules SchemaRules, path string, prev, next DataSchema) []FieldChange {
+	p, n := rules.Deref(prev), rules.Deref(next)
+	if p != nil && n != nil && p.Type() == n.Type() {
+		pBranches, pUnion := rules.Branches(p)
+		nBranches, nUnion := rules.Branches(n)
+		switch {
+		case n.Type() == Record && p.(RecordSchema).Name() == n.(RecordSchema).Name():
+			return diffFields(rules, path, p.(RecordSchema), n.(RecordSchema))
+		case n.Type() == Array:
+			pItems, _ := rules.Items(p)
+			nItems, _ := rules.Items(n)
+			return diff(rules, path+"[]", pItems, nItems)
+		case pUnion && nUnion && rules.SameBranches(p, n):
+			var out []FieldChange
+			for i := range nBranches {
+				out = append(out, diff(rules, path, pBranches[i], nBranches[i])...)
+			}
+			return out
+		}
+	}
+	if from, to := rules.Describe(p), rules.Describe(n); from != to {
+		return []FieldChange{{Path: path, Change: FieldChanged, From: from, To: to}}
+	}
+	return nil
+}
+
+// diffFields reports a field removed and added with the removed as
+// alias as renamed, followed by its changes
+func diffFields(rules SchemaRules, path string, p, n RecordSchema) []FieldChange {
+	has := func(r RecordSchema, name string) bool {
+		_, _, ok := r.Field(name)
+		return ok
+	}
+	// the next fields having a previous one as alias
+	renamedFrom, renamed := map[string]string{}, map[string]bool{}
+	for _, name := range n.FieldNames() {
+		if has(p, name) {
+			continue
+		}
+		_, options, _ := n.Field(name)
+		for _, alias := range options.Aliases {
+			if has(p, alias) && !has(n, alias) && !renamed[alias] {
+				renamedFrom[name], renamed[alias] = alias, true
+				break
+			}
+		}
+	}
+	names := n.FieldNames()
+	for _, name := range p.FieldNames() {
+		if !has(n, name) && !renamed[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var out []FieldChange
+	for _, name := range names {
+		fieldPath := path + "." + name
+		pField, _, inPrev := p.Field(name)
+		nField, _, inNext := n.Field(name)
+		if from, ok := renamedFrom[name]; ok {
+			pField, _, inPrev = p.Field(from)
+			out = append(out, FieldChange{Path: fieldPath, Change: FieldRenamed, From: from, To: name})
+		}
+		switch {
+		case !inPrev:
+			out = append(out, FieldChange{Path: fieldPath, Change: FieldAdded, To: rules.Describe(rules.Deref(nField))})
+		case !inNext:
+			out = append(out, FieldChange{Path: fieldPath, Change: FieldRemoved, From: rules.Describe(rules.Deref(pField))})
+		default:
+			out = append(out, diff(rules, fieldPath, pField, nField)...)
+		}
+	}
+	return out
+}
+
+// HasSymbol is true if sym is one of the enum symbols
+func HasSymbol(symbols []string, sym string) bool {
+	for _, s := range symbols {
+		if s == sym {
+			return true
+		}
+	}
+	return false
+}
+
+func nameMismatch(path, reader, writer string) []Incompatibility {
+	return []Incompatibility{{
+		Path:   path,
+		Rule:   RuleNameMismatch,
+		Detail: fmt.Sprintf("reader %s, writer %s", reader, writer),
+	}}
+}
@@ -25,10 +25,15 @@ func GetSchema(txn *badger.Txn, vsn uint64, dec SchemaDecoder) (Schema, error) {
 	return getSchema(txn, dec, func(s Schema) bool { return s.VSN >= vsn })
 }
 
+// LatestSchema returns the latest version of the schema
+func LatestSchema(txn *badger.Txn, dec SchemaDecoder) (Schema, error) {
+	return getSchema(txn, dec, nil)
+}
+
 // SchemaVSN returns the latest version of the schema
 func SchemaVSN(txn *badger.Txn, dec SchemaDecoder) (vsn uint64, err error) {
 	var scm Schema
-	if scm, err = getSchema(txn, dec, func(_ Schema) bool { return false }); err != nil {
+	if scm, err = getSchema(txn, dec, nil); err != nil {
 		return
 	}
 	vsn = scm.VSN
@@ -70,7 +75,7 @@ func DeleteEntityType(txn *badger.Txn, name string, dec SchemaDecoder) (err erro
 	var schema Schema
 	// var typ EntityType
 	var ok bool
-	if schema, err = getSchema(txn, dec, func(_ Schema) bool { return false }); err != nil {
+	if schema, err = getSchema(txn, dec, nil); err != nil {
 		return
 	}
 	// check entity type exists
@@ -137,6 +142,9 @@ func CreateEntityEventType(txn *badger.Txn, entName, evtName string, schema Data
 	if _, err = GetEntityType(txn, schema.SchemaDecoder(), entName, 0); err != nil {
 		return EntityTypeNotFound
 	}
+	if err = checkRefs(txn, schema); err != nil {
+		return
+	}
 
 	var evt item.Event
 	if evt, err = newEventTypeCreated(entName, evtName, schema); err != nil {
@@ -151,6 +159,12 @@ func UpdateEventType(txn *badger.Txn, entName, evtName string, schema DataSchema
 	if _, err = GetEntityType(txn, schema.SchemaDecoder(), entName, 0); err != nil {
 		return 0, EntityTypeNotFound
 	}
+	if err = checkRefs(txn, schema); err != nil {
+		return
+	}
+	if err = checkCompatibility(txn, entName, evtName, schema); err != nil {
+		return
+	}
 
 	// add event
 	var evt item.Event
@@ -228,3 +242,142 @@ func GetEventType(txn *badger.Txn, dec SchemaDecoder, entName, evtName string, v
 	}
 	return
 }
+
+// checkRefs ensures the named types referenced by the data schema
+// exist in the latest schema, since the schema fold resolves them
+func checkRefs(txn *badger.Txn, ds DataSchema) (err error) {
+	dec := ds.SchemaDecoder()
+	var scm Schema
+	if scm, err = LatestSchema(txn, dec); err != nil {
+		return
+	}
+	var b []byte
+	if b, err = ds.EncodeSchema(); err != nil {
+		return
+	}
+	_, err = dec.WithTypes(scm).Decode(b)
+	return
+}
+
+// checkCompatibility checks the update of the event type
+// against its latest schema, with the event type compatibility
+func checkCompatibility(txn *badger.Txn, entName, evtName string, ds DataSchema) (err error) {
+	var scm Schema
+	if scm, err = LatestSchema(txn, ds.SchemaDecoder()); err != nil {
+		return
+	}
+	et := scm.Entities[entName]
+	latestID, ok := et.LatestEvent(evtName)
+	if !ok {
+		return
+	}
+	c := et.CompatibilityOf(evtName)
+	if incompatibilities := CheckCompatibility(c, et.Events[latestID], ds); len(incompatibilities) > 0 {
+		err = IncompatibleSchemaError{Entity: entName, Event: evtName, Compatibility: c, Incompatibilities: incompatibilities}
+	}
+	return
+}
+
+// typeKind returns the kind of the latest version of the named type
+func typeKind(scm Schema, name string) (DataType, bool) {
+	if _, ok := latestTypeVSN(scm.Records, name); ok {
+		return Record, true
+	}
+	if _, ok := latestTypeVSN(scm.Enums, name); ok {
+		return Enum, true
+	}
+	return 0, false
+}
+
+// CreateType creates a named record or enum type, at version 0, or
+// after the versions of a deleted type with the same name.
+// Data schemas refer to it by name and version
+func CreateType(txn *badger.Txn, name string, ds DataSchema) (err error) {
+	kind := ds.Type()
+	if kind != Record && kind != Enum {
+		return InvalidType
+	}
+	var scm Schema
+	if scm, err = LatestSchema(txn, ds.SchemaDecoder()); err != nil {
+		return
+	}
+	if _, ok := typeKind(scm, name); ok {
+		return TypeExists
+	}
+	if err = checkRefs(txn, ds); err != nil {
+		return
+	}
+
+	var evt item.Event
+	if evt, err = newTypeCreated(name, kind, ds); err != nil {
+		return
+	}
+	_, err = item.Put(txn, schemaID, evt)
+	return
+}
+
+// UpdateType adds a new version of the named type, and returns it.
+// The versions already referenced are left untouched
+func UpdateType(txn *badger.Txn, name string, ds DataSchema) (vsn uint64, err error) {
+	var scm Schema
+	if scm, err = LatestSchema(txn, ds.SchemaDecoder()); err != nil {
+		return
+	}
+	kind, ok := typeKind(scm, name)
+	if !ok {
+		return 0, TypeNotFound
+	}
+	if ds.Type() != kind {
+		return 0, InvalidType
+	}
+	if err = checkRefs(txn, ds); err != nil {
+		return
+	}
+
+	var evt item.Event
+	if evt, err = newTypeUpdated(name, kind, ds); err != nil {
+		return
+	}
+	if _, err = item.Put(txn, schemaID, evt); err != nil {
+		return
+	}
+	types := scm.Records
+	if kind == Enum {
+		types = scm.Enums
+	}
+	vsn, _ = latestTypeVSN(types, name)
+	return vsn + 1, nil
+}
+
+// DeleteType removes every version of the named type. The data
+// schemas already referencing it are left untouched, new ones cannot
+func DeleteType(txn *badger.Txn, dec SchemaDecoder, name string) (err error) {
+	var scm Schema
+	if scm, err = LatestSchema(txn, dec); err != nil {
+		return
+	}
+	kind, ok := typeKind(scm, name)
+	if !ok {
+		return TypeNotFound
+	}
+
+	var evt item.Event
+	if evt, err = newTypeDeleted(name, kind); err != nil {
+		return
+	}
+	_, err = item.Put(txn, schemaID, evt)
+	return
+}
+
+// GetType returns the named type at the given version
+func GetType(txn *badger.Txn, dec SchemaDecoder, name string, vsn uint64) (out DataSchema, err error) {
+	var scm Schema
+	if scm, err = LatestSchema(txn, dec); err != nil {
+		return
+	}
+	var ok bool
+	if out, ok = scm.ResolveType(NewEventSchemaID(name, vsn)); !ok {
+		err = TypeNotFound
+	}
+	return
+}
@@ -2,6 +2,7 @@ package schemaavro
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/cheng81/eventino/internal/eventino/schema"
 	"github.com/linkedin/goavro"
@@ -10,6 +11,7 @@ import (
 var basicSchemaCodec *goavro.Codec
 
 type basicSchema struct {
+	avroBase
 	t    schema.DataType
 	jScm map[string]interface{}
 	scm  *goavro.Codec
@@ -30,6 +32,18 @@ func (b *basicSchema) AvroNativeMeta() map[string]interface{} {
 		ts = "DOUBLE"
 	case schema.Bytes:
 		ts = "BYTES"
+	case schema.Int32:
+		ts = "INT"
+	case schema.Float32:
+		ts = "FLOAT"
+	case schema.TimestampMillis:
+		ts = "TIMESTAMP_MILLIS"
+	case schema.TimestampMicros:
+		ts = "TIMESTAMP_MICROS"
+	case schema.Date:
+		ts = "DATE"
+	case schema.UUID:
+		ts = "UUID"
 	}
 	return map[string]interface{}{
 		"Simple": ts,
@@ -40,24 +54,41 @@ func (b *basicSchema) AvroNative() map[string]interface{} {
 	return b.jScm
 }
 
-func (b *basicSchema) SchemaDecoder() schema.SchemaDecoder {
-	return avroSchemaDecoder{}
+func (b *basicSchema) Type() schema.DataType {
+	return b.t
 }
 
-func (b *basicSchema) EncodeSchema() ([]byte, error) {
-	return avroSchemaCodec.BinaryFromNative(nil, b.AvroNativeMeta())
+func (b *basicSchema) resolved() bool {
+	return true
 }
 
-func (b *basicSchema) EncodeSchemaNative() interface{} {
-	return b.AvroNativeMeta()
-}
-
-func (b *basicSchema) Encoder() schema.DataEncoder {
-	return b
-}
-
-func (b *basicSchema) Decoder() schema.DataDecoder {
-	return b
+// normalize converts the Go native values of the
+// logical types to the values they are stored as
+func (b *basicSchema) normalize(v interface{}) (interface{}, bool) {
+	switch b.t {
+	case schema.TimestampMillis:
+		if t, ok := v.(time.Time); ok {
+			return schema.ToTimestampMillis(t), true
+		}
+		_, ok := v.(int64)
+		return v, ok
+	case schema.TimestampMicros:
+		if t, ok := v.(time.Time); ok {
+			return schema.ToTimestampMicros(t), true
+		}
+		_, ok := v.(int64)
+		return v, ok
+	case schema.Date:
+		if t, ok := v.(time.Time); ok {
+			return schema.ToDateDays(t), true
+		}
+		_, ok := v.(int32)
+		return v, ok
+	case schema.UUID:
+		str, ok := v.(string)
+		return v, ok && schema.ValidUUID(str)
+	}
+	return v, b.Valid(v)
 }
 
 func (b *basicSchema) Valid(v interface{}) (out bool) {
@@ -74,13 +105,38 @@ func (b *basicSchema) Valid(v interface{}) (out bool) {
 		_, out = v.(float64)
 	case schema.Bytes:
 		_, out = v.([]byte)
+	case schema.Int32:
+		_, out = v.(int32)
+	case schema.Float32:
+		_, out = v.(float32)
+	default:
+		_, out = b.normalize(v)
 	}
 	return
 }
 
+// GoNative converts the timestamps and dates to time.Time
+func (b *basicSchema) GoNative(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int64:
+		if b.t == schema.TimestampMillis {
+			return schema.FromTimestampMillis(n)
+		}
+		if b.t == schema.TimestampMicros {
+			return schema.FromTimestampMicros(n)
+		}
+	case int32:
+		if b.t == schema.Date {
+			return schema.FromDateDays(n)
+		}
+	}
+	return v
+}
+
 // DataEncoder
 func (b *basicSchema) Encode(v interface{}) ([]byte, error) {
-	return b.scm.BinaryFromNative(nil, v)
+	n, _ := b.normalize(v)
+	return b.scm.BinaryFromNative(nil, n)
 }
 
 // DataDecoder
@@ -96,7 +152,9 @@ func newBasicSchema(t schema.DataType, schemaSpecs string) *basicSchema {
 	}
 	var jsonScm map[string]interface{}
 	json.Unmarshal([]byte(schemaSpecs), &jsonScm)
-	return &basicSchema{t: t, scm: codec, jScm: jsonScm}
+	b := &basicSchema{t: t, scm: codec, jScm: jsonScm}
+	b.avroBase = avroBase{b}
+	return b
 }
 
 var nilSchema *basicSchema
@@ -105,6 +163,12 @@ var stringSchema *basicSchema
 var longSchema *basicSchema
 var doublueSchema *basicSchema
 var bytesSchema *basicSchema
+var intSchema *basicSchema
+var floatSchema *basicSchema
+var timestampMillisSchema *basicSchema
+var timestampMicrosSchema *basicSchema
+var dateSchema *basicSchema
+var uuidSchema *basicSchema
 
 func init() {
 	nilSchema = newBasicSchema(schema.Null, `{"type":"null"}`)
@@ -113,4 +177,10 @@ func init() {
 	longSchema = newBasicSchema(schema.Int64, `{"type":"long"}`)
 	doublueSchema = newBasicSchema(schema.Float64, `{"type":"double"}`)
 	bytesSchema = newBasicSchema(schema.Bytes, `{"type":"bytes"}`)
+	intSchema = newBasicSchema(schema.Int32, `{"type":"int"}`)
+	floatSchema = newBasicSchema(schema.Float32, `{"type":"float"}`)
+	timestampMillisSchema = newBasicSchema(schema.TimestampMillis, `{"type":"long","logicalType":"timestamp-millis"}`)
+	timestampMicrosSchema = newBasicSchema(schema.TimestampMicros, `{"type":"long","logicalType":"timestamp-micros"}`)
+	dateSchema = newBasicSchema(schema.Date, `{"type":"int","logicalType":"date"}`)
+	uuidSchema = newBasicSchema(schema.UUID, `{"type":"string","logicalType":"uuid"}`)
 }
@@ -0,0 +1,99 @@
+package schemaavro
+
+import (
+	"strings"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// avroRules are the avro schema resolution rules, see schema.SchemaRules
+type avroRules struct{}
+
+// Deref returns the type referred by refs, or nil if unresolved
+func (avroRules) Deref(ds schema.DataSchema) schema.DataSchema {
+	return deref(ds)
+}
+
+func (avroRules) Branches(ds schema.DataSchema) ([]schema.DataSchema, bool) {
+	if u, ok := ds.(*avroUnionSchema); ok {
+		return u.types, true
+	}
+	return nil, false
+}
+
+func (avroRules) Items(ds schema.DataSchema) (schema.DataSchema, bool) {
+	if a, ok := ds.(*avroArraySchema); ok {
+		return a.items, true
+	}
+	return nil, false
+}
+
+func (avroRules) Enum(ds schema.DataSchema) (string, []string, bool) {
+	if e, ok := ds.(*avroEnumSchema); ok {
+		return e.name, e.symbols, true
+	}
+	return "", nil, false
+}
+
+// Promotes reads the numbers as the wider ones, strings as bytes and
+// back, and the decimals unscaled values as they are
+func (avroRules) Promotes(reader, writer schema.DataSchema) bool {
+	switch r := reader.(type) {
+	case *basicSchema:
+		w, ok := writer.(*basicSchema)
+		return ok && promotes(w.t, r.t)
+	case *avroDecimalSchema:
+		w, ok := writer.(*avroDecimalSchema)
+		return ok && w.scale == r.scale && w.precision <= r.precision
+	}
+	return false
+}
+
+func (avroRules) HasDefault(r schema.RecordSchema, name string) bool {
+	return r.(*avroRecordSchema).hasDefault(name)
+}
+
+// SameBranches is true if the unions have the same branch names
+func (avroRules) SameBranches(prev, next schema.DataSchema) bool {
+	return strings.Join(prev.(*avroUnionSchema).names, ",") == strings.Join(next.(*avroUnionSchema).names, ",")
+}
+
+func (avroRules) Describe(ds schema.DataSchema) string {
+	return describe(ds)
+}
+
+// promotes is true if the writer type can be read as the reader type
+func promotes(w, r schema.DataType) bool {
+	switch {
+	case w == r:
+		return true
+	case w == schema.Int32 && (r == schema.Int64 || r == schema.Float32 || r == schema.Float64):
+		return true
+	case w == schema.Int64 && (r == schema.Float32 || r == schema.Float64):
+		return true
+	case w == schema.Float32 && r == schema.Float64:
+		return true
+	case w == schema.String && r == schema.Bytes, w == schema.Bytes && r == schema.String:
+		return true
+	}
+	return false
+}
+
+// deref returns the type referred by refs, or nil if unresolved
+func deref(ds schema.DataSchema) schema.DataSchema {
+	for {
+		ref, ok := ds.(*avroRefSchema)
+		if !ok {
+			return ds
+		}
+		if ref.target == nil {
+			return nil
+		}
+		ds = ref.target
+	}
+}
+
+// typeName is the avro name of the type, as in the union branches
+func typeName(ds schema.DataSchema) string {
+	return branchName(ds.(avroSchema).AvroNative())
+}
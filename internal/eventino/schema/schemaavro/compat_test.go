@@ -0,0 +1,96 @@
+package schemaavro
+
+import (
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestCanRead(t *testing.T) {
+	f := Factory()
+	str, long, dbl := f.SimpleType(schema.String), f.SimpleType(schema.Int64), f.SimpleType(schema.Float64)
+	v0 := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetField("age", long).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		ToDataSchema()
+
+	// added optional field, widened type, added symbol
+	v1 := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetField("age", dbl).
+		SetField("color", f.NewEnum("color", "RED", "GREEN", "BLUE")).
+		SetField("email", f.NewOptional(str)).
+		ToDataSchema()
+	if out := v1.CanRead(v0); len(out) != 0 {
+		t.Fatal("v1 should read v0", out)
+	}
+	out := v0.CanRead(v1)
+	if len(out) != 2 {
+		t.Fatal("v0 should not read v1", out)
+	}
+	if out[0].Path != "$.age" || out[0].Rule != schema.RuleTypeMismatch {
+		t.Fatal("double cannot be read as long", out[0])
+	}
+	if out[1].Path != "$.color" || out[1].Rule != schema.RuleMissingSymbol {
+		t.Fatal("BLUE cannot be read", out[1])
+	}
+
+	// added required field
+	v2 := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetField("age", long).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		SetField("tags", f.NewArray(str)).
+		ToDataSchema()
+	if out = v2.CanRead(v0); len(out) != 1 || out[0].Path != "$.tags" || out[0].Rule != schema.RuleMissingDefault {
+		t.Fatal("tags has no default", out)
+	}
+	// removed fields are skipped
+	if out = v0.CanRead(v2); len(out) != 0 {
+		t.Fatal("v0 should read v2", out)
+	}
+
+	renamed := f.NewRecord().SetName("made").SetField("name", str).ToDataSchema()
+	if out = renamed.CanRead(v0); len(out) != 1 || out[0].Rule != schema.RuleNameMismatch {
+		t.Fatal("records should have the same name", out)
+	}
+
+	// added field with a default, renamed field read by its alias
+	v3 := f.NewRecord().SetName("created").
+		SetField("fullName", str).
+		SetFieldOptions("fullName", schema.FieldOptions{Aliases: []string{"name"}}).
+		SetField("age", long).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		SetField("tags", f.NewArray(str)).
+		SetFieldOptions("tags", schema.FieldOptions{Default: []interface{}{}}).
+		ToDataSchema()
+	if out = v3.CanRead(v0); len(out) != 0 {
+		t.Fatal("v3 should read v0", out)
+	}
+	if out = v3.CanRead(f.NewRecord().SetName("created").SetField("name", long).ToDataSchema()); len(out) != 3 || out[2].Path != "$.fullName" || out[2].Rule != schema.RuleTypeMismatch {
+		t.Fatal("the aliased field should have the same type", out)
+	}
+}
+
+func TestCanReadUnion(t *testing.T) {
+	f := Factory()
+	str, long, boolean := f.SimpleType(schema.String), f.SimpleType(schema.Int64), f.SimpleType(schema.Bool)
+	u := f.NewUnion(long, str)
+
+	if out := u.CanRead(long); len(out) != 0 {
+		t.Fatal("union should read its branch", out)
+	}
+	if out := u.CanRead(boolean); len(out) != 1 || out[0].Rule != schema.RuleMissingBranch {
+		t.Fatal("union should not read boolean", out)
+	}
+	if out := long.CanRead(u); len(out) != 1 || out[0].Rule != schema.RuleTypeMismatch {
+		t.Fatal("long should not read the string branch", out)
+	}
+	if out := f.NewUnion(str, long, boolean).CanRead(u); len(out) != 0 {
+		t.Fatal("wider union should read", out)
+	}
+	if out := f.NewOptional(f.NewArray(str)).CanRead(f.NewArray(f.SimpleType(schema.Bytes))); len(out) != 0 {
+		t.Fatal("bytes should be read as strings", out)
+	}
+}
@@ -1,7 +1,6 @@
 package schemaavro
 
 import (
-	"encoding/json"
 	"reflect"
 
 	"github.com/cheng81/eventino/internal/eventino/schema"
@@ -9,68 +8,66 @@ import (
 )
 
 type avroArraySchema struct {
+	avroBase
 	items schema.DataSchema
 	scm   *goavro.Codec
 	jScm  map[string]interface{}
 }
 
+// newArray panics if the array is not valid, see buildArray
 func newArray(items schema.DataSchema) schema.DataSchema {
+	s, err := buildArray(items)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func buildArray(items schema.DataSchema) (schema.DataSchema, error) {
 	jScm := map[string]interface{}{
 		"type":  "array",
 		"items": items.(avroSchema).AvroNative(),
 	}
-	b, err := json.Marshal(jScm)
+	scm, err := buildCodec(jScm, items.(avroSchema).resolved())
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	scm, err := goavro.NewCodec(string(b))
-	if err != nil {
-		panic(err)
-	}
-	return &avroArraySchema{items: items, scm: scm, jScm: jScm}
+	s := &avroArraySchema{items: items, scm: scm, jScm: jScm}
+	s.avroBase = avroBase{s}
+	return s, nil
 }
 
-func (*avroArraySchema) SchemaDecoder() schema.SchemaDecoder {
-	return avroSchemaDecoder{}
+func (s *avroArraySchema) Type() schema.DataType {
+	return schema.Array
 }
 
-func (s *avroArraySchema) EncodeSchemaNative() interface{} {
-	return s.AvroNativeMeta()
+func (s *avroArraySchema) resolved() bool {
+	return s.items.(avroSchema).resolved()
 }
 
-func (s *avroArraySchema) EncodeSchema() ([]byte, error) {
-	return avroSchemaCodec.BinaryFromNative(nil, s.AvroNativeMeta())
-}
-
-func (s *avroArraySchema) Encoder() schema.DataEncoder {
-	return s
-}
-
-func (s *avroArraySchema) Decoder() schema.DataDecoder {
-	return s
-}
-
-func (s *avroArraySchema) Valid(v interface{}) bool {
+func (s *avroArraySchema) normalize(v interface{}) (interface{}, bool) {
 	vv := reflect.ValueOf(v)
-	if vv.Kind() == reflect.Slice {
-		if vv.Len() > 0 {
-			return s.items.Valid(vv.Index(0).Interface())
+	if vv.Kind() != reflect.Slice {
+		return v, false
+	}
+	out := make([]interface{}, vv.Len())
+	for i := range out {
+		n, ok := s.items.(avroSchema).normalize(vv.Index(i).Interface())
+		if !ok {
+			return v, false
 		}
-
-		// ugh.. I guess?
-		return true
-
+		out[i] = n
 	}
-	return false
+	return out, true
 }
 
 func (s *avroArraySchema) Encode(v interface{}) ([]byte, error) {
-	return s.scm.BinaryFromNative(nil, v)
+	n, _ := s.normalize(v)
+	return encodeWith(s.scm, n)
 }
 
 func (s *avroArraySchema) Decode(buf []byte) (interface{}, error) {
-	out, _, err := s.scm.NativeFromBinary(buf)
-	return out, err
+	return decodeWith(s.scm, buf)
 }
 
 func (s *avroArraySchema) AvroNative() map[string]interface{} {
@@ -0,0 +1,39 @@
+package schemaavro
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// describe is a short description of the type, e.g. optional<long>,
+// enum color{RED,GREEN}, record created or timestamp-millis
+func describe(ds schema.DataSchema) string {
+	switch s := ds.(type) {
+	case nil:
+		return "unresolved"
+	case *avroRecordSchema:
+		return "record " + s.name
+	case *avroEnumSchema:
+		return fmt.Sprintf("enum %s{%s}", s.name, strings.Join(s.symbols, ","))
+	case *avroArraySchema:
+		return fmt.Sprintf("array<%s>", describe(deref(s.items)))
+	case *avroDecimalSchema:
+		return fmt.Sprintf("decimal(%d,%d)", s.precision, s.scale)
+	case *basicSchema:
+		if logical, ok := s.jScm["logicalType"].(string); ok {
+			return logical
+		}
+	case *avroUnionSchema:
+		if s.optional {
+			return fmt.Sprintf("optional<%s>", describe(deref(s.types[1])))
+		}
+		branches := make([]string, len(s.types))
+		for i, t := range s.types {
+			branches[i] = describe(deref(t))
+		}
+		return fmt.Sprintf("union<%s>", strings.Join(branches, ","))
+	}
+	return typeName(ds)
+}
@@ -0,0 +1,67 @@
+package schemaavro
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestDiff(t *testing.T) {
+	f := Factory()
+	str, long := f.SimpleType(schema.String), f.SimpleType(schema.Int64)
+	address := f.NewRecord().SetName("address").SetField("street", str).ToDataSchema()
+	v0 := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetField("age", long).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		SetField("home", address).
+		ToDataSchema()
+	if out := v0.Diff(v0); len(out) != 0 {
+		t.Fatal("same schema should have no changes", out)
+	}
+
+	v1 := f.NewRecord().SetName("created").
+		SetField("name", f.SimpleType(schema.Bytes)).
+		SetField("color", f.NewEnum("color", "RED", "GREEN", "BLUE")).
+		SetField("home", f.NewRecord().SetName("address").SetField("street", str).SetField("zip", f.NewOptional(str)).ToDataSchema()).
+		SetField("tags", f.NewArray(str)).
+		ToDataSchema()
+	out := v1.Diff(v0)
+	expected := []schema.FieldChange{
+		{Path: "$.age", Change: schema.FieldRemoved, From: "long"},
+		{Path: "$.color", Change: schema.FieldChanged, From: "enum color{RED,GREEN}", To: "enum color{RED,GREEN,BLUE}"},
+		{Path: "$.home.zip", Change: schema.FieldAdded, To: "optional<string>"},
+		{Path: "$.name", Change: schema.FieldChanged, From: "string", To: "bytes"},
+		{Path: "$.tags", Change: schema.FieldAdded, To: "array<string>"},
+	}
+	if fmt.Sprint(out) != fmt.Sprint(expected) {
+		t.Fatal("wrong changes", out)
+	}
+
+	// refs are compared by their target
+	withRef := f.NewRecord().SetName("created").
+		SetField("home", newRef(schema.NewEventSchemaID("address", 0), address)).
+		ToDataSchema()
+	withRecord := f.NewRecord().SetName("created").SetField("home", address).ToDataSchema()
+	if out = withRef.Diff(withRecord); len(out) != 0 {
+		t.Fatal("ref should be the same as its target", out)
+	}
+
+	// a field added with the removed one as alias is renamed
+	v2 := f.NewRecord().SetName("created").
+		SetField("fullName", f.SimpleType(schema.String)).
+		SetFieldOptions("fullName", schema.FieldOptions{Aliases: []string{"name"}}).
+		ToDataSchema()
+	out = v2.Diff(v1)
+	expected = []schema.FieldChange{
+		{Path: "$.color", Change: schema.FieldRemoved, From: "enum color{RED,GREEN,BLUE}"},
+		{Path: "$.fullName", Change: schema.FieldRenamed, From: "name", To: "fullName"},
+		{Path: "$.fullName", Change: schema.FieldChanged, From: "bytes", To: "string"},
+		{Path: "$.home", Change: schema.FieldRemoved, From: "record address"},
+		{Path: "$.tags", Change: schema.FieldRemoved, From: "array<string>"},
+	}
+	if fmt.Sprint(out) != fmt.Sprint(expected) {
+		t.Fatal("wrong renamed changes", out)
+	}
+}
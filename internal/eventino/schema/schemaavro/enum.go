@@ -0,0 +1,97 @@
+package schemaavro
+
+import (
+	"fmt"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/linkedin/goavro"
+)
+
+type avroEnumSchema struct {
+	avroBase
+	name    string
+	symbols []string
+	scm     *goavro.Codec
+	jScm    map[string]interface{}
+}
+
+// newEnum panics if the enum is not valid, see buildEnum
+func newEnum(name string, symbols []string) schema.DataSchema {
+	s, err := buildEnum(name, symbols)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// buildEnum returns an error if the name or the symbols
+// are not valid, e.g. duplicated
+func buildEnum(name string, symbols []string) (schema.DataSchema, error) {
+	jSymbols := make([]interface{}, len(symbols))
+	for i, s := range symbols {
+		if schema.HasSymbol(symbols[:i], s) {
+			return nil, fmt.Errorf("enum %s: duplicated symbol %s", name, s)
+		}
+		jSymbols[i] = s
+	}
+	jScm := map[string]interface{}{
+		"type":    "enum",
+		"name":    name,
+		"symbols": jSymbols,
+	}
+	scm, err := buildCodec(jScm, true)
+	if err != nil {
+		return nil, err
+	}
+	s := &avroEnumSchema{name: name, symbols: symbols, scm: scm, jScm: jScm}
+	s.avroBase = avroBase{s}
+	return s, nil
+}
+
+func (s *avroEnumSchema) Type() schema.DataType {
+	return schema.Enum
+}
+
+func (s *avroEnumSchema) resolved() bool {
+	return true
+}
+
+// enum values are one of the symbols
+func (s *avroEnumSchema) normalize(v interface{}) (interface{}, bool) {
+	str, ok := v.(string)
+	if !ok {
+		return v, false
+	}
+	for _, sym := range s.symbols {
+		if sym == str {
+			return v, true
+		}
+	}
+	return v, false
+}
+
+func (s *avroEnumSchema) Encode(v interface{}) ([]byte, error) {
+	return s.scm.BinaryFromNative(nil, v)
+}
+
+func (s *avroEnumSchema) Decode(buf []byte) (interface{}, error) {
+	out, _, err := s.scm.NativeFromBinary(buf)
+	return out, err
+}
+
+func (s *avroEnumSchema) AvroNative() map[string]interface{} {
+	return s.jScm
+}
+
+func (s *avroEnumSchema) AvroNativeMeta() map[string]interface{} {
+	values := make([]interface{}, len(s.symbols))
+	for i, sym := range s.symbols {
+		values[i] = sym
+	}
+	return map[string]interface{}{
+		"Enum": map[string]interface{}{
+			"name":   s.name,
+			"values": values,
+		},
+	}
+}
@@ -0,0 +1,62 @@
+package schemaavro
+
+import (
+	"testing"
+)
+
+func TestEnum(t *testing.T) {
+	f := Factory()
+	enumT := f.NewEnum("color", "RED", "GREEN", "BLUE")
+
+	if !enumT.Valid("GREEN") {
+		t.Fatal("symbol should be valid")
+	}
+	if enumT.Valid("PINK") || enumT.Valid(int64(1)) {
+		t.Fatal("only symbols should be valid")
+	}
+
+	b, err := enumT.Encoder().Encode("BLUE")
+	if err != nil {
+		t.Fatal("should not fail on encode", err)
+	}
+	v, err := enumT.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should not fail on decode", err)
+	}
+	if v != "BLUE" {
+		t.Fatal("decoded symbol should be BLUE", v)
+	}
+}
+
+func TestEnumMeta(t *testing.T) {
+	f := Factory()
+	enumT := f.NewEnum("color", "RED", "GREEN", "BLUE")
+
+	b, err := enumT.EncodeSchema()
+	if err != nil {
+		t.Fatal("should not fail on encode", err)
+	}
+	dec, err := f.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode avro bytes", err)
+	}
+	enumDec, ok := dec.(*avroEnumSchema)
+	if !ok {
+		t.Fatal("decoded schema should be enum")
+	}
+	if enumDec.name != "color" || len(enumDec.symbols) != 3 || enumDec.symbols[2] != "BLUE" {
+		t.Fatal("decoded enum should match", enumDec.name, enumDec.symbols)
+	}
+}
+
+func TestEnumInvalid(t *testing.T) {
+	dec := Factory().Decoder()
+	for _, spec := range []map[string]interface{}{
+		{"name": "bad name", "values": []interface{}{"a"}},
+		{"name": "color", "values": []interface{}{"a", "a"}},
+	} {
+		if _, err := dec.DecodeNative(map[string]interface{}{"Enum": spec}); err == nil {
+			t.Fatal("invalid enum should not be decoded", spec)
+		}
+	}
+}
@@ -14,9 +14,14 @@ import (
 
 var avroSchemaCodec *goavro.Codec
 
-// TODO: encode also our truly "OPTIONAL",
-// which underlying is mapped to a union:
-// optional(T) -> union(nil, T)
+// OPTIONAL is our optional(T), which underlying is
+// mapped to a union: optional(T) -> union(null, T).
+// New types go last, so that the schemas already
+// encoded can still be decoded. Decimal is defined
+// at its first use, in the UNION types.
+// RECORD_FIELDS is a record whose fields have options:
+// a doc, a default (as avro JSON), aliases, and the
+// optional flag
 const avroSchemaSchema = `
 {
 	"type": [
@@ -32,7 +37,7 @@ const avroSchemaSchema = `
 		 "fields": [{"name": "typename", "type": "string"}]},
 		{"type": "enum",
 		 "name": "Simple",
-		 "symbols": ["INT", "LONG", "STRING", "BOOLEAN", "FLOAT", "DOUBLE", "NULL", "BYTES"]},
+		 "symbols": ["INT", "LONG", "STRING", "BOOLEAN", "FLOAT", "DOUBLE", "NULL", "BYTES", "TIMESTAMP_MILLIS", "TIMESTAMP_MICROS", "DATE", "UUID"]},
 		{"type": "record",
  		 "name": "Complex",
 		 "fields": [{
@@ -40,16 +45,34 @@ const avroSchemaSchema = `
 			"type": [
 				{"type": "record",
 					"name": "UNION",
-					"fields": [{"name": "types", "type": {"type": "array", "items": ["Simple", "Complex", "Enum", "Ref"]}}]},
+					"fields": [{"name": "types", "type": {"type": "array", "items": ["Simple", "Complex", "Enum", "Ref",
+						{"type": "record",
+						 "name": "Decimal",
+						 "fields": [{"name": "precision", "type": "int"}, {"name": "scale", "type": "int"}]}]}}]},
 				{"type": "record",
 					"name": "ARRAY",
-					"fields": [{"name": "items", "type": ["Simple", "Complex", "Enum", "Ref"]}]},
+					"fields": [{"name": "items", "type": ["Simple", "Complex", "Enum", "Ref", "Decimal"]}]},
 				{"type": "record",
 					"name": "RECORD",
 					"fields": [{"name": "name", "type": "string"},
-										 {"name": "fields", "type": {"type": "map", "values": ["Simple", "Complex", "Enum", "Ref"]}}]}
+										 {"name": "fields", "type": {"type": "map", "values": ["Simple", "Complex", "Enum", "Ref", "Decimal"]}}]},
+				{"type": "record",
+					"name": "OPTIONAL",
+					"fields": [{"name": "type", "type": ["Simple", "Complex", "Enum", "Ref", "Decimal"]}]},
+				{"type": "record",
+					"name": "RECORD_FIELDS",
+					"fields": [{"name": "name", "type": "string"},
+										 {"name": "fields", "type": {"type": "map", "values": {
+											 "type": "record",
+											 "name": "Field",
+											 "fields": [{"name": "type", "type": ["Simple", "Complex", "Enum", "Ref", "Decimal"]},
+																	{"name": "doc", "type": ["null", "string"]},
+																	{"name": "default", "type": ["null", "string"]},
+																	{"name": "optional", "type": "boolean"},
+																	{"name": "aliases", "type": {"type": "array", "items": "string"}}]}}}]}
 			]
-		}]}
+		}]},
+		"Decimal"
 	]
 }
 `
@@ -58,6 +81,58 @@ const avroSchemaSchema = `
 type avroSchema interface {
 	AvroNativeMeta() map[string]interface{}
 	AvroNative() map[string]interface{}
+	// normalize returns v in the form goavro expects, e.g. union
+	// values wrapped in their branch, and whether v is valid
+	normalize(v interface{}) (interface{}, bool)
+	// resolved is false if the schema refers to a type not resolved
+	resolved() bool
+}
+
+// avroBase implements the schema.DataSchema methods shared by the avro
+// schemas on top of their avroSchema methods. self is the embedding schema
+type avroBase struct {
+	self schema.DataSchema
+}
+
+func (avroBase) SchemaDecoder() schema.SchemaDecoder {
+	return avroSchemaDecoder{}
+}
+
+func (b avroBase) EncodeSchemaNative() interface{} {
+	return b.self.(avroSchema).AvroNativeMeta()
+}
+
+func (b avroBase) EncodeSchema() ([]byte, error) {
+	return avroSchemaCodec.BinaryFromNative(nil, b.self.(avroSchema).AvroNativeMeta())
+}
+
+func (b avroBase) Encoder() schema.DataEncoder {
+	return b.self.(schema.DataEncoder)
+}
+
+func (b avroBase) Decoder() schema.DataDecoder {
+	return b.self.(schema.DataDecoder)
+}
+
+func (b avroBase) Valid(v interface{}) bool {
+	_, ok := b.self.(avroSchema).normalize(v)
+	return ok
+}
+
+func (b avroBase) Validate(v interface{}) []schema.ValidationError {
+	return validate("", b.self, v)
+}
+
+func (b avroBase) CanRead(writer schema.DataSchema) []schema.Incompatibility {
+	return schema.CanReadData(avroRules{}, b.self, writer)
+}
+
+func (b avroBase) Diff(prev schema.DataSchema) []schema.FieldChange {
+	return schema.DiffData(avroRules{}, prev, b.self)
+}
+
+func (b avroBase) GoNative(v interface{}) interface{} {
+	return goNative(b.self, v)
 }
 
 // MetaSchema is the native avro schema to encode avro-like schemas
@@ -96,6 +171,18 @@ func (avroSchemaFactory) SimpleType(t schema.DataType) schema.DataSchema {
 		return doublueSchema
 	case schema.Bytes:
 		return bytesSchema
+	case schema.Int32:
+		return intSchema
+	case schema.Float32:
+		return floatSchema
+	case schema.TimestampMillis:
+		return timestampMillisSchema
+	case schema.TimestampMicros:
+		return timestampMicrosSchema
+	case schema.Date:
+		return dateSchema
+	case schema.UUID:
+		return uuidSchema
 	}
 	return nil
 
@@ -109,6 +196,28 @@ func (avroSchemaFactory) NewArray(items schema.DataSchema) schema.DataSchema {
 	return newArray(items)
 }
 
+func (avroSchemaFactory) NewEnum(name string, symbols ...string) schema.DataSchema {
+	return newEnum(name, symbols)
+}
+
+func (avroSchemaFactory) NewOptional(t schema.DataSchema) schema.DataSchema {
+	return newOptional(t)
+}
+
+func (avroSchemaFactory) NewUnion(types ...schema.DataSchema) schema.DataSchema {
+	return newUnion(types, false)
+}
+
+// NewRef refers to the named type at the given version,
+// resolved when the schema is decoded with the schema types
+func (avroSchemaFactory) NewRef(name string, vsn uint64) schema.DataSchema {
+	return newRef(schema.NewEventSchemaID(name, vsn), nil)
+}
+
+func (avroSchemaFactory) NewDecimal(precision, scale int) schema.DataSchema {
+	return newDecimal(precision, scale)
+}
+
 func (avroSchemaFactory) Decoder() schema.SchemaDecoder {
 	return avroSchemaDecoder{}
 }
@@ -140,6 +249,7 @@ func (a byNameMap) Less(i, j int) bool {
 
 func (avroSchemaFactory) EncodeNetwork(s *schema.Schema) []byte {
 	entsEvt := []map[string]interface{}{}
+	entsEvts := []map[string]interface{}{}
 	entsLoad := []map[string]interface{}{}
 	for name, typ := range s.Entities {
 		if len(typ.Events) == 0 {
@@ -200,14 +310,34 @@ func (avroSchemaFactory) EncodeNetwork(s *schema.Schema) []byte {
 					"type": "bytes",
 					"name": "id",
 				},
+				map[string]interface{}{
+					"type": "long",
+					"name": "expected_vsn",
+				},
 				map[string]interface{}{
 					"name": "event",
 					"type": evts,
 				},
+				// set on the events delivered to subscribers
+				map[string]interface{}{"name": "subscription", "type": "long", "default": 0},
+				map[string]interface{}{"name": "vsn", "type": "long", "default": 0},
+				map[string]interface{}{"name": "ts", "type": "long", "default": 0},
+				map[string]interface{}{"name": "position", "type": "bytes", "default": ""},
 			},
 		}
 		entsEvt = append(entsEvt, ent)
 
+		entEvts := map[string]interface{}{
+			"name": name,
+			"type": "record",
+			"fields": []map[string]interface{}{
+				map[string]interface{}{"name": "id", "type": "bytes"},
+				map[string]interface{}{"name": "expected_vsn", "type": "long"},
+				map[string]interface{}{"name": "events", "type": map[string]interface{}{"type": "array", "items": evts}},
+			},
+		}
+		entsEvts = append(entsEvts, entEvts)
+
 		entLoad := map[string]interface{}{
 			"name": name, "type": "record",
 			"fields": []map[string]interface{}{
@@ -221,14 +351,17 @@ func (avroSchemaFactory) EncodeNetwork(s *schema.Schema) []byte {
 		entsLoad = append(entsLoad, entLoad)
 	}
 	sort.Sort(byNameMap(entsEvt))
+	sort.Sort(byNameMap(entsEvts))
 
 	null := map[string]interface{}{"type": "null"}
 	entsEvt = append(entsEvt, null)
+	entsEvts = append(entsEvts, null)
 	entsLoad = append(entsLoad, null)
 	wrapper := map[string]interface{}{
 		"name": "data", "type": "record",
 		"fields": []map[string]interface{}{
 			map[string]interface{}{"name": "entity_event", "type": entsEvt},
+			map[string]interface{}{"name": "entity_events", "type": entsEvts},
 			map[string]interface{}{"name": "entity_load", "type": entsLoad},
 		},
 	}
@@ -240,24 +373,47 @@ func (avroSchemaFactory) EncodeNetwork(s *schema.Schema) []byte {
 	return out
 }
 
-type avroSchemaDecoder struct{}
+// avroSchemaDecoder resolves the referenced types with types,
+// if set. Otherwise references are left unresolved
+type avroSchemaDecoder struct {
+	types schema.TypeResolver
+}
+
+func (d avroSchemaDecoder) WithTypes(types schema.TypeResolver) schema.SchemaDecoder {
+	return avroSchemaDecoder{types: types}
+}
 
-func (avroSchemaDecoder) Decode(b []byte) (dec schema.DataSchema, err error) {
+func (d avroSchemaDecoder) Decode(b []byte) (dec schema.DataSchema, err error) {
 	var descr interface{}
 	if descr, _, err = avroSchemaCodec.NativeFromBinary(b); err != nil {
 		return nil, err
 	}
 	var descrMap = descr.(map[string]interface{})
-	dec, err = decodeNative(descrMap)
+	dec, err = d.decodeNative(descrMap)
 	return
 }
 
-func (avroSchemaDecoder) DecodeNative(descrMap interface{}) (dec schema.DataSchema, err error) {
-	dec, err = decodeNative(descrMap.(map[string]interface{}))
+func (d avroSchemaDecoder) DecodeNative(descrMap interface{}) (dec schema.DataSchema, err error) {
+	dec, err = d.decodeNative(descrMap.(map[string]interface{}))
 	return
 }
 
-func decodeNative(descrMap map[string]interface{}) (dec schema.DataSchema, err error) {
+func (d avroSchemaDecoder) decodeNative(descrMap map[string]interface{}) (dec schema.DataSchema, err error) {
+	if e, ok := descrMap["Enum"]; ok {
+		eMap := e.(map[string]interface{})
+		values := eMap["values"].([]interface{})
+		symbols := make([]string, len(values))
+		for i, v := range values {
+			symbols[i] = v.(string)
+		}
+		dec, err = buildEnum(eMap["name"].(string), symbols)
+	}
+	if dm, ok := descrMap["Decimal"]; ok {
+		dec, err = decodeDecimal(dm.(map[string]interface{}))
+	}
+	if r, ok := descrMap["Ref"]; ok {
+		dec, err = d.decodeRef(r.(map[string]interface{})["typename"].(string))
+	}
 	if _, ok := descrMap["Simple"]; ok {
 		// simple t
 		switch descrMap["Simple"].(string) {
@@ -273,6 +429,18 @@ func decodeNative(descrMap map[string]interface{}) (dec schema.DataSchema, err e
 			dec = doublueSchema
 		case "BYTES":
 			dec = bytesSchema
+		case "INT":
+			dec = intSchema
+		case "FLOAT":
+			dec = floatSchema
+		case "TIMESTAMP_MILLIS":
+			dec = timestampMillisSchema
+		case "TIMESTAMP_MICROS":
+			dec = timestampMicrosSchema
+		case "DATE":
+			dec = dateSchema
+		case "UUID":
+			dec = uuidSchema
 		default:
 			err = errors.New("NOT IMPLEMENTED")
 		}
@@ -289,35 +457,158 @@ func decodeNative(descrMap map[string]interface{}) (dec schema.DataSchema, err e
 		fmt.Println("decode COMPLEX", t, val)
 		switch t {
 		case "RECORD":
-			dec = decodeRecord(val.(map[string]interface{}))
+			dec, err = d.decodeRecord(val.(map[string]interface{}))
+		case "RECORD_FIELDS":
+			dec, err = d.decodeRecordFields(val.(map[string]interface{}))
 		case "ARRAY":
 			itemsJScm := val.(map[string]interface{})["items"].(map[string]interface{})
-			itemsDec, err := decodeNative(itemsJScm)
-			if err == nil {
-				dec = newArray(itemsDec)
+			var itemsDec schema.DataSchema
+			if itemsDec, err = d.decodeNative(itemsJScm); err == nil {
+				dec, err = buildArray(itemsDec)
+			}
+		case "OPTIONAL":
+			var t schema.DataSchema
+			if t, err = d.decodeNative(val.(map[string]interface{})["type"].(map[string]interface{})); err == nil {
+				dec, err = buildOptional(t)
 			}
+		case "UNION":
+			jTypes := val.(map[string]interface{})["types"].([]interface{})
+			types := make([]schema.DataSchema, len(jTypes))
+			for i, jType := range jTypes {
+				if types[i], err = d.decodeNative(jType.(map[string]interface{})); err != nil {
+					return
+				}
+			}
+			dec, err = buildUnion(types, false)
 		default:
 			err = errors.New("NOT IMPLEMENTED")
 		}
 	}
-	if dec == nil {
-		panic(fmt.Sprintf("cannot decode %+v", descrMap))
+	if dec == nil && err == nil {
+		err = fmt.Errorf("cannot decode %+v", descrMap)
 	}
 	return
 }
 
-func decodeRecord(d map[string]interface{}) schema.DataSchema {
-	mFields := d["fields"].(map[string]interface{})
+func (d avroSchemaDecoder) decodeRecord(r map[string]interface{}) (schema.DataSchema, error) {
+	mFields := r["fields"].(map[string]interface{})
 	fields := map[string]schema.DataSchema{}
 	fmt.Printf("decodeRecord-specs %+v\n", mFields)
 	for name, spec := range mFields {
 		fmt.Printf("decodeRecord-field %s %+v\n", name, spec)
-		dec, err := decodeNative(spec.(map[string]interface{}))
+		dec, err := d.decodeNative(spec.(map[string]interface{}))
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		fields[name] = dec
 	}
 
-	return (&avroRecordSchemaBuilder{Name: d["name"].(string), Fields: fields}).ToDataSchema()
+	return (&avroRecordSchemaBuilder{Name: r["name"].(string), Fields: fields}).ToDataSchema(), nil
+}
+
+// decodeRecordFields decodes the fields with their options. Doc
+// and default are wrapped in their union branch if decoded from avro
+func (d avroSchemaDecoder) decodeRecordFields(r map[string]interface{}) (schema.DataSchema, error) {
+	name, _ := r["name"].(string)
+	mFields, ok := r["fields"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot decode record %+v", r)
+	}
+	b := &avroRecordSchemaBuilder{
+		Name:     name,
+		Fields:   map[string]schema.DataSchema{},
+		Options:  map[string]schema.FieldOptions{},
+		defaults: map[string]string{},
+	}
+	for fieldName, spec := range mFields {
+		m, ok := spec.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot decode field %s %+v", fieldName, spec)
+		}
+		t, ok := m["type"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot decode field %s %+v", fieldName, spec)
+		}
+		dec, err := d.decodeNative(t)
+		if err != nil {
+			return nil, err
+		}
+		opts := schema.FieldOptions{Doc: unwrapString(m["doc"])}
+		opts.Optional, _ = m["optional"].(bool)
+		if m["aliases"] != nil {
+			if opts.Aliases, ok = toStrings(m["aliases"]); !ok {
+				return nil, fmt.Errorf("cannot decode aliases %+v", m["aliases"])
+			}
+		}
+		if text := unwrapString(m["default"]); text != "" {
+			b.defaults[fieldName] = text
+		}
+		b.Fields[fieldName] = dec
+		b.Options[fieldName] = opts
+	}
+	rec, err := b.build()
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func unwrapString(v interface{}) string {
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["string"]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+func toStrings(v interface{}) ([]string, bool) {
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	out := make([]string, len(vs))
+	for i, s := range vs {
+		if out[i], ok = s.(string); !ok {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// decodeDecimal decodes the precision and scale, the native
+// values are int32 from avro, float64 from JSON specs
+func decodeDecimal(m map[string]interface{}) (schema.DataSchema, error) {
+	precision, ok := toInt(m["precision"])
+	scale, ok2 := toInt(m["scale"])
+	if !ok || !ok2 || precision < 1 || scale < 0 || scale > precision {
+		return nil, fmt.Errorf("cannot decode decimal %+v", m)
+	}
+	return newDecimal(precision, scale), nil
+}
+
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), n == float64(int(n))
+	}
+	return 0, false
+}
+
+// decodeRef parses the "name_vsn" typename, and resolves it
+func (d avroSchemaDecoder) decodeRef(typename string) (dec schema.DataSchema, err error) {
+	id := schema.EventSchemaIDFromString(typename)
+	if d.types == nil {
+		return newRef(id, nil), nil
+	}
+	target, ok := d.types.ResolveType(id)
+	if !ok {
+		return nil, schema.TypeNotFound
+	}
+	return newRef(id, target), nil
 }
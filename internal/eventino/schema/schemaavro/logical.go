@@ -0,0 +1,129 @@
+package schemaavro
+
+import (
+	"math/big"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/linkedin/goavro"
+)
+
+// avroDecimalSchema is a decimal, stored as the bytes of its
+// unscaled value. Values are *big.Rat, decimal strings, e.g.
+// "12.50", or the stored bytes
+type avroDecimalSchema struct {
+	avroBase
+	precision int
+	scale     int
+	scm       *goavro.Codec
+	jScm      map[string]interface{}
+}
+
+func newDecimal(precision, scale int) schema.DataSchema {
+	jScm := map[string]interface{}{
+		"type":        "bytes",
+		"logicalType": "decimal",
+		"precision":   precision,
+		"scale":       scale,
+	}
+	s := &avroDecimalSchema{precision: precision, scale: scale, scm: newCodec(jScm, true), jScm: jScm}
+	s.avroBase = avroBase{s}
+	return s
+}
+
+func (s *avroDecimalSchema) Type() schema.DataType {
+	return schema.Decimal
+}
+
+func (s *avroDecimalSchema) resolved() bool {
+	return true
+}
+
+func (s *avroDecimalSchema) normalize(v interface{}) (interface{}, bool) {
+	switch d := v.(type) {
+	case []byte:
+		return v, true
+	case string:
+		r, ok := new(big.Rat).SetString(d)
+		if !ok {
+			return v, false
+		}
+		return schema.ToDecimalBytes(r, s.precision, s.scale)
+	case *big.Rat:
+		if d == nil {
+			return v, false
+		}
+		return schema.ToDecimalBytes(d, s.precision, s.scale)
+	}
+	return v, false
+}
+
+// GoNative converts the stored bytes to *big.Rat
+func (s *avroDecimalSchema) GoNative(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return schema.FromDecimalBytes(b, s.scale)
+	}
+	return v
+}
+
+func (s *avroDecimalSchema) Encode(v interface{}) ([]byte, error) {
+	n, _ := s.normalize(v)
+	return encodeWith(s.scm, n)
+}
+
+func (s *avroDecimalSchema) Decode(buf []byte) (interface{}, error) {
+	return decodeWith(s.scm, buf)
+}
+
+func (s *avroDecimalSchema) AvroNative() map[string]interface{} {
+	return s.jScm
+}
+
+func (s *avroDecimalSchema) AvroNativeMeta() map[string]interface{} {
+	return map[string]interface{}{
+		"Decimal": map[string]interface{}{
+			"precision": s.precision,
+			"scale":     s.scale,
+		},
+	}
+}
+
+// goNative converts the logical values within v to their Go native values
+func goNative(ds schema.DataSchema, v interface{}) interface{} {
+	switch s := ds.(type) {
+	case *avroRefSchema:
+		if s.target != nil {
+			return s.target.GoNative(v)
+		}
+	case *avroRecordSchema:
+		if m, ok := v.(map[string]interface{}); ok {
+			out := make(map[string]interface{}, len(m))
+			for k, val := range m {
+				out[k] = val
+				if f, ok := s.fields[k]; ok {
+					out[k] = f.GoNative(val)
+				}
+			}
+			return out
+		}
+	case *avroArraySchema:
+		if arr, ok := v.([]interface{}); ok {
+			out := make([]interface{}, len(arr))
+			for i, item := range arr {
+				out[i] = s.items.GoNative(item)
+			}
+			return out
+		}
+	case *avroUnionSchema:
+		// decoded union values are wrapped in their branch
+		if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+			for k, val := range m {
+				for i, name := range s.names {
+					if name == k {
+						return map[string]interface{}{k: s.types[i].GoNative(val)}
+					}
+				}
+			}
+		}
+	}
+	return v
+}
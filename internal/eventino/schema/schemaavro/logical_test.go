@@ -0,0 +1,150 @@
+package schemaavro
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestTimestamps(t *testing.T) {
+	f := Factory()
+	now := time.Date(2018, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	for _, c := range []struct {
+		t        schema.DataType
+		expected time.Time
+	}{
+		{schema.TimestampMillis, now.Truncate(time.Millisecond)},
+		{schema.TimestampMicros, now.Truncate(time.Microsecond)},
+		{schema.Date, time.Date(2018, 3, 4, 0, 0, 0, 0, time.UTC)},
+	} {
+		ds := f.SimpleType(c.t)
+		if !ds.Valid(now) {
+			t.Fatal("time should be valid", c.t)
+		}
+		b, err := ds.Encoder().Encode(now)
+		if err != nil {
+			t.Fatal("should encode", c.t, err)
+		}
+		v, err := ds.Decoder().Decode(b)
+		if err != nil {
+			t.Fatal("should decode", c.t, err)
+		}
+		if ds.GoNative(v).(time.Time) != c.expected {
+			t.Fatal("wrong time", c.t, ds.GoNative(v))
+		}
+		// the stored values are valid too
+		if !ds.Valid(v) || ds.Valid("2018-03-04") {
+			t.Fatal("wrong validation", c.t, v)
+		}
+	}
+
+	before := time.Date(1969, 12, 31, 23, 0, 0, 0, time.UTC)
+	if schema.ToDateDays(before) != -1 || schema.FromDateDays(-1) != time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC) {
+		t.Fatal("wrong date before the epoch", schema.ToDateDays(before))
+	}
+	if schema.FromTimestampMillis(schema.ToTimestampMillis(before)) != before {
+		t.Fatal("wrong timestamp before the epoch")
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	f := Factory()
+	ds := f.NewDecimal(5, 2)
+	for _, s := range []string{"-12.5", "0", "999.99", "-128", "0.01"} {
+		r, _ := new(big.Rat).SetString(s)
+		b, err := ds.Encoder().Encode(r)
+		if err != nil {
+			t.Fatal("should encode", s, err)
+		}
+		v, err := ds.Decoder().Decode(b)
+		if err != nil {
+			t.Fatal("should decode", s, err)
+		}
+		if ds.GoNative(v).(*big.Rat).Cmp(r) != 0 {
+			t.Fatal("wrong decimal", s, ds.GoNative(v))
+		}
+	}
+	if !ds.Valid("12.34") {
+		t.Fatal("decimal strings should be valid")
+	}
+	for _, v := range []interface{}{"1.234", "1000.00", "foo", 12.34} {
+		if ds.Valid(v) {
+			t.Fatal("should not be valid", v)
+		}
+	}
+	if out := ds.Validate("1.234"); len(out) != 1 || out[0].Message != "expected decimal(5,2), got string" {
+		t.Fatal("wrong error", out)
+	}
+
+	if out := f.NewDecimal(6, 2).CanRead(ds); len(out) != 0 {
+		t.Fatal("a larger precision should read", out)
+	}
+	if out := f.NewDecimal(5, 3).CanRead(ds); len(out) != 1 || out[0].Rule != schema.RuleTypeMismatch {
+		t.Fatal("the scale should match", out)
+	}
+}
+
+func TestLogicalMeta(t *testing.T) {
+	f := Factory()
+	ds := f.NewRecord().SetName("paid").
+		SetField("id", f.SimpleType(schema.UUID)).
+		SetField("at", f.SimpleType(schema.TimestampMillis)).
+		SetField("on", f.NewOptional(f.SimpleType(schema.Date))).
+		SetField("amount", f.NewDecimal(10, 2)).
+		SetField("fees", f.NewArray(f.NewDecimal(4, 2))).
+		SetField("count", f.SimpleType(schema.Int32)).
+		SetField("rate", f.SimpleType(schema.Float32)).
+		ToDataSchema()
+	b, err := ds.EncodeSchema()
+	if err != nil {
+		t.Fatal("should encode schema", err)
+	}
+	decoded, err := f.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode schema", err)
+	}
+	if out := decoded.Diff(ds); len(out) != 0 {
+		t.Fatal("schema should round trip", out)
+	}
+	if decoded.(*avroRecordSchema).fields["amount"].Type() != schema.Decimal {
+		t.Fatal("amount should be a decimal")
+	}
+
+	at := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	v := map[string]interface{}{
+		"id":     "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"at":     at,
+		"on":     at,
+		"amount": "1250.50",
+		"fees":   []interface{}{big.NewRat(1, 4)},
+		"count":  int32(3),
+		"rate":   float32(0.5),
+	}
+	if out := decoded.Validate(v); len(out) != 0 {
+		t.Fatal("value should be valid", out)
+	}
+	if b, err = decoded.Encoder().Encode(v); err != nil {
+		t.Fatal("should encode", err)
+	}
+	stored, err := decoded.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode", err)
+	}
+	native := decoded.GoNative(stored).(map[string]interface{})
+	if native["at"].(time.Time) != at || native["on"].(map[string]interface{})["int"].(time.Time) != time.Date(2018, 3, 4, 0, 0, 0, 0, time.UTC) {
+		t.Fatal("wrong times", native)
+	}
+	if native["amount"].(*big.Rat).Cmp(big.NewRat(2501, 2)) != 0 || native["fees"].([]interface{})[0].(*big.Rat).Cmp(big.NewRat(1, 4)) != 0 {
+		t.Fatal("wrong decimals", native)
+	}
+
+	v["id"] = "not-a-uuid"
+	if out := decoded.Validate(v); len(out) != 1 || out[0].String() != "id: expected uuid, got string" {
+		t.Fatal("wrong uuid error", out)
+	}
+	if out := f.SimpleType(schema.Int64).CanRead(f.SimpleType(schema.Int32)); len(out) != 0 {
+		t.Fatal("int should be read as long", out)
+	}
+}
@@ -11,8 +11,11 @@ import (
 )
 
 type avroRecordSchemaBuilder struct {
-	Name   string
-	Fields map[string]schema.DataSchema
+	Name    string
+	Fields  map[string]schema.DataSchema
+	Options map[string]schema.FieldOptions
+	// the defaults as avro JSON, when decoding the meta-schema
+	defaults map[string]string
 }
 
 func (r *avroRecordSchemaBuilder) SetName(name string) schema.RecordSchemaBuilder {
@@ -23,6 +26,13 @@ func (r *avroRecordSchemaBuilder) SetField(name string, typ schema.DataSchema) s
 	r.Fields[name] = typ
 	return r
 }
+func (r *avroRecordSchemaBuilder) SetFieldOptions(name string, opts schema.FieldOptions) schema.RecordSchemaBuilder {
+	if r.Options == nil {
+		r.Options = map[string]schema.FieldOptions{}
+	}
+	r.Options[name] = opts
+	return r
+}
 
 // ensure fields are ordered,
 // since order matters in avro schema
@@ -40,68 +50,149 @@ func (a byFieldName) Less(i, j int) bool {
 	return strings.Compare(x, y) > 0
 }
 
+// ToDataSchema panics if a default is not valid for its field
 func (r *avroRecordSchemaBuilder) ToDataSchema() schema.DataSchema {
-	jFields := make([]map[string]interface{}, 0, len(r.Fields))
-	jScm := map[string]interface{}{
-		"type": "record",
-		"name": r.Name,
+	ds, err := r.build()
+	if err != nil {
+		panic(err)
 	}
+	return ds
+}
+
+func (r *avroRecordSchemaBuilder) build() (*avroRecordSchema, error) {
+	rec := &avroRecordSchema{
+		name:     r.Name,
+		fields:   make(map[string]schema.DataSchema, len(r.Fields)),
+		options:  map[string]schema.FieldOptions{},
+		defaults: map[string]string{},
+	}
+	rec.avroBase = avroBase{rec}
 	for name, field := range r.Fields {
+		opts := r.Options[name]
+		if _, nullable := field.(avroSchema).normalize(nil); opts.Optional && !nullable {
+			var err error
+			if field, err = buildOptional(field); err != nil {
+				return nil, fmt.Errorf("record %s field %s: %s", r.Name, name, err)
+			}
+		}
+		rec.fields[name] = field
+		if opts.IsZero() && r.defaults[name] == "" {
+			continue
+		}
+		text, ok := r.defaults[name]
+		if !ok && opts.Default != nil {
+			var err error
+			if text, err = defaultText(field, opts.Default); err != nil {
+				return nil, fmt.Errorf("record %s field %s: %s", r.Name, name, err)
+			}
+		}
+		if text != "" {
+			rec.defaults[name] = text
+			opts.Default = nil
+			if field.(avroSchema).resolved() {
+				codec := newCodec(field.(avroSchema).AvroNative(), true)
+				v, _, err := codec.NativeFromTextual([]byte(text))
+				if err != nil {
+					return nil, fmt.Errorf("record %s field %s: invalid default %s", r.Name, name, text)
+				}
+				opts.Default = v
+			}
+		}
+		rec.options[name] = opts
+	}
+
+	jFields := make([]map[string]interface{}, 0, len(rec.fields))
+	for name, field := range rec.fields {
 		jField := map[string]interface{}{
 			"name": name,
 			"type": field.(avroSchema).AvroNative(),
 		}
+		opts := rec.options[name]
+		if opts.Doc != "" {
+			jField["doc"] = opts.Doc
+		}
+		if len(opts.Aliases) > 0 {
+			jField["aliases"] = opts.Aliases
+		}
+		if text, ok := rec.defaults[name]; ok {
+			v, err := jsonDefault(field, text)
+			if err != nil {
+				return nil, fmt.Errorf("record %s field %s: %s", r.Name, name, err)
+			}
+			jField["default"] = v
+		} else if _, err := jsonDefault(field, "null"); opts.Optional && err == nil {
+			jField["default"] = nil
+		}
 		jFields = append(jFields, jField)
 	}
 	sort.Sort(byFieldName(jFields))
-	jScm["fields"] = jFields
-	b, err := json.Marshal(jScm)
+	rec.jScm = defineOnce(map[string]interface{}{
+		"type":   "record",
+		"name":   r.Name,
+		"fields": jFields,
+	}, map[string]bool{}).(map[string]interface{})
+	b, err := json.Marshal(rec.jScm)
 	fmt.Printf("record %s avro schema -> %s\n", r.Name, string(b))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	scm, err := goavro.NewCodec(string(b))
-	if err != nil {
-		panic(err)
-	}
-	return &avroRecordSchema{
-		jScm:   jScm,
-		name:   r.Name,
-		fields: r.Fields,
-		scm:    scm,
+	if rec.scm, err = buildCodec(rec.jScm, rec.resolved()); err != nil {
+		return nil, err
 	}
+	return rec, nil
 }
 
-type avroRecordSchema struct {
-	jScm   map[string]interface{}
-	name   string
-	fields map[string]schema.DataSchema
-	scm    *goavro.Codec
-}
-
-func (r *avroRecordSchema) SchemaDecoder() schema.SchemaDecoder {
-	return avroSchemaDecoder{}
-}
-
-func (r *avroRecordSchema) EncodeSchema() ([]byte, error) {
-	return avroSchemaCodec.BinaryFromNative(nil, r.AvroNativeMeta())
-}
-func (r *avroRecordSchema) EncodeSchemaNative() interface{} {
-	return r.AvroNativeMeta()
+// defaultText returns the avro JSON of the default value
+func defaultText(field schema.DataSchema, v interface{}) (string, error) {
+	n, ok := field.(avroSchema).normalize(v)
+	if !ok || !field.(avroSchema).resolved() {
+		return "", fmt.Errorf("invalid default %v", v)
+	}
+	b, err := newCodec(field.(avroSchema).AvroNative(), true).TextualFromNative(nil, n)
+	if err != nil {
+		return "", fmt.Errorf("invalid default %v", v)
+	}
+	return string(b), nil
 }
 
-func (r *avroRecordSchema) Encoder() schema.DataEncoder {
-	return r
+// jsonDefault returns the default as in the avro schemas: union
+// defaults are the plain value of the first branch, e.g. null
+func jsonDefault(field schema.DataSchema, text string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return nil, fmt.Errorf("invalid default %s", text)
+	}
+	u, ok := deref(field).(*avroUnionSchema)
+	if !ok || v == nil {
+		if ok && u.names[0] != "null" {
+			return nil, fmt.Errorf("default %s is not a %s", text, u.names[0])
+		}
+		return v, nil
+	}
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+		if inner, ok := m[u.names[0]]; ok {
+			return inner, nil
+		}
+	}
+	return nil, fmt.Errorf("default %s is not a %s", text, u.names[0])
 }
 
-func (r *avroRecordSchema) Decoder() schema.DataDecoder {
-	return r
+type avroRecordSchema struct {
+	avroBase
+	jScm    map[string]interface{}
+	name    string
+	fields  map[string]schema.DataSchema
+	options map[string]schema.FieldOptions
+	// the defaults as avro JSON, e.g. {"long": 1} for union(long, null)
+	defaults map[string]string
+	scm      *goavro.Codec
 }
 
 // DataEncoder
 func (r *avroRecordSchema) Encode(v interface{}) ([]byte, error) {
 	// out, err := r.scm.TextualFromNative(nil, v)
-	out, err := r.scm.BinaryFromNative(nil, v)
+	n, _ := r.normalize(v)
+	out, err := encodeWith(r.scm, n)
 	fmt.Println("encoded record", v, out, err, r.AvroNative(), r.AvroNativeMeta())
 	return out, err
 	// return r.scm.BinaryFromNative(nil, v)
@@ -109,35 +200,120 @@ func (r *avroRecordSchema) Encode(v interface{}) ([]byte, error) {
 
 // DataDecoder
 func (r *avroRecordSchema) Decode(buf []byte) (interface{}, error) {
-	out, _, err := r.scm.NativeFromBinary(buf)
+	out, err := decodeWith(r.scm, buf)
 	// out, _, err := r.scm.NativeFromTextual(buf)
 	fmt.Println("decoded record", buf, out, err, r.AvroNative(), r.AvroNativeMeta())
 	return out, err
 }
 
-func (r *avroRecordSchema) Valid(obj interface{}) bool {
+func (r *avroRecordSchema) Type() schema.DataType {
+	return schema.Record
+}
+
+func (r *avroRecordSchema) Name() string {
+	return r.name
+}
+
+func (r *avroRecordSchema) FieldNames() []string {
+	names := make([]string, 0, len(r.fields))
+	for name := range r.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Field returns the type of the field and its options,
+// the default is its stored value, once resolved
+func (r *avroRecordSchema) Field(name string) (schema.DataSchema, schema.FieldOptions, bool) {
+	f, ok := r.fields[name]
+	return f, r.options[name], ok
+}
+
+// hasDefault is true if the field has a default, or is nullable
+func (r *avroRecordSchema) hasDefault(name string) bool {
+	if _, ok := r.defaults[name]; ok {
+		return true
+	}
+	_, nullable := r.fields[name].(avroSchema).normalize(nil)
+	return nullable
+}
+
+func (r *avroRecordSchema) resolved() bool {
+	for _, f := range r.fields {
+		if !f.(avroSchema).resolved() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *avroRecordSchema) normalize(obj interface{}) (interface{}, bool) {
 	m, ok := obj.(map[string]interface{})
 	if !ok {
-		return false
+		return obj, false
 	}
+	out := make(map[string]interface{}, len(r.fields))
 	for k, v := range m {
 		f, ok := r.fields[k]
-		if !ok || !f.Valid(v) {
-			return false
+		if !ok {
+			return obj, false
+		}
+		n, ok := f.(avroSchema).normalize(v)
+		if !ok {
+			return obj, false
 		}
+		out[k] = n
 	}
-	return true
+	// missing fields take their default, nullable ones are
+	// null by default, the other ones are required
+	for k, f := range r.fields {
+		if _, ok := m[k]; ok {
+			continue
+		}
+		if _, ok := r.defaults[k]; ok {
+			out[k] = r.options[k].Default
+			continue
+		}
+		if _, ok := f.(avroSchema).normalize(nil); !ok {
+			return obj, false
+		}
+		out[k] = nil
+	}
+	return out, true
 }
 
+// AvroNativeMeta is a RECORD, or a RECORD_FIELDS if
+// any field has options, as the fields have no options
+// in the schemas encoded before they were added
 func (r *avroRecordSchema) AvroNativeMeta() map[string]interface{} {
+	t := "RECORD"
+	if len(r.options) > 0 {
+		t = "RECORD_FIELDS"
+	}
 	fields := map[string]interface{}{}
 	for name, field := range r.fields {
 		fields[name] = field.(avroSchema).AvroNativeMeta()
+		if t == "RECORD" {
+			continue
+		}
+		opts := r.options[name]
+		aliases := make([]interface{}, len(opts.Aliases))
+		for i, alias := range opts.Aliases {
+			aliases[i] = alias
+		}
+		fields[name] = map[string]interface{}{
+			"type":     fields[name],
+			"doc":      optionalString(opts.Doc),
+			"default":  optionalString(r.defaults[name]),
+			"optional": opts.Optional,
+			"aliases":  aliases,
+		}
 	}
 	return map[string]interface{}{
 		"Complex": map[string]interface{}{
 			"type": map[string]interface{}{
-				"RECORD": map[string]interface{}{
+				t: map[string]interface{}{
 					"name":   r.name,
 					"fields": fields,
 				},
@@ -146,6 +322,14 @@ func (r *avroRecordSchema) AvroNativeMeta() map[string]interface{} {
 	}
 }
 
+// optionalString is the union(null, string) value of s, null if empty
+func optionalString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return map[string]interface{}{"string": s}
+}
+
 func (r *avroRecordSchema) AvroNative() map[string]interface{} {
 	return r.jScm
 }
@@ -1,6 +1,7 @@
 package schemaavro
 
 import (
+	"math/big"
 	"testing"
 
 	"github.com/cheng81/eventino/internal/eventino/schema"
@@ -85,3 +86,91 @@ func TestRecordEncodeDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestRecordFieldOptions(t *testing.T) {
+	f := Factory()
+	str := f.SimpleType(schema.String)
+	ds := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetFieldOptions("name", schema.FieldOptions{Doc: "the full name", Aliases: []string{"Name"}}).
+		SetField("email", str).
+		SetFieldOptions("email", schema.FieldOptions{Optional: true}).
+		SetField("country", str).
+		SetFieldOptions("country", schema.FieldOptions{Default: "DK"}).
+		SetField("amount", f.NewDecimal(5, 2)).
+		SetFieldOptions("amount", schema.FieldOptions{Default: "0.50"}).
+		ToDataSchema()
+
+	// the options survive the meta-schema
+	b, err := ds.EncodeSchema()
+	if err != nil {
+		t.Fatal("should encode schema", err)
+	}
+	decoded, err := f.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode schema", err)
+	}
+	rec := decoded.(schema.RecordSchema)
+	if names := rec.FieldNames(); len(names) != 4 || names[0] != "amount" {
+		t.Fatal("wrong field names", names)
+	}
+	if _, opts, _ := rec.Field("name"); opts.Doc != "the full name" || !opts.HasAlias("Name") {
+		t.Fatal("wrong name options", opts)
+	}
+	if email, opts, _ := rec.Field("email"); email.Type() != schema.Optional || !opts.Optional {
+		t.Fatal("email should be optional", email, opts)
+	}
+	if _, opts, _ := rec.Field("country"); opts.Default != "DK" {
+		t.Fatal("wrong country default", opts.Default)
+	}
+
+	// the missing fields take their defaults
+	if out := decoded.Validate(map[string]interface{}{"name": "foo"}); len(out) != 0 {
+		t.Fatal("value should be valid", out)
+	}
+	if b, err = decoded.Encoder().Encode(map[string]interface{}{"name": "foo"}); err != nil {
+		t.Fatal("should encode", err)
+	}
+	v, err := decoded.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode", err)
+	}
+	m := decoded.GoNative(v).(map[string]interface{})
+	if m["country"] != "DK" || m["email"] != nil || m["amount"].(*big.Rat).Cmp(big.NewRat(1, 2)) != 0 {
+		t.Fatal("wrong defaults", m)
+	}
+	if out := decoded.Validate(map[string]interface{}{}); len(out) != 1 || out[0].Message != "missing required field name" {
+		t.Fatal("name is required", out)
+	}
+
+	// the avro schema has the docs, defaults and aliases
+	for _, jField := range decoded.(avroSchema).AvroNative()["fields"].([]map[string]interface{}) {
+		switch jField["name"] {
+		case "name":
+			if jField["doc"] != "the full name" || jField["aliases"].([]string)[0] != "Name" {
+				t.Fatal("wrong name field", jField)
+			}
+		case "country":
+			if jField["default"] != "DK" {
+				t.Fatal("wrong country field", jField)
+			}
+		case "email":
+			if d, ok := jField["default"]; !ok || d != nil {
+				t.Fatal("email should default to null", jField)
+			}
+		}
+	}
+
+	// the defaults must be valid
+	if _, err = f.Decoder().DecodeNative(map[string]interface{}{
+		"Complex": map[string]interface{}{"type": map[string]interface{}{"RECORD_FIELDS": map[string]interface{}{
+			"name": "created",
+			"fields": map[string]interface{}{"age": map[string]interface{}{
+				"type":    map[string]interface{}{"Simple": "LONG"},
+				"default": "\"ten\"",
+			}},
+		}}},
+	}); err == nil {
+		t.Fatal("the default of age should be a long")
+	}
+}
@@ -0,0 +1,163 @@
+package schemaavro
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/linkedin/goavro"
+)
+
+// UnresolvedTypeError is returned when encoding or decoding
+// data with a schema that refers to a type not resolved yet
+var UnresolvedTypeError error
+
+func init() {
+	UnresolvedTypeError = errors.New("schema refers to an unresolved type")
+}
+
+// avroRefSchema refers to a named record or enum type,
+// by name and version. target is nil until resolved
+type avroRefSchema struct {
+	avroBase
+	id     schema.EventSchemaID
+	target schema.DataSchema
+}
+
+func newRef(id schema.EventSchemaID, target schema.DataSchema) schema.DataSchema {
+	s := &avroRefSchema{id: id, target: target}
+	s.avroBase = avroBase{s}
+	return s
+}
+
+func (s *avroRefSchema) Type() schema.DataType {
+	return schema.Ref
+}
+
+func (s *avroRefSchema) resolved() bool {
+	return s.target != nil && s.target.(avroSchema).resolved()
+}
+
+func (s *avroRefSchema) normalize(v interface{}) (interface{}, bool) {
+	if s.target == nil {
+		return v, false
+	}
+	return s.target.(avroSchema).normalize(v)
+}
+
+func (s *avroRefSchema) Encode(v interface{}) ([]byte, error) {
+	if s.target == nil {
+		return nil, UnresolvedTypeError
+	}
+	return s.target.Encoder().Encode(v)
+}
+
+func (s *avroRefSchema) Decode(buf []byte) (interface{}, error) {
+	if s.target == nil {
+		return nil, UnresolvedTypeError
+	}
+	return s.target.Decoder().Decode(buf)
+}
+
+// AvroNative inlines the referenced type, named after the reference
+// (e.g. address_1) so that two versions of a type do not clash.
+// The records and unions define it once, see defineOnce
+func (s *avroRefSchema) AvroNative() map[string]interface{} {
+	if s.target == nil {
+		return map[string]interface{}{"type": "null"}
+	}
+	native := s.target.(avroSchema).AvroNative()
+	out := make(map[string]interface{}, len(native))
+	for k, v := range native {
+		out[k] = v
+	}
+	out["name"] = s.id.ToString()
+	return out
+}
+
+func (s *avroRefSchema) AvroNativeMeta() map[string]interface{} {
+	return map[string]interface{}{
+		"Ref": map[string]interface{}{
+			"typename": s.id.ToString(),
+		},
+	}
+}
+
+// defineOnce returns a copy of the avro schema t where the named
+// types already defined, in the schema or in defined, are referred
+// by name. The first definition is kept
+func defineOnce(t interface{}, defined map[string]bool) interface{} {
+	switch typ := t.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(typ))
+		for i, branch := range typ {
+			out[i] = defineOnce(branch, defined)
+		}
+		return out
+	case map[string]interface{}:
+		switch typ["type"] {
+		case "record", "enum", "fixed":
+			name, _ := typ["name"].(string)
+			if defined[name] {
+				return name
+			}
+			defined[name] = true
+		}
+		out := make(map[string]interface{}, len(typ))
+		for k, v := range typ {
+			out[k] = v
+		}
+		for _, k := range []string{"type", "items", "values"} {
+			if v, ok := typ[k]; ok {
+				out[k] = defineOnce(v, defined)
+			}
+		}
+		if fields, ok := typ["fields"].([]map[string]interface{}); ok {
+			outFields := make([]map[string]interface{}, len(fields))
+			for i, field := range fields {
+				outFields[i] = defineOnce(field, defined).(map[string]interface{})
+			}
+			out["fields"] = outFields
+		}
+		return out
+	}
+	return t
+}
+
+// newCodec builds the goavro codec for the json schema,
+// or returns nil if the schema refers to unresolved types.
+// It panics if goavro rejects the schema, see buildCodec
+func newCodec(jScm map[string]interface{}, resolved bool) *goavro.Codec {
+	scm, err := buildCodec(jScm, resolved)
+	if err != nil {
+		panic(err)
+	}
+	return scm
+}
+
+// buildCodec is newCodec, returning the error of goavro
+func buildCodec(jScm map[string]interface{}, resolved bool) (*goavro.Codec, error) {
+	if !resolved {
+		return nil, nil
+	}
+	b, err := json.Marshal(jScm)
+	if err != nil {
+		return nil, err
+	}
+	return goavro.NewCodec(string(b))
+}
+
+func encodeWith(scm *goavro.Codec, v interface{}) ([]byte, error) {
+	if scm == nil {
+		return nil, UnresolvedTypeError
+	}
+	return scm.BinaryFromNative(nil, v)
+}
+
+func decodeWith(scm *goavro.Codec, buf []byte) (interface{}, error) {
+	if scm == nil {
+		return nil, UnresolvedTypeError
+	}
+	out, _, err := scm.NativeFromBinary(buf)
+	return out, err
+}
@@ -0,0 +1,129 @@
+package schemaavro
+
+import (
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestRef(t *testing.T) {
+	f := Factory()
+	address := f.NewRecord().SetName("address").
+		SetField("street", f.SimpleType(schema.String)).
+		SetField("kind", f.NewEnum("kind", "HOME", "WORK")).
+		ToDataSchema()
+	types := schema.Schema{Records: map[schema.EventSchemaID]schema.DataSchema{
+		schema.NewEventSchemaID("address", 0): address,
+	}}
+
+	ds := f.NewRecord().SetName("created").
+		SetField("name", f.SimpleType(schema.String)).
+		SetField("address", f.NewRef("address", 0)).
+		ToDataSchema()
+	if _, err := ds.Encoder().Encode(map[string]interface{}{"name": "foo"}); err != UnresolvedTypeError {
+		t.Fatal("unresolved refs should not encode", err)
+	}
+
+	b, err := ds.EncodeSchema()
+	if err != nil {
+		t.Fatal("should encode schema", err)
+	}
+	if _, err = f.Decoder().WithTypes(schema.Schema{}).Decode(b); err != schema.TypeNotFound {
+		t.Fatal("unknown types should not resolve", err)
+	}
+	if ds, err = f.Decoder().WithTypes(types).Decode(b); err != nil {
+		t.Fatal("should decode schema with types", err)
+	}
+	if ds.(*avroRecordSchema).fields["address"].Type() != schema.Ref {
+		t.Fatal("address field should be a ref")
+	}
+
+	v := map[string]interface{}{
+		"name": "foo",
+		"address": map[string]interface{}{
+			"street": "main st",
+			"kind":   "HOME",
+		},
+	}
+	if !ds.Valid(v) {
+		t.Fatal("value should be valid")
+	}
+	if ds.Valid(map[string]interface{}{"name": "foo", "address": map[string]interface{}{"street": "main st", "kind": "MARS"}}) {
+		t.Fatal("referenced enum should be validated")
+	}
+	if b, err = ds.Encoder().Encode(v); err != nil {
+		t.Fatal("should encode", err)
+	}
+	out, err := ds.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode", err)
+	}
+	addr := out.(map[string]interface{})["address"].(map[string]interface{})
+	if addr["street"] != "main st" || addr["kind"] != "HOME" {
+		t.Fatal("decoded address should match", addr)
+	}
+
+	// the ref is kept in the meta schema
+	meta := ds.(*avroRecordSchema).AvroNativeMeta()
+	field := meta["Complex"].(map[string]interface{})["type"].(map[string]interface{})["RECORD"].(map[string]interface{})["fields"].(map[string]interface{})["address"]
+	if field.(map[string]interface{})["Ref"].(map[string]interface{})["typename"] != "address_0" {
+		t.Fatal("meta schema should refer to address_0", field)
+	}
+}
+
+func TestRefDefinedOnce(t *testing.T) {
+	f := Factory()
+	v0 := f.NewRecord().SetName("address").SetField("street", f.SimpleType(schema.String)).ToDataSchema()
+	v1 := f.NewRecord().SetName("address").
+		SetField("street", f.SimpleType(schema.String)).
+		SetField("city", f.SimpleType(schema.String)).
+		ToDataSchema()
+	types := schema.Schema{Records: map[schema.EventSchemaID]schema.DataSchema{
+		schema.NewEventSchemaID("address", 0): v0,
+		schema.NewEventSchemaID("address", 1): v1,
+	}}
+	b, err := f.NewRecord().SetName("moved").
+		SetField("from", f.NewRef("address", 0)).
+		SetField("to", f.NewRef("address", 1)).
+		SetField("via", f.NewRef("address", 1)).
+		ToDataSchema().EncodeSchema()
+	if err != nil {
+		t.Fatal("should encode schema", err)
+	}
+	ds, err := f.Decoder().WithTypes(types).Decode(b)
+	if err != nil {
+		t.Fatal("should decode schema with types", err)
+	}
+
+	// the versions have their own name, and the second
+	// address_1 refers to the first one by name
+	fieldTypes := map[string]interface{}{}
+	for _, field := range ds.(avroSchema).AvroNative()["fields"].([]map[string]interface{}) {
+		fieldTypes[field["name"].(string)] = field["type"]
+	}
+	if fieldTypes["from"].(map[string]interface{})["name"] != "address_0" {
+		t.Fatal("address_0 should be defined", fieldTypes["from"])
+	}
+	to, toDefined := fieldTypes["to"].(map[string]interface{})
+	via, viaDefined := fieldTypes["via"].(map[string]interface{})
+	if toDefined == viaDefined || (toDefined && (to["name"] != "address_1" || fieldTypes["via"] != "address_1")) ||
+		(viaDefined && (via["name"] != "address_1" || fieldTypes["to"] != "address_1")) {
+		t.Fatal("address_1 should be defined once", fieldTypes["to"], fieldTypes["via"])
+	}
+
+	v := map[string]interface{}{
+		"from": map[string]interface{}{"street": "a"},
+		"to":   map[string]interface{}{"street": "b", "city": "c"},
+		"via":  map[string]interface{}{"street": "d", "city": "e"},
+	}
+	if b, err = ds.Encoder().Encode(v); err != nil {
+		t.Fatal("should encode", err)
+	}
+	out, err := ds.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode", err)
+	}
+	if out.(map[string]interface{})["via"].(map[string]interface{})["city"] != "e" {
+		t.Fatal("wrong decoded value", out)
+	}
+}
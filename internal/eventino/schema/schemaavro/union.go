@@ -0,0 +1,152 @@
+package schemaavro
+
+import (
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/linkedin/goavro"
+)
+
+// avroUnionSchema is an avro union. Values are either nil (for
+// the null branch), a map with the branch name as only key, e.g.
+// {"string": "foo"}, as goavro does, or a plain value, wrapped
+// in the first branch it is valid for
+type avroUnionSchema struct {
+	avroBase
+	types []schema.DataSchema
+	// names are the branch names
+	names []string
+	// optional is union(null, T), declared with NewOptional
+	optional bool
+	scm      *goavro.Codec
+	jScm     map[string]interface{}
+}
+
+// newUnion panics if the union is not valid, see buildUnion
+func newUnion(types []schema.DataSchema, optional bool) schema.DataSchema {
+	s, err := buildUnion(types, optional)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// buildUnion returns an error if the branches are not valid,
+// e.g. two branches of the same type, or a nested union
+func buildUnion(types []schema.DataSchema, optional bool) (schema.DataSchema, error) {
+	jTypes := make([]interface{}, len(types))
+	names := make([]string, len(types))
+	for i, t := range types {
+		jType := t.(avroSchema).AvroNative()
+		jTypes[i] = jType
+		names[i] = branchName(jType)
+	}
+	jScm := defineOnce(map[string]interface{}{
+		"type": jTypes,
+	}, map[string]bool{}).(map[string]interface{})
+	s := &avroUnionSchema{types: types, names: names, optional: optional, jScm: jScm}
+	s.avroBase = avroBase{s}
+	var err error
+	if s.scm, err = buildCodec(jScm, s.resolved()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newOptional(t schema.DataSchema) schema.DataSchema {
+	return newUnion([]schema.DataSchema{nilSchema, t}, true)
+}
+
+func buildOptional(t schema.DataSchema) (schema.DataSchema, error) {
+	return buildUnion([]schema.DataSchema{nilSchema, t}, true)
+}
+
+// branchName is the name goavro uses for a union branch:
+// the name of named types, the type otherwise
+func branchName(jType map[string]interface{}) string {
+	t, _ := jType["type"].(string)
+	switch t {
+	case "record", "enum", "fixed":
+		return jType["name"].(string)
+	}
+	return t
+}
+
+func (s *avroUnionSchema) Type() schema.DataType {
+	if s.optional {
+		return schema.Optional
+	}
+	return schema.Union
+}
+
+func (s *avroUnionSchema) resolved() bool {
+	for _, t := range s.types {
+		if !t.(avroSchema).resolved() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *avroUnionSchema) normalize(v interface{}) (interface{}, bool) {
+	// already wrapped in its branch
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+		for k, val := range m {
+			for i, name := range s.names {
+				if name != k {
+					continue
+				}
+				if n, ok := s.types[i].(avroSchema).normalize(val); ok {
+					return map[string]interface{}{k: n}, true
+				}
+			}
+		}
+	}
+	for i, t := range s.types {
+		if n, ok := t.(avroSchema).normalize(v); ok {
+			if n == nil {
+				return nil, true
+			}
+			return map[string]interface{}{s.names[i]: n}, true
+		}
+	}
+	return v, false
+}
+
+func (s *avroUnionSchema) Encode(v interface{}) ([]byte, error) {
+	n, _ := s.normalize(v)
+	return encodeWith(s.scm, n)
+}
+
+func (s *avroUnionSchema) Decode(buf []byte) (interface{}, error) {
+	return decodeWith(s.scm, buf)
+}
+
+func (s *avroUnionSchema) AvroNative() map[string]interface{} {
+	return s.jScm
+}
+
+func (s *avroUnionSchema) AvroNativeMeta() map[string]interface{} {
+	if s.optional {
+		return map[string]interface{}{
+			"Complex": map[string]interface{}{
+				"type": map[string]interface{}{
+					"OPTIONAL": map[string]interface{}{
+						"type": s.types[1].(avroSchema).AvroNativeMeta(),
+					},
+				},
+			},
+		}
+	}
+	types := make([]interface{}, len(s.types))
+	for i, t := range s.types {
+		types[i] = t.(avroSchema).AvroNativeMeta()
+	}
+	return map[string]interface{}{
+		"Complex": map[string]interface{}{
+			"type": map[string]interface{}{
+				"UNION": map[string]interface{}{
+					"types": types,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,159 @@
+package schemaavro
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/linkedin/goavro"
+)
+
+func TestOptional(t *testing.T) {
+	f := Factory()
+	rec := f.NewRecord().SetName("user").
+		SetField("name", f.SimpleType(schema.String)).
+		SetField("email", f.NewOptional(f.SimpleType(schema.String))).
+		ToDataSchema()
+
+	for _, v := range []map[string]interface{}{
+		{"name": "a"},
+		{"name": "a", "email": nil},
+		{"name": "a", "email": "a@b.c"},
+		{"name": "a", "email": map[string]interface{}{"string": "a@b.c"}},
+	} {
+		if !rec.Valid(v) {
+			t.Fatal("should be valid", v)
+		}
+	}
+	if rec.Valid(map[string]interface{}{"name": "a", "email": int64(1)}) {
+		t.Fatal("long email should not be valid")
+	}
+
+	roundTrip := func(v map[string]interface{}) interface{} {
+		b, err := rec.Encoder().Encode(v)
+		if err != nil {
+			t.Fatal("should not fail on encode", err)
+		}
+		out, err := rec.Decoder().Decode(b)
+		if err != nil {
+			t.Fatal("should not fail on decode", err)
+		}
+		return out.(map[string]interface{})["email"]
+	}
+	if email := roundTrip(map[string]interface{}{"name": "a"}); email != nil {
+		t.Fatal("missing email should decode as null", email)
+	}
+	email := roundTrip(map[string]interface{}{"name": "a", "email": "a@b.c"})
+	if m, ok := email.(map[string]interface{}); !ok || m["string"] != "a@b.c" {
+		t.Fatal("email should decode in its branch", email)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	f := Factory()
+	point := f.NewRecord().SetName("point").SetField("x", f.SimpleType(schema.Int64)).ToDataSchema()
+	unionT := f.NewUnion(f.SimpleType(schema.Int64), f.SimpleType(schema.String), point)
+
+	if unionT.Valid(nil) || unionT.Valid(true) {
+		t.Fatal("null and boolean should not be valid")
+	}
+	for _, v := range []interface{}{
+		int64(1),
+		"foo",
+		map[string]interface{}{"x": int64(2)},
+		map[string]interface{}{"point": map[string]interface{}{"x": int64(3)}},
+	} {
+		if !unionT.Valid(v) {
+			t.Fatal("should be valid", v)
+		}
+		b, err := unionT.Encoder().Encode(v)
+		if err != nil {
+			t.Fatal("should not fail on encode", v, err)
+		}
+		if _, err = unionT.Decoder().Decode(b); err != nil {
+			t.Fatal("should not fail on decode", v, err)
+		}
+	}
+
+	b, _ := unionT.Encoder().Encode("foo")
+	v, _ := unionT.Decoder().Decode(b)
+	if v.(map[string]interface{})["string"] != "foo" {
+		t.Fatal("string should decode in its branch", v)
+	}
+}
+
+func TestUnionMeta(t *testing.T) {
+	f := Factory()
+	for _, ds := range []schema.DataSchema{
+		f.NewOptional(f.NewEnum("color", "RED", "GREEN")),
+		f.NewUnion(f.SimpleType(schema.Null), f.SimpleType(schema.Int64), f.NewArray(f.SimpleType(schema.String))),
+	} {
+		b, err := ds.EncodeSchema()
+		if err != nil {
+			t.Fatal("should not fail on encode", err)
+		}
+		dec, err := f.Decoder().Decode(b)
+		if err != nil {
+			t.Fatal("should decode avro bytes", err)
+		}
+		u, ok := dec.(*avroUnionSchema)
+		if !ok {
+			t.Fatal("decoded schema should be union")
+		}
+		if u.optional != ds.(*avroUnionSchema).optional || len(u.names) != len(ds.(*avroUnionSchema).names) {
+			t.Fatal("decoded union should match", u.names, u.optional)
+		}
+		if dec, err = f.Decoder().DecodeNative(ds.EncodeSchemaNative()); err != nil {
+			t.Fatal("should decode avro native", err)
+		}
+	}
+
+	if _, err := f.Decoder().WithTypes(schema.Schema{}).DecodeNative(map[string]interface{}{"Ref": map[string]interface{}{"typename": "foo_0"}}); err != schema.TypeNotFound {
+		t.Fatal("unknown refs cannot be decoded", err)
+	}
+
+	str := map[string]interface{}{"Simple": "STRING"}
+	sameBranches := map[string]interface{}{"Complex": map[string]interface{}{"type": map[string]interface{}{
+		"UNION": map[string]interface{}{"types": []interface{}{str, str}},
+	}}}
+	if _, err := f.Decoder().DecodeNative(sameBranches); err == nil {
+		t.Fatal("union of the same types should not be decoded")
+	}
+}
+
+func TestUnionNetwork(t *testing.T) {
+	f := Factory()
+	rec := f.NewRecord().SetName("created").
+		SetField("name", f.SimpleType(schema.String)).
+		SetField("color", f.NewOptional(f.NewEnum("color", "RED", "GREEN"))).
+		ToDataSchema()
+	scm := &schema.Schema{Entities: map[string]schema.EntityType{
+		"user": schema.EntityType{Name: "user", Events: map[schema.EventSchemaID]schema.DataSchema{
+			schema.NewEventSchemaID("created", 0): rec,
+		}},
+	}}
+	var wrapper interface{}
+	if err := json.Unmarshal(f.EncodeNetwork(scm), &wrapper); err != nil {
+		t.Fatal("network schema should be json", err)
+	}
+	b, _ := json.Marshal([]interface{}{map[string]interface{}{"type": "null"}, wrapper})
+	codec, err := goavro.NewCodec(string(b))
+	if err != nil {
+		t.Fatal("network schema should be valid avro", err)
+	}
+	native := map[string]interface{}{"data": map[string]interface{}{
+		"entity_event": map[string]interface{}{"user": map[string]interface{}{
+			"id":           []byte("u1"),
+			"expected_vsn": int64(-1),
+			"event": map[string]interface{}{"created_0": map[string]interface{}{
+				"data": map[string]interface{}{"name": "a", "color": map[string]interface{}{"color": "RED"}},
+			}},
+			"subscription": int64(0), "vsn": int64(0), "ts": int64(0), "position": []byte{},
+		}},
+		"entity_events": nil,
+		"entity_load":   nil,
+	}}
+	if _, err = codec.BinaryFromNative(nil, native); err != nil {
+		t.Fatal("should encode network data", err)
+	}
+}
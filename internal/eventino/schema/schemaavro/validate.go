@@ -0,0 +1,90 @@
+package schemaavro
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// validate walks the whole value, returning the errors
+// of v for the schema, with their path below path
+func validate(path string, ds schema.DataSchema, v interface{}) []schema.ValidationError {
+	switch s := ds.(type) {
+	case *avroRefSchema:
+		if s.target == nil {
+			return invalid(path, "unresolved type %s", s.id.ToString())
+		}
+		return validate(path, s.target, v)
+	case *avroRecordSchema:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch(path, ds, v)
+		}
+		return validateFields(path, s, m)
+	case *avroArraySchema:
+		vv := reflect.ValueOf(v)
+		if v == nil || vv.Kind() != reflect.Slice {
+			return mismatch(path, ds, v)
+		}
+		var out []schema.ValidationError
+		for i := 0; i < vv.Len(); i++ {
+			out = append(out, validate(schema.ItemPath(path, i), s.items, vv.Index(i).Interface())...)
+		}
+		return out
+	case *avroUnionSchema:
+		if _, ok := s.normalize(v); ok {
+			return nil
+		}
+		// the optional value errors are more useful than a mismatch
+		if s.optional && v != nil {
+			return validate(path, s.types[1], v)
+		}
+	case *avroEnumSchema:
+		if str, ok := v.(string); ok && !schema.HasSymbol(s.symbols, str) {
+			return invalid(path, "unknown symbol %s of %s", str, describe(s))
+		}
+	}
+	if _, ok := ds.(avroSchema).normalize(v); !ok {
+		return mismatch(path, ds, v)
+	}
+	return nil
+}
+
+// validateFields reports the unknown fields, and the missing required ones
+func validateFields(path string, r *avroRecordSchema, m map[string]interface{}) []schema.ValidationError {
+	names := make([]string, 0, len(r.fields)+len(m))
+	for name := range r.fields {
+		names = append(names, name)
+	}
+	for name := range m {
+		if _, ok := r.fields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var out []schema.ValidationError
+	for _, name := range names {
+		f, known := r.fields[name]
+		v, present := m[name]
+		switch {
+		case !known:
+			out = append(out, invalid(path, "unknown field %s", name)...)
+		case present:
+			out = append(out, validate(schema.FieldPath(path, name), f, v)...)
+		case !r.hasDefault(name):
+			out = append(out, invalid(path, "missing required field %s", name)...)
+		}
+	}
+	return out
+}
+
+func mismatch(path string, ds schema.DataSchema, v interface{}) []schema.ValidationError {
+	return invalid(path, "expected %s, got %s", describe(deref(ds)), schema.ValueType(v))
+}
+
+func invalid(path, format string, args ...interface{}) []schema.ValidationError {
+	return []schema.ValidationError{{Path: path, Message: fmt.Sprintf(format, args...)}}
+}
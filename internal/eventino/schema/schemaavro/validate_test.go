@@ -0,0 +1,72 @@
+package schemaavro
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestValidate(t *testing.T) {
+	f := Factory()
+	str := f.SimpleType(schema.String)
+	ds := f.NewRecord().SetName("created").
+		SetField("Name", str).
+		SetField("Email", str).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		SetField("address", f.NewRecord().SetName("address").
+			SetField("street", str).
+			SetField("zip", f.NewOptional(str)).
+			ToDataSchema()).
+		SetField("tags", f.NewArray(str)).
+		ToDataSchema()
+
+	v := map[string]interface{}{
+		"Name":    "foo",
+		"Email":   "foo@bar.baz",
+		"color":   "RED",
+		"address": map[string]interface{}{"street": "main st"},
+		"tags":    []interface{}{"a", "b"},
+	}
+	if out := ds.Validate(v); len(out) != 0 {
+		t.Fatal("value should be valid", out)
+	}
+
+	v = map[string]interface{}{
+		"Name":    int64(1),
+		"color":   "BLUE",
+		"address": map[string]interface{}{"street": "main st", "zip": int64(1234)},
+		"tags":    []interface{}{"a", "b", "c", true},
+		"unknown": "x",
+	}
+	expected := []schema.ValidationError{
+		{Path: "", Message: "missing required field Email"},
+		{Path: "Name", Message: "expected string, got int64"},
+		{Path: "address.zip", Message: "expected string, got int64"},
+		{Path: "color", Message: "unknown symbol BLUE of enum color{RED,GREEN}"},
+		{Path: "tags[3]", Message: "expected string, got bool"},
+		{Path: "", Message: "unknown field unknown"},
+	}
+	out := ds.Validate(v)
+	if fmt.Sprint(out) != fmt.Sprint(expected) {
+		t.Fatal("wrong errors", out)
+	}
+	if ds.Valid(v) {
+		t.Fatal("value should not be valid")
+	}
+	// Valid agrees with Validate on the missing required fields
+	if ds.Valid(map[string]interface{}{"Name": "foo", "color": "RED", "address": map[string]interface{}{"street": "main st"}, "tags": []interface{}{}}) {
+		t.Fatal("value missing Email should not be valid")
+	}
+
+	if out = ds.Validate("foo"); len(out) != 1 || out[0].String() != "expected record created, got string" {
+		t.Fatal("wrong error", out)
+	}
+	union := f.NewUnion(f.SimpleType(schema.Int64), str)
+	if out = union.Validate(true); len(out) != 1 || out[0].String() != "expected union<long,string>, got bool" {
+		t.Fatal("wrong union error", out)
+	}
+	if out = f.NewRef("address", 0).Validate(nil); len(out) != 1 || out[0].Message != "unresolved type address_0" {
+		t.Fatal("wrong ref error", out)
+	}
+}
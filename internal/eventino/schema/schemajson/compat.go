@@ -0,0 +1,115 @@
+package schemajson
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// jsonRules are the resolution rules of the json schemas, the avro
+// ones since the unknown fields are dropped when decoding. See
+// schema.SchemaRules
+type jsonRules struct{}
+
+// Deref returns the type referred by refs, or nil if unresolved
+func (jsonRules) Deref(ds schema.DataSchema) schema.DataSchema {
+	if s := deref(ds); s != nil {
+		return s
+	}
+	return nil
+}
+
+func (jsonRules) Branches(ds schema.DataSchema) ([]schema.DataSchema, bool) {
+	if s := ds.(*jsonSchema); isUnion(s) {
+		return s.types, true
+	}
+	return nil, false
+}
+
+func (jsonRules) Items(ds schema.DataSchema) (schema.DataSchema, bool) {
+	s := ds.(*jsonSchema)
+	return s.items, s.t == schema.Array
+}
+
+func (jsonRules) Enum(ds schema.DataSchema) (string, []string, bool) {
+	s := ds.(*jsonSchema)
+	return s.name, s.symbols, s.t == schema.Enum
+}
+
+// Promotes reads the same types, the integers as wider ones or as
+// numbers, and the decimals with the same scale as the wider ones
+func (jsonRules) Promotes(reader, writer schema.DataSchema) bool {
+	r, w := reader.Type(), writer.Type()
+	switch {
+	case r == schema.Decimal && w == schema.Decimal:
+		rd, wd := reader.(*jsonSchema), writer.(*jsonSchema)
+		return wd.scale == rd.scale && wd.precision <= rd.precision
+	case r == w:
+		return true
+	case w == schema.Int32 && (r == schema.Int64 || r == schema.Float32 || r == schema.Float64):
+		return true
+	case w == schema.Int64 && (r == schema.Float32 || r == schema.Float64):
+		return true
+	case w == schema.Float32 && r == schema.Float64:
+		return true
+	}
+	return false
+}
+
+func (jsonRules) HasDefault(r schema.RecordSchema, name string) bool {
+	return r.(*jsonSchema).hasDefault(name)
+}
+
+// SameBranches is true if the unions have as many branches
+func (jsonRules) SameBranches(prev, next schema.DataSchema) bool {
+	return len(prev.(*jsonSchema).types) == len(next.(*jsonSchema).types)
+}
+
+func (jsonRules) Describe(ds schema.DataSchema) string {
+	s, _ := ds.(*jsonSchema)
+	return describe(s)
+}
+
+// describe is a short description of the type, e.g. optional<integer>,
+// enum color{RED,GREEN}, object created or timestamp-millis
+func describe(s *jsonSchema) string {
+	if s == nil {
+		return "unresolved"
+	}
+	switch s.t {
+	case schema.Record:
+		return "object " + s.name
+	case schema.Enum:
+		return fmt.Sprintf("enum %s{%s}", s.name, strings.Join(s.symbols, ","))
+	case schema.Array:
+		return fmt.Sprintf("array<%s>", describe(deref(s.items)))
+	case schema.Optional:
+		return fmt.Sprintf("optional<%s>", describe(deref(s.types[1])))
+	case schema.Union:
+		branches := make([]string, len(s.types))
+		for i, t := range s.types {
+			branches[i] = describe(deref(t))
+		}
+		return fmt.Sprintf("anyOf<%s>", strings.Join(branches, ","))
+	case schema.Decimal:
+		return fmt.Sprintf("decimal(%d,%d)", s.precision, s.scale)
+	}
+	if f, ok := formatTypes[s.t]; ok {
+		return f.format
+	}
+	return basicTypes[s.t]
+}
+
+// deref returns the type referred by refs, or nil if unresolved
+func deref(ds schema.DataSchema) *jsonSchema {
+	s, _ := ds.(*jsonSchema)
+	for s != nil && s.t == schema.Ref {
+		s, _ = s.target.(*jsonSchema)
+	}
+	return s
+}
+
+func isUnion(s *jsonSchema) bool {
+	return s.t == schema.Union || s.t == schema.Optional
+}
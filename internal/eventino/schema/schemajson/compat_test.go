@@ -0,0 +1,101 @@
+package schemajson
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestCanRead(t *testing.T) {
+	f := Factory()
+	str, integer, number := f.SimpleType(schema.String), f.SimpleType(schema.Int64), f.SimpleType(schema.Float64)
+	v0 := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetField("age", integer).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		ToDataSchema()
+
+	// added optional field, widened type, added symbol
+	v1 := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetField("age", number).
+		SetField("color", f.NewEnum("color", "RED", "GREEN", "BLUE")).
+		SetField("email", f.NewOptional(str)).
+		ToDataSchema()
+	if out := v1.CanRead(v0); len(out) != 0 {
+		t.Fatal("v1 should read v0", out)
+	}
+	out := v0.CanRead(v1)
+	if len(out) != 2 {
+		t.Fatal("v0 should not read v1", out)
+	}
+	if out[0].Path != "$.age" || out[0].Rule != schema.RuleTypeMismatch {
+		t.Fatal("number cannot be read as integer", out[0])
+	}
+	if out[1].Path != "$.color" || out[1].Rule != schema.RuleMissingSymbol {
+		t.Fatal("BLUE cannot be read", out[1])
+	}
+
+	// added required field
+	v2 := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetField("age", integer).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		SetField("tags", f.NewArray(str)).
+		ToDataSchema()
+	if out = v2.CanRead(v0); len(out) != 1 || out[0].Path != "$.tags" || out[0].Rule != schema.RuleMissingDefault {
+		t.Fatal("tags is required", out)
+	}
+	if out = v0.CanRead(v2); len(out) != 0 {
+		t.Fatal("v0 should read v2", out)
+	}
+
+	// added field with a default, renamed field read by its alias
+	v3 := f.NewRecord().SetName("created").
+		SetField("fullName", str).
+		SetFieldOptions("fullName", schema.FieldOptions{Aliases: []string{"name"}}).
+		SetField("age", integer).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		SetField("tags", f.NewArray(str)).
+		SetFieldOptions("tags", schema.FieldOptions{Default: []interface{}{}}).
+		ToDataSchema()
+	if out = v3.CanRead(v0); len(out) != 0 {
+		t.Fatal("v3 should read v0", out)
+	}
+	if changes := v3.Diff(v0); len(changes) != 2 || changes[0].Change != schema.FieldRenamed || changes[1].Change != schema.FieldAdded {
+		t.Fatal("name should be renamed", changes)
+	}
+
+	if out = f.NewUnion(integer, str).CanRead(f.NewUnion(integer, f.SimpleType(schema.Bool))); len(out) != 1 || out[0].Rule != schema.RuleMissingBranch {
+		t.Fatal("boolean matches no branch", out)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	f := Factory()
+	str := f.SimpleType(schema.String)
+	v0 := f.NewRecord().SetName("created").
+		SetField("name", str).
+		SetField("age", f.SimpleType(schema.Int64)).
+		SetField("home", f.NewRecord().SetName("address").SetField("street", str).ToDataSchema()).
+		ToDataSchema()
+	if out := v0.Diff(v0); len(out) != 0 {
+		t.Fatal("same schema should have no changes", out)
+	}
+
+	v1 := f.NewRecord().SetName("created").
+		SetField("name", f.SimpleType(schema.Bytes)).
+		SetField("home", f.NewRecord().SetName("address").SetField("street", str).SetField("zip", f.NewOptional(str)).ToDataSchema()).
+		SetField("tags", f.NewArray(str)).
+		ToDataSchema()
+	expected := []schema.FieldChange{
+		{Path: "$.age", Change: schema.FieldRemoved, From: "integer"},
+		{Path: "$.home.zip", Change: schema.FieldAdded, To: "optional<string>"},
+		{Path: "$.name", Change: schema.FieldChanged, From: "string", To: "bytes"},
+		{Path: "$.tags", Change: schema.FieldAdded, To: "array<string>"},
+	}
+	if out := v1.Diff(v0); fmt.Sprint(out) != fmt.Sprint(expected) {
+		t.Fatal("wrong changes", out)
+	}
+}
@@ -0,0 +1,322 @@
+package schemajson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// Factory returns a schema.SchemaFactory whose payloads are stored
+// as JSON, and described with a JSON-Schema-like description
+func Factory() schema.SchemaFactory {
+	return jsonSchemaFactory{}
+}
+
+type jsonSchemaFactory struct{}
+
+// SimpleType returns the basic and the format types,
+// nil for the other ones, built with the factory
+func (jsonSchemaFactory) SimpleType(t schema.DataType) schema.DataSchema {
+	_, basic := basicTypes[t]
+	_, format := formatTypes[t]
+	if !basic && !format {
+		return nil
+	}
+	return &jsonSchema{t: t}
+}
+
+func (jsonSchemaFactory) NewRecord() schema.RecordSchemaBuilder {
+	return &jsonRecordSchemaBuilder{fields: map[string]schema.DataSchema{}}
+}
+
+func (jsonSchemaFactory) NewArray(items schema.DataSchema) schema.DataSchema {
+	return &jsonSchema{t: schema.Array, items: items}
+}
+
+func (jsonSchemaFactory) NewEnum(name string, symbols ...string) schema.DataSchema {
+	return &jsonSchema{t: schema.Enum, name: name, symbols: symbols}
+}
+
+func (jsonSchemaFactory) NewOptional(t schema.DataSchema) schema.DataSchema {
+	return newOptional(t)
+}
+
+func (jsonSchemaFactory) NewUnion(types ...schema.DataSchema) schema.DataSchema {
+	return &jsonSchema{t: schema.Union, types: types}
+}
+
+// NewRef refers to the named type at the given version,
+// resolved when the schema is decoded with the schema types
+func (jsonSchemaFactory) NewRef(name string, vsn uint64) schema.DataSchema {
+	return &jsonSchema{t: schema.Ref, id: schema.NewEventSchemaID(name, vsn)}
+}
+
+// NewDecimal is a decimal string with at most precision
+// digits, scale of them after the point
+func (jsonSchemaFactory) NewDecimal(precision, scale int) schema.DataSchema {
+	return newDecimal(precision, scale)
+}
+
+func (jsonSchemaFactory) Decoder() schema.SchemaDecoder {
+	return jsonSchemaDecoder{}
+}
+
+// EncodeNetwork describes the schema as JSON: the event types of
+// the entity types, and the named types, by their "name_vsn".
+// The TCP server speaks avro, and runs with the avro factory
+func (jsonSchemaFactory) EncodeNetwork(s *schema.Schema) []byte {
+	entities := map[string]interface{}{}
+	for name, typ := range s.Entities {
+		entities[name] = map[string]interface{}{"events": describeTypes(typ.Events)}
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"vsn":      s.VSN,
+		"entities": entities,
+		"records":  describeTypes(s.Records),
+		"enums":    describeTypes(s.Enums),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func describeTypes(types map[schema.EventSchemaID]schema.DataSchema) map[string]interface{} {
+	out := make(map[string]interface{}, len(types))
+	for id, ds := range types {
+		out[id.ToString()] = ds.EncodeSchemaNative()
+	}
+	return out
+}
+
+func newOptional(t schema.DataSchema) schema.DataSchema {
+	return &jsonSchema{t: schema.Optional, types: []schema.DataSchema{&jsonSchema{t: schema.Null}, t}}
+}
+
+type jsonRecordSchemaBuilder struct {
+	name    string
+	fields  map[string]schema.DataSchema
+	options map[string]schema.FieldOptions
+}
+
+func (r *jsonRecordSchemaBuilder) SetName(name string) schema.RecordSchemaBuilder {
+	r.name = name
+	return r
+}
+
+func (r *jsonRecordSchemaBuilder) SetField(name string, typ schema.DataSchema) schema.RecordSchemaBuilder {
+	r.fields[name] = typ
+	return r
+}
+
+func (r *jsonRecordSchemaBuilder) SetFieldOptions(name string, opts schema.FieldOptions) schema.RecordSchemaBuilder {
+	if r.options == nil {
+		r.options = map[string]schema.FieldOptions{}
+	}
+	r.options[name] = opts
+	return r
+}
+
+// ToDataSchema panics if a default is not valid for its field
+func (r *jsonRecordSchemaBuilder) ToDataSchema() schema.DataSchema {
+	s, err := r.build(false)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// build makes the optional fields optional, and conforms the defaults
+func (r *jsonRecordSchemaBuilder) build(decoding bool) (*jsonSchema, error) {
+	s := &jsonSchema{t: schema.Record, name: r.name, fields: make(map[string]schema.DataSchema, len(r.fields))}
+	for name, field := range r.fields {
+		opts := r.options[name]
+		if opts.Optional && !nullable(field) {
+			field = newOptional(field)
+		}
+		s.fields[name] = field
+		if opts.IsZero() {
+			continue
+		}
+		if opts.Default != nil {
+			d, err := field.(*jsonSchema).conform(opts.Default, decoding)
+			if err != nil {
+				return nil, fmt.Errorf("object %s property %s: invalid default %v", r.name, name, opts.Default)
+			}
+			opts.Default = d
+		}
+		if s.options == nil {
+			s.options = map[string]schema.FieldOptions{}
+		}
+		s.options[name] = opts
+	}
+	return s, nil
+}
+
+// jsonSchemaDecoder resolves the referenced types with types,
+// if set. Otherwise references are left unresolved
+type jsonSchemaDecoder struct {
+	types schema.TypeResolver
+}
+
+func (d jsonSchemaDecoder) WithTypes(types schema.TypeResolver) schema.SchemaDecoder {
+	return jsonSchemaDecoder{types: types}
+}
+
+func (d jsonSchemaDecoder) Decode(b []byte) (schema.DataSchema, error) {
+	var descr interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if err := dec.Decode(&descr); err != nil {
+		return nil, err
+	}
+	return d.DecodeNative(descr)
+}
+
+func (d jsonSchemaDecoder) DecodeNative(descr interface{}) (schema.DataSchema, error) {
+	m, ok := descr.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot decode %+v", descr)
+	}
+	if ref, ok := m["$ref"]; ok {
+		typename, ok := ref.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot decode ref %+v", ref)
+		}
+		return d.decodeRef(typename)
+	}
+	if anyOf, ok := m["anyOf"]; ok {
+		return d.decodeUnion(anyOf)
+	}
+	if symbols, ok := m["enum"]; ok {
+		name, _ := m["title"].(string)
+		strs, ok := toStrings(symbols)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("cannot decode enum %+v", m)
+		}
+		return &jsonSchema{t: schema.Enum, name: name, symbols: strs}, nil
+	}
+	t, _ := m["type"].(string)
+	switch t {
+	case "object":
+		return d.decodeRecord(m)
+	case "array":
+		items, err := d.DecodeNative(m["items"])
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{t: schema.Array, items: items}, nil
+	}
+	if ds, ok, err := decodeFormat(m); ok {
+		return ds, err
+	}
+	for dt, name := range basicTypes {
+		if name == t {
+			return &jsonSchema{t: dt}, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot decode %+v", m)
+}
+
+// decodeUnion decodes anyOf, as an optional if it is (null, T)
+func (d jsonSchemaDecoder) decodeUnion(anyOf interface{}) (schema.DataSchema, error) {
+	descrs, ok := anyOf.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot decode anyOf %+v", anyOf)
+	}
+	types := make([]schema.DataSchema, len(descrs))
+	for i, descr := range descrs {
+		t, err := d.DecodeNative(descr)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = t
+	}
+	if len(types) == 2 && types[0].Type() == schema.Null {
+		return newOptional(types[1]), nil
+	}
+	return &jsonSchema{t: schema.Union, types: types}, nil
+}
+
+// decodeRecord decodes an object, the properties not
+// required are optional, unless they have a default
+func (d jsonSchemaDecoder) decodeRecord(m map[string]interface{}) (schema.DataSchema, error) {
+	name, _ := m["title"].(string)
+	properties, ok := m["properties"].(map[string]interface{})
+	if name == "" || !ok {
+		return nil, fmt.Errorf("cannot decode object %+v", m)
+	}
+	required := map[string]bool{}
+	if m["required"] != nil {
+		names, ok := toStrings(m["required"])
+		if !ok {
+			return nil, fmt.Errorf("cannot decode required %+v", m["required"])
+		}
+		for _, name := range names {
+			required[name] = true
+		}
+	}
+	b := &jsonRecordSchemaBuilder{name: name, fields: make(map[string]schema.DataSchema, len(properties))}
+	for fieldName, descr := range properties {
+		field, err := d.DecodeNative(descr)
+		if err != nil {
+			return nil, err
+		}
+		// DecodeNative checked descr is a map
+		pm := descr.(map[string]interface{})
+		opts := schema.FieldOptions{Default: pm["default"]}
+		opts.Doc, _ = pm["description"].(string)
+		if pm["aliases"] != nil {
+			if opts.Aliases, ok = toStrings(pm["aliases"]); !ok {
+				return nil, fmt.Errorf("cannot decode aliases %+v", pm["aliases"])
+			}
+		}
+		if !required[fieldName] && opts.Default == nil && !nullable(field) {
+			field = newOptional(field)
+		}
+		b.SetField(fieldName, field).SetFieldOptions(fieldName, opts)
+	}
+	s, err := b.build(true)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// decodeRef parses the "name_vsn" typename, and resolves it
+func (d jsonSchemaDecoder) decodeRef(typename string) (schema.DataSchema, error) {
+	id := schema.EventSchemaIDFromString(typename)
+	if d.types == nil {
+		return &jsonSchema{t: schema.Ref, id: id}, nil
+	}
+	target, ok := d.types.ResolveType(id)
+	if !ok {
+		return nil, schema.TypeNotFound
+	}
+	return &jsonSchema{t: schema.Ref, id: id, target: target}, nil
+}
+
+// nullable is true if the schema accepts null
+func nullable(ds schema.DataSchema) bool {
+	_, err := ds.(*jsonSchema).conform(nil, false)
+	return err == nil
+}
+
+func toStrings(v interface{}) ([]string, bool) {
+	switch vs := v.(type) {
+	case []string:
+		return vs, true
+	case []interface{}:
+		out := make([]string, len(vs))
+		for i, s := range vs {
+			str, ok := s.(string)
+			if !ok {
+				return nil, false
+			}
+			out[i] = str
+		}
+		return out, true
+	}
+	return nil, false
+}
@@ -0,0 +1,67 @@
+package schemajson
+
+import (
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestRef(t *testing.T) {
+	f := Factory()
+	address := f.NewRecord().SetName("address").
+		SetField("street", f.SimpleType(schema.String)).
+		ToDataSchema()
+	types := schema.Schema{Records: map[schema.EventSchemaID]schema.DataSchema{
+		schema.NewEventSchemaID("address", 0): address,
+	}}
+
+	ds := f.NewRecord().SetName("created").
+		SetField("address", f.NewRef("address", 0)).
+		ToDataSchema()
+	if _, err := ds.Encoder().Encode(map[string]interface{}{"address": nil}); err != UnresolvedTypeError {
+		t.Fatal("unresolved refs should not encode", err)
+	}
+
+	b, err := ds.EncodeSchema()
+	if err != nil {
+		t.Fatal("should encode schema", err)
+	}
+	if _, err = f.Decoder().WithTypes(schema.Schema{}).Decode(b); err != schema.TypeNotFound {
+		t.Fatal("unknown types should not resolve", err)
+	}
+	if ds, err = f.Decoder().WithTypes(types).Decode(b); err != nil {
+		t.Fatal("should decode schema with types", err)
+	}
+
+	v := map[string]interface{}{"address": map[string]interface{}{"street": "main st"}}
+	b, err = ds.Encoder().Encode(v)
+	if err != nil {
+		t.Fatal("should encode", err)
+	}
+	decoded, err := ds.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode", err)
+	}
+	if decoded.(map[string]interface{})["address"].(map[string]interface{})["street"] != "main st" {
+		t.Fatal("wrong decoded value", decoded)
+	}
+	if ds.Valid(map[string]interface{}{"address": map[string]interface{}{}}) {
+		t.Fatal("street is required")
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	dec := Factory().Decoder()
+	for _, descr := range []string{
+		`"string"`,
+		`{"type": "date"}`,
+		`{"type": "object", "properties": {}}`,
+		`{"type": "string", "enum": ["RED"]}`,
+		`{"type": "array", "items": 1}`,
+		`{"anyOf": {}}`,
+	} {
+		if _, err := dec.Decode([]byte(descr)); err == nil {
+			t.Fatal("should not decode", descr)
+		}
+	}
+}
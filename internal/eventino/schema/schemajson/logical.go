@@ -0,0 +1,179 @@
+package schemajson
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// jsonFormat is a type described by a JSON type and a format
+type jsonFormat struct {
+	typ    string
+	format string
+}
+
+// formatTypes are the types stored as a JSON type: the 32 bits
+// numbers, and the logical types, named after the avro ones.
+// Decimals are strings too, with their precision and scale
+var formatTypes = map[schema.DataType]jsonFormat{
+	schema.Int32:           {"integer", "int32"},
+	schema.Float32:         {"number", "float"},
+	schema.TimestampMillis: {"integer", "timestamp-millis"},
+	schema.TimestampMicros: {"integer", "timestamp-micros"},
+	schema.Date:            {"integer", "date"},
+	schema.UUID:            {"string", "uuid"},
+}
+
+const decimalFormat = "decimal"
+
+// conformLogical conforms the values of the format types, converting
+// the Go native values to the stored ones: time.Time to the integers of
+// the timestamps and dates, *big.Rat to the decimal strings, e.g. "12.50"
+func (s *jsonSchema) conformLogical(v interface{}) (interface{}, bool) {
+	switch s.t {
+	case schema.Int32:
+		if n, ok := toInt64(v); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int32(n), true
+		}
+	case schema.Float32:
+		if n, ok := toFloat64(v); ok {
+			return float32(n), true
+		}
+	case schema.TimestampMillis:
+		if t, ok := v.(time.Time); ok {
+			return schema.ToTimestampMillis(t), true
+		}
+		return toInt64(v)
+	case schema.TimestampMicros:
+		if t, ok := v.(time.Time); ok {
+			return schema.ToTimestampMicros(t), true
+		}
+		return toInt64(v)
+	case schema.Date:
+		if t, ok := v.(time.Time); ok {
+			return schema.ToDateDays(t), true
+		}
+		if n, ok := toInt64(v); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int32(n), true
+		}
+	case schema.UUID:
+		str, ok := v.(string)
+		return v, ok && schema.ValidUUID(str)
+	case schema.Decimal:
+		return s.conformDecimal(v)
+	}
+	return v, false
+}
+
+// conformDecimal accepts *big.Rat and decimal strings
+// fitting the precision and scale
+func (s *jsonSchema) conformDecimal(v interface{}) (interface{}, bool) {
+	var r *big.Rat
+	switch d := v.(type) {
+	case *big.Rat:
+		r = d
+	case string:
+		r, _ = new(big.Rat).SetString(d)
+	}
+	if r == nil {
+		return v, false
+	}
+	if _, ok := schema.ToDecimalBytes(r, s.precision, s.scale); !ok {
+		return v, false
+	}
+	return r.FloatString(s.scale), true
+}
+
+// goNative converts the logical values within v to their Go native values
+func goNative(s *jsonSchema, v interface{}) interface{} {
+	switch s.t {
+	case schema.Ref:
+		if s.target != nil {
+			return goNative(s.target.(*jsonSchema), v)
+		}
+	case schema.Record:
+		if m, ok := v.(map[string]interface{}); ok {
+			out := make(map[string]interface{}, len(m))
+			for k, val := range m {
+				out[k] = val
+				if f, ok := s.fields[k]; ok {
+					out[k] = goNative(f.(*jsonSchema), val)
+				}
+			}
+			return out
+		}
+	case schema.Array:
+		if arr, ok := v.([]interface{}); ok {
+			out := make([]interface{}, len(arr))
+			for i, item := range arr {
+				out[i] = goNative(s.items.(*jsonSchema), item)
+			}
+			return out
+		}
+	case schema.Union, schema.Optional:
+		// union values are plain, converted by the first branch they conform to
+		for _, t := range s.types {
+			if _, err := t.(*jsonSchema).conform(v, true); err == nil {
+				return goNative(t.(*jsonSchema), v)
+			}
+		}
+	case schema.TimestampMillis:
+		if n, ok := v.(int64); ok {
+			return schema.FromTimestampMillis(n)
+		}
+	case schema.TimestampMicros:
+		if n, ok := v.(int64); ok {
+			return schema.FromTimestampMicros(n)
+		}
+	case schema.Date:
+		if n, ok := v.(int32); ok {
+			return schema.FromDateDays(n)
+		}
+	case schema.Decimal:
+		if str, ok := v.(string); ok {
+			if r, ok := new(big.Rat).SetString(str); ok {
+				return r
+			}
+		}
+	}
+	return v
+}
+
+// describeFormat describes the format types, and the decimals
+func (s *jsonSchema) describeFormat() (map[string]interface{}, bool) {
+	if s.t == schema.Decimal {
+		return map[string]interface{}{"type": "string", "format": decimalFormat, "precision": s.precision, "scale": s.scale}, true
+	}
+	if f, ok := formatTypes[s.t]; ok {
+		return map[string]interface{}{"type": f.typ, "format": f.format}, true
+	}
+	return nil, false
+}
+
+// decodeFormat decodes the format types, and the decimals.
+// The other formats are left to the JSON type
+func decodeFormat(m map[string]interface{}) (schema.DataSchema, bool, error) {
+	t, _ := m["type"].(string)
+	format, _ := m["format"].(string)
+	if t == "string" && format == decimalFormat {
+		precision, ok1 := toInt64(m["precision"])
+		scale, ok2 := toInt64(m["scale"])
+		if !ok1 || !ok2 || precision <= 0 || scale < 0 || scale > precision {
+			return nil, true, fmt.Errorf("cannot decode decimal %+v", m)
+		}
+		return newDecimal(int(precision), int(scale)), true, nil
+	}
+	for dt, f := range formatTypes {
+		if f.typ == t && f.format == format {
+			return &jsonSchema{t: dt}, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func newDecimal(precision, scale int) *jsonSchema {
+	return &jsonSchema{t: schema.Decimal, precision: precision, scale: scale}
+}
@@ -0,0 +1,135 @@
+package schemajson
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestNumbers(t *testing.T) {
+	f := Factory()
+	i32, f32 := f.SimpleType(schema.Int32), f.SimpleType(schema.Float32)
+	v, err := i32.Decoder().Decode([]byte(`42`))
+	if err != nil || v != int32(42) {
+		t.Fatal("wrong int32", v, err)
+	}
+	if i32.Valid(int64(1) << 40) {
+		t.Fatal("int32 should not overflow")
+	}
+	if v, err = f32.Decoder().Decode([]byte(`1.5`)); err != nil || v != float32(1.5) {
+		t.Fatal("wrong float", v, err)
+	}
+	if out := f.SimpleType(schema.Int64).CanRead(i32); len(out) != 0 {
+		t.Fatal("integers should read int32", out)
+	}
+	if out := i32.CanRead(f.SimpleType(schema.Int64)); len(out) != 1 {
+		t.Fatal("int32 should not read integers", out)
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	f := Factory()
+	now := time.Date(2018, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	for _, c := range []struct {
+		t        schema.DataType
+		expected time.Time
+	}{
+		{schema.TimestampMillis, now.Truncate(time.Millisecond)},
+		{schema.TimestampMicros, now.Truncate(time.Microsecond)},
+		{schema.Date, time.Date(2018, 3, 4, 0, 0, 0, 0, time.UTC)},
+	} {
+		ds := f.SimpleType(c.t)
+		if !ds.Valid(now) {
+			t.Fatal("time should be valid", c.t)
+		}
+		b, err := ds.Encoder().Encode(now)
+		if err != nil {
+			t.Fatal("should encode", c.t, err)
+		}
+		v, err := ds.Decoder().Decode(b)
+		if err != nil {
+			t.Fatal("should decode", c.t, err)
+		}
+		if ds.GoNative(v).(time.Time) != c.expected {
+			t.Fatal("wrong time", c.t, ds.GoNative(v))
+		}
+		if !ds.Valid(v) || ds.Valid("2018-03-04") {
+			t.Fatal("wrong validation", c.t, v)
+		}
+	}
+
+	uuid := f.SimpleType(schema.UUID)
+	if !uuid.Valid("123e4567-e89b-12d3-a456-426655440000") || uuid.Valid("foo") {
+		t.Fatal("wrong uuid validation")
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	f := Factory()
+	ds := f.NewDecimal(5, 2)
+	for _, s := range []string{"-12.5", "0", "999.99", "-128", "0.01"} {
+		r, _ := new(big.Rat).SetString(s)
+		b, err := ds.Encoder().Encode(r)
+		if err != nil {
+			t.Fatal("should encode", s, err)
+		}
+		v, err := ds.Decoder().Decode(b)
+		if err != nil {
+			t.Fatal("should decode", s, err)
+		}
+		if ds.GoNative(v).(*big.Rat).Cmp(r) != 0 {
+			t.Fatal("wrong decimal", s, ds.GoNative(v))
+		}
+	}
+	if b, _ := ds.Encoder().Encode("12.5"); string(b) != `"12.50"` {
+		t.Fatal("decimals should be stored with their scale", string(b))
+	}
+	for _, v := range []interface{}{"1.234", "1000.00", "foo", 12.34} {
+		if ds.Valid(v) {
+			t.Fatal("should not be valid", v)
+		}
+	}
+	if out := ds.Validate("1.234"); len(out) != 1 || out[0].Message != "expected decimal(5,2), got string" {
+		t.Fatal("wrong error", out)
+	}
+	if out := f.NewDecimal(6, 2).CanRead(ds); len(out) != 0 {
+		t.Fatal("a larger precision should read", out)
+	}
+	if out := f.NewDecimal(5, 3).CanRead(ds); len(out) != 1 || out[0].Rule != schema.RuleTypeMismatch {
+		t.Fatal("the scale should match", out)
+	}
+}
+
+func TestEncodeFormats(t *testing.T) {
+	f := Factory()
+	ds := f.NewRecord().SetName("paid").
+		SetField("at", f.SimpleType(schema.TimestampMillis)).
+		SetField("amount", f.NewDecimal(10, 2)).
+		SetField("seats", f.SimpleType(schema.Int32)).
+		ToDataSchema()
+	b, err := ds.EncodeSchema()
+	if err != nil {
+		t.Fatal("cannot encode schema", err)
+	}
+	decoded, err := f.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("cannot decode schema", err)
+	}
+	if out := decoded.Diff(ds); len(out) != 0 {
+		t.Fatal("the formats should round trip", out, string(b))
+	}
+	at, _, _ := decoded.(schema.RecordSchema).Field("at")
+	amount, _, _ := decoded.(schema.RecordSchema).Field("amount")
+	if at.Type() != schema.TimestampMillis || amount.Type() != schema.Decimal {
+		t.Fatal("wrong decoded types", at.Type(), amount.Type())
+	}
+	if _, err = f.Decoder().Decode([]byte(`{"type": "string", "format": "decimal", "precision": 2, "scale": 3}`)); err == nil {
+		t.Fatal("the scale should not exceed the precision")
+	}
+	// the other formats are left to the JSON type
+	if ds, err = f.Decoder().Decode([]byte(`{"type": "string", "format": "email"}`)); err != nil || ds.Type() != schema.String {
+		t.Fatal("unknown formats should be strings", err)
+	}
+}
@@ -0,0 +1,362 @@
+package schemajson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// InvalidValueError is returned when encoding or decoding
+// a value not valid for the schema
+var InvalidValueError error
+
+// UnresolvedTypeError is returned when encoding or decoding
+// data with a schema that refers to a type not resolved yet
+var UnresolvedTypeError error
+
+func init() {
+	InvalidValueError = errors.New("value not valid for the schema")
+	UnresolvedTypeError = errors.New("schema refers to an unresolved type")
+}
+
+// jsonSchema is a data schema whose values are stored as JSON.
+// The fields used depend on its type
+type jsonSchema struct {
+	t schema.DataType
+	// name of records and enums
+	name string
+	// fields of records, and their options. The defaults are conformed
+	fields  map[string]schema.DataSchema
+	options map[string]schema.FieldOptions
+	// items of arrays
+	items schema.DataSchema
+	// symbols of enums
+	symbols []string
+	// types of unions, optionals are union(null, T)
+	types []schema.DataSchema
+	// id of the type referred, target is nil until resolved
+	id     schema.EventSchemaID
+	target schema.DataSchema
+	// precision and scale of decimals
+	precision int
+	scale     int
+}
+
+var basicTypes = map[schema.DataType]string{
+	schema.Null:    "null",
+	schema.Bool:    "boolean",
+	schema.Int64:   "integer",
+	schema.Float64: "number",
+	schema.String:  "string",
+	schema.Bytes:   "bytes",
+}
+
+func (s *jsonSchema) SchemaDecoder() schema.SchemaDecoder {
+	return jsonSchemaDecoder{}
+}
+
+// EncodeSchemaNative returns the JSON-Schema-like description, e.g.
+// {"type": "object", "title": "created", "properties": {...}, "required": [...]}
+func (s *jsonSchema) EncodeSchemaNative() interface{} {
+	return s.describe()
+}
+
+func (s *jsonSchema) EncodeSchema() ([]byte, error) {
+	return json.Marshal(s.describe())
+}
+
+func (s *jsonSchema) describe() map[string]interface{} {
+	switch s.t {
+	case schema.Record:
+		properties := map[string]interface{}{}
+		required := []interface{}{}
+		for _, name := range fieldNames(s) {
+			field := s.fields[name].(*jsonSchema)
+			opts := s.options[name]
+			// optional fields are the ones not required,
+			// as the ones with a default
+			descr := field.describe()
+			if field.t == schema.Optional {
+				descr = field.types[1].(*jsonSchema).describe()
+			} else if opts.Default == nil {
+				required = append(required, name)
+			}
+			if opts.Doc != "" {
+				descr["description"] = opts.Doc
+			}
+			if opts.Default != nil {
+				descr["default"] = opts.Default
+			}
+			if len(opts.Aliases) > 0 {
+				aliases := make([]interface{}, len(opts.Aliases))
+				for i, alias := range opts.Aliases {
+					aliases[i] = alias
+				}
+				descr["aliases"] = aliases
+			}
+			properties[name] = descr
+		}
+		return map[string]interface{}{"type": "object", "title": s.name, "properties": properties, "required": required}
+	case schema.Array:
+		return map[string]interface{}{"type": "array", "items": s.items.(*jsonSchema).describe()}
+	case schema.Enum:
+		symbols := make([]interface{}, len(s.symbols))
+		for i, sym := range s.symbols {
+			symbols[i] = sym
+		}
+		return map[string]interface{}{"type": "string", "title": s.name, "enum": symbols}
+	case schema.Union, schema.Optional:
+		types := make([]interface{}, len(s.types))
+		for i, t := range s.types {
+			types[i] = t.(*jsonSchema).describe()
+		}
+		return map[string]interface{}{"anyOf": types}
+	case schema.Ref:
+		return map[string]interface{}{"$ref": s.id.ToString()}
+	}
+	if descr, ok := s.describeFormat(); ok {
+		return descr
+	}
+	return map[string]interface{}{"type": basicTypes[s.t]}
+}
+
+func (s *jsonSchema) Encoder() schema.DataEncoder {
+	return s
+}
+
+func (s *jsonSchema) Decoder() schema.DataDecoder {
+	return s
+}
+
+func (s *jsonSchema) Type() schema.DataType {
+	return s.t
+}
+
+func (s *jsonSchema) CanRead(writer schema.DataSchema) []schema.Incompatibility {
+	return schema.CanReadData(jsonRules{}, s, writer)
+}
+
+func (s *jsonSchema) Diff(prev schema.DataSchema) []schema.FieldChange {
+	return schema.DiffData(jsonRules{}, prev, s)
+}
+
+func (s *jsonSchema) Valid(v interface{}) bool {
+	_, err := s.conform(v, false)
+	return err == nil
+}
+
+func (s *jsonSchema) Validate(v interface{}) []schema.ValidationError {
+	return validate("", s, v)
+}
+
+// GoNative converts the timestamps and dates to
+// time.Time, and the decimals to *big.Rat
+func (s *jsonSchema) GoNative(v interface{}) interface{} {
+	return goNative(s, v)
+}
+
+// DataEncoder
+func (s *jsonSchema) Encode(v interface{}) ([]byte, error) {
+	n, err := s.conform(v, false)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(n)
+}
+
+// DataDecoder
+func (s *jsonSchema) Decode(buf []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return s.conform(v, true)
+}
+
+// conform returns v as the schema native value: integers are
+// int64, numbers float64, bytes []byte, the format types as
+// in conformLogical, records maps with all their
+// fields (missing optional ones are nil), union values are plain.
+// When decoding, bytes are base64 strings and unknown fields are dropped
+func (s *jsonSchema) conform(v interface{}, decoding bool) (interface{}, error) {
+	switch s.t {
+	case schema.Null:
+		if v == nil {
+			return nil, nil
+		}
+	case schema.Bool:
+		if _, ok := v.(bool); ok {
+			return v, nil
+		}
+	case schema.String:
+		if _, ok := v.(string); ok {
+			return v, nil
+		}
+	case schema.Int64:
+		if n, ok := toInt64(v); ok {
+			return n, nil
+		}
+	case schema.Float64:
+		if n, ok := toFloat64(v); ok {
+			return n, nil
+		}
+	case schema.Bytes:
+		if b, ok := v.([]byte); ok {
+			return b, nil
+		}
+		if str, ok := v.(string); ok && decoding {
+			if b, err := base64.StdEncoding.DecodeString(str); err == nil {
+				return b, nil
+			}
+		}
+	case schema.Enum:
+		if sym, ok := v.(string); ok {
+			for _, symbol := range s.symbols {
+				if symbol == sym {
+					return sym, nil
+				}
+			}
+		}
+	case schema.Array:
+		if arr, ok := v.([]interface{}); ok {
+			out := make([]interface{}, len(arr))
+			for i, item := range arr {
+				n, err := s.items.(*jsonSchema).conform(item, decoding)
+				if err != nil {
+					return v, err
+				}
+				out[i] = n
+			}
+			return out, nil
+		}
+	case schema.Union, schema.Optional:
+		for _, t := range s.types {
+			if n, err := t.(*jsonSchema).conform(v, decoding); err == nil {
+				return n, nil
+			}
+		}
+	case schema.Record:
+		return s.conformRecord(v, decoding)
+	case schema.Ref:
+		if s.target == nil {
+			return v, UnresolvedTypeError
+		}
+		return s.target.(*jsonSchema).conform(v, decoding)
+	default:
+		if n, ok := s.conformLogical(v); ok {
+			return n, nil
+		}
+	}
+	return v, InvalidValueError
+}
+
+func (s *jsonSchema) conformRecord(v interface{}, decoding bool) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v, InvalidValueError
+	}
+	out := make(map[string]interface{}, len(s.fields))
+	for k, val := range m {
+		f, ok := s.fields[k]
+		if !ok {
+			if decoding {
+				continue
+			}
+			return v, InvalidValueError
+		}
+		n, err := f.(*jsonSchema).conform(val, decoding)
+		if err != nil {
+			return v, err
+		}
+		out[k] = n
+	}
+	// missing fields take their default, nullable ones are
+	// null by default, the other ones are required
+	for k, f := range s.fields {
+		if _, ok := m[k]; ok {
+			continue
+		}
+		if d := s.options[k].Default; d != nil {
+			out[k] = d
+			continue
+		}
+		if _, err := f.(*jsonSchema).conform(nil, decoding); err != nil {
+			return v, err
+		}
+		out[k] = nil
+	}
+	return out, nil
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case float64:
+		if n == math.Trunc(n) && math.Abs(n) < math.MaxInt64 {
+			return int64(n), true
+		}
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Name is the name of records and enums
+func (s *jsonSchema) Name() string {
+	return s.name
+}
+
+// FieldNames returns the sorted field names of records
+func (s *jsonSchema) FieldNames() []string {
+	return fieldNames(s)
+}
+
+// Field returns the type and the options of a record field
+func (s *jsonSchema) Field(name string) (schema.DataSchema, schema.FieldOptions, bool) {
+	f, ok := s.fields[name]
+	return f, s.options[name], ok
+}
+
+// hasDefault is true if the field has a default, or is nullable
+func (s *jsonSchema) hasDefault(name string) bool {
+	return s.options[name].Default != nil || nullable(s.fields[name])
+}
+
+func fieldNames(s *jsonSchema) []string {
+	names := make([]string, 0, len(s.fields))
+	for name := range s.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
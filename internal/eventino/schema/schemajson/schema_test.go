@@ -0,0 +1,191 @@
+package schemajson
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestRecord(t *testing.T) {
+	f := Factory()
+	ds := f.NewRecord().SetName("created").
+		SetField("name", f.SimpleType(schema.String)).
+		SetField("age", f.SimpleType(schema.Int64)).
+		SetField("score", f.SimpleType(schema.Float64)).
+		SetField("avatar", f.SimpleType(schema.Bytes)).
+		SetField("tags", f.NewArray(f.SimpleType(schema.String))).
+		SetField("email", f.NewOptional(f.SimpleType(schema.String))).
+		ToDataSchema()
+
+	v := map[string]interface{}{
+		"name":   "foo",
+		"age":    42,
+		"score":  1.5,
+		"avatar": []byte{1, 2, 3},
+		"tags":   []interface{}{"a", "b"},
+	}
+	if !ds.Valid(v) {
+		t.Fatal("value should be valid")
+	}
+	b, err := ds.Encoder().Encode(v)
+	if err != nil {
+		t.Fatal("should encode", err)
+	}
+	decoded, err := ds.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode", err)
+	}
+	m := decoded.(map[string]interface{})
+	if m["name"] != "foo" || m["age"] != int64(42) || m["score"] != 1.5 || m["email"] != nil {
+		t.Fatal("wrong decoded value", m)
+	}
+	if !bytes.Equal(m["avatar"].([]byte), []byte{1, 2, 3}) {
+		t.Fatal("bytes should round trip", m["avatar"])
+	}
+	if tags := m["tags"].([]interface{}); len(tags) != 2 || tags[1] != "b" {
+		t.Fatal("wrong tags", tags)
+	}
+
+	// required fields
+	delete(v, "name")
+	if ds.Valid(v) {
+		t.Fatal("name is required")
+	}
+	if _, err = ds.Encoder().Encode(v); err != InvalidValueError {
+		t.Fatal("should not encode without name", err)
+	}
+	if _, err = ds.Decoder().Decode([]byte(`{"age": 1, "score": 1, "avatar": "", "tags": []}`)); err != InvalidValueError {
+		t.Fatal("should not decode without name", err)
+	}
+
+	// types
+	v["name"] = "foo"
+	v["age"] = 1.5
+	if ds.Valid(v) {
+		t.Fatal("age should be an integer")
+	}
+	v["age"] = 1
+	v["unknown"] = true
+	if ds.Valid(v) {
+		t.Fatal("unknown fields should not be valid")
+	}
+	if decoded, err = ds.Decoder().Decode([]byte(`{"name": "foo", "age": 1, "score": 2, "avatar": "", "tags": [], "unknown": true}`)); err != nil {
+		t.Fatal("unknown fields should be dropped when decoding", err)
+	}
+	if _, ok := decoded.(map[string]interface{})["unknown"]; ok {
+		t.Fatal("unknown field should be dropped", decoded)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	f := Factory()
+	color := f.NewEnum("color", "RED", "GREEN")
+	ds := f.NewUnion(f.SimpleType(schema.Int64), f.SimpleType(schema.String), color)
+
+	for _, v := range []interface{}{int64(1), "foo", "RED"} {
+		b, err := ds.Encoder().Encode(v)
+		if err != nil {
+			t.Fatal("should encode", v, err)
+		}
+		decoded, err := ds.Decoder().Decode(b)
+		if err != nil || decoded != v {
+			t.Fatal("union values should be plain", v, decoded, err)
+		}
+	}
+	if ds.Valid(true) {
+		t.Fatal("bool is not a branch")
+	}
+	if color.Valid("BLUE") {
+		t.Fatal("BLUE is not a symbol")
+	}
+}
+
+func TestEncodeSchema(t *testing.T) {
+	f := Factory()
+	ds := f.NewRecord().SetName("created").
+		SetField("name", f.SimpleType(schema.String)).
+		SetField("email", f.NewOptional(f.SimpleType(schema.String))).
+		SetField("color", f.NewEnum("color", "RED", "GREEN")).
+		SetField("home", f.NewRecord().SetName("address").SetField("street", f.SimpleType(schema.String)).ToDataSchema()).
+		SetField("id", f.NewUnion(f.SimpleType(schema.Int64), f.SimpleType(schema.String))).
+		ToDataSchema()
+
+	b, err := ds.EncodeSchema()
+	if err != nil {
+		t.Fatal("should encode schema", err)
+	}
+	expected := `{"properties":{` +
+		`"color":{"enum":["RED","GREEN"],"title":"color","type":"string"},` +
+		`"email":{"type":"string"},` +
+		`"home":{"properties":{"street":{"type":"string"}},"required":["street"],"title":"address","type":"object"},` +
+		`"id":{"anyOf":[{"type":"integer"},{"type":"string"}]},` +
+		`"name":{"type":"string"}},` +
+		`"required":["color","home","id","name"],"title":"created","type":"object"}`
+	if string(b) != expected {
+		t.Fatal("wrong schema", string(b))
+	}
+
+	decoded, err := f.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode schema", err)
+	}
+	if out := decoded.Diff(ds); len(out) != 0 {
+		t.Fatal("schema should round trip", out)
+	}
+	if decoded.(*jsonSchema).fields["email"].Type() != schema.Optional {
+		t.Fatal("fields not required should be optional")
+	}
+}
+
+func TestFieldOptions(t *testing.T) {
+	f := Factory()
+	str := f.SimpleType(schema.String)
+	ds := f.NewRecord().SetName("created").
+		SetField("fullName", str).
+		SetFieldOptions("fullName", schema.FieldOptions{Doc: "the full name", Aliases: []string{"name"}}).
+		SetField("email", str).
+		SetFieldOptions("email", schema.FieldOptions{Optional: true}).
+		SetField("age", f.SimpleType(schema.Int64)).
+		SetFieldOptions("age", schema.FieldOptions{Default: 18}).
+		ToDataSchema()
+
+	b, err := ds.EncodeSchema()
+	if err != nil {
+		t.Fatal("should encode schema", err)
+	}
+	expected := `{"properties":{` +
+		`"age":{"default":18,"type":"integer"},` +
+		`"email":{"type":"string"},` +
+		`"fullName":{"aliases":["name"],"description":"the full name","type":"string"}},` +
+		`"required":["fullName"],"title":"created","type":"object"}`
+	if string(b) != expected {
+		t.Fatal("wrong schema", string(b))
+	}
+	decoded, err := f.Decoder().Decode(b)
+	if err != nil {
+		t.Fatal("should decode schema", err)
+	}
+	rec := decoded.(schema.RecordSchema)
+	if age, opts, _ := rec.Field("age"); age.Type() != schema.Int64 || opts.Default != int64(18) {
+		t.Fatal("age should have a default", age, opts)
+	}
+	if _, opts, _ := rec.Field("fullName"); opts.Doc != "the full name" || !opts.HasAlias("name") {
+		t.Fatal("wrong fullName options", opts)
+	}
+
+	v, err := decoded.Decoder().Decode([]byte(`{"fullName": "foo"}`))
+	if err != nil {
+		t.Fatal("should decode", err)
+	}
+	if m := v.(map[string]interface{}); m["age"] != int64(18) || m["email"] != nil {
+		t.Fatal("wrong defaults", m)
+	}
+	if out := decoded.Validate(map[string]interface{}{}); len(out) != 1 || out[0].Message != "missing required field fullName" {
+		t.Fatal("fullName is required", out)
+	}
+
+	if _, err = f.Decoder().Decode([]byte(`{"type": "object", "title": "created", "properties": {"age": {"type": "integer", "default": "ten"}}}`)); err == nil {
+		t.Fatal("the default of age should be an integer")
+	}
+}
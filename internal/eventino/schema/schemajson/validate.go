@@ -0,0 +1,83 @@
+package schemajson
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+// validate walks the whole value, returning the errors
+// of v for the schema, with their path below path
+func validate(path string, s *jsonSchema, v interface{}) []schema.ValidationError {
+	switch s.t {
+	case schema.Ref:
+		if s.target == nil {
+			return invalid(path, "unresolved type %s", s.id.ToString())
+		}
+		return validate(path, s.target.(*jsonSchema), v)
+	case schema.Record:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		return validateFields(path, s, m)
+	case schema.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		var out []schema.ValidationError
+		for i, item := range arr {
+			out = append(out, validate(schema.ItemPath(path, i), s.items.(*jsonSchema), item)...)
+		}
+		return out
+	case schema.Optional:
+		// the optional value errors are more useful than a mismatch
+		if v != nil {
+			return validate(path, s.types[1].(*jsonSchema), v)
+		}
+	case schema.Enum:
+		if str, ok := v.(string); ok && !schema.HasSymbol(s.symbols, str) {
+			return invalid(path, "unknown symbol %s of %s", str, describe(s))
+		}
+	}
+	if _, err := s.conform(v, false); err != nil {
+		return mismatch(path, s, v)
+	}
+	return nil
+}
+
+// validateFields reports the unknown fields, and the missing required ones
+func validateFields(path string, s *jsonSchema, m map[string]interface{}) []schema.ValidationError {
+	names := fieldNames(s)
+	for name := range m {
+		if _, ok := s.fields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var out []schema.ValidationError
+	for _, name := range names {
+		f, known := s.fields[name]
+		v, present := m[name]
+		switch {
+		case !known:
+			out = append(out, invalid(path, "unknown field %s", name)...)
+		case present:
+			out = append(out, validate(schema.FieldPath(path, name), f.(*jsonSchema), v)...)
+		case !s.hasDefault(name):
+			out = append(out, invalid(path, "missing required field %s", name)...)
+		}
+	}
+	return out
+}
+
+func mismatch(path string, s *jsonSchema, v interface{}) []schema.ValidationError {
+	return invalid(path, "expected %s, got %s", describe(deref(s)), schema.ValueType(v))
+}
+
+func invalid(path, format string, args ...interface{}) []schema.ValidationError {
+	return []schema.ValidationError{{Path: path, Message: fmt.Sprintf(format, args...)}}
+}
@@ -0,0 +1,48 @@
+package schemajson
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cheng81/eventino/internal/eventino/schema"
+)
+
+func TestValidate(t *testing.T) {
+	f := Factory()
+	str := f.SimpleType(schema.String)
+	ds := f.NewRecord().SetName("created").
+		SetField("Name", str).
+		SetField("Email", str).
+		SetField("address", f.NewRecord().SetName("address").
+			SetField("street", str).
+			SetField("zip", f.NewOptional(str)).
+			ToDataSchema()).
+		SetField("tags", f.NewArray(str)).
+		ToDataSchema()
+
+	v := map[string]interface{}{
+		"Name":    "foo",
+		"Email":   "foo@bar.baz",
+		"address": map[string]interface{}{"street": "main st"},
+		"tags":    []interface{}{"a"},
+	}
+	if out := ds.Validate(v); len(out) != 0 {
+		t.Fatal("value should be valid", out)
+	}
+
+	v = map[string]interface{}{
+		"Name":    1.5,
+		"address": map[string]interface{}{"zip": int64(1234)},
+		"tags":    []interface{}{"a", true},
+	}
+	expected := []schema.ValidationError{
+		{Path: "", Message: "missing required field Email"},
+		{Path: "Name", Message: "expected string, got float64"},
+		{Path: "address", Message: "missing required field street"},
+		{Path: "address.zip", Message: "expected string, got int64"},
+		{Path: "tags[1]", Message: "expected string, got bool"},
+	}
+	if out := ds.Validate(v); fmt.Sprint(out) != fmt.Sprint(expected) {
+		t.Fatal("wrong errors", out)
+	}
+}
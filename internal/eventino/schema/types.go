@@ -12,6 +12,24 @@ type Schema struct {
 	Records  map[EventSchemaID]DataSchema
 	Enums    map[EventSchemaID]DataSchema
 	Entities map[string]EntityType
+	// Deleted is the next version of the deleted named types: a type
+	// created again never reuses the versions, and so the references
+	// (e.g. address_0), of the deleted one
+	Deleted map[string]uint64
+}
+
+// ResolveType returns the named record or enum type with the given version
+func (s Schema) ResolveType(id EventSchemaID) (DataSchema, bool) {
+	if ds, ok := s.Records[id]; ok {
+		return ds, true
+	}
+	ds, ok := s.Enums[id]
+	return ds, ok
+}
+
+// TypeResolver resolves the named types referenced by data schemas
+type TypeResolver interface {
+	ResolveType(id EventSchemaID) (DataSchema, bool)
 }
 
 // TODO: consider renaming, since it is used
@@ -42,6 +60,28 @@ type EntityType struct {
 	Name   string
 	VSN    uint64
 	Events map[EventSchemaID]DataSchema
+	// Compatibility is the default of the event types,
+	// Compatibilities the one set per event type
+	Compatibility   Compatibility
+	Compatibilities map[string]Compatibility
+}
+
+// CompatibilityOf returns the compatibility of the event type
+func (typ EntityType) CompatibilityOf(evtName string) Compatibility {
+	if c, ok := typ.Compatibilities[evtName]; ok {
+		return c
+	}
+	return typ.Compatibility
+}
+
+// LatestEvent returns the latest version of the event type, false if not found
+func (typ EntityType) LatestEvent(evtName string) (id EventSchemaID, ok bool) {
+	for evtID := range typ.Events {
+		if evtID.Name == evtName && (!ok || evtID.VSN > id.VSN) {
+			id, ok = evtID, true
+		}
+	}
+	return
 }
 
 func (typ EntityType) EntityID(ID []byte) item.ItemID {
@@ -83,19 +123,64 @@ type SchemaFactory interface {
 	NewRecord() RecordSchemaBuilder
 	Decoder() SchemaDecoder
 	EncodeNetwork(s *Schema) []byte
-	// TODO suport other complex types
-	// NewEnum(items ...string) DataSchema
-	// NewOptional(DataSchema) DataSchema
+	NewEnum(name string, symbols ...string) DataSchema
+	NewOptional(DataSchema) DataSchema
 	NewArray(DataSchema) DataSchema
-	// NewUnion(types ...DataSchema) DataSchema
+	NewUnion(types ...DataSchema) DataSchema
+	// NewRef refers to a named type of the schema
+	NewRef(name string, vsn uint64) DataSchema
+	// NewDecimal is a decimal with at most precision
+	// digits, scale of which after the decimal point
+	NewDecimal(precision, scale int) DataSchema
 }
 
 type RecordSchemaBuilder interface {
 	SetName(string) RecordSchemaBuilder
 	SetField(string, DataSchema) RecordSchemaBuilder
+	// SetFieldOptions sets the options of a field, set with SetField
+	SetFieldOptions(string, FieldOptions) RecordSchemaBuilder
 	ToDataSchema() DataSchema
 }
 
+// FieldOptions are the optional settings of a record field
+type FieldOptions struct {
+	Doc string
+	// Default is the value of the field when it is missing, in the
+	// values put or in the data written before it was added.
+	// Nil is no default: optional fields default to null anyway
+	Default interface{}
+	// Optional fields may be missing or null, their type is made optional
+	Optional bool
+	// Aliases are the previous names of the field, to read
+	// the data written before it was renamed
+	Aliases []string
+}
+
+// IsZero is true if no option is set
+func (o FieldOptions) IsZero() bool {
+	return o.Doc == "" && o.Default == nil && !o.Optional && len(o.Aliases) == 0
+}
+
+// HasAlias is true if name is one of the aliases
+func (o FieldOptions) HasAlias(name string) bool {
+	for _, alias := range o.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordSchema is implemented by the data schemas of
+// type Record, to list their fields and their options
+type RecordSchema interface {
+	DataSchema
+	Name() string
+	// FieldNames returns the sorted names of the fields
+	FieldNames() []string
+	Field(name string) (DataSchema, FieldOptions, bool)
+}
+
 type DataDecoder interface {
 	Decode([]byte) (interface{}, error)
 }
@@ -113,11 +198,26 @@ type DataSchema interface {
 	Decoder() DataDecoder
 
 	Valid(interface{}) bool
+	// Validate walks the whole value, returning its errors
+	Validate(interface{}) []ValidationError
+	Type() DataType
+	// CanRead returns the resolution rules broken reading,
+	// with this schema, the data written with the writer one
+	CanRead(writer DataSchema) []Incompatibility
+	// Diff returns the field changes from the previous schema to this one
+	Diff(prev DataSchema) []FieldChange
+	// GoNative converts a decoded value to the Go native values of
+	// its logical types: time.Time for timestamps and dates, *big.Rat
+	// for decimals. Encoding accepts both
+	GoNative(interface{}) interface{}
 }
 
 type SchemaDecoder interface {
 	DecodeNative(interface{}) (DataSchema, error)
 	Decode([]byte) (DataSchema, error)
+	// WithTypes returns a decoder resolving the
+	// referenced named types with the given resolver
+	WithTypes(TypeResolver) SchemaDecoder
 }
 
 type DataType byte
@@ -138,6 +238,15 @@ const (
 	Array
 	Union
 	Record
+	Ref
+	Int32
+	Float32
+	// the logical types
+	TimestampMillis
+	TimestampMicros
+	Date
+	Decimal
+	UUID
 )
 
 func (dt DataType) IsSimple() bool {
@@ -153,6 +262,20 @@ func (dt DataType) IsSimple() bool {
 	case String:
 		fallthrough
 	case Bytes:
+		fallthrough
+	case Int32:
+		fallthrough
+	case Float32:
+		return true
+	}
+	return false
+}
+
+// IsLogical is true for the types stored as another
+// type, e.g. timestamps as longs, decimals as bytes
+func (dt DataType) IsLogical() bool {
+	switch dt {
+	case TimestampMillis, TimestampMicros, Date, Decimal, UUID:
 		return true
 	}
 	return false
@@ -16,10 +16,32 @@ var schemaID item.ItemID
 var EntityTypeNotFound error
 var EntityTypeExists error
 
+// EventTypeNotFound is returned when an event type does not exist
+var EventTypeNotFound error
+
+// TypeNotFound is returned when a named type (or a version of it) does not exist
+var TypeNotFound error
+
+// TypeExists is returned when creating a named type that already exists
+var TypeExists error
+
+// InvalidType is returned when a named type is not a record or an enum,
+// or when its update changes its kind
+var InvalidType error
+
 func init() {
 	schemaID = item.NewItemID(0, []byte("SCHEMA"))
 	EntityTypeNotFound = errors.New("entity type not found")
 	EntityTypeExists = errors.New("entity already exists")
+	EventTypeNotFound = errors.New("event type not found")
+	TypeNotFound = errors.New("type not found")
+	TypeExists = errors.New("type already exists")
+	InvalidType = errors.New("named types are records or enums, and cannot change kind")
+}
+
+// Partition returns the log partition of the schema events
+func Partition() uint8 {
+	return schemaID.Type
 }
 
 // func EntityIndexID(entityType string) item.ItemID {
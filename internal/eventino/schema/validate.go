@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ValidationError is a value not valid for its schema. Path is the
+// invalid value, e.g. address.zip or tags[3], empty for the whole value
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) String() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// InvalidPayloadError is returned when an event payload
+// is not valid for the schema of the event type
+type InvalidPayloadError struct {
+	Entity string
+	Event  EventSchemaID
+	Errors []ValidationError
+}
+
+func (e InvalidPayloadError) Error() string {
+	report := make([]string, len(e.Errors))
+	for i, v := range e.Errors {
+		report[i] = v.String()
+	}
+	return fmt.Sprintf("Wrong payload for event schema %s.%s: %s", e.Entity, e.Event.ToString(), strings.Join(report, "; "))
+}
+
+// FieldPath is the path of a record field, e.g. address.zip
+func FieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// ItemPath is the path of an array item, e.g. tags[3]
+func ItemPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// ValueType describes the type of a value in the
+// validation errors, e.g. null, int64, map or array
+func ValueType(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Map:
+		return "map"
+	case reflect.Slice:
+		if _, ok := v.([]byte); ok {
+			return "bytes"
+		}
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
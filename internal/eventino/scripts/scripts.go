@@ -0,0 +1,118 @@
+package scripts
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strconv"
+
+	"github.com/cheng81/eventino/internal/eventino"
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/dgraph-io/badger"
+)
+
+const scriptRegistered string = "SCRIPT:REGISTERED"
+
+// KindView is the Kind of the persistent view scripts
+const KindView string = "view"
+
+// KindUpcaster is the Kind of the upcaster scripts,
+// named after their event type, from version VSN
+const KindUpcaster string = "upcaster"
+
+// ScriptNotFound is returned when the script is not registered
+var ScriptNotFound error
+
+func init() {
+	ScriptNotFound = errors.New("Script not found")
+}
+
+// Script is a javascript registered on an entity type, stored
+// so that it can be compiled and registered back on start
+type Script struct {
+	Kind       string
+	EntityType string
+	Name       string
+	// VSN is the source event version of the upcasters
+	VSN    uint64
+	Source string
+}
+
+func (s Script) itemID() item.ItemID {
+	ID := s.Kind + "\x00" + s.EntityType + "\x00" + s.Name
+	if s.Kind == KindUpcaster {
+		ID += "\x00" + strconv.FormatUint(s.VSN, 10)
+	}
+	return item.NewItemID(eventino.ItemTypeScript, []byte(ID))
+}
+
+// Put stores the script, replacing the one
+// with the same kind, entity type and name
+func Put(txn *badger.Txn, s Script) (err error) {
+	ID := s.itemID()
+	if err = item.Create(txn, ID); err != nil && err != item.ItemExistsError {
+		return
+	}
+	var b []byte
+	if b, err = encode(s); err != nil {
+		return
+	}
+	_, err = item.Put(txn, ID, item.NewEvent(eventino.EventKindScript, []byte(scriptRegistered), b))
+	return
+}
+
+// get returns the latest registration of the item, or ScriptNotFound
+func get(txn *badger.Txn, ID item.ItemID) (out Script, err error) {
+	var itm item.Item
+	if itm, err = item.Get(txn, ID, 0, 0); err != nil {
+		if err == item.ItemNotFoundError {
+			err = ScriptNotFound
+		}
+		return
+	}
+	found := false
+	for _, evt := range itm.Events {
+		if evt.Kind == eventino.EventKindScript && string(evt.Type) == scriptRegistered {
+			if err = decode(evt.Payload, &out); err != nil {
+				return
+			}
+			found = true
+		}
+	}
+	if !found {
+		err = ScriptNotFound
+	}
+	return
+}
+
+// List returns the scripts registered, sorted by kind, entity type and name
+func List(txn *badger.Txn) (out []Script, err error) {
+	var IDs []item.ItemID
+	if IDs, err = item.List(txn, eventino.ItemTypeScript, nil); err != nil {
+		return
+	}
+	out = make([]Script, 0, len(IDs))
+	for _, ID := range IDs {
+		var s Script
+		if s, err = get(txn, ID); err != nil {
+			return
+		}
+		out = append(out, s)
+	}
+	return
+}
+
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(b []byte, v interface{}) error {
+	buf := bytes.NewBuffer(b)
+	dec := gob.NewDecoder(buf)
+	return dec.Decode(v)
+}
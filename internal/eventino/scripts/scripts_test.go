@@ -0,0 +1,88 @@
+package scripts
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+func withTempDB(fn func(*badger.DB) error) error {
+	dbDir := fmt.Sprintf("/tmp/badger-%d", time.Now().UnixNano())
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	db, err := badger.Open(opts)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	defer os.RemoveAll(dbDir)
+	defer db.Close()
+	return fn(db)
+}
+
+func TestScripts(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			if err = Put(txn, Script{Kind: KindView, EntityType: "User", Name: "tags", Source: "({})"}); err != nil {
+				return
+			}
+			if err = Put(txn, Script{Kind: KindView, EntityType: "User", Name: "names", Source: "({})"}); err != nil {
+				return
+			}
+			// replaces the first one
+			return Put(txn, Script{Kind: KindView, EntityType: "User", Name: "tags", Source: "({Tags_0: null})"})
+		})
+		if err != nil {
+			t.Fatal("cannot put", err)
+		}
+		err = db.View(func(txn *badger.Txn) (err error) {
+			var stored []Script
+			if stored, err = List(txn); err != nil {
+				return
+			}
+			if len(stored) != 2 || stored[0].Name != "names" || stored[1].Name != "tags" {
+				t.Fatal("wrong scripts", stored)
+			}
+			if stored[1].Source != "({Tags_0: null})" || stored[1].EntityType != "User" || stored[1].Kind != KindView {
+				t.Fatal("the latest registration should be kept", stored[1])
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot list", err)
+		}
+		return nil
+	})
+}
+
+func TestUpcasterScripts(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		err = db.Update(func(txn *badger.Txn) (err error) {
+			if err = Put(txn, Script{Kind: KindUpcaster, EntityType: "User", Name: "Created", VSN: 0, Source: "(function(p) { return p; })"}); err != nil {
+				return
+			}
+			return Put(txn, Script{Kind: KindUpcaster, EntityType: "User", Name: "Created", VSN: 1, Source: "(function(p) { return p; })"})
+		})
+		if err != nil {
+			t.Fatal("cannot put", err)
+		}
+		err = db.View(func(txn *badger.Txn) (err error) {
+			var stored []Script
+			if stored, err = List(txn); err != nil {
+				return
+			}
+			if len(stored) != 2 || stored[0].VSN != 0 || stored[1].VSN != 1 {
+				t.Fatal("the upcasters of each version should be kept", stored)
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot list", err)
+		}
+		return nil
+	})
+}
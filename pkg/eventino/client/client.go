@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/internal/eventino/schema"
 
 	"github.com/linkedin/goavro"
 
@@ -21,10 +25,22 @@ import (
 type Client interface {
 	AvroSchema() string
 	Eventino() eventino.Eventino
+	// Negotiate states the schema version the client handles, by version
+	// or, if not zero, by the fingerprint of its exported schema (see
+	// ExportSchema): the server sends the events of that version only
+	Negotiate(vsn, fingerprint uint64) (Negotiated, error)
 	Start(addr string, port int) error
 	Stop() error
 }
 
+// Negotiated is the schema version of the session, with the
+// fingerprint of its exported schema, and the latest server version
+type Negotiated struct {
+	VSN         uint64
+	LatestVSN   uint64
+	Fingerprint uint64
+}
+
 func NewClient() Client {
 	return &client{codec: common.NetCodec}
 }
@@ -34,7 +50,16 @@ type client struct {
 	addr string
 	conn net.Conn
 
+	// codec is switched by the reader on loadSchema and negotiate replies
 	codec *goavro.Codec
+
+	// mu serializes the commands
+	mu      sync.Mutex
+	replies chan map[string]interface{}
+	readErr error
+
+	subsMu sync.Mutex
+	subs   map[int64]*subscription
 }
 
 func (c *client) AvroSchema() string {
@@ -48,7 +73,12 @@ func (c *client) Eventino() eventino.Eventino {
 func (c *client) Start(addr string, port int) (err error) {
 	c.addr = addr
 	c.port = port
-	c.conn, err = net.Dial("tcp", fmt.Sprintf("%s:%d", c.addr, c.port))
+	if c.conn, err = net.Dial("tcp", net.JoinHostPort(c.addr, strconv.Itoa(c.port))); err != nil {
+		return
+	}
+	c.replies = make(chan map[string]interface{})
+	c.subs = map[int64]*subscription{}
+	go c.read()
 	return
 }
 
@@ -58,6 +88,8 @@ func (c *client) Stop() error {
 
 func (c *client) exec(cmd interface{}) (map[string]interface{}, error) {
 	fmt.Println("exec.called", cmd)
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	var b []byte
 	var err error
 	if b, err = c.codec.BinaryFromNative(nil, cmd); err != nil {
@@ -68,21 +100,99 @@ func (c *client) exec(cmd interface{}) (map[string]interface{}, error) {
 		fmt.Println("exec.write req failed", err)
 		return nil, err
 	}
+	rsp, ok := <-c.replies
+	if !ok {
+		fmt.Println("exec.read reply failed", c.readErr)
+		return nil, c.readErr
+	}
+	return rsp, nil
+}
+
+// read decodes the messages from the server, delivering
+// the replies to exec and the events to the subscriptions
+func (c *client) read() {
+	buf := common.NewCircbuf(256*1024, c.onData)
+	_, err := io.Copy(buf, c.conn)
+	if err == nil {
+		err = io.EOF
+	} else {
+		// nothing can be read after a malformed message
+		c.conn.Close()
+	}
+	c.readErr = err
+	close(c.replies)
+
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	for id, sub := range c.subs {
+		sub.end(SubscriptionClosedError)
+		delete(c.subs, id)
+	}
+}
+
+func (c *client) onData(buf *common.Circbuf) error {
+	b, err := buf.ReadAll()
+	if err != nil {
+		return err
+	}
 	var out interface{}
-	// fmt.Println("exec.read reply")
-	b = make([]byte, 256*1024)
-	var wrote int
-	if wrote, err = c.conn.Read(b); err != nil {
-		fmt.Println("exec.read reply failed", err)
-		return nil, err
+	var rest []byte
+	if out, rest, err = c.codec.NativeFromBinary(b); err != nil {
+		if common.Incomplete(err) {
+			// wait for the rest of the message
+			return nil
+		}
+		return fmt.Errorf("malformed message: %s", err)
 	}
-	if out, _, err = c.codec.NativeFromBinary(b[0:wrote]); err != nil {
-		fmt.Println("circuf.callback - err decode", err)
-		return nil, err
+	buf.Consume(len(b) - len(rest))
+	m := out.(map[string]interface{})
+
+	if command.IsData(m) {
+		if evt, ok := m["data"].(map[string]interface{})["entity_event"].(map[string]interface{}); ok {
+			c.dispatch(evt)
+			return nil
+		}
+	}
+	if rsp := (&command.SubscriptionEnded{}); rsp.Is(m) {
+		rsp.Decode(m)
+		c.ended(rsp.Subscription, errors.New(rsp.Error))
+		return nil
+	}
+	if rsp := (&command.LoadSchemaReply{}); rsp.Is(m) {
+		// switch codec before reading the next message
+		rsp.Decode(m)
+		if err = c.switchCodec(rsp.Encoded); err != nil {
+			m = command.NewErrorMessage(err).Encode()
+		}
 	}
+	if rsp := (&command.Subscribed{}); rsp.Is(m) {
+		// register before reading the subscription events
+		rsp.Decode(m)
+		c.subsMu.Lock()
+		c.subs[rsp.Subscription] = newSubscription(c, rsp.Subscription)
+		c.subsMu.Unlock()
+	}
+	if rsp := (&command.NegotiateReply{}); rsp.Is(m) {
+		rsp.Decode(m)
+		if err = c.switchCodec(rsp.Encoded); err != nil {
+			m = command.NewErrorMessage(err).Encode()
+		}
+	}
+	c.replies <- m
+	return nil
+}
 
-	// fmt.Println("exec, io ended", out, err)
-	return out.(map[string]interface{}), nil
+func (c *client) switchCodec(encoded []byte) error {
+	var dataSchema map[string]interface{}
+	if err := json.Unmarshal(encoded, &dataSchema); err != nil {
+		return err
+	}
+	cdc, err := common.NetCodecWithSchema(dataSchema)
+	if err != nil {
+		return err
+	}
+	c.codec = cdc
+	return nil
 }
 
 func (c *client) CreateEntityType(name string) (uint64, error) {
@@ -121,6 +231,129 @@ func (c *client) CreateEventType(entName, name string, specs interface{}) (uint6
 	return 0, decodeError(rsp)
 }
 
+func (c *client) UpdateEventType(entName, name string, specs interface{}) (uint64, uint64, error) {
+	cmd := (&command.UpdateEntityEventType{
+		EntityType: entName,
+		EventName:  name,
+		MetaSchema: specs.(map[string]interface{}),
+	}).Encode()
+	rsp, err := c.exec(cmd)
+	if err != nil {
+		return 0, 0, err
+	}
+	rsp1 := &command.UpdateEventTypeReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		return rsp1.SchemaVSN, rsp1.VSN, nil
+	}
+	return 0, 0, decodeError(rsp)
+}
+
+func (c *client) SetCompatibility(entName, evtName string, compat eventino.Compatibility) (uint64, error) {
+	return c.execSchema((&command.SetCompatibility{
+		EntityType:    entName,
+		EventName:     evtName,
+		Compatibility: compat.String(),
+	}).Encode())
+}
+
+func (c *client) CreateType(name string, specs interface{}) (uint64, error) {
+	cmd := (&command.CreateType{
+		Name:       name,
+		MetaSchema: specs.(map[string]interface{}),
+	}).Encode()
+	return c.execSchema(cmd)
+}
+
+func (c *client) UpdateType(name string, specs interface{}) (uint64, uint64, error) {
+	cmd := (&command.UpdateType{
+		Name:       name,
+		MetaSchema: specs.(map[string]interface{}),
+	}).Encode()
+	rsp, err := c.exec(cmd)
+	if err != nil {
+		return 0, 0, err
+	}
+	rsp1 := &command.UpdateTypeReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		return rsp1.SchemaVSN, rsp1.VSN, nil
+	}
+	return 0, 0, decodeError(rsp)
+}
+
+func (c *client) DeleteType(name string) (uint64, error) {
+	return c.execSchema((&command.DeleteType{Name: name}).Encode())
+}
+
+func (c *client) ApplySchema(spec []byte, dryRun bool) (uint64, []string, error) {
+	rsp, err := c.exec((&command.ApplySchema{Spec: spec, DryRun: dryRun}).Encode())
+	if err != nil {
+		return 0, nil, err
+	}
+	rsp1 := &command.ApplySchemaReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		return rsp1.SchemaVSN, rsp1.Plan, nil
+	}
+	return 0, nil, decodeError(rsp)
+}
+
+func (c *client) SchemaHistory(fromVsn, toVsn uint64) (out []eventino.SchemaChange, err error) {
+	err = c.execSchemaHistory(&command.SchemaHistory{From: fromVsn, To: toVsn}, &out)
+	return
+}
+
+func (c *client) DiffSchema(fromVsn, toVsn uint64) (out eventino.SchemaDiff, err error) {
+	err = c.execSchemaHistory(&command.SchemaHistory{From: fromVsn, To: toVsn, Diff: true}, &out)
+	return
+}
+
+func (c *client) ExportSchema(vsn uint64) (uint64, []eventino.SchemaFile, error) {
+	rsp, err := c.exec((&command.ExportSchema{VSN: vsn}).Encode())
+	if err != nil {
+		return 0, nil, err
+	}
+	rsp1 := &command.ExportSchemaReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		files := make([]eventino.SchemaFile, len(rsp1.Files))
+		for i, f := range rsp1.Files {
+			files[i] = eventino.SchemaFile{Name: f.Name, Schema: f.Schema, Fingerprint: f.Fingerprint}
+		}
+		return rsp1.SchemaVSN, files, nil
+	}
+	return 0, nil, decodeError(rsp)
+}
+
+// execSchemaHistory decodes the JSON reply of a schema history command into out
+func (c *client) execSchemaHistory(cmd *command.SchemaHistory, out interface{}) error {
+	rsp, err := c.exec(cmd.Encode())
+	if err != nil {
+		return err
+	}
+	rsp1 := &command.SchemaHistoryReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		return json.Unmarshal(rsp1.Data, out)
+	}
+	return decodeError(rsp)
+}
+
+// execSchema executes a schema command, replied with a SchemaResponse
+func (c *client) execSchema(cmd map[string]interface{}) (uint64, error) {
+	rsp, err := c.exec(cmd)
+	if err != nil {
+		return 0, err
+	}
+	rsp1 := &command.SchemaResponse{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		return rsp1.VSN, nil
+	}
+	return 0, decodeError(rsp)
+}
+
 func (c *client) LoadSchema(vsn uint64) (uint64, []byte, error) {
 	cmd := (&command.LoadSchema{VSN: vsn}).Encode()
 	rsp, err := c.exec(cmd)
@@ -130,40 +363,49 @@ func (c *client) LoadSchema(vsn uint64) (uint64, []byte, error) {
 	}
 	rsp1 := &command.LoadSchemaReply{}
 	if rsp1.Is(rsp) {
+		// the codec is already switched by the reader
 		rsp1.Decode(rsp)
-		var dataSchema map[string]interface{}
-		err = json.Unmarshal(rsp1.Encoded, &dataSchema)
-		if err != nil {
-			return 0, nil, err
-		}
-		c.codec, err = common.NetCodecWithSchema(dataSchema)
-		if err != nil {
-			return 0, nil, err
-		}
 		return rsp1.VSN, rsp1.Encoded, nil
 	}
 	return 0, nil, decodeError(rsp)
 }
 
-func (c *client) NewEntity(entName string, ID []byte) error {
+func (c *client) Negotiate(vsn, fingerprint uint64) (Negotiated, error) {
+	rsp, err := c.exec((&command.Negotiate{VSN: vsn, Fingerprint: fingerprint}).Encode())
+	if err != nil {
+		return Negotiated{}, err
+	}
+	rsp1 := &command.NegotiateReply{}
+	if rsp1.Is(rsp) {
+		// the codec is already switched by the reader
+		rsp1.Decode(rsp)
+		return Negotiated{VSN: rsp1.VSN, LatestVSN: rsp1.LatestVSN, Fingerprint: rsp1.Fingerprint}, nil
+	}
+	return Negotiated{}, decodeError(rsp)
+}
+
+func (c *client) NewEntity(entName string, ID []byte) (eventino.EventID, error) {
 	cmd := (&command.CreateEntity{Type: entName, ID: ID}).Encode()
 	rsp, err := c.exec(cmd)
 	if err != nil {
-		return err
+		return eventino.EventID{}, err
 	}
-	if _, ok := rsp["boolean"]; ok {
+	rsp1 := &command.CreateEntityReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
 		fmt.Println("Entity created.")
-		return nil
+		return eventino.DecodeOffset(rsp1.Position)
 	}
-	return decodeError(rsp)
+	return eventino.EventID{}, decodeError(rsp)
 }
 
-func (c *client) Put(entName string, entID []byte, evtIDenc string, evt interface{}) (uint64, error) {
+func (c *client) Put(entName string, entID []byte, expected eventino.ExpectedVSN, evtIDenc string, evt interface{}) (uint64, eventino.EventID, error) {
 	cmd := map[string]interface{}{
 		"data": map[string]interface{}{
 			"entity_event": map[string]interface{}{
 				entName: map[string]interface{}{
-					"id": entID,
+					"id":           entID,
+					"expected_vsn": int64(expected),
 					"event": map[string]interface{}{
 						evtIDenc: map[string]interface{}{
 							"data": evt,
@@ -171,28 +413,83 @@ func (c *client) Put(entName string, entID []byte, evtIDenc string, evt interfac
 					},
 				},
 			},
+			"entity_events": nil,
+			"entity_load":   nil,
 		},
 	}
 	b, _ := json.Marshal(cmd)
 	fmt.Println("data command: ", string(b))
 	rsp, err := c.exec(cmd)
 	if err != nil {
-		return 0, err
+		return 0, eventino.EventID{}, err
 	}
-	if vsn, ok := rsp["long"]; ok {
+	rsp1 := &command.PutReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
 		fmt.Println("Event saved.")
-		return uint64(vsn.(int64)), nil
+		pos, err := eventino.DecodeOffset(rsp1.Position)
+		return rsp1.VSN, pos, err
 	}
-	return 0, decodeError(rsp)
+	return 0, eventino.EventID{}, decodeEntityError(entName, entID, rsp)
 }
 
-func (c *client) GetEntity(entName string, entID []byte, vsn uint64) (entity.Entity, error) {
-	cmd := (&command.LoadEntity{Type: entName, ID: entID, VSN: vsn}).Encode()
+func (c *client) PutMany(entName string, entID []byte, expected eventino.ExpectedVSN, evts []entity.EntityEvent) ([]uint64, eventino.EventID, error) {
+	evtsNative := make([]interface{}, len(evts))
+	for i, evt := range evts {
+		evtsNative[i] = map[string]interface{}{
+			evt.Type.ToString(): map[string]interface{}{
+				"data": evt.Payload,
+			},
+		}
+	}
+	cmd := map[string]interface{}{
+		"data": map[string]interface{}{
+			"entity_event": nil,
+			"entity_events": map[string]interface{}{
+				entName: map[string]interface{}{
+					"id":           entID,
+					"expected_vsn": int64(expected),
+					"events":       evtsNative,
+				},
+			},
+			"entity_load": nil,
+		},
+	}
+	rsp, err := c.exec(cmd)
+	if err != nil {
+		return nil, eventino.EventID{}, err
+	}
+	rsp1 := &command.PutManyReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		fmt.Println("Events saved.")
+		pos, err := eventino.DecodeOffset(rsp1.Position)
+		return rsp1.VSNs, pos, err
+	}
+	return nil, eventino.EventID{}, decodeEntityError(entName, entID, rsp)
+}
+
+func (c *client) GetEntity(entName string, entID []byte, vsn uint64, minPos eventino.EventID) (entity.Entity, error) {
+	return c.GetEntityAt(entName, entID, vsn, minPos, eventino.Versions{})
+}
+
+func (c *client) GetEntityAt(entName string, entID []byte, vsn uint64, minPos eventino.EventID, versions eventino.Versions) (entity.Entity, error) {
+	cmd := (&command.LoadEntity{
+		Type:     entName,
+		ID:       entID,
+		VSN:      vsn,
+		MinPos:   eventino.EncodeOffset(minPos),
+		Latest:   versions.Latest,
+		Versions: versions.ByEvent,
+	}).Encode()
 	rsp, err := c.exec(cmd)
 	out := entity.Entity{}
 	if err != nil {
 		return out, err
 	}
+	if !command.IsData(rsp) {
+		return out, decodeEntityError(entName, entID, rsp)
+	}
 	var ent map[string]interface{}
 	for _, v := range rsp["data"].(map[string]interface{})["entity_load"].(map[string]interface{}) {
 		ent = v.(map[string]interface{})
@@ -230,6 +527,60 @@ func (c *client) GetEntity(entName string, entID []byte, vsn uint64) (entity.Ent
 
 }
 
+// RegisterUpcaster fails: only javascript upcasters can be registered remotely
+func (c *client) RegisterUpcaster(entName, evtName string, vsn uint64, up eventino.Upcaster) error {
+	return errors.New("Go upcasters cannot be registered remotely, use RegisterScriptUpcaster")
+}
+
+func (c *client) RegisterScriptUpcaster(entName, evtName string, vsn uint64, src string) error {
+	cmd := (&command.RegisterUpcaster{Type: entName, Event: evtName, VSN: vsn, Script: src}).Encode()
+	rsp, err := c.exec(cmd)
+	if err != nil {
+		return err
+	}
+	if _, ok := rsp["boolean"]; ok {
+		return nil
+	}
+	return decodeError(rsp)
+}
+
+// RegisterView fails: only javascript views can be registered remotely
+func (c *client) RegisterView(entName, viewName string, view entity.PersistentViewFold, initial interface{}) error {
+	return errors.New("Go views cannot be registered remotely, use RegisterScriptView")
+}
+
+func (c *client) RegisterScriptView(entName, viewName, src string) error {
+	cmd := (&command.RegisterView{Type: entName, Name: viewName, Script: src}).Encode()
+	rsp, err := c.exec(cmd)
+	if err != nil {
+		return err
+	}
+	if _, ok := rsp["boolean"]; ok {
+		fmt.Println("View registered.")
+		return nil
+	}
+	return decodeError(rsp)
+}
+
+// GetView returns the view state decoded from JSON
+func (c *client) GetView(entName string, entID []byte, viewName string, minPos eventino.EventID) (uint64, interface{}, error) {
+	cmd := (&command.LoadView{Type: entName, ID: entID, Name: viewName, MinPos: eventino.EncodeOffset(minPos)}).Encode()
+	rsp, err := c.exec(cmd)
+	if err != nil {
+		return 0, nil, err
+	}
+	rsp1 := &command.LoadViewReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		var state interface{}
+		if err = json.Unmarshal(rsp1.State, &state); err != nil {
+			return 0, nil, err
+		}
+		return rsp1.VSN, state, nil
+	}
+	return 0, nil, decodeError(rsp)
+}
+
 func (c *client) SchemaVSN() (uint64, error) {
 	cmd := map[string]interface{}{"string": "schema_vsn"}
 	rsp, err := c.exec(cmd)
@@ -242,9 +593,39 @@ func (c *client) SchemaVSN() (uint64, error) {
 	return 0, decodeError(rsp)
 }
 
+// decodeEntityError decodes an error on a write to an entity,
+// rebuilding the VersionConflictError if the entity was not
+// at the expected version
+func decodeEntityError(entName string, entID []byte, m map[string]interface{}) error {
+	conflict := &command.VersionConflictResponse{}
+	if conflict.Is(m) {
+		conflict.Decode(m)
+		return eventino.VersionConflictError{
+			ID:       schema.EntityType{Name: entName}.EntityID(entID),
+			Expected: eventino.ExpectedVSN(conflict.Expected),
+			Actual:   eventino.ExpectedVSN(conflict.Actual),
+		}
+	}
+	return decodeError(m)
+}
+
+// ResponseError is an error returned by the server, with the
+// validation errors if the payload of an event was not valid
+type ResponseError struct {
+	Message string
+	Errors  []command.ValidationError
+}
+
+func (e ResponseError) Error() string {
+	return e.Message
+}
+
 func decodeError(m map[string]interface{}) error {
 	errorMsg := &command.ErrorResponse{}
 	errorMsg.Decode(m)
 	fmt.Println(">> ERROR >>", errorMsg.Message)
+	if len(errorMsg.Errors) > 0 {
+		return ResponseError{Message: errorMsg.Message, Errors: errorMsg.Errors}
+	}
 	return errors.New(errorMsg.Message)
 }
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cheng81/eventino/pkg/eventino"
+	"github.com/cheng81/eventino/pkg/eventino/common/command"
+)
+
+func (c *client) CreateConsumer(name, entName string, filter eventino.SubscriptionFilter) error {
+	cmd := &command.CreateConsumer{
+		Name:      name,
+		Type:      entName,
+		EventName: filter.EventName,
+		MatchVSN:  filter.MatchVSN,
+		EventVSN:  filter.EventVSN,
+		Predicate: filter.Predicate,
+	}
+	cmd.Since, cmd.Until = eventino.EncodeFilterTimes(filter)
+	rsp, err := c.exec(cmd.Encode())
+	if err != nil {
+		return err
+	}
+	if _, ok := rsp["boolean"]; ok {
+		fmt.Println("Consumer created.")
+		return nil
+	}
+	return decodeError(rsp)
+}
+
+func (c *client) ListConsumers() ([]eventino.Consumer, error) {
+	rsp, err := c.exec(map[string]interface{}{"string": "list_consumers"})
+	if err != nil {
+		return nil, err
+	}
+	rsp1 := &command.ListConsumersReply{}
+	if !rsp1.Is(rsp) {
+		return nil, decodeError(rsp)
+	}
+	rsp1.Decode(rsp)
+	out := make([]eventino.Consumer, len(rsp1.Consumers))
+	for i, info := range rsp1.Consumers {
+		out[i] = eventino.Consumer{
+			Name:       info.Name,
+			EntityType: info.Type,
+			Filter: eventino.SubscriptionFilter{
+				EventName: info.EventName,
+				MatchVSN:  info.MatchVSN,
+				EventVSN:  info.EventVSN,
+				Predicate: info.Predicate,
+			},
+		}
+		if info.Since != 0 {
+			out[i].Filter.Since = time.Unix(0, info.Since)
+		}
+		if info.Until != 0 {
+			out[i].Filter.Until = time.Unix(0, info.Until)
+		}
+		if out[i].Offset, err = eventino.DecodeOffset(info.Offset); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (c *client) ResetConsumer(name string, offset eventino.EventID) error {
+	rsp, err := c.exec((&command.ResetConsumer{Name: name, Offset: eventino.EncodeOffset(offset)}).Encode())
+	if err != nil {
+		return err
+	}
+	if _, ok := rsp["boolean"]; ok {
+		return nil
+	}
+	return decodeError(rsp)
+}
+
+func (c *client) DeleteConsumer(name string) error {
+	rsp, err := c.exec((&command.DeleteConsumer{Name: name}).Encode())
+	if err != nil {
+		return err
+	}
+	if _, ok := rsp["boolean"]; ok {
+		return nil
+	}
+	return decodeError(rsp)
+}
+
+// Consume subscribes to the events of the consumer, Ack and Commit
+// are sent to the server
+func (c *client) Consume(name string) (eventino.ConsumerSubscription, error) {
+	sub, err := c.subscribe((&command.Consume{Name: name}).Encode())
+	if err != nil {
+		return nil, err
+	}
+	return consumerSubscription{sub.(*subscription)}, nil
+}
+
+type consumerSubscription struct {
+	*subscription
+}
+
+func (s consumerSubscription) Ack(position eventino.EventID) error {
+	rsp, err := s.c.exec((&command.Ack{Subscription: s.id, Position: eventino.EncodeOffset(position)}).Encode())
+	if err != nil {
+		return err
+	}
+	if _, ok := rsp["boolean"]; ok {
+		return nil
+	}
+	return decodeError(rsp)
+}
+
+func (s consumerSubscription) Commit() (eventino.EventID, error) {
+	rsp, err := s.c.exec((&command.Commit{Subscription: s.id}).Encode())
+	if err != nil {
+		return eventino.EventID{}, err
+	}
+	rsp1 := &command.CommitReply{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		return eventino.DecodeOffset(rsp1.Offset)
+	}
+	return eventino.EventID{}, decodeError(rsp)
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/pkg/eventino"
+	"github.com/cheng81/eventino/pkg/eventino/common/command"
+)
+
+func (c *client) SubscribeEntity(entName string, entID []byte, fromVsn uint64) (eventino.Subscription, error) {
+	return c.subscribe((&command.SubscribeEntity{Type: entName, ID: entID, VSN: fromVsn}).Encode())
+}
+
+// SubscribeType subscribes to the events of an entity type, after the
+// given position: use the Position of the last event received to resume
+// a subscription, or the zero EventID to read the whole log
+func (c *client) SubscribeType(entName string, filter eventino.SubscriptionFilter, after eventino.EventID) (eventino.Subscription, error) {
+	cmd := &command.SubscribeType{
+		Type:      entName,
+		EventName: filter.EventName,
+		MatchVSN:  filter.MatchVSN,
+		EventVSN:  filter.EventVSN,
+		Predicate: filter.Predicate,
+		After:     eventino.EncodeOffset(after),
+	}
+	cmd.Since, cmd.Until = eventino.EncodeFilterTimes(filter)
+	return c.subscribe(cmd.Encode())
+}
+
+func (c *client) subscribe(cmd map[string]interface{}) (eventino.Subscription, error) {
+	rsp, err := c.exec(cmd)
+	if err != nil {
+		return nil, err
+	}
+	rsp1 := &command.Subscribed{}
+	if rsp1.Is(rsp) {
+		rsp1.Decode(rsp)
+		c.subsMu.Lock()
+		defer c.subsMu.Unlock()
+		if sub, ok := c.subs[rsp1.Subscription]; ok {
+			return sub, nil
+		}
+		// the connection dropped right after the reply
+		return nil, c.readErr
+	}
+	return nil, decodeError(rsp)
+}
+
+// dispatch delivers an event pushed by the server to its subscription
+func (c *client) dispatch(evt map[string]interface{}) {
+	for entName, v := range evt {
+		ent := v.(map[string]interface{})
+		c.subsMu.Lock()
+		sub, ok := c.subs[ent["subscription"].(int64)]
+		c.subsMu.Unlock()
+		if !ok {
+			// already unsubscribed
+			return
+		}
+		var entEvt entity.EntityEvent
+		for k, vv := range ent["event"].(map[string]interface{}) {
+			entEvt = entity.EntityEvent{
+				Type:      entity.EventNameIDFromString(k),
+				Timestamp: time.Unix(0, ent["ts"].(int64)),
+				Payload:   vv.(map[string]interface{})["data"],
+			}
+			break
+		}
+		position, err := eventino.DecodeOffset(ent["position"].([]byte))
+		if err != nil {
+			fmt.Println("dispatch.cannot decode position", err)
+		}
+		sub.deliver(entity.SubscriptionEvent{
+			EntityType: entName,
+			ID:         ent["id"].([]byte),
+			VSN:        uint64(ent["vsn"].(int64)),
+			Event:      entEvt,
+			Position:   position,
+		})
+		return
+	}
+}
+
+// ended closes a subscription ended by the server, Err returns why
+func (c *client) ended(id int64, err error) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if sub, ok := c.subs[id]; ok {
+		sub.end(err)
+		delete(c.subs, id)
+	}
+}
+
+// subscription queues the events read from the connection, so that
+// a slow consumer never blocks the replies to the other commands
+type subscription struct {
+	c  *client
+	id int64
+
+	in   chan entity.SubscriptionEvent
+	out  chan entity.SubscriptionEvent
+	done chan struct{}
+	once sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+func newSubscription(c *client, id int64) *subscription {
+	s := &subscription{
+		c:    c,
+		id:   id,
+		in:   make(chan entity.SubscriptionEvent),
+		out:  make(chan entity.SubscriptionEvent),
+		done: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *subscription) Events() <-chan entity.SubscriptionEvent {
+	return s.out
+}
+
+func (s *subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close unsubscribes, the events not yet consumed are dropped
+func (s *subscription) Close() (err error) {
+	closed := false
+	s.once.Do(func() {
+		close(s.done)
+		closed = true
+	})
+	if !closed {
+		return nil
+	}
+	s.c.subsMu.Lock()
+	_, ok := s.c.subs[s.id]
+	s.c.subsMu.Unlock()
+	if !ok {
+		// the connection dropped
+		return nil
+	}
+	rsp, err := s.c.exec((&command.Unsubscribe{Subscription: s.id}).Encode())
+	s.c.subsMu.Lock()
+	delete(s.c.subs, s.id)
+	s.c.subsMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if _, ok := rsp["boolean"]; !ok {
+		return decodeError(rsp)
+	}
+	return nil
+}
+
+// SubscriptionClosedError is returned by Err when the
+// connection to the server drops
+var SubscriptionClosedError error
+
+// SubscriptionOverflowError is returned by Err when more than
+// maxQueued events are not consumed: the subscription is closed,
+// and can be resumed from the Position of the last event consumed
+var SubscriptionOverflowError error
+
+func init() {
+	SubscriptionClosedError = errors.New("Subscription closed, connection dropped")
+	SubscriptionOverflowError = errors.New("Subscription closed, too many events not consumed")
+}
+
+// maxQueued bounds the events read from the connection
+// and not yet consumed, per subscription
+const maxQueued = 4096
+
+// end is called by the reader when the connection drops,
+// or when the server ends the subscription
+func (s *subscription) end(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	close(s.in)
+}
+
+func (s *subscription) deliver(evt entity.SubscriptionEvent) {
+	select {
+	case s.in <- evt:
+	case <-s.done:
+	}
+}
+
+func (s *subscription) run() {
+	defer close(s.out)
+	var queue []entity.SubscriptionEvent
+	in := s.in
+	for in != nil || len(queue) > 0 {
+		var out chan entity.SubscriptionEvent
+		var next entity.SubscriptionEvent
+		if len(queue) > 0 {
+			out = s.out
+			next = queue[0]
+		}
+		select {
+		case evt, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			if len(queue) == maxQueued {
+				s.mu.Lock()
+				s.err = SubscriptionOverflowError
+				s.mu.Unlock()
+				go s.Close()
+				return
+			}
+			queue = append(queue, evt)
+		case out <- next:
+			queue = queue[1:]
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/linkedin/goavro"
+)
+
+// SchemaFile is a standalone avro schema (.avsc) of the network
+// protocol, with the CRC-64-AVRO fingerprint of its parsing canonical
+// form (as Java's SchemaNormalization.parsingFingerprint64)
+type SchemaFile struct {
+	Name        string
+	Schema      []byte
+	Fingerprint uint64
+}
+
+// ProtocolNamespace is the namespace of the exported protocol schemas.
+// The data types of the network schema are in the data namespace,
+// per section, entity type and event type, e.g.
+// eventino.data.entity_event.user.created_0
+const ProtocolNamespace = "eventino"
+
+// ProtocolFiles returns the schemas of the protocol: eventino.avsc, the
+// commands exchanged before a schema is loaded, and, given the network
+// data schema of a schema version (see LoadSchema), eventino_<vsn>.avsc,
+// the commands and the data types of that version. Only the names
+// differ from the codecs the clients use: the binary encoding is the same
+func ProtocolFiles(vsn uint64, data []byte) (out []SchemaFile, err error) {
+	var commands []interface{}
+	if err = roundTrip(initialSchema, &commands); err != nil {
+		return
+	}
+	for _, cmd := range commands {
+		namespaceTypes(cmd, ProtocolNamespace)
+	}
+	var f SchemaFile
+	if f, err = schemaFile("eventino.avsc", commands); err != nil {
+		return
+	}
+	out = append(out, f)
+	if data == nil {
+		return
+	}
+
+	var dataSchema map[string]interface{}
+	if err = json.Unmarshal(data, &dataSchema); err != nil {
+		return
+	}
+	if _, err = NetCodecWithSchema(dataSchema); err != nil {
+		return nil, fmt.Errorf("not an avro network schema: %s", err)
+	}
+	dataSchema["namespace"] = ProtocolNamespace + ".data"
+	fields, _ := dataSchema["fields"].([]interface{})
+	for _, field := range fields {
+		section, _ := field.(map[string]interface{})
+		entities, _ := section["type"].([]interface{})
+		for _, ent := range entities {
+			namespaceEntity(ent, fmt.Sprintf("%s.data.%s", ProtocolNamespace, section["name"]))
+		}
+	}
+	f, err = schemaFile(fmt.Sprintf("eventino_%d.avsc", vsn), append(commands, dataSchema))
+	out = append(out, f)
+	return
+}
+
+// namespaceEntity sets the namespace of an entity record of a section,
+// of its event records, and of the named types of their data
+func namespaceEntity(ent interface{}, ns string) {
+	record, _ := ent.(map[string]interface{})
+	if record["type"] != "record" {
+		return
+	}
+	record["namespace"] = ns
+	entNs := fmt.Sprintf("%s.%s", ns, record["name"])
+	fields, _ := record["fields"].([]interface{})
+	for _, field := range fields {
+		f, _ := field.(map[string]interface{})
+		evts, _ := f["type"].([]interface{})
+		if items, ok := f["type"].(map[string]interface{}); ok {
+			// entity_events and entity_load, an array of events
+			evts, _ = items["items"].([]interface{})
+		}
+		for _, evt := range evts {
+			evtRecord, _ := evt.(map[string]interface{})
+			evtRecord["namespace"] = entNs
+			evtFields, _ := evtRecord["fields"].([]interface{})
+			for _, evtField := range evtFields {
+				namespaceTypes(evtField.(map[string]interface{})["type"], fmt.Sprintf("%s.%s", entNs, evtRecord["name"]))
+			}
+		}
+	}
+}
+
+// namespaceTypes sets the namespace of the named types within t
+func namespaceTypes(t interface{}, ns string) {
+	switch typ := t.(type) {
+	case []interface{}:
+		for _, branch := range typ {
+			namespaceTypes(branch, ns)
+		}
+	case map[string]interface{}:
+		switch typ["type"] {
+		case "record", "enum", "fixed":
+			typ["namespace"] = ns
+		}
+		namespaceTypes(typ["type"], ns)
+		namespaceTypes(typ["items"], ns)
+		namespaceTypes(typ["values"], ns)
+		fields, _ := typ["fields"].([]interface{})
+		for _, field := range fields {
+			namespaceTypes(field.(map[string]interface{})["type"], ns)
+		}
+	}
+}
+
+// schemaFile defines each named type of the schema once, and
+// fingerprints it
+func schemaFile(name string, scm interface{}) (f SchemaFile, err error) {
+	var defined interface{}
+	if defined, err = definitions(map[string]string{}).define(scm, ""); err != nil {
+		return
+	}
+	f.Name = name
+	if f.Schema, err = json.MarshalIndent(defined, "", "  "); err != nil {
+		return
+	}
+	if _, err = goavro.NewCodec(string(f.Schema)); err != nil {
+		return
+	}
+	var canonical []byte
+	if canonical, err = CanonicalForm(f.Schema); err != nil {
+		return
+	}
+	f.Fingerprint = Fingerprint64(canonical)
+	return
+}
+
+// definitions are the canonical forms of the named types, by full name
+type definitions map[string]string
+
+// define returns t with the named types already defined replaced by
+// their full name, and the wrapped types, e.g. {"type": ["null",
+// "string"]}, unwrapped. Redefining a name differently fails
+func (d definitions) define(t interface{}, ns string) (interface{}, error) {
+	switch typ := t.(type) {
+	case string:
+		return fullName(typ, ns), nil
+	case []interface{}:
+		out := make([]interface{}, len(typ))
+		for i, branch := range typ {
+			var err error
+			if out[i], err = d.define(branch, ns); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]interface{}:
+		kind, ok := typ["type"].(string)
+		if !ok {
+			return d.define(typ["type"], ns)
+		}
+		out := make(map[string]interface{}, len(typ))
+		for k, v := range typ {
+			out[k] = v
+		}
+		var err error
+		switch kind {
+		case "record", "error", "enum", "fixed":
+			full, typNs := namedType(typ, ns)
+			var buf bytes.Buffer
+			if err = writeCanonical(&buf, typ, ns, map[string]bool{}); err != nil {
+				return nil, err
+			}
+			if prev, ok := d[full]; ok {
+				if prev != buf.String() {
+					return nil, fmt.Errorf("%s is defined twice, differently", full)
+				}
+				return full, nil
+			}
+			d[full] = buf.String()
+			fields, _ := typ["fields"].([]interface{})
+			outFields := make([]interface{}, len(fields))
+			for i, field := range fields {
+				f := field.(map[string]interface{})
+				outField := make(map[string]interface{}, len(f))
+				for k, v := range f {
+					outField[k] = v
+				}
+				if outField["type"], err = d.define(f["type"], typNs); err != nil {
+					return nil, fmt.Errorf("%s.%s: %s", full, f["name"], err)
+				}
+				outFields[i] = outField
+			}
+			if kind != "enum" && kind != "fixed" {
+				out["fields"] = outFields
+			}
+		case "array":
+			out["items"], err = d.define(typ["items"], ns)
+		case "map":
+			out["values"], err = d.define(typ["values"], ns)
+		}
+		return out, err
+	}
+	return nil, fmt.Errorf("invalid type %v", t)
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// fullName is the full name of the type named n in the namespace ns
+func fullName(n, ns string) string {
+	if primitives[n] || ns == "" || strings.Contains(n, ".") {
+		return n
+	}
+	return ns + "." + n
+}
+
+// namedType returns the full name and the namespace of a named type
+func namedType(typ map[string]interface{}, ns string) (full, typNs string) {
+	name, _ := typ["name"].(string)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name, name[:i]
+	}
+	if explicit, ok := typ["namespace"].(string); ok {
+		ns = explicit
+	}
+	return fullName(name, ns), ns
+}
+
+// CanonicalForm returns the parsing canonical form of the JSON schema:
+// full names, no attributes but the ones defining the encoding, in the
+// order of the avro specification, and no whitespace
+func CanonicalForm(scm []byte) ([]byte, error) {
+	var t interface{}
+	if err := json.Unmarshal(scm, &t); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err := writeCanonical(&buf, t, "", map[string]bool{})
+	return buf.Bytes(), err
+}
+
+func writeCanonical(buf *bytes.Buffer, t interface{}, ns string, seen map[string]bool) (err error) {
+	switch typ := t.(type) {
+	case string:
+		buf.WriteString(strconv.Quote(fullName(typ, ns)))
+		return
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, branch := range typ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err = writeCanonical(buf, branch, ns, seen); err != nil {
+				return
+			}
+		}
+		buf.WriteByte(']')
+		return
+	case map[string]interface{}:
+		kind, ok := typ["type"].(string)
+		if !ok {
+			return writeCanonical(buf, typ["type"], ns, seen)
+		}
+		switch kind {
+		case "record", "error", "enum", "fixed":
+			full, typNs := namedType(typ, ns)
+			if seen[full] {
+				buf.WriteString(strconv.Quote(full))
+				return
+			}
+			seen[full] = true
+			fmt.Fprintf(buf, `{"name":%s,"type":%s`, strconv.Quote(full), strconv.Quote(kind))
+			switch kind {
+			case "enum":
+				symbols, _ := json.Marshal(typ["symbols"])
+				fmt.Fprintf(buf, `,"symbols":%s`, symbols)
+			case "fixed":
+				size, _ := typ["size"].(float64)
+				fmt.Fprintf(buf, `,"size":%d`, int64(size))
+			default:
+				buf.WriteString(`,"fields":[`)
+				fields, _ := typ["fields"].([]interface{})
+				for i, field := range fields {
+					f, _ := field.(map[string]interface{})
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					fmt.Fprintf(buf, `{"name":%s,"type":`, strconv.Quote(f["name"].(string)))
+					if err = writeCanonical(buf, f["type"], typNs, seen); err != nil {
+						return
+					}
+					buf.WriteByte('}')
+				}
+				buf.WriteByte(']')
+			}
+			buf.WriteByte('}')
+		case "array":
+			buf.WriteString(`{"type":"array","items":`)
+			if err = writeCanonical(buf, typ["items"], ns, seen); err != nil {
+				return
+			}
+			buf.WriteByte('}')
+		case "map":
+			buf.WriteString(`{"type":"map","values":`)
+			if err = writeCanonical(buf, typ["values"], ns, seen); err != nil {
+				return
+			}
+			buf.WriteByte('}')
+		default:
+			// primitives, and the logical types of primitives
+			buf.WriteString(strconv.Quote(kind))
+		}
+		return
+	}
+	return fmt.Errorf("invalid type %v", t)
+}
+
+// the CRC-64-AVRO fingerprint of the avro specification
+const emptyFingerprint uint64 = 0xc15d213aa4d7a795
+
+var fingerprintTable [256]uint64
+
+func init() {
+	for i := range fingerprintTable {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (emptyFingerprint & -(fp & 1))
+		}
+		fingerprintTable[i] = fp
+	}
+}
+
+// Fingerprint64 returns the CRC-64-AVRO fingerprint of the canonical form
+func Fingerprint64(canonical []byte) uint64 {
+	fp := emptyFingerprint
+	for _, b := range canonical {
+		fp = (fp >> 8) ^ fingerprintTable[byte(fp)^b]
+	}
+	return fp
+}
+
+// roundTrip converts v to the generic JSON values of out
+func roundTrip(v interface{}, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
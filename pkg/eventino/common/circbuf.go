@@ -0,0 +1,88 @@
+package common
+
+// Circbuf buffers the bytes read from a stream connection, and calls
+// back on every write: the callback reads the buffered bytes, and consumes
+// the ones it could decode. Partial messages are kept until the rest
+// of the message is written. The buffer grows as needed
+type Circbuf struct {
+	buf   []byte
+	start int
+	size  int
+	cb    func(*Circbuf) error
+}
+
+// NewCircbuf returns a Circbuf with the given initial capacity
+func NewCircbuf(size int, cb func(*Circbuf) error) *Circbuf {
+	if size < 1 {
+		size = 1
+	}
+	return &Circbuf{buf: make([]byte, size), cb: cb}
+}
+
+// Write buffers p, then calls back until the callback
+// stops consuming bytes
+func (c *Circbuf) Write(p []byte) (int, error) {
+	c.grow(len(p))
+	end := (c.start + c.size) % len(c.buf)
+	n := copy(c.buf[end:], p)
+	copy(c.buf, p[n:])
+	c.size += len(p)
+
+	for c.size > 0 {
+		size := c.size
+		if err := c.cb(c); err != nil {
+			return len(p), err
+		}
+		if c.size == size {
+			break
+		}
+	}
+	return len(p), nil
+}
+
+// Len returns the number of buffered bytes
+func (c *Circbuf) Len() int {
+	return c.size
+}
+
+// ReadAll returns a copy of the buffered bytes, without consuming them
+func (c *Circbuf) ReadAll() ([]byte, error) {
+	out := make([]byte, c.size)
+	n := copy(out, c.buf[c.start:minInt(c.start+c.size, len(c.buf))])
+	copy(out[n:], c.buf[:c.size-n])
+	return out, nil
+}
+
+// Consume drops the first n buffered bytes
+func (c *Circbuf) Consume(n int) {
+	if n > c.size {
+		n = c.size
+	}
+	c.start = (c.start + n) % len(c.buf)
+	c.size -= n
+	if c.size == 0 {
+		c.start = 0
+	}
+}
+
+func (c *Circbuf) grow(n int) {
+	if c.size+n <= len(c.buf) {
+		return
+	}
+	capacity := 2 * len(c.buf)
+	for capacity < c.size+n {
+		capacity *= 2
+	}
+	buf := make([]byte, capacity)
+	data, _ := c.ReadAll()
+	copy(buf, data)
+	c.buf = buf
+	c.start = 0
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,382 @@
+package command
+
+// CreateConsumer creates a durable consumer of the events of an entity
+// type matching the filter, see SubscribeType for the filter fields
+type CreateConsumer struct {
+	Name      string
+	Type      string
+	EventName string
+	MatchVSN  bool
+	EventVSN  uint64
+	Since     int64
+	Until     int64
+	Predicate string
+}
+
+func (c *CreateConsumer) Is(m map[string]interface{}) bool {
+	_, ok := m["createConsumer"]
+	return ok
+}
+func (c *CreateConsumer) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"createConsumer": c.encodeFields(),
+	}
+}
+func (c *CreateConsumer) encodeFields() map[string]interface{} {
+	return map[string]interface{}{
+		"name":      c.Name,
+		"type":      c.Type,
+		"event":     c.EventName,
+		"match_vsn": c.MatchVSN,
+		"event_vsn": int64(c.EventVSN),
+		"since":     c.Since,
+		"until":     c.Until,
+		"predicate": c.Predicate,
+	}
+}
+func (c *CreateConsumer) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.decodeFields(m["createConsumer"].(map[string]interface{}))
+	}
+}
+func (c *CreateConsumer) decodeFields(cc map[string]interface{}) {
+	c.Name = cc["name"].(string)
+	c.Type = cc["type"].(string)
+	c.EventName = cc["event"].(string)
+	c.MatchVSN = cc["match_vsn"].(bool)
+	c.EventVSN = uint64(cc["event_vsn"].(int64))
+	c.Since = cc["since"].(int64)
+	c.Until = cc["until"].(int64)
+	c.Predicate = cc["predicate"].(string)
+}
+func (c *CreateConsumer) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "record",
+		"name":   "createConsumer",
+		"fields": consumerFields(),
+	}
+}
+
+func consumerFields() []map[string]interface{} {
+	return []map[string]interface{}{
+		map[string]interface{}{
+			"type": "string",
+			"name": "name",
+		},
+		map[string]interface{}{
+			"type": "string",
+			"name": "type",
+		},
+		map[string]interface{}{
+			"type": "string",
+			"name": "event",
+		},
+		map[string]interface{}{
+			"type": "boolean",
+			"name": "match_vsn",
+		},
+		map[string]interface{}{
+			"type": "long",
+			"name": "event_vsn",
+		},
+		map[string]interface{}{
+			"type": "long",
+			"name": "since",
+		},
+		map[string]interface{}{
+			"type": "long",
+			"name": "until",
+		},
+		map[string]interface{}{
+			"type": "string",
+			"name": "predicate",
+		},
+	}
+}
+
+// ConsumerInfo is a consumer listed by ListConsumersReply,
+// Offset is its encoded committed position
+type ConsumerInfo struct {
+	CreateConsumer
+	Offset []byte
+}
+
+// ListConsumersReply is the reply to the "list_consumers" string command
+type ListConsumersReply struct {
+	Consumers []ConsumerInfo
+}
+
+func (c *ListConsumersReply) Is(m map[string]interface{}) bool {
+	_, ok := m["listConsumersReply"]
+	return ok
+}
+func (c *ListConsumersReply) Encode() map[string]interface{} {
+	consumers := make([]interface{}, len(c.Consumers))
+	for i, info := range c.Consumers {
+		fields := info.encodeFields()
+		fields["offset"] = info.Offset
+		consumers[i] = fields
+	}
+	return map[string]interface{}{
+		"listConsumersReply": map[string]interface{}{
+			"consumers": consumers,
+		},
+	}
+}
+func (c *ListConsumersReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		consumers := m["listConsumersReply"].(map[string]interface{})["consumers"].([]interface{})
+		c.Consumers = make([]ConsumerInfo, len(consumers))
+		for i, v := range consumers {
+			fields := v.(map[string]interface{})
+			c.Consumers[i].decodeFields(fields)
+			c.Consumers[i].Offset = fields["offset"].([]byte)
+		}
+	}
+}
+func (c *ListConsumersReply) AvroSchema() map[string]interface{} {
+	fields := append(consumerFields(), map[string]interface{}{
+		"type": "bytes",
+		"name": "offset",
+	})
+	return map[string]interface{}{
+		"type": "record",
+		"name": "listConsumersReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"name": "consumers",
+				"type": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type":   "record",
+						"name":   "consumer",
+						"fields": fields,
+					},
+				},
+			},
+		},
+	}
+}
+
+// ResetConsumer moves the consumer offset to the encoded
+// position, empty to read the whole log
+type ResetConsumer struct {
+	Name   string
+	Offset []byte
+}
+
+func (c *ResetConsumer) Is(m map[string]interface{}) bool {
+	_, ok := m["resetConsumer"]
+	return ok
+}
+func (c *ResetConsumer) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"resetConsumer": map[string]interface{}{
+			"name":   c.Name,
+			"offset": c.Offset,
+		},
+	}
+}
+func (c *ResetConsumer) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		rc := m["resetConsumer"].(map[string]interface{})
+		c.Name = rc["name"].(string)
+		c.Offset = rc["offset"].([]byte)
+	}
+}
+func (c *ResetConsumer) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "resetConsumer",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "name",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "offset",
+			},
+		},
+	}
+}
+
+type DeleteConsumer struct {
+	Name string
+}
+
+func (c *DeleteConsumer) Is(m map[string]interface{}) bool {
+	_, ok := m["deleteConsumer"]
+	return ok
+}
+func (c *DeleteConsumer) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"deleteConsumer": map[string]interface{}{
+			"name": c.Name,
+		},
+	}
+}
+func (c *DeleteConsumer) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Name = m["deleteConsumer"].(map[string]interface{})["name"].(string)
+	}
+}
+func (c *DeleteConsumer) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "deleteConsumer",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "name",
+			},
+		},
+	}
+}
+
+// Consume subscribes to the events of a consumer, the reply is Subscribed
+type Consume struct {
+	Name string
+}
+
+func (c *Consume) Is(m map[string]interface{}) bool {
+	_, ok := m["consume"]
+	return ok
+}
+func (c *Consume) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"consume": map[string]interface{}{
+			"name": c.Name,
+		},
+	}
+}
+func (c *Consume) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Name = m["consume"].(map[string]interface{})["name"].(string)
+	}
+}
+func (c *Consume) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "consume",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "name",
+			},
+		},
+	}
+}
+
+// Ack acknowledges the event at the encoded position,
+// delivered by a Consume subscription
+type Ack struct {
+	Subscription int64
+	Position     []byte
+}
+
+func (c *Ack) Is(m map[string]interface{}) bool {
+	_, ok := m["ack"]
+	return ok
+}
+func (c *Ack) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"ack": map[string]interface{}{
+			"subscription": c.Subscription,
+			"position":     c.Position,
+		},
+	}
+}
+func (c *Ack) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		a := m["ack"].(map[string]interface{})
+		c.Subscription = a["subscription"].(int64)
+		c.Position = a["position"].([]byte)
+	}
+}
+func (c *Ack) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "ack",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "subscription",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "position",
+			},
+		},
+	}
+}
+
+// Commit persists the offset of a Consume subscription,
+// the reply is CommitReply
+type Commit struct {
+	Subscription int64
+}
+
+func (c *Commit) Is(m map[string]interface{}) bool {
+	_, ok := m["commit"]
+	return ok
+}
+func (c *Commit) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"commit": map[string]interface{}{
+			"subscription": c.Subscription,
+		},
+	}
+}
+func (c *Commit) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Subscription = m["commit"].(map[string]interface{})["subscription"].(int64)
+	}
+}
+func (c *Commit) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "commit",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "subscription",
+			},
+		},
+	}
+}
+
+// CommitReply carries the encoded committed offset,
+// empty if nothing was committed yet
+type CommitReply struct {
+	Offset []byte
+}
+
+func (c *CommitReply) Is(m map[string]interface{}) bool {
+	_, ok := m["commitReply"]
+	return ok
+}
+func (c *CommitReply) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"commitReply": map[string]interface{}{
+			"offset": c.Offset,
+		},
+	}
+}
+func (c *CommitReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Offset = m["commitReply"].(map[string]interface{})["offset"].([]byte)
+	}
+}
+func (c *CommitReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "commitReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "offset",
+			},
+		},
+	}
+}
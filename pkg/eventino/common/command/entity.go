@@ -40,10 +40,52 @@ func (c *CreateEntity) AvroSchema() map[string]interface{} {
 	}
 }
 
+// CreateEntityReply carries the position of the entity creation,
+// the consistency token of the write
+type CreateEntityReply struct {
+	Position []byte
+}
+
+func (c *CreateEntityReply) Is(m map[string]interface{}) bool {
+	_, ok := m["createEntityReply"]
+	return ok
+}
+func (c *CreateEntityReply) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"createEntityReply": map[string]interface{}{
+			"position": c.Position,
+		},
+	}
+}
+func (c *CreateEntityReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Position = m["createEntityReply"].(map[string]interface{})["position"].([]byte)
+	}
+}
+func (c *CreateEntityReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "createEntityReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "position",
+			},
+		},
+	}
+}
+
+// LoadEntity loads an entity. When MinPos is set, the read waits
+// until the server has committed that position
 type LoadEntity struct {
-	Type string
-	ID   []byte
-	VSN  uint64
+	Type   string
+	ID     []byte
+	VSN    uint64
+	MinPos []byte
+	// Latest and Versions select the versions
+	// the events are presented at, see eventino.Versions
+	Latest   bool
+	Versions map[string]uint64
 }
 
 func (c *LoadEntity) Is(m map[string]interface{}) bool {
@@ -53,9 +95,12 @@ func (c *LoadEntity) Is(m map[string]interface{}) bool {
 func (c *LoadEntity) Encode() map[string]interface{} {
 	return map[string]interface{}{
 		"loadEntity": map[string]interface{}{
-			"type": c.Type,
-			"id":   c.ID,
-			"vsn":  int64(c.VSN),
+			"type":     c.Type,
+			"id":       c.ID,
+			"vsn":      int64(c.VSN),
+			"min_pos":  c.MinPos,
+			"latest":   c.Latest,
+			"versions": encodeVersions(c.Versions),
 		},
 	}
 }
@@ -65,6 +110,9 @@ func (c *LoadEntity) Decode(m map[string]interface{}) {
 		c.Type = le["type"].(string)
 		c.ID = le["id"].([]byte)
 		c.VSN = uint64(le["vsn"].(int64))
+		c.MinPos = le["min_pos"].([]byte)
+		c.Latest = le["latest"].(bool)
+		c.Versions = decodeVersions(le["versions"].(map[string]interface{}))
 	}
 }
 func (c *LoadEntity) AvroSchema() map[string]interface{} {
@@ -84,6 +132,126 @@ func (c *LoadEntity) AvroSchema() map[string]interface{} {
 				"type": "long",
 				"name": "vsn",
 			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "min_pos",
+			},
+			map[string]interface{}{
+				"type": "boolean",
+				"name": "latest",
+			},
+			map[string]interface{}{
+				"type": map[string]interface{}{"type": "map", "values": "long"},
+				"name": "versions",
+			},
+		},
+	}
+}
+
+func encodeVersions(versions map[string]uint64) map[string]interface{} {
+	out := make(map[string]interface{}, len(versions))
+	for name, vsn := range versions {
+		out[name] = int64(vsn)
+	}
+	return out
+}
+
+func decodeVersions(m map[string]interface{}) map[string]uint64 {
+	out := make(map[string]uint64, len(m))
+	for name, vsn := range m {
+		out[name] = uint64(vsn.(int64))
+	}
+	return out
+}
+
+// PutReply carries the entity version after a put, and the
+// position of the event, the consistency token of the write
+type PutReply struct {
+	VSN      uint64
+	Position []byte
+}
+
+func (c *PutReply) Is(m map[string]interface{}) bool {
+	_, ok := m["putReply"]
+	return ok
+}
+func (c *PutReply) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"putReply": map[string]interface{}{
+			"vsn":      int64(c.VSN),
+			"position": c.Position,
+		},
+	}
+}
+func (c *PutReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		pr := m["putReply"].(map[string]interface{})
+		c.VSN = uint64(pr["vsn"].(int64))
+		c.Position = pr["position"].([]byte)
+	}
+}
+func (c *PutReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "putReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "position",
+			},
+		},
+	}
+}
+
+type PutManyReply struct {
+	VSNs     []uint64
+	Position []byte
+}
+
+func (c *PutManyReply) Is(m map[string]interface{}) bool {
+	_, ok := m["putManyReply"]
+	return ok
+}
+func (c *PutManyReply) Encode() map[string]interface{} {
+	vsns := make([]interface{}, len(c.VSNs))
+	for i, vsn := range c.VSNs {
+		vsns[i] = int64(vsn)
+	}
+	return map[string]interface{}{
+		"putManyReply": map[string]interface{}{
+			"vsns":     vsns,
+			"position": c.Position,
+		},
+	}
+}
+func (c *PutManyReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		pr := m["putManyReply"].(map[string]interface{})
+		vsns := pr["vsns"].([]interface{})
+		c.Position = pr["position"].([]byte)
+		c.VSNs = make([]uint64, len(vsns))
+		for i, vsn := range vsns {
+			c.VSNs[i] = uint64(vsn.(int64))
+		}
+	}
+}
+func (c *PutManyReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "putManyReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"name": "vsns",
+				"type": map[string]interface{}{"type": "array", "items": "long"},
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "position",
+			},
 		},
 	}
 }
@@ -1,11 +1,40 @@
 package command
 
+import (
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/linkedin/goavro"
+)
+
+// ErrorResponse is a failed command. Errors are the
+// validation errors, if the payload of an event was not valid
 type ErrorResponse struct {
 	Message string
+	Errors  []ValidationError
+}
+
+// ValidationError is a value not valid for its
+// schema, e.g. address.zip: expected string, got int64
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) String() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
 }
 
 func NewErrorMessage(err error) *ErrorResponse {
-	return &ErrorResponse{Message: err.Error()}
+	rsp := &ErrorResponse{Message: err.Error()}
+	if invalid, ok := err.(schema.InvalidPayloadError); ok {
+		rsp.Errors = make([]ValidationError, len(invalid.Errors))
+		for i, e := range invalid.Errors {
+			rsp.Errors[i] = ValidationError{Path: e.Path, Message: e.Message}
+		}
+	}
+	return rsp
 }
 
 func (c *ErrorResponse) Is(m map[string]interface{}) bool {
@@ -13,15 +42,38 @@ func (c *ErrorResponse) Is(m map[string]interface{}) bool {
 	return ok
 }
 func (c *ErrorResponse) Encode() map[string]interface{} {
+	// null when there are no validation errors
+	var errs interface{}
+	if len(c.Errors) > 0 {
+		items := make([]interface{}, len(c.Errors))
+		for i, e := range c.Errors {
+			items[i] = map[string]interface{}{
+				"path":    e.Path,
+				"message": e.Message,
+			}
+		}
+		errs = goavro.Union("array", items)
+	}
 	return map[string]interface{}{
 		"errorResponse": map[string]interface{}{
 			"message": c.Message,
+			"errors":  errs,
 		},
 	}
 }
 func (c *ErrorResponse) Decode(m map[string]interface{}) {
 	if c.Is(m) {
-		c.Message = m["errorResponse"].(map[string]interface{})["message"].(string)
+		fields := m["errorResponse"].(map[string]interface{})
+		c.Message = fields["message"].(string)
+		var errs []interface{}
+		if union, ok := fields["errors"].(map[string]interface{}); ok {
+			errs, _ = union["array"].([]interface{})
+		}
+		c.Errors = make([]ValidationError, len(errs))
+		for i, e := range errs {
+			c.Errors[i].Path = e.(map[string]interface{})["path"].(string)
+			c.Errors[i].Message = e.(map[string]interface{})["message"].(string)
+		}
 	}
 }
 func (c *ErrorResponse) AvroSchema() map[string]interface{} {
@@ -33,6 +85,70 @@ func (c *ErrorResponse) AvroSchema() map[string]interface{} {
 				"type": "string",
 				"name": "message",
 			},
+			map[string]interface{}{
+				"name":    "errors",
+				"default": nil,
+				"type": []interface{}{
+					"null",
+					map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "record",
+							"name": "validationError",
+							"fields": []map[string]interface{}{
+								map[string]interface{}{
+									"type": "string",
+									"name": "path",
+								},
+								map[string]interface{}{
+									"type": "string",
+									"name": "message",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+type VersionConflictResponse struct {
+	Expected int64
+	Actual   int64
+}
+
+func (c *VersionConflictResponse) Is(m map[string]interface{}) bool {
+	_, ok := m["versionConflictResponse"]
+	return ok
+}
+func (c *VersionConflictResponse) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"versionConflictResponse": map[string]interface{}{
+			"expected": c.Expected,
+			"actual":   c.Actual,
+		},
+	}
+}
+func (c *VersionConflictResponse) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Expected = m["versionConflictResponse"].(map[string]interface{})["expected"].(int64)
+		c.Actual = m["versionConflictResponse"].(map[string]interface{})["actual"].(int64)
+	}
+}
+func (c *VersionConflictResponse) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "versionConflictResponse",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "expected",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "actual",
+			},
 		},
 	}
 }
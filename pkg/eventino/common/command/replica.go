@@ -0,0 +1,97 @@
+package command
+
+// Replicate turns the connection into a replication stream: the leader
+// pushes ReplicaEvent messages, after the given encoded positions
+// (the latest event of each partition on the follower)
+type Replicate struct {
+	Positions [][]byte
+}
+
+func (c *Replicate) Is(m map[string]interface{}) bool {
+	_, ok := m["replicate"]
+	return ok
+}
+func (c *Replicate) Encode() map[string]interface{} {
+	positions := make([]interface{}, len(c.Positions))
+	for i, position := range c.Positions {
+		positions[i] = position
+	}
+	return map[string]interface{}{
+		"replicate": map[string]interface{}{
+			"positions": positions,
+		},
+	}
+}
+func (c *Replicate) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		positions := m["replicate"].(map[string]interface{})["positions"].([]interface{})
+		c.Positions = make([][]byte, len(positions))
+		for i, position := range positions {
+			c.Positions[i] = position.([]byte)
+		}
+	}
+}
+func (c *Replicate) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "replicate",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"name": "positions",
+				"type": map[string]interface{}{
+					"type":  "array",
+					"items": "bytes",
+				},
+			},
+		},
+	}
+}
+
+// ReplicaEvent is a log event pushed by the leader to a follower
+type ReplicaEvent struct {
+	Meta    byte
+	ID      []byte
+	Payload []byte
+}
+
+func (c *ReplicaEvent) Is(m map[string]interface{}) bool {
+	_, ok := m["replicaEvent"]
+	return ok
+}
+func (c *ReplicaEvent) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"replicaEvent": map[string]interface{}{
+			"meta":    int32(c.Meta),
+			"id":      c.ID,
+			"payload": c.Payload,
+		},
+	}
+}
+func (c *ReplicaEvent) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		re := m["replicaEvent"].(map[string]interface{})
+		c.Meta = byte(re["meta"].(int32))
+		c.ID = re["id"].([]byte)
+		c.Payload = re["payload"].([]byte)
+	}
+}
+func (c *ReplicaEvent) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "replicaEvent",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "int",
+				"name": "meta",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "id",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "payload",
+			},
+		},
+	}
+}
@@ -201,3 +201,686 @@ func (c *LoadSchemaReply) AvroSchema() map[string]interface{} {
 		},
 	}
 }
+
+// CreateType creates a named record or enum type
+type CreateType struct {
+	Name       string
+	MetaSchema map[string]interface{}
+}
+
+func (c *CreateType) Is(m map[string]interface{}) bool {
+	_, ok := m["createType"]
+	return ok
+}
+func (c *CreateType) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"createType": map[string]interface{}{
+			"name":       c.Name,
+			"metaSchema": c.MetaSchema,
+		},
+	}
+}
+func (c *CreateType) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Name = m["createType"].(map[string]interface{})["name"].(string)
+		c.MetaSchema = m["createType"].(map[string]interface{})["metaSchema"].(map[string]interface{})
+	}
+}
+func (c *CreateType) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "createType",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "name",
+			},
+			map[string]interface{}{
+				"name": "metaSchema",
+				"type": schemaavro.MetaSchema,
+			},
+		},
+	}
+}
+
+// UpdateType adds a new version of a named type,
+// replied with UpdateTypeReply
+type UpdateType struct {
+	Name       string
+	MetaSchema map[string]interface{}
+}
+
+func (c *UpdateType) Is(m map[string]interface{}) bool {
+	_, ok := m["updateType"]
+	return ok
+}
+func (c *UpdateType) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"updateType": map[string]interface{}{
+			"name":       c.Name,
+			"metaSchema": c.MetaSchema,
+		},
+	}
+}
+func (c *UpdateType) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Name = m["updateType"].(map[string]interface{})["name"].(string)
+		c.MetaSchema = m["updateType"].(map[string]interface{})["metaSchema"].(map[string]interface{})
+	}
+}
+func (c *UpdateType) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "updateType",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "name",
+			},
+			map[string]interface{}{
+				"name": "metaSchema",
+				"type": schemaavro.MetaSchema,
+			},
+		},
+	}
+}
+
+// UpdateTypeReply holds the schema version and the new type version
+type UpdateTypeReply struct {
+	SchemaVSN uint64
+	VSN       uint64
+}
+
+func (c *UpdateTypeReply) Is(m map[string]interface{}) bool {
+	_, ok := m["updateTypeReply"]
+	return ok
+}
+func (c *UpdateTypeReply) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"updateTypeReply": map[string]interface{}{
+			"schemaVsn": int64(c.SchemaVSN),
+			"vsn":       int64(c.VSN),
+		},
+	}
+}
+func (c *UpdateTypeReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.SchemaVSN = uint64(m["updateTypeReply"].(map[string]interface{})["schemaVsn"].(int64))
+		c.VSN = uint64(m["updateTypeReply"].(map[string]interface{})["vsn"].(int64))
+	}
+}
+func (c *UpdateTypeReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "updateTypeReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "schemaVsn",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+		},
+	}
+}
+
+// DeleteType removes every version of a named type
+type DeleteType struct {
+	Name string
+}
+
+func (c *DeleteType) Is(m map[string]interface{}) bool {
+	_, ok := m["deleteType"]
+	return ok
+}
+func (c *DeleteType) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"deleteType": map[string]interface{}{
+			"name": c.Name,
+		},
+	}
+}
+func (c *DeleteType) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Name = m["deleteType"].(map[string]interface{})["name"].(string)
+	}
+}
+func (c *DeleteType) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "deleteType",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "name",
+			},
+		},
+	}
+}
+
+// UpdateEntityEventType adds a new version of an event type,
+// replied with UpdateEventTypeReply
+type UpdateEntityEventType struct {
+	EntityType string
+	EventName  string
+	MetaSchema map[string]interface{}
+}
+
+func (c *UpdateEntityEventType) Is(m map[string]interface{}) bool {
+	_, ok := m["updateEntityEventType"]
+	return ok
+}
+func (c *UpdateEntityEventType) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"updateEntityEventType": map[string]interface{}{
+			"entityType": c.EntityType,
+			"eventName":  c.EventName,
+			"metaSchema": c.MetaSchema,
+		},
+	}
+}
+func (c *UpdateEntityEventType) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.EntityType = m["updateEntityEventType"].(map[string]interface{})["entityType"].(string)
+		c.EventName = m["updateEntityEventType"].(map[string]interface{})["eventName"].(string)
+		c.MetaSchema = m["updateEntityEventType"].(map[string]interface{})["metaSchema"].(map[string]interface{})
+	}
+}
+func (c *UpdateEntityEventType) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "updateEntityEventType",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "entityType",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "eventName",
+			},
+			map[string]interface{}{
+				"name": "metaSchema",
+				"type": schemaavro.MetaSchema,
+			},
+		},
+	}
+}
+
+type UpdateEventTypeReply struct {
+	SchemaVSN uint64
+	VSN       uint64
+}
+
+func (c *UpdateEventTypeReply) Is(m map[string]interface{}) bool {
+	_, ok := m["updateEventTypeReply"]
+	return ok
+}
+func (c *UpdateEventTypeReply) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"updateEventTypeReply": map[string]interface{}{
+			"schemaVsn": int64(c.SchemaVSN),
+			"vsn":       int64(c.VSN),
+		},
+	}
+}
+func (c *UpdateEventTypeReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.SchemaVSN = uint64(m["updateEventTypeReply"].(map[string]interface{})["schemaVsn"].(int64))
+		c.VSN = uint64(m["updateEventTypeReply"].(map[string]interface{})["vsn"].(int64))
+	}
+}
+func (c *UpdateEventTypeReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "updateEventTypeReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "schemaVsn",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+		},
+	}
+}
+
+// SetCompatibility sets the compatibility (NONE, BACKWARD, FORWARD or FULL)
+// of an event type, or the entity type default if EventName is empty
+type SetCompatibility struct {
+	EntityType    string
+	EventName     string
+	Compatibility string
+}
+
+func (c *SetCompatibility) Is(m map[string]interface{}) bool {
+	_, ok := m["setCompatibility"]
+	return ok
+}
+func (c *SetCompatibility) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"setCompatibility": map[string]interface{}{
+			"entityType":    c.EntityType,
+			"eventName":     c.EventName,
+			"compatibility": c.Compatibility,
+		},
+	}
+}
+func (c *SetCompatibility) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.EntityType = m["setCompatibility"].(map[string]interface{})["entityType"].(string)
+		c.EventName = m["setCompatibility"].(map[string]interface{})["eventName"].(string)
+		c.Compatibility = m["setCompatibility"].(map[string]interface{})["compatibility"].(string)
+	}
+}
+func (c *SetCompatibility) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "setCompatibility",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "entityType",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "eventName",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "compatibility",
+			},
+		},
+	}
+}
+
+// ApplySchema applies a JSON schema spec, or only plans it if DryRun
+type ApplySchema struct {
+	Spec   []byte
+	DryRun bool
+}
+
+func (c *ApplySchema) Is(m map[string]interface{}) bool {
+	_, ok := m["applySchema"]
+	return ok
+}
+func (c *ApplySchema) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"applySchema": map[string]interface{}{
+			"spec":   c.Spec,
+			"dryRun": c.DryRun,
+		},
+	}
+}
+func (c *ApplySchema) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Spec = m["applySchema"].(map[string]interface{})["spec"].([]byte)
+		c.DryRun = m["applySchema"].(map[string]interface{})["dryRun"].(bool)
+	}
+}
+func (c *ApplySchema) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "applySchema",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "spec",
+			},
+			map[string]interface{}{
+				"type": "boolean",
+				"name": "dryRun",
+			},
+		},
+	}
+}
+
+// ApplySchemaReply carries the schema version and the planned changes
+type ApplySchemaReply struct {
+	SchemaVSN uint64
+	Plan      []string
+}
+
+func (c *ApplySchemaReply) Is(m map[string]interface{}) bool {
+	_, ok := m["applySchemaReply"]
+	return ok
+}
+func (c *ApplySchemaReply) Encode() map[string]interface{} {
+	plan := make([]interface{}, len(c.Plan))
+	for i, change := range c.Plan {
+		plan[i] = change
+	}
+	return map[string]interface{}{
+		"applySchemaReply": map[string]interface{}{
+			"schemaVsn": int64(c.SchemaVSN),
+			"plan":      plan,
+		},
+	}
+}
+func (c *ApplySchemaReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.SchemaVSN = uint64(m["applySchemaReply"].(map[string]interface{})["schemaVsn"].(int64))
+		plan := m["applySchemaReply"].(map[string]interface{})["plan"].([]interface{})
+		c.Plan = make([]string, len(plan))
+		for i, change := range plan {
+			c.Plan[i] = change.(string)
+		}
+	}
+}
+func (c *ApplySchemaReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "applySchemaReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "schemaVsn",
+			},
+			map[string]interface{}{
+				"type": map[string]interface{}{"type": "array", "items": "string"},
+				"name": "plan",
+			},
+		},
+	}
+}
+
+// SchemaHistory lists the schema changes after the From
+// version up to the To one (the latest if 0), with Diff
+// the difference between the two versions instead
+type SchemaHistory struct {
+	From uint64
+	To   uint64
+	Diff bool
+}
+
+func (c *SchemaHistory) Is(m map[string]interface{}) bool {
+	_, ok := m["schemaHistory"]
+	return ok
+}
+func (c *SchemaHistory) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"schemaHistory": map[string]interface{}{
+			"from": int64(c.From),
+			"to":   int64(c.To),
+			"diff": c.Diff,
+		},
+	}
+}
+func (c *SchemaHistory) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		sh := m["schemaHistory"].(map[string]interface{})
+		c.From = uint64(sh["from"].(int64))
+		c.To = uint64(sh["to"].(int64))
+		c.Diff = sh["diff"].(bool)
+	}
+}
+func (c *SchemaHistory) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "schemaHistory",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "from",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "to",
+			},
+			map[string]interface{}{
+				"type": "boolean",
+				"name": "diff",
+			},
+		},
+	}
+}
+
+// SchemaHistoryReply carries the schema changes, or the diff, encoded as JSON
+type SchemaHistoryReply struct {
+	Data []byte
+}
+
+func (c *SchemaHistoryReply) Is(m map[string]interface{}) bool {
+	_, ok := m["schemaHistoryReply"]
+	return ok
+}
+func (c *SchemaHistoryReply) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"schemaHistoryReply": map[string]interface{}{
+			"data": c.Data,
+		},
+	}
+}
+func (c *SchemaHistoryReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Data = m["schemaHistoryReply"].(map[string]interface{})["data"].([]byte)
+	}
+}
+func (c *SchemaHistoryReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "schemaHistoryReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "data",
+			},
+		},
+	}
+}
+
+// ExportSchema asks the standalone avro schemas of the
+// protocol at the schema version VSN
+type ExportSchema struct {
+	VSN uint64
+}
+
+func (c *ExportSchema) Is(m map[string]interface{}) bool {
+	_, ok := m["exportSchema"]
+	return ok
+}
+func (c *ExportSchema) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"exportSchema": map[string]interface{}{
+			"vsn": int64(c.VSN),
+		},
+	}
+}
+func (c *ExportSchema) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.VSN = uint64(m["exportSchema"].(map[string]interface{})["vsn"].(int64))
+	}
+}
+func (c *ExportSchema) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "exportSchema",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+		},
+	}
+}
+
+// ExportSchemaReply carries the exported schema files
+type ExportSchemaReply struct {
+	SchemaVSN uint64
+	Files     []ExportedSchema
+}
+
+// ExportedSchema is an exported schema file, with its fingerprint
+type ExportedSchema struct {
+	Name        string
+	Schema      []byte
+	Fingerprint uint64
+}
+
+func (c *ExportSchemaReply) Is(m map[string]interface{}) bool {
+	_, ok := m["exportSchemaReply"]
+	return ok
+}
+func (c *ExportSchemaReply) Encode() map[string]interface{} {
+	files := make([]interface{}, len(c.Files))
+	for i, f := range c.Files {
+		files[i] = map[string]interface{}{
+			"name":        f.Name,
+			"schema":      f.Schema,
+			"fingerprint": int64(f.Fingerprint),
+		}
+	}
+	return map[string]interface{}{
+		"exportSchemaReply": map[string]interface{}{
+			"schemaVsn": int64(c.SchemaVSN),
+			"files":     files,
+		},
+	}
+}
+func (c *ExportSchemaReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		rsp := m["exportSchemaReply"].(map[string]interface{})
+		c.SchemaVSN = uint64(rsp["schemaVsn"].(int64))
+		files := rsp["files"].([]interface{})
+		c.Files = make([]ExportedSchema, len(files))
+		for i, f := range files {
+			file := f.(map[string]interface{})
+			c.Files[i] = ExportedSchema{
+				Name:        file["name"].(string),
+				Schema:      file["schema"].([]byte),
+				Fingerprint: uint64(file["fingerprint"].(int64)),
+			}
+		}
+	}
+}
+func (c *ExportSchemaReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "exportSchemaReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "schemaVsn",
+			},
+			map[string]interface{}{
+				"name": "files",
+				"type": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "record",
+						"name": "exportedSchema",
+						"fields": []map[string]interface{}{
+							map[string]interface{}{"type": "string", "name": "name"},
+							map[string]interface{}{"type": "bytes", "name": "schema"},
+							map[string]interface{}{"type": "long", "name": "fingerprint"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Negotiate states the schema version the client speaks, or,
+// if not 0, the fingerprint of its exported protocol schema
+type Negotiate struct {
+	VSN         uint64
+	Fingerprint uint64
+}
+
+func (c *Negotiate) Is(m map[string]interface{}) bool {
+	_, ok := m["negotiate"]
+	return ok
+}
+func (c *Negotiate) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"negotiate": map[string]interface{}{
+			"vsn":         int64(c.VSN),
+			"fingerprint": int64(c.Fingerprint),
+		},
+	}
+}
+func (c *Negotiate) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		n := m["negotiate"].(map[string]interface{})
+		c.VSN = uint64(n["vsn"].(int64))
+		c.Fingerprint = uint64(n["fingerprint"].(int64))
+	}
+}
+func (c *Negotiate) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "negotiate",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "fingerprint",
+			},
+		},
+	}
+}
+
+// NegotiateReply carries the schema version of the session, the
+// latest one, and the network schema, encoded with its codec
+type NegotiateReply struct {
+	VSN         uint64
+	LatestVSN   uint64
+	Fingerprint uint64
+	Encoded     []byte
+}
+
+func (c *NegotiateReply) Is(m map[string]interface{}) bool {
+	_, ok := m["negotiateReply"]
+	return ok
+}
+func (c *NegotiateReply) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"negotiateReply": map[string]interface{}{
+			"vsn":         int64(c.VSN),
+			"latestVsn":   int64(c.LatestVSN),
+			"fingerprint": int64(c.Fingerprint),
+			"encoded":     c.Encoded,
+		},
+	}
+}
+func (c *NegotiateReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		rsp := m["negotiateReply"].(map[string]interface{})
+		c.VSN = uint64(rsp["vsn"].(int64))
+		c.LatestVSN = uint64(rsp["latestVsn"].(int64))
+		c.Fingerprint = uint64(rsp["fingerprint"].(int64))
+		c.Encoded = rsp["encoded"].([]byte)
+	}
+}
+func (c *NegotiateReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "negotiateReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "latestVsn",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "fingerprint",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "encoded",
+			},
+		},
+	}
+}
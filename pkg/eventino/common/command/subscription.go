@@ -0,0 +1,247 @@
+package command
+
+type SubscribeEntity struct {
+	Type string
+	ID   []byte
+	VSN  uint64
+}
+
+func (c *SubscribeEntity) Is(m map[string]interface{}) bool {
+	_, ok := m["subscribeEntity"]
+	return ok
+}
+func (c *SubscribeEntity) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"subscribeEntity": map[string]interface{}{
+			"type": c.Type,
+			"id":   c.ID,
+			"vsn":  int64(c.VSN),
+		},
+	}
+}
+func (c *SubscribeEntity) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		se := m["subscribeEntity"].(map[string]interface{})
+		c.Type = se["type"].(string)
+		c.ID = se["id"].([]byte)
+		c.VSN = uint64(se["vsn"].(int64))
+	}
+}
+func (c *SubscribeEntity) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "subscribeEntity",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "type",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "id",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+		},
+	}
+}
+
+// Subscribed is the reply to a subscription: the events are
+// then delivered as entity_event data, tagged with the subscription
+type Subscribed struct {
+	Subscription int64
+}
+
+func (c *Subscribed) Is(m map[string]interface{}) bool {
+	_, ok := m["subscribed"]
+	return ok
+}
+func (c *Subscribed) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"subscribed": map[string]interface{}{
+			"subscription": c.Subscription,
+		},
+	}
+}
+func (c *Subscribed) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Subscription = m["subscribed"].(map[string]interface{})["subscription"].(int64)
+	}
+}
+func (c *Subscribed) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "subscribed",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "subscription",
+			},
+		},
+	}
+}
+
+type Unsubscribe struct {
+	Subscription int64
+}
+
+func (c *Unsubscribe) Is(m map[string]interface{}) bool {
+	_, ok := m["unsubscribe"]
+	return ok
+}
+func (c *Unsubscribe) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"unsubscribe": map[string]interface{}{
+			"subscription": c.Subscription,
+		},
+	}
+}
+func (c *Unsubscribe) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		c.Subscription = m["unsubscribe"].(map[string]interface{})["subscription"].(int64)
+	}
+}
+func (c *Unsubscribe) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "unsubscribe",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "subscription",
+			},
+		},
+	}
+}
+
+// SubscriptionEnded is pushed when the server ends a subscription,
+// e.g. on an event the schema of the client has no type for
+type SubscriptionEnded struct {
+	Subscription int64
+	Error        string
+}
+
+func (c *SubscriptionEnded) Is(m map[string]interface{}) bool {
+	_, ok := m["subscriptionEnded"]
+	return ok
+}
+func (c *SubscriptionEnded) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"subscriptionEnded": map[string]interface{}{
+			"subscription": c.Subscription,
+			"error":        c.Error,
+		},
+	}
+}
+func (c *SubscriptionEnded) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		m1 := m["subscriptionEnded"].(map[string]interface{})
+		c.Subscription = m1["subscription"].(int64)
+		c.Error = m1["error"].(string)
+	}
+}
+func (c *SubscriptionEnded) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "subscriptionEnded",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "subscription",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "error",
+			},
+		},
+	}
+}
+
+// SubscribeType subscribes to the events of an entity type matching
+// the filter. Since and Until are unix nanoseconds, 0 when unset.
+// After is the encoded log position to resume from, empty to read
+// the whole log
+type SubscribeType struct {
+	Type      string
+	EventName string
+	MatchVSN  bool
+	EventVSN  uint64
+	Since     int64
+	Until     int64
+	Predicate string
+	After     []byte
+}
+
+func (c *SubscribeType) Is(m map[string]interface{}) bool {
+	_, ok := m["subscribeType"]
+	return ok
+}
+func (c *SubscribeType) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"subscribeType": map[string]interface{}{
+			"type":      c.Type,
+			"event":     c.EventName,
+			"match_vsn": c.MatchVSN,
+			"event_vsn": int64(c.EventVSN),
+			"since":     c.Since,
+			"until":     c.Until,
+			"predicate": c.Predicate,
+			"after":     c.After,
+		},
+	}
+}
+func (c *SubscribeType) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		st := m["subscribeType"].(map[string]interface{})
+		c.Type = st["type"].(string)
+		c.EventName = st["event"].(string)
+		c.MatchVSN = st["match_vsn"].(bool)
+		c.EventVSN = uint64(st["event_vsn"].(int64))
+		c.Since = st["since"].(int64)
+		c.Until = st["until"].(int64)
+		c.Predicate = st["predicate"].(string)
+		c.After = st["after"].([]byte)
+	}
+}
+func (c *SubscribeType) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "subscribeType",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "type",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "event",
+			},
+			map[string]interface{}{
+				"type": "boolean",
+				"name": "match_vsn",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "event_vsn",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "since",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "until",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "predicate",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "after",
+			},
+		},
+	}
+}
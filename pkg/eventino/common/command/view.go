@@ -0,0 +1,205 @@
+package command
+
+type RegisterView struct {
+	Type   string
+	Name   string
+	Script string
+}
+
+func (c *RegisterView) Is(m map[string]interface{}) bool {
+	_, ok := m["registerView"]
+	return ok
+}
+func (c *RegisterView) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"registerView": map[string]interface{}{
+			"type":   c.Type,
+			"name":   c.Name,
+			"script": c.Script,
+		},
+	}
+}
+func (c *RegisterView) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		rv := m["registerView"].(map[string]interface{})
+		c.Type = rv["type"].(string)
+		c.Name = rv["name"].(string)
+		c.Script = rv["script"].(string)
+	}
+}
+func (c *RegisterView) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "registerView",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "type",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "name",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "script",
+			},
+		},
+	}
+}
+
+// LoadView loads a view state. When MinPos is set, the read waits
+// until the server has committed that position
+type LoadView struct {
+	Type   string
+	ID     []byte
+	Name   string
+	MinPos []byte
+}
+
+func (c *LoadView) Is(m map[string]interface{}) bool {
+	_, ok := m["loadView"]
+	return ok
+}
+func (c *LoadView) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"loadView": map[string]interface{}{
+			"type":    c.Type,
+			"id":      c.ID,
+			"name":    c.Name,
+			"min_pos": c.MinPos,
+		},
+	}
+}
+func (c *LoadView) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		lv := m["loadView"].(map[string]interface{})
+		c.Type = lv["type"].(string)
+		c.ID = lv["id"].([]byte)
+		c.Name = lv["name"].(string)
+		c.MinPos = lv["min_pos"].([]byte)
+	}
+}
+func (c *LoadView) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "loadView",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "type",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "id",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "name",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "min_pos",
+			},
+		},
+	}
+}
+
+// LoadViewReply carries the view state encoded as JSON
+type LoadViewReply struct {
+	VSN   uint64
+	State []byte
+}
+
+func (c *LoadViewReply) Is(m map[string]interface{}) bool {
+	_, ok := m["loadViewReply"]
+	return ok
+}
+func (c *LoadViewReply) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"loadViewReply": map[string]interface{}{
+			"vsn":   int64(c.VSN),
+			"state": c.State,
+		},
+	}
+}
+func (c *LoadViewReply) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		lv := m["loadViewReply"].(map[string]interface{})
+		c.VSN = uint64(lv["vsn"].(int64))
+		c.State = lv["state"].([]byte)
+	}
+}
+func (c *LoadViewReply) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "loadViewReply",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+			map[string]interface{}{
+				"type": "bytes",
+				"name": "state",
+			},
+		},
+	}
+}
+
+// RegisterUpcaster registers a javascript upcaster
+// of an event type, from version VSN to VSN+1
+type RegisterUpcaster struct {
+	Type   string
+	Event  string
+	VSN    uint64
+	Script string
+}
+
+func (c *RegisterUpcaster) Is(m map[string]interface{}) bool {
+	_, ok := m["registerUpcaster"]
+	return ok
+}
+func (c *RegisterUpcaster) Encode() map[string]interface{} {
+	return map[string]interface{}{
+		"registerUpcaster": map[string]interface{}{
+			"type":   c.Type,
+			"event":  c.Event,
+			"vsn":    int64(c.VSN),
+			"script": c.Script,
+		},
+	}
+}
+func (c *RegisterUpcaster) Decode(m map[string]interface{}) {
+	if c.Is(m) {
+		ru := m["registerUpcaster"].(map[string]interface{})
+		c.Type = ru["type"].(string)
+		c.Event = ru["event"].(string)
+		c.VSN = uint64(ru["vsn"].(int64))
+		c.Script = ru["script"].(string)
+	}
+}
+func (c *RegisterUpcaster) AvroSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "record",
+		"name": "registerUpcaster",
+		"fields": []map[string]interface{}{
+			map[string]interface{}{
+				"type": "string",
+				"name": "type",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "event",
+			},
+			map[string]interface{}{
+				"type": "long",
+				"name": "vsn",
+			},
+			map[string]interface{}{
+				"type": "string",
+				"name": "script",
+			},
+		},
+	}
+}
@@ -2,6 +2,8 @@ package common
 
 import (
 	"encoding/json"
+	"io"
+	"strings"
 
 	"github.com/cheng81/eventino/pkg/eventino/common/command"
 	"github.com/linkedin/goavro"
@@ -23,6 +25,46 @@ func init() {
 		map[string]interface{}{"type": "boolean"},
 		map[string]interface{}{"type": "string"},
 		map[string]interface{}{"type": "long"},
+		// the union branches are indexed on the wire:
+		// new members are appended, never inserted
+		new(command.VersionConflictResponse).AvroSchema(),
+		new(command.CreateEntityReply).AvroSchema(),
+		new(command.PutReply).AvroSchema(),
+		new(command.PutManyReply).AvroSchema(),
+		new(command.RegisterView).AvroSchema(),
+		new(command.LoadView).AvroSchema(),
+		new(command.LoadViewReply).AvroSchema(),
+		new(command.SubscribeEntity).AvroSchema(),
+		new(command.SubscribeType).AvroSchema(),
+		new(command.Subscribed).AvroSchema(),
+		new(command.Unsubscribe).AvroSchema(),
+		new(command.CreateConsumer).AvroSchema(),
+		new(command.ListConsumersReply).AvroSchema(),
+		new(command.ResetConsumer).AvroSchema(),
+		new(command.DeleteConsumer).AvroSchema(),
+		new(command.Consume).AvroSchema(),
+		new(command.Ack).AvroSchema(),
+		new(command.Commit).AvroSchema(),
+		new(command.CommitReply).AvroSchema(),
+		new(command.Replicate).AvroSchema(),
+		new(command.ReplicaEvent).AvroSchema(),
+		new(command.CreateType).AvroSchema(),
+		new(command.UpdateType).AvroSchema(),
+		new(command.UpdateTypeReply).AvroSchema(),
+		new(command.DeleteType).AvroSchema(),
+		new(command.UpdateEntityEventType).AvroSchema(),
+		new(command.UpdateEventTypeReply).AvroSchema(),
+		new(command.SetCompatibility).AvroSchema(),
+		new(command.RegisterUpcaster).AvroSchema(),
+		new(command.ApplySchema).AvroSchema(),
+		new(command.ApplySchemaReply).AvroSchema(),
+		new(command.SchemaHistory).AvroSchema(),
+		new(command.SchemaHistoryReply).AvroSchema(),
+		new(command.ExportSchema).AvroSchema(),
+		new(command.ExportSchemaReply).AvroSchema(),
+		new(command.Negotiate).AvroSchema(),
+		new(command.NegotiateReply).AvroSchema(),
+		new(command.SubscriptionEnded).AvroSchema(),
 	}
 
 	var err error
@@ -44,3 +86,9 @@ func makeCodec(scm []map[string]interface{}) (*goavro.Codec, error) {
 	}
 	return goavro.NewCodec(string(schema))
 }
+
+// Incomplete is true if the decoding error is due to a message
+// not entirely read yet, rather than to a malformed one
+func Incomplete(err error) bool {
+	return err == io.ErrShortBuffer || strings.Contains(err.Error(), io.ErrShortBuffer.Error())
+}
@@ -0,0 +1,224 @@
+package eventino
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cheng81/eventino/internal/eventino/consumer"
+	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/dgraph-io/badger"
+)
+
+// Consumer is a named, durable reader of the events of an entity type,
+// see Eventino.Consume
+type Consumer = consumer.Consumer
+
+// ConsumerSubscription delivers the events of a consumer, starting
+// after its committed offset. Delivery is at-least-once: the events
+// delivered but not committed are delivered again by the next Consume
+type ConsumerSubscription interface {
+	Subscription
+	// Ack marks the event at the given position as processed
+	Ack(position EventID) error
+	// Commit persists the offset of the consumer: the position of the
+	// last event such that it and every event delivered before it were
+	// acknowledged. Returns the committed offset
+	Commit() (EventID, error)
+}
+
+// ConsumerBusyError is returned when a consumer is already being consumed
+var ConsumerBusyError error
+
+// NotDeliveredError is returned when acknowledging an
+// event that was not delivered by the subscription
+var NotDeliveredError error
+
+func init() {
+	ConsumerBusyError = errors.New("Consumer busy")
+	NotDeliveredError = errors.New("Event not delivered")
+}
+
+func (e *eventino) CreateConsumer(name, entName string, filter SubscriptionFilter) error {
+	if _, ok := e.loadedSchema().Entities[entName]; !ok {
+		return errors.New("entity-type-not-found")
+	}
+	// fail early on bad predicates
+	if _, err := filter.Compile(); err != nil {
+		return err
+	}
+	return e.hub.Update(func(txn *badger.Txn) error {
+		return consumer.Create(txn, Consumer{Name: name, EntityType: entName, Filter: filter})
+	})
+}
+
+func (e *eventino) ListConsumers() (out []Consumer, err error) {
+	err = e.db.View(func(txn *badger.Txn) (err error) {
+		out, err = consumer.List(txn)
+		return
+	})
+	return
+}
+
+// ResetConsumer moves the offset of a consumer that is not being consumed
+func (e *eventino) ResetConsumer(name string, offset EventID) error {
+	return e.withIdleConsumer(name, func() error {
+		return e.hub.Update(func(txn *badger.Txn) error {
+			return consumer.Reset(txn, name, offset)
+		})
+	})
+}
+
+// DeleteConsumer deletes a consumer that is not being consumed
+func (e *eventino) DeleteConsumer(name string) error {
+	return e.withIdleConsumer(name, func() error {
+		return e.hub.Update(func(txn *badger.Txn) error {
+			return consumer.Delete(txn, name)
+		})
+	})
+}
+
+// Consume subscribes to the events of the consumer after its committed
+// offset. A consumer can be consumed by one subscription at a time
+func (e *eventino) Consume(name string) (ConsumerSubscription, error) {
+	if !e.acquireConsumer(name) {
+		return nil, ConsumerBusyError
+	}
+	var c Consumer
+	err := e.db.View(func(txn *badger.Txn) (err error) {
+		c, err = consumer.Get(txn, name)
+		return
+	})
+	var entFilter entity.Filter
+	if err == nil {
+		entFilter, err = c.Filter.Compile()
+	}
+	typ, ok := e.loadedSchema().Entities[c.EntityType]
+	if err == nil && !ok {
+		err = errors.New("entity-type-not-found")
+	}
+	if err != nil {
+		e.releaseConsumer(name)
+		return nil, err
+	}
+	sub := &consumerSubscription{
+		e:     e,
+		name:  name,
+		sub:   entity.SubscribeType(e.hub, typ, entFilter, c.Offset, subscriptionBuffer),
+		out:   make(chan SubscriptionEvent),
+		done:  make(chan struct{}),
+		acked: map[EventID]bool{},
+	}
+	go sub.run()
+	return sub, nil
+}
+
+func (e *eventino) acquireConsumer(name string) bool {
+	e.consumersMu.Lock()
+	defer e.consumersMu.Unlock()
+	if e.consumers[name] {
+		return false
+	}
+	e.consumers[name] = true
+	return true
+}
+
+func (e *eventino) releaseConsumer(name string) {
+	e.consumersMu.Lock()
+	defer e.consumersMu.Unlock()
+	delete(e.consumers, name)
+}
+
+func (e *eventino) withIdleConsumer(name string, fn func() error) error {
+	if !e.acquireConsumer(name) {
+		return ConsumerBusyError
+	}
+	defer e.releaseConsumer(name)
+	return fn()
+}
+
+// consumerSubscription tracks the delivered events,
+// in order, and the acknowledged ones
+type consumerSubscription struct {
+	e    *eventino
+	name string
+	sub  *entity.Subscription
+	out  chan SubscriptionEvent
+	done chan struct{}
+	once sync.Once
+
+	mu        sync.Mutex
+	delivered []EventID
+	acked     map[EventID]bool
+}
+
+func (s *consumerSubscription) run() {
+	defer close(s.out)
+	for evt := range s.sub.Events() {
+		s.mu.Lock()
+		s.delivered = append(s.delivered, evt.Position)
+		s.mu.Unlock()
+		select {
+		case s.out <- evt:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *consumerSubscription) Events() <-chan SubscriptionEvent {
+	return s.out
+}
+
+func (s *consumerSubscription) Err() error {
+	return s.sub.Err()
+}
+
+// Close ends the subscription, the events not committed
+// will be delivered again by the next Consume
+func (s *consumerSubscription) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.sub.Close()
+		s.e.releaseConsumer(s.name)
+	})
+	return nil
+}
+
+func (s *consumerSubscription) Ack(position EventID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the delivered events are all in the partition of the entity type
+	for _, delivered := range s.delivered {
+		if delivered.Timestamp == position.Timestamp && delivered.Index == position.Index {
+			s.acked[delivered] = true
+			return nil
+		}
+	}
+	return NotDeliveredError
+}
+
+func (s *consumerSubscription) Commit() (EventID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for n < len(s.delivered) && s.acked[s.delivered[n]] {
+		n++
+	}
+	var c Consumer
+	err := s.e.hub.Update(func(txn *badger.Txn) (err error) {
+		if n == 0 {
+			c, err = consumer.Get(txn, s.name)
+			return
+		}
+		c, err = consumer.Commit(txn, s.name, s.delivered[n-1])
+		return
+	})
+	if err != nil {
+		return EventID{}, err
+	}
+	for _, position := range s.delivered[:n] {
+		delete(s.acked, position)
+	}
+	s.delivered = s.delivered[n:]
+	return c.Offset, nil
+}
@@ -0,0 +1,35 @@
+package eventino
+
+import (
+	"github.com/cheng81/eventino/internal/eventino/log"
+)
+
+// EncodeOffset encodes a log position for the wire,
+// the zero EventID as empty bytes
+func EncodeOffset(offset EventID) []byte {
+	if offset == (EventID{}) {
+		return []byte{}
+	}
+	return offset.Encode()
+}
+
+// DecodeOffset decodes a log position read from the wire,
+// empty bytes as the zero EventID
+func DecodeOffset(b []byte) (offset EventID, err error) {
+	if len(b) > 0 {
+		err = log.DecodeEventID(b, &offset)
+	}
+	return
+}
+
+// EncodeFilterTimes returns the Since and Until bounds of the filter
+// as unix nanoseconds, 0 when unset
+func EncodeFilterTimes(filter SubscriptionFilter) (since, until int64) {
+	if !filter.Since.IsZero() {
+		since = filter.Since.UnixNano()
+	}
+	if !filter.Until.IsZero() {
+		until = filter.Until.UnixNano()
+	}
+	return
+}
@@ -0,0 +1,362 @@
+package eventino
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+
+	ieventino "github.com/cheng81/eventino/internal/eventino"
+	"github.com/cheng81/eventino/internal/eventino/consumer"
+	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/cheng81/eventino/internal/eventino/log"
+	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/dgraph-io/badger"
+)
+
+// LogEvent is an event of the log, as streamed from a leader to its followers
+type LogEvent = log.Event
+
+// Leader streams its log to the followers
+type Leader interface {
+	// StreamLog delivers the log events after the given positions, the latest
+	// event of each partition on the follower: first the events of the schema
+	// partition, then the ones of the other partitions, then the new events
+	// as they are committed
+	StreamLog(positions []EventID) LogStream
+}
+
+// LogStream delivers log events, see Leader.StreamLog
+type LogStream interface {
+	Events() <-chan LogEvent
+	Err() error
+	Close()
+}
+
+// Follower is an Eventino replicating the log of a leader:
+// it serves reads, and rejects writes with ReadOnlyError.
+// A follower can be the leader of other followers
+type Follower interface {
+	Eventino
+	Leader
+	// Positions returns the latest replicated event of every partition:
+	// the events of a partition are replicated in key order, which
+	// is their commit order on the leader, see OutOfOrderError
+	Positions() ([]EventID, error)
+	// Replicate applies an event streamed by the leader,
+	// the events already replicated are skipped
+	Replicate(evt LogEvent) error
+}
+
+// ReadOnlyError is returned by the writes on a Follower
+var ReadOnlyError error
+
+// OutOfOrderError is returned when replicating an event
+// before the latest replicated one of its partition
+var OutOfOrderError error
+
+func init() {
+	ReadOnlyError = errors.New("Read only, writes go to the leader")
+	OutOfOrderError = errors.New("Event out of order, a later one is already replicated")
+}
+
+// replicaBuffer bounds the events queued for a follower
+const replicaBuffer = 1024
+
+func (e *eventino) StreamLog(positions []EventID) LogStream {
+	s := &logStream{out: make(chan LogEvent), done: make(chan struct{})}
+	go s.run(e.hub, positions)
+	return s
+}
+
+type logStream struct {
+	out  chan LogEvent
+	done chan struct{}
+	once sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+func (s *logStream) Events() <-chan LogEvent {
+	return s.out
+}
+
+// Err returns the reason the stream stopped,
+// once the events channel is closed
+func (s *logStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *logStream) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *logStream) Close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *logStream) run(hub *log.Hub, positions []EventID) {
+	defer close(s.out)
+	after := map[uint8]EventID{}
+	for _, position := range positions {
+		after[position.Prefix] = position
+	}
+	w, err := hub.ViewWatchAll(replicaBuffer, func(txn *badger.Txn) error {
+		prefixes, err := log.Partitions(txn)
+		if err != nil {
+			return err
+		}
+		// the schema first, so that the follower can decode the entities
+		sort.SliceStable(prefixes, func(i, j int) bool {
+			return prefixes[i] == schema.Partition() && prefixes[j] != schema.Partition()
+		})
+		for _, prefix := range prefixes {
+			if err = s.catchUp(txn, prefix, after[prefix]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	defer w.Close()
+	for evt := range w.Events() {
+		if !s.send(evt) {
+			return
+		}
+	}
+	s.fail(w.Err())
+}
+
+// catchUp sends the events of a partition after the given position
+func (s *logStream) catchUp(txn *badger.Txn, prefix uint8, after EventID) error {
+	from := log.NewEventID(prefix, after.Timestamp, after.Index)
+	to := log.NewEventID(prefix, math.MaxUint64, math.MaxUint16)
+	for {
+		evts, next, err := log.RangeScope(txn, log.Partition(prefix), from, to, replicaBuffer)
+		if err != nil {
+			return err
+		}
+		for _, evt := range evts {
+			if evt.ID == after {
+				continue
+			}
+			if !s.send(evt) {
+				return log.WatcherClosedError
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		from = *next
+	}
+}
+
+func (s *logStream) send(evt LogEvent) bool {
+	select {
+	case s.out <- evt:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// NewFollower returns a Follower on the given db, the log
+// (schema included) is replicated with Replicate
+func NewFollower(db *badger.DB, factory schema.SchemaFactory) (Follower, error) {
+	e, err := newEventino(db, factory)
+	if err != nil {
+		return nil, err
+	}
+	return &follower{e}, nil
+}
+
+type follower struct {
+	*eventino
+}
+
+func (f *follower) Positions() (positions []EventID, err error) {
+	err = f.db.View(func(txn *badger.Txn) (err error) {
+		positions, err = log.Positions(txn)
+		return
+	})
+	return
+}
+
+func (f *follower) Replicate(evt LogEvent) error {
+	err := f.hub.Update(func(txn *badger.Txn) error {
+		// after a reconnection, the leader might stream
+		// again the latest events
+		if _, err := log.Get(txn, evt.ID); err == nil {
+			return nil
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		// the leader commits the events of a partition in key order
+		// (see log.Hub.UpdatePosition), and Positions resumes after
+		// the latest one: an earlier event would never be streamed again
+		latest, ok, err := log.Position(txn, evt.ID.Prefix)
+		if err != nil {
+			return err
+		}
+		if ok && evt.ID.Before(latest) {
+			return OutOfOrderError
+		}
+		if err := log.Replicate(txn, evt); err != nil {
+			return err
+		}
+		if err := item.Replicate(txn, evt); err != nil {
+			return err
+		}
+		return f.sync(txn, evt)
+	})
+	if err != nil {
+		return err
+	}
+	// the schema and the scripts are loaded in memory
+	switch evt.Meta {
+	case ieventino.EventKindSchema:
+		return f.reloadSchema()
+	case ieventino.EventKindScript:
+		return f.loadScripts()
+	}
+	return nil
+}
+
+// sync updates the state the leader updates along its writes:
+// the persistent views of the entities and the consumers
+func (f *follower) sync(txn *badger.Txn, evt LogEvent) error {
+	if evt.Meta != ieventino.EventKindEntity && evt.Meta != ieventino.EventKindConsumer {
+		return nil
+	}
+	idEvt, err := item.FromLogEvent(evt)
+	if err != nil {
+		return err
+	}
+	if evt.Meta == ieventino.EventKindConsumer {
+		return consumer.Sync(txn, idEvt.ID)
+	}
+	// the entity item ID is the entity type name, ':' and the entity ID
+	sep := bytes.IndexByte(idEvt.ID.ID, ':')
+	if sep < 0 {
+		return nil
+	}
+	entName := string(idEvt.ID.ID[:sep])
+	if len(f.views.Names(entName)) == 0 {
+		return nil
+	}
+	scm, err := schema.LatestSchema(txn, f.factory.Decoder())
+	if err != nil {
+		return err
+	}
+	typ, ok := scm.Entities[entName]
+	if !ok {
+		return schema.EntityTypeNotFound
+	}
+	return f.views.Sync(txn, typ, idEvt.ID.ID[sep+1:])
+}
+
+// reloadSchema loads the latest schema replicated,
+// while the sessions read it, see loadedSchema
+func (f *follower) reloadSchema() error {
+	return f.db.View(func(txn *badger.Txn) error {
+		scm, err := schema.LatestSchema(txn, f.factory.Decoder())
+		if err != nil {
+			return err
+		}
+		f.scmMu.Lock()
+		f.scm = &scm
+		f.scmMu.Unlock()
+		return nil
+	})
+}
+
+func (f *follower) CreateEntityType(name string) (uint64, error) {
+	return 0, ReadOnlyError
+}
+
+func (f *follower) CreateEventType(entName, name string, specs interface{}) (uint64, error) {
+	return 0, ReadOnlyError
+}
+
+func (f *follower) UpdateEventType(entName, name string, specs interface{}) (uint64, uint64, error) {
+	return 0, 0, ReadOnlyError
+}
+
+func (f *follower) SetCompatibility(entName, evtName string, c Compatibility) (uint64, error) {
+	return 0, ReadOnlyError
+}
+
+func (f *follower) CreateType(name string, specs interface{}) (uint64, error) {
+	return 0, ReadOnlyError
+}
+
+func (f *follower) UpdateType(name string, specs interface{}) (uint64, uint64, error) {
+	return 0, 0, ReadOnlyError
+}
+
+func (f *follower) DeleteType(name string) (uint64, error) {
+	return 0, ReadOnlyError
+}
+
+func (f *follower) ApplySchema(spec []byte, dryRun bool) (uint64, []string, error) {
+	return 0, nil, ReadOnlyError
+}
+
+func (f *follower) NewEntity(entName string, entID []byte) (EventID, error) {
+	return EventID{}, ReadOnlyError
+}
+
+func (f *follower) Put(entName string, entID []byte, expected ExpectedVSN, evtIDenc string, evt interface{}) (uint64, EventID, error) {
+	return 0, EventID{}, ReadOnlyError
+}
+
+func (f *follower) PutMany(entName string, entID []byte, expected ExpectedVSN, evts []entity.EntityEvent) ([]uint64, EventID, error) {
+	return nil, EventID{}, ReadOnlyError
+}
+
+// RegisterUpcaster fails: the upcasters are registered on the
+// leader, its javascript ones are replicated
+func (f *follower) RegisterUpcaster(entName, evtName string, vsn uint64, up Upcaster) error {
+	return ReadOnlyError
+}
+
+func (f *follower) RegisterScriptUpcaster(entName, evtName string, vsn uint64, src string) error {
+	return ReadOnlyError
+}
+
+// RegisterView fails: the views are registered on the
+// leader, its javascript ones are replicated
+func (f *follower) RegisterView(entName, viewName string, view entity.PersistentViewFold, initial interface{}) error {
+	return ReadOnlyError
+}
+
+func (f *follower) RegisterScriptView(entName, viewName, src string) error {
+	return ReadOnlyError
+}
+
+func (f *follower) CreateConsumer(name, entName string, filter SubscriptionFilter) error {
+	return ReadOnlyError
+}
+
+func (f *follower) ResetConsumer(name string, offset EventID) error {
+	return ReadOnlyError
+}
+
+func (f *follower) DeleteConsumer(name string) error {
+	return ReadOnlyError
+}
+
+// Consume fails: committing the consumer offsets is a write
+func (f *follower) Consume(name string) (ConsumerSubscription, error) {
+	return nil, ReadOnlyError
+}
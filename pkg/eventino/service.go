@@ -3,15 +3,24 @@ package eventino
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/internal/eventino/entity/script"
+	"github.com/cheng81/eventino/internal/eventino/item"
+	"github.com/cheng81/eventino/internal/eventino/log"
 
 	"github.com/cheng81/eventino/internal/eventino/schema"
+	"github.com/cheng81/eventino/internal/eventino/scripts"
+	"github.com/cheng81/eventino/pkg/eventino/common"
 
 	"github.com/dgraph-io/badger"
 )
 
 type Eventino interface {
+	// LoadSchema returns the network schema of a version, the latest if
+	// above it. The writes use the latest version loaded
 	LoadSchema(vsn uint64) (uint64, []byte, error)
 	SchemaVSN() (uint64, error)
 
@@ -20,27 +29,252 @@ type Eventino interface {
 	// GetEntityType(name string, vsn uint64) (schema.EntityType, error)
 
 	CreateEventType(entName, name string, specs interface{}) (uint64, error)
-	// UpdateEventType(entName, name string, specs schema.DataSchema) (uint64, uint64, error)
+	// UpdateEventType returns the schema and the new event type versions,
+	// or an IncompatibleSchemaError if the update breaks its Compatibility
+	UpdateEventType(entName, name string, specs interface{}) (uint64, uint64, error)
+	// SetCompatibility sets the compatibility of the event type,
+	// or the default one of the entity type if evtName is empty
+	SetCompatibility(entName, evtName string, c Compatibility) (uint64, error)
 	// GetEventType(entName, name string, vsn uint64) (schema.DataSchema, error)
 	// DeleteEventType(entName, name string) (uint64, error)
 
-	NewEntity(entName string, entID []byte) error
-	Put(entName string, entID []byte, evtIDenc string, evt interface{}) (uint64, error)
-	GetEntity(entName string, entID []byte, vsn uint64) (entity.Entity, error)
+	// named record and enum types, referred by the event types specs
+	// as {"Ref": {"typename": "<name>_<vsn>"}}
+	CreateType(name string, specs interface{}) (uint64, error)
+	UpdateType(name string, specs interface{}) (uint64, uint64, error)
+	DeleteType(name string) (uint64, error)
+
+	// SchemaHistory returns the schema changes after the from version,
+	// up to the to version (the latest if 0)
+	SchemaHistory(fromVsn, toVsn uint64) ([]SchemaChange, error)
+	// DiffSchema returns the difference between two schema versions,
+	// from 0 being the empty schema and to 0 the latest one
+	DiffSchema(fromVsn, toVsn uint64) (SchemaDiff, error)
+
+	// ApplySchema applies a JSON schema spec (see schema.SchemaSpec)
+	// in a single transaction, and returns the planned changes.
+	// With dryRun, the changes are only planned
+	ApplySchema(spec []byte, dryRun bool) (uint64, []string, error)
+
+	// ExportSchema returns the standalone avro schemas (.avsc) of the
+	// network protocol at a schema version, for the non-Go clients
+	// (see common.ProtocolFiles). Needs the avro schema factory
+	ExportSchema(vsn uint64) (uint64, []SchemaFile, error)
+
+	// writes return the position of their last event, as a consistency token
+	// to be passed to the reads as minPos (see ReadTimeout).
+	// Payloads not valid for their event type fail with an InvalidPayloadError
+	NewEntity(entName string, entID []byte) (EventID, error)
+	Put(entName string, entID []byte, expected ExpectedVSN, evtIDenc string, evt interface{}) (uint64, EventID, error)
+	PutMany(entName string, entID []byte, expected ExpectedVSN, evts []entity.EntityEvent) ([]uint64, EventID, error)
+	GetEntity(entName string, entID []byte, vsn uint64, minPos EventID) (entity.Entity, error)
+	// GetEntityAt presents the entity events at the given versions, see RegisterUpcaster
+	GetEntityAt(entName string, entID []byte, vsn uint64, minPos EventID, versions Versions) (entity.Entity, error)
+
+	// RegisterUpcaster registers the upcaster of an event type, from version vsn to vsn+1
+	RegisterUpcaster(entName, evtName string, vsn uint64, up Upcaster) error
+	RegisterScriptUpcaster(entName, evtName string, vsn uint64, src string) error
+
+	RegisterView(entName, viewName string, view entity.PersistentViewFold, initial interface{}) error
+	RegisterScriptView(entName, viewName, src string) error
+	GetView(entName string, entID []byte, viewName string, minPos EventID) (uint64, interface{}, error)
+
+	SubscribeEntity(entName string, entID []byte, fromVsn uint64) (Subscription, error)
+	SubscribeType(entName string, filter SubscriptionFilter, after EventID) (Subscription, error)
+
+	CreateConsumer(name, entName string, filter SubscriptionFilter) error
+	ListConsumers() ([]Consumer, error)
+	ResetConsumer(name string, offset EventID) error
+	DeleteConsumer(name string) error
+	Consume(name string) (ConsumerSubscription, error)
+}
+
+// Subscription delivers entity events: first the
+// ones already stored, then the new ones as they are written
+type Subscription interface {
+	Events() <-chan SubscriptionEvent
+	Err() error
+	Close() error
+}
+
+// SubscriptionEvent is an event delivered by a Subscription.
+// Its Position can be used to resume a type subscription
+type SubscriptionEvent = entity.SubscriptionEvent
+
+// EventID is a position in the log
+type EventID = log.EventID
+
+// SubscriptionFilter selects the events delivered by SubscribeType.
+// The zero SubscriptionFilter matches every event
+type SubscriptionFilter = script.Filter
+
+// ReadTimeout bounds how long a read waits for its minPos to be
+// committed - e.g. on a follower lagging behind its leader - before
+// failing with StaleReadError
+const ReadTimeout = 2 * time.Second
+
+// StaleReadError is returned by the reads whose minPos is not reached in time
+var StaleReadError error
+
+func init() {
+	StaleReadError = errors.New("Stale read, min position not reached")
+}
+
+// Upcaster transforms the payload of an event type version
+// into the payload of the next version
+type Upcaster = entity.Upcaster
+
+// Versions selects the versions the events are presented at.
+// The zero Versions presents the events as they were written
+type Versions = entity.Versions
+
+// Compatibility is checked on the event type updates. The default is CompatibilityNone
+type Compatibility = schema.Compatibility
+
+const (
+	CompatibilityNone     = schema.CompatibilityNone
+	CompatibilityBackward = schema.CompatibilityBackward
+	CompatibilityForward  = schema.CompatibilityForward
+	CompatibilityFull     = schema.CompatibilityFull
+)
+
+// IncompatibleSchemaError reports the schema resolution rules broken by an update
+type IncompatibleSchemaError = schema.IncompatibleSchemaError
+
+// ValidationError is a value not valid for its schema, e.g. address.zip: expected string, got int64
+type ValidationError = schema.ValidationError
+
+// InvalidPayloadError is returned when putting events whose payload
+// is not valid for the event type, with all its validation errors
+type InvalidPayloadError = schema.InvalidPayloadError
+
+// SchemaChange is a schema event, with the schema version it produced
+type SchemaChange = schema.SchemaChange
+
+// SchemaDiff is the difference between two schema versions,
+// down to the fields of the event types
+type SchemaDiff = schema.SchemaDiff
+
+// SchemaFile is an exported avro schema, with its fingerprint
+type SchemaFile = common.SchemaFile
+
+// the conversions of the logical type values to the ones they are
+// stored and sent as, and back: the clients put the stored values
+var (
+	ToTimestampMillis   = schema.ToTimestampMillis
+	FromTimestampMillis = schema.FromTimestampMillis
+	ToTimestampMicros   = schema.ToTimestampMicros
+	FromTimestampMicros = schema.FromTimestampMicros
+	ToDateDays          = schema.ToDateDays
+	FromDateDays        = schema.FromDateDays
+	ToDecimalBytes      = schema.ToDecimalBytes
+	FromDecimalBytes    = schema.FromDecimalBytes
+)
+
+// subscriptionBuffer bounds the events queued for a subscriber
+const subscriptionBuffer = 128
+
+// ExpectedVSN is the version an entity is expected to be at when
+// putting events: an exact version, AnyVSN or NotExistsVSN.
+// Writes on an entity at a different version fail with a
+// VersionConflictError
+type ExpectedVSN = item.ExpectedVSN
+
+// VersionConflictError is returned by Put and PutMany when
+// the entity is not at the expected version
+type VersionConflictError = item.VersionConflictError
+
+const (
+	// AnyVSN skips the version check
+	AnyVSN = item.AnyVSN
+	// NotExistsVSN creates the entity, failing if it exists
+	NotExistsVSN = item.NotExistsVSN
+)
+
+// ExactVSN expects the entity latest event to be at the given version
+func ExactVSN(vsn uint64) ExpectedVSN {
+	return item.ExactVSN(vsn)
 }
 
-func NewEventino(db *badger.DB, factory schema.SchemaFactory) Eventino {
+func NewEventino(db *badger.DB, factory schema.SchemaFactory) (Eventino, error) {
+	e, err := newEventino(db, factory)
+	if err != nil {
+		return nil, err
+	}
 	// init schema if necessary
-	_ = db.Update(func(txn *badger.Txn) error {
-		return schema.EnsureSchema(txn)
+	if err = db.Update(schema.EnsureSchema); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func newEventino(db *badger.DB, factory schema.SchemaFactory) (*eventino, error) {
+	// new events must come after the ones in the store
+	if err := db.View(log.SeedClock); err != nil {
+		return nil, err
+	}
+	e := &eventino{db: db, hub: log.NewHub(db), factory: factory, views: entity.NewViews(), upcasters: entity.NewUpcasters(), consumers: map[string]bool{}}
+	if err := e.loadScripts(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// loadScripts registers back the scripts registered over the wire
+func (e *eventino) loadScripts() error {
+	var stored []scripts.Script
+	err := e.db.View(func(txn *badger.Txn) (err error) {
+		stored, err = scripts.List(txn)
+		return
 	})
-	return &eventino{db: db, factory: factory}
+	if err != nil {
+		return err
+	}
+	for _, s := range stored {
+		switch s.Kind {
+		case scripts.KindView:
+			view, initial, err := script.NewView(s.Source)
+			if err != nil {
+				return fmt.Errorf("view %s of %s: %s", s.Name, s.EntityType, err)
+			}
+			e.views.Register(s.EntityType, s.Name, view, initial)
+		case scripts.KindUpcaster:
+			up, err := script.NewUpcaster(s.Source)
+			if err != nil {
+				return fmt.Errorf("upcaster %s_%d of %s: %s", s.Name, s.VSN, s.EntityType, err)
+			}
+			e.upcasters.Register(s.EntityType, s.Name, s.VSN, up)
+		}
+	}
+	return nil
 }
 
 type eventino struct {
-	db      *badger.DB
+	db  *badger.DB
+	hub *log.Hub
+	// scm is the latest schema loaded, see loadedSchema
+	scmMu   sync.RWMutex
 	scm     *schema.Schema
 	factory schema.SchemaFactory
+	// views are the persistent views of this instance
+	views *entity.Views
+	// upcasters are the upcasters of this instance
+	upcasters *entity.Upcasters
+
+	// consumers are the consumers being consumed
+	consumersMu sync.Mutex
+	consumers   map[string]bool
+}
+
+// loadedSchema returns the latest schema loaded, replaced
+// by LoadSchema while the other calls read it
+func (e *eventino) loadedSchema() *schema.Schema {
+	e.scmMu.RLock()
+	defer e.scmMu.RUnlock()
+	if e.scm == nil {
+		return &schema.Schema{}
+	}
+	return e.scm
 }
 
 func (e *eventino) SchemaVSN() (uint64, error) {
@@ -61,20 +295,38 @@ func (e *eventino) LoadSchema(vsn uint64) (loadedVsn uint64, encoded []byte, err
 		if scm, err = schema.GetSchema(txn, vsn, dec); err != nil {
 			return
 		}
-		e.scm = &scm
+		// the writes use the latest schema loaded, which has every
+		// event version: loading an older one only encodes it
+		e.scmMu.Lock()
+		if e.scm == nil || scm.VSN >= e.scm.VSN {
+			e.scm = &scm
+		}
+		e.scmMu.Unlock()
+		loadedVsn = scm.VSN
+		encoded = e.factory.EncodeNetwork(&scm)
+		return
+	})
+	return
+}
+
+func (e *eventino) ExportSchema(vsn uint64) (loadedVsn uint64, files []SchemaFile, err error) {
+	dec := e.factory.Decoder()
+	var scm schema.Schema
+	err = e.db.View(func(txn *badger.Txn) (err error) {
+		scm, err = schema.GetSchema(txn, vsn, dec)
 		return
 	})
 	if err != nil {
 		return
 	}
-	loadedVsn = e.scm.VSN
-	encoded = e.factory.EncodeNetwork(e.scm)
+	loadedVsn = scm.VSN
+	files, err = common.ProtocolFiles(loadedVsn, e.factory.EncodeNetwork(&scm))
 	return
 }
 
 func (e *eventino) CreateEntityType(name string) (vsn uint64, err error) {
 	dec := e.factory.Decoder()
-	err = e.db.Update(func(txn *badger.Txn) (err error) {
+	err = e.hub.Update(func(txn *badger.Txn) (err error) {
 		if err = schema.CreateEntityType(txn, dec, name); err != nil {
 			return
 		}
@@ -87,13 +339,25 @@ func (e *eventino) CreateEntityType(name string) (vsn uint64, err error) {
 	return
 }
 
-func (e *eventino) CreateEventType(entName, name string, specsNative interface{}) (vsn uint64, err error) {
+// decodeSpecs decodes the data schema specs, resolving
+// the named types referred with the latest schema
+func (e *eventino) decodeSpecs(txn *badger.Txn, specsNative interface{}) (specs schema.DataSchema, err error) {
 	dec := e.factory.Decoder()
-	var specs schema.DataSchema
-	if specs, err = dec.DecodeNative(specsNative); err != nil {
-		return 0, err
+	var latest schema.Schema
+	if latest, err = schema.LatestSchema(txn, dec); err != nil {
+		return
 	}
-	err = e.db.Update(func(txn *badger.Txn) (err error) {
+	specs, err = dec.WithTypes(latest).DecodeNative(specsNative)
+	return
+}
+
+func (e *eventino) CreateEventType(entName, name string, specsNative interface{}) (vsn uint64, err error) {
+	dec := e.factory.Decoder()
+	err = e.hub.Update(func(txn *badger.Txn) (err error) {
+		var specs schema.DataSchema
+		if specs, err = e.decodeSpecs(txn, specsNative); err != nil {
+			return
+		}
 		if err = schema.CreateEntityEventType(txn, entName, name, specs); err != nil {
 			return
 		}
@@ -106,39 +370,307 @@ func (e *eventino) CreateEventType(entName, name string, specsNative interface{}
 	return
 }
 
-func (e *eventino) NewEntity(entName string, entID []byte) error {
-	typ, ok := e.scm.Entities[entName]
+func (e *eventino) UpdateEventType(entName, name string, specsNative interface{}) (vsn uint64, evtVsn uint64, err error) {
+	dec := e.factory.Decoder()
+	err = e.hub.Update(func(txn *badger.Txn) (err error) {
+		var specs schema.DataSchema
+		if specs, err = e.decodeSpecs(txn, specsNative); err != nil {
+			return
+		}
+		if evtVsn, err = schema.UpdateEventType(txn, entName, name, specs); err != nil {
+			return
+		}
+		vsn, err = schema.SchemaVSN(txn, dec)
+		return
+	})
+	return
+}
+
+func (e *eventino) SetCompatibility(entName, evtName string, c Compatibility) (vsn uint64, err error) {
+	dec := e.factory.Decoder()
+	err = e.hub.Update(func(txn *badger.Txn) (err error) {
+		if err = schema.SetCompatibility(txn, dec, entName, evtName, c); err != nil {
+			return
+		}
+		vsn, err = schema.SchemaVSN(txn, dec)
+		return
+	})
+	return
+}
+
+func (e *eventino) CreateType(name string, specsNative interface{}) (vsn uint64, err error) {
+	dec := e.factory.Decoder()
+	err = e.hub.Update(func(txn *badger.Txn) (err error) {
+		var specs schema.DataSchema
+		if specs, err = e.decodeSpecs(txn, specsNative); err != nil {
+			return
+		}
+		if err = schema.CreateType(txn, name, specs); err != nil {
+			return
+		}
+		vsn, err = schema.SchemaVSN(txn, dec)
+		return
+	})
+	return
+}
+
+func (e *eventino) UpdateType(name string, specsNative interface{}) (vsn uint64, typeVsn uint64, err error) {
+	dec := e.factory.Decoder()
+	err = e.hub.Update(func(txn *badger.Txn) (err error) {
+		var specs schema.DataSchema
+		if specs, err = e.decodeSpecs(txn, specsNative); err != nil {
+			return
+		}
+		if typeVsn, err = schema.UpdateType(txn, name, specs); err != nil {
+			return
+		}
+		vsn, err = schema.SchemaVSN(txn, dec)
+		return
+	})
+	return
+}
+
+func (e *eventino) DeleteType(name string) (vsn uint64, err error) {
+	dec := e.factory.Decoder()
+	err = e.hub.Update(func(txn *badger.Txn) (err error) {
+		if err = schema.DeleteType(txn, dec, name); err != nil {
+			return
+		}
+		vsn, err = schema.SchemaVSN(txn, dec)
+		return
+	})
+	return
+}
+
+func (e *eventino) SchemaHistory(fromVsn, toVsn uint64) (out []SchemaChange, err error) {
+	err = e.db.View(func(txn *badger.Txn) (err error) {
+		out, err = schema.History(txn, fromVsn, toVsn)
+		return
+	})
+	return
+}
+
+func (e *eventino) DiffSchema(fromVsn, toVsn uint64) (out SchemaDiff, err error) {
+	dec := e.factory.Decoder()
+	err = e.db.View(func(txn *badger.Txn) (err error) {
+		out, err = schema.DiffSchema(txn, dec, fromVsn, toVsn)
+		return
+	})
+	return
+}
+
+func (e *eventino) ApplySchema(specJSON []byte, dryRun bool) (vsn uint64, plan []string, err error) {
+	dec := e.factory.Decoder()
+	var spec schema.SchemaSpec
+	if spec, err = schema.ParseSchemaSpec(specJSON); err != nil {
+		return
+	}
+	err = e.hub.Update(func(txn *badger.Txn) (err error) {
+		var latest schema.Schema
+		if latest, err = schema.LatestSchema(txn, dec); err != nil {
+			return
+		}
+		var changes []schema.Change
+		if changes, err = schema.Plan(latest, dec, spec); err != nil {
+			return
+		}
+		plan = make([]string, len(changes))
+		for i, c := range changes {
+			plan[i] = c.String()
+		}
+		if !dryRun {
+			if err = schema.Apply(txn, dec, changes); err != nil {
+				return
+			}
+		}
+		vsn, err = schema.SchemaVSN(txn, dec)
+		return
+	})
+	return
+}
+
+func (e *eventino) NewEntity(entName string, entID []byte) (EventID, error) {
+	typ, ok := e.loadedSchema().Entities[entName]
 	if !ok {
-		return errors.New("entity-type-not-found")
+		return EventID{}, errors.New("entity-type-not-found")
 	}
-	return e.db.Update(func(txn *badger.Txn) error {
+	return e.hub.UpdatePosition(func(txn *badger.Txn) error {
 		return entity.NewEntity(txn, typ, entID)
 	})
 }
 
-func (e *eventino) Put(entName string, entID []byte, evtIDenc string, evt interface{}) (uint64, error) {
-	typ, ok := e.scm.Entities[entName]
+func (e *eventino) Put(entName string, entID []byte, expected ExpectedVSN, evtIDenc string, evt interface{}) (uint64, EventID, error) {
+	typ, ok := e.loadedSchema().Entities[entName]
 	if !ok {
-		return 0, errors.New("entity-type-not-found")
+		return 0, EventID{}, errors.New("entity-type-not-found")
 	}
 	evtID := schema.EventSchemaIDFromString(evtIDenc)
 	var vsn uint64
-	err := e.db.Update(func(txn *badger.Txn) (err error) {
-		vsn, err = entity.Put(txn, typ, entID, evtID, evt)
+	pos, err := e.hub.UpdatePosition(func(txn *badger.Txn) (err error) {
+		if vsn, err = entity.Put(txn, typ, entID, expected, evtID, evt); err != nil {
+			return
+		}
+		err = e.views.Sync(txn, typ, entID)
 		return
 	})
-	return vsn, err
+	return vsn, pos, err
 }
 
-func (e *eventino) GetEntity(entName string, entID []byte, vsn uint64) (entity.Entity, error) {
-	typ, ok := e.scm.Entities[entName]
+func (e *eventino) PutMany(entName string, entID []byte, expected ExpectedVSN, evts []entity.EntityEvent) ([]uint64, EventID, error) {
+	typ, ok := e.loadedSchema().Entities[entName]
+	if !ok {
+		return nil, EventID{}, errors.New("entity-type-not-found")
+	}
+	var vsns []uint64
+	pos, err := e.hub.UpdatePosition(func(txn *badger.Txn) (err error) {
+		if vsns, _, err = entity.PutMany(txn, typ, entID, expected, evts); err != nil {
+			return
+		}
+		err = e.views.Sync(txn, typ, entID)
+		return
+	})
+	return vsns, pos, err
+}
+
+// waitFor blocks until minPos is committed. The zero EventID does not wait
+func (e *eventino) waitFor(minPos EventID) error {
+	if minPos == (EventID{}) {
+		return nil
+	}
+	err := e.hub.WaitFor(minPos, ReadTimeout)
+	if err == log.PositionTimeoutError {
+		return StaleReadError
+	}
+	return err
+}
+
+func (e *eventino) GetEntity(entName string, entID []byte, vsn uint64, minPos EventID) (entity.Entity, error) {
+	return e.GetEntityAt(entName, entID, vsn, minPos, Versions{})
+}
+
+func (e *eventino) GetEntityAt(entName string, entID []byte, vsn uint64, minPos EventID, versions Versions) (entity.Entity, error) {
+	typ, ok := e.loadedSchema().Entities[entName]
 	if !ok {
 		return entity.Entity{}, errors.New("entity-type-not-found")
 	}
+	if err := e.waitFor(minPos); err != nil {
+		return entity.Entity{}, err
+	}
 	var ent entity.Entity
 	err := e.db.View(func(txn *badger.Txn) (err error) {
-		ent, err = entity.Get(txn, typ, entID, vsn)
+		ent, err = entity.GetAt(txn, e.upcasters, typ, entID, vsn, versions)
 		return
 	})
 	return ent, err
 }
+
+// RegisterUpcaster registers the upcaster of the event type, from version
+// vsn to vsn+1. The Go upcasters are not stored: they are to be registered on every start
+func (e *eventino) RegisterUpcaster(entName, evtName string, vsn uint64, up Upcaster) error {
+	if _, ok := e.loadedSchema().Entities[entName]; !ok {
+		return errors.New("entity-type-not-found")
+	}
+	e.upcasters.Register(entName, evtName, vsn, up)
+	return nil
+}
+
+// RegisterScriptUpcaster registers a javascript upcaster, see script.NewUpcaster.
+// The script is stored, and registered back on start
+func (e *eventino) RegisterScriptUpcaster(entName, evtName string, vsn uint64, src string) error {
+	up, err := script.NewUpcaster(src)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.loadedSchema().Entities[entName]; !ok {
+		return errors.New("entity-type-not-found")
+	}
+	err = e.hub.Update(func(txn *badger.Txn) error {
+		return scripts.Put(txn, scripts.Script{Kind: scripts.KindUpcaster, EntityType: entName, Name: evtName, VSN: vsn, Source: src})
+	})
+	if err != nil {
+		return err
+	}
+	e.upcasters.Register(entName, evtName, vsn, up)
+	return nil
+}
+
+// RegisterView registers a persistent view on the entity type,
+// updated on every Put and PutMany. The Go views are not stored:
+// they are to be registered on every start
+func (e *eventino) RegisterView(entName, viewName string, view entity.PersistentViewFold, initial interface{}) error {
+	if _, ok := e.loadedSchema().Entities[entName]; !ok {
+		return errors.New("entity-type-not-found")
+	}
+	e.views.Register(entName, viewName, view, initial)
+	return nil
+}
+
+// RegisterScriptView registers a javascript persistent view on the
+// entity type. The script is stored, and registered back on start
+func (e *eventino) RegisterScriptView(entName, viewName, src string) error {
+	view, initial, err := script.NewView(src)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.loadedSchema().Entities[entName]; !ok {
+		return errors.New("entity-type-not-found")
+	}
+	err = e.hub.Update(func(txn *badger.Txn) error {
+		return scripts.Put(txn, scripts.Script{Kind: scripts.KindView, EntityType: entName, Name: viewName, Source: src})
+	})
+	if err != nil {
+		return err
+	}
+	e.views.Register(entName, viewName, view, initial)
+	return nil
+}
+
+func (e *eventino) GetView(entName string, entID []byte, viewName string, minPos EventID) (uint64, interface{}, error) {
+	typ, ok := e.loadedSchema().Entities[entName]
+	if !ok {
+		return 0, nil, errors.New("entity-type-not-found")
+	}
+	if err := e.waitFor(minPos); err != nil {
+		return 0, nil, err
+	}
+	var vsn uint64
+	var state interface{}
+	err := e.db.View(func(txn *badger.Txn) (err error) {
+		vsn, state, err = e.views.Get(txn, typ, entID, viewName)
+		return
+	})
+	return vsn, state, err
+}
+
+func (e *eventino) SubscribeEntity(entName string, entID []byte, fromVsn uint64) (Subscription, error) {
+	typ, ok := e.loadedSchema().Entities[entName]
+	if !ok {
+		return nil, errors.New("entity-type-not-found")
+	}
+	sub, err := entity.Subscribe(e.hub, typ, entID, fromVsn, subscriptionBuffer)
+	if err != nil {
+		return nil, err
+	}
+	return subscription{sub}, nil
+}
+
+type subscription struct {
+	*entity.Subscription
+}
+
+func (s subscription) Close() error {
+	s.Subscription.Close()
+	return nil
+}
+
+func (e *eventino) SubscribeType(entName string, filter SubscriptionFilter, after EventID) (Subscription, error) {
+	typ, ok := e.loadedSchema().Entities[entName]
+	if !ok {
+		return nil, errors.New("entity-type-not-found")
+	}
+	entFilter, err := filter.Compile()
+	if err != nil {
+		return nil, err
+	}
+	return subscription{entity.SubscribeType(e.hub, typ, entFilter, after, subscriptionBuffer)}, nil
+}
@@ -1,16 +1,27 @@
 package eventino
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	ieventino "github.com/cheng81/eventino/internal/eventino"
+	"github.com/cheng81/eventino/internal/eventino/consumer"
+	"github.com/cheng81/eventino/internal/eventino/entity"
+	"github.com/cheng81/eventino/internal/eventino/schema"
 	"github.com/cheng81/eventino/internal/eventino/schema/schemaavro"
+	"github.com/cheng81/eventino/internal/eventino/schema/schemajson"
+	"github.com/cheng81/eventino/pkg/eventino/common"
 
 	"github.com/dgraph-io/badger"
+	"github.com/linkedin/goavro"
 )
 
 func DirSize(path string) (int64, error) {
@@ -47,9 +58,35 @@ func withTempDB(fn func(*badger.DB) error) error {
 	return nil
 }
 
+// publishesScript fails unless fn publishes a script event to the
+// live watchers of the log, e.g. to the followers
+func publishesScript(t *testing.T, e Eventino, fn func() error) {
+	w, err := e.(*eventino).hub.ViewWatchAll(10, func(txn *badger.Txn) error { return nil })
+	if err != nil {
+		t.Fatal("cannot watch", err)
+	}
+	defer w.Close()
+	if err = fn(); err != nil {
+		t.Fatal("cannot register", err)
+	}
+	for {
+		select {
+		case evt := <-w.Events():
+			if evt.Meta == ieventino.EventKindScript {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no script event published")
+		}
+	}
+}
+
 func TestCreateEntType(t *testing.T) {
 	withTempDB(func(db *badger.DB) (err error) {
-		evt := NewEventino(db, schemaavro.Factory())
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
 		vsn, err := evt.CreateEntityType("foo")
 		if err != nil {
 			t.Fatal("should not fail on create an entity type")
@@ -68,3 +105,1120 @@ func TestCreateEntType(t *testing.T) {
 		return
 	})
 }
+
+func TestPutMany(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		f := schemaavro.Factory()
+		rec := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", rec.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		created := func(name interface{}) entity.EntityEvent {
+			return entity.EntityEvent{Type: entity.EntityEventType{Name: "created", VSN: 0}, Payload: map[string]interface{}{"Name": name}}
+		}
+		vsns, pos, err := evt.PutMany("user", []byte("u1"), NotExistsVSN, []entity.EntityEvent{created("a"), created("b"), created("c")})
+		if err != nil {
+			t.Fatal("cannot put many", err)
+		}
+		if len(vsns) != 3 || vsns[0] != 1 || vsns[2] != 3 {
+			t.Fatal("wrong versions", vsns)
+		}
+
+		// an invalid event fails the whole batch
+		if _, _, err = evt.PutMany("user", []byte("u1"), ExactVSN(3), []entity.EntityEvent{created("d"), created(42)}); err == nil {
+			t.Fatal("should not put an invalid event")
+		}
+		// so does a version conflict
+		if _, _, err = evt.PutMany("user", []byte("u1"), ExactVSN(2), []entity.EntityEvent{created("d")}); err == nil {
+			t.Fatal("should not put on a stale version")
+		} else if _, ok := err.(VersionConflictError); !ok {
+			t.Fatal("should be a version conflict", err)
+		}
+
+		ent, err := evt.GetEntity("user", []byte("u1"), 100, pos)
+		if err != nil {
+			t.Fatal("cannot get entity", err)
+		}
+		if ent.VSN != 3 || len(ent.Events) != 3 {
+			t.Fatal("only the first batch should be stored", ent.VSN, ent.Events)
+		}
+		for i, name := range []string{"a", "b", "c"} {
+			if ent.Events[i].Payload.(map[string]interface{})["Name"] != name {
+				t.Fatal("wrong event", i, ent.Events[i])
+			}
+			// the events of a batch share the log timestamp
+			if !ent.Events[i].Timestamp.Equal(ent.Events[0].Timestamp) {
+				t.Fatal("the batch should be written at once", ent.Events)
+			}
+		}
+		return nil
+	})
+}
+
+func TestScriptView(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		f := schemaavro.Factory()
+		rec := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", rec.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		src := `({created_0: function(acc, evt, vsn) { acc['names'] = (acc['names'] || '') + evt['Name']; return acc; }})`
+		publishesScript(t, evt, func() error {
+			return evt.RegisterScriptView("user", "names", src)
+		})
+		names := func(e Eventino) interface{} {
+			_, state, err := e.GetView("user", []byte("u1"), "names", EventID{})
+			if err != nil {
+				t.Fatal("cannot get view", err)
+			}
+			return state.(map[string]interface{})["names"]
+		}
+		if _, _, err = evt.Put("user", []byte("u1"), AnyVSN, "created_0", map[string]interface{}{"Name": "a"}); err != nil {
+			t.Fatal("cannot put", err)
+		}
+
+		// restart: the view is registered back, and still updated
+		restarted, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot restart eventino", err)
+		}
+		if _, _, err = restarted.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		if _, _, err = restarted.Put("user", []byte("u1"), AnyVSN, "created_0", map[string]interface{}{"Name": "b"}); err != nil {
+			t.Fatal("cannot put", err)
+		}
+		if n := names(restarted); n != "ab" {
+			t.Fatal("the view should be updated after a restart", n)
+		}
+
+		// the views of a db are not registered on another
+		withTempDB(func(other *badger.DB) error {
+			otherEvt, err := NewEventino(other, schemaavro.Factory())
+			if err != nil {
+				t.Fatal("cannot start eventino", err)
+			}
+			if _, err = otherEvt.CreateEntityType("user"); err != nil {
+				t.Fatal("cannot create entity type", err)
+			}
+			if _, _, err = otherEvt.LoadSchema(100); err != nil {
+				t.Fatal("cannot load schema", err)
+			}
+			if _, _, err = otherEvt.GetView("user", []byte("u1"), "names", EventID{}); err != entity.ViewNotFound {
+				t.Fatal("the view should not be registered on another db", err)
+			}
+			return nil
+		})
+		return nil
+	})
+}
+
+func TestUpcaster(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		f := schemaavro.Factory()
+		rec := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", rec.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		if _, _, err = evt.Put("user", []byte("u1"), AnyVSN, "created_0", map[string]interface{}{"Name": "a"}); err != nil {
+			t.Fatal("cannot put", err)
+		}
+		rec = f.NewRecord().SetName("created").
+			SetField("Name", f.SimpleType(schema.String)).
+			SetField("Plan", f.SimpleType(schema.String)).ToDataSchema()
+		if _, _, err = evt.UpdateEventType("user", "created", rec.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot update event type", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		publishesScript(t, evt, func() error {
+			return evt.RegisterScriptUpcaster("user", "created", 0, `(function(p) { return {Name: p.Name, Plan: "free"}; })`)
+		})
+		plan := func(e Eventino) interface{} {
+			ent, err := e.GetEntityAt("user", []byte("u1"), 0, EventID{}, Versions{Latest: true})
+			if err != nil {
+				t.Fatal("cannot get upcasted entity", err)
+			}
+			if ent.Events[0].Type.VSN != 1 {
+				t.Fatal("the event should be upcasted", ent.Events[0])
+			}
+			return ent.Events[0].Payload.(map[string]interface{})["Plan"]
+		}
+		if p := plan(evt); p != "free" {
+			t.Fatal("wrong upcasted payload", p)
+		}
+
+		// restart: the upcaster is registered back
+		restarted, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot restart eventino", err)
+		}
+		if _, _, err = restarted.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		if p := plan(restarted); p != "free" {
+			t.Fatal("the upcaster should be registered after a restart", p)
+		}
+
+		// the Go upcasters are kept per instance
+		if err = restarted.RegisterUpcaster("user", "created", 0, func(p interface{}) (interface{}, error) {
+			return map[string]interface{}{"Name": p.(map[string]interface{})["Name"], "Plan": "paying"}, nil
+		}); err != nil {
+			t.Fatal("cannot register upcaster", err)
+		}
+		if p := plan(restarted); p != "paying" {
+			t.Fatal("the Go upcaster should replace the script one", p)
+		}
+		if p := plan(evt); p != "free" {
+			t.Fatal("the upcasters of an instance should not leak to another", p)
+		}
+		return nil
+	})
+}
+
+func TestConsumer(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		f := schemaavro.Factory()
+		rec := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", rec.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		for _, name := range []string{"a", "b", "c"} {
+			if _, _, err = evt.Put("user", []byte(name), AnyVSN, "created_0", map[string]interface{}{"Name": name}); err != nil {
+				t.Fatal("cannot put", err)
+			}
+		}
+		if err = evt.CreateConsumer("mailer", "user", SubscriptionFilter{}); err != nil {
+			t.Fatal("cannot create consumer", err)
+		}
+		if err = evt.CreateConsumer("mailer", "user", SubscriptionFilter{}); err != consumer.ConsumerExists {
+			t.Fatal("should not create the consumer twice", err)
+		}
+
+		next := func(sub ConsumerSubscription) SubscriptionEvent {
+			select {
+			case evt := <-sub.Events():
+				return evt
+			case <-time.After(2 * time.Second):
+				t.Fatal("no event delivered", sub.Err())
+			}
+			return SubscriptionEvent{}
+		}
+		sub, err := evt.Consume("mailer")
+		if err != nil {
+			t.Fatal("cannot consume", err)
+		}
+		if _, err = evt.Consume("mailer"); err != ConsumerBusyError {
+			t.Fatal("should not consume twice", err)
+		}
+		a, b, c := next(sub), next(sub), next(sub)
+		if string(c.ID) != "c" {
+			t.Fatal("wrong event", c)
+		}
+		// b is not acknowledged: only a is committed
+		if err = sub.Ack(a.Position); err != nil {
+			t.Fatal("cannot ack", err)
+		}
+		if err = sub.Ack(c.Position); err != nil {
+			t.Fatal("cannot ack", err)
+		}
+		offset, err := sub.Commit()
+		if err != nil {
+			t.Fatal("cannot commit", err)
+		}
+		if offset != a.Position {
+			t.Fatal("should commit a", offset, a.Position)
+		}
+		sub.Close()
+
+		consumers, err := evt.ListConsumers()
+		if err != nil || len(consumers) != 1 || consumers[0].Offset != a.Position {
+			t.Fatal("wrong consumers", consumers, err)
+		}
+
+		// b and c are delivered again
+		if sub, err = evt.Consume("mailer"); err != nil {
+			t.Fatal("cannot consume again", err)
+		}
+		if redelivered := next(sub); redelivered.Position != b.Position {
+			t.Fatal("should deliver b again", redelivered)
+		}
+		if redelivered := next(sub); redelivered.Position != c.Position {
+			t.Fatal("should deliver c again", redelivered)
+		}
+		if err = evt.ResetConsumer("mailer", EventID{}); err != ConsumerBusyError {
+			t.Fatal("should not reset a consumer being consumed", err)
+		}
+		sub.Close()
+
+		if err = evt.DeleteConsumer("mailer"); err != nil {
+			t.Fatal("cannot delete consumer", err)
+		}
+		if _, err = evt.Consume("mailer"); err != consumer.ConsumerNotFound {
+			t.Fatal("consumer should be deleted", err)
+		}
+		return nil
+	})
+}
+
+func TestFollower(t *testing.T) {
+	withTempDB(func(leaderDB *badger.DB) (err error) {
+		return withTempDB(func(followerDB *badger.DB) (err error) {
+			leader, err := NewEventino(leaderDB, schemaavro.Factory())
+			if err != nil {
+				t.Fatal("cannot start eventino", err)
+			}
+			if _, err = leader.CreateEntityType("user"); err != nil {
+				t.Fatal("cannot create entity type", err)
+			}
+			f := schemaavro.Factory()
+			rec := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+			if _, err = leader.CreateEventType("user", "created", rec.EncodeSchemaNative()); err != nil {
+				t.Fatal("cannot create event type", err)
+			}
+			if _, _, err = leader.LoadSchema(100); err != nil {
+				t.Fatal("cannot load schema", err)
+			}
+			put := func(name string) EventID {
+				_, pos, err := leader.Put("user", []byte("a"), AnyVSN, "created_0", map[string]interface{}{"Name": name})
+				if err != nil {
+					t.Fatal("cannot put", err)
+				}
+				return pos
+			}
+			put("a0")
+
+			follower, err := NewFollower(followerDB, schemaavro.Factory())
+			if err != nil {
+				t.Fatal("cannot start eventino", err)
+			}
+			// replicate n events, from the latest replicated ones
+			replicate := func(n int) {
+				positions, err := follower.Positions()
+				if err != nil {
+					t.Fatal("cannot read positions", err)
+				}
+				stream := leader.(Leader).StreamLog(positions)
+				defer stream.Close()
+				for i := 0; i < n; i++ {
+					select {
+					case evt := <-stream.Events():
+						if err = follower.Replicate(evt); err != nil {
+							t.Fatal("cannot replicate", err)
+						}
+					case <-time.After(2 * time.Second):
+						t.Fatal("no event streamed", i, stream.Err())
+					}
+				}
+			}
+			// schema: created, entity type, event type - entity: a0.
+			// The follower loads the replicated schema
+			replicate(4)
+			ent, err := follower.GetEntity("user", []byte("a"), 100, EventID{})
+			if err != nil || len(ent.Events) != 1 {
+				t.Fatal("wrong replicated entity", ent, err)
+			}
+			if _, _, err = follower.Put("user", []byte("a"), AnyVSN, "created_0", map[string]interface{}{"Name": "x"}); err != ReadOnlyError {
+				t.Fatal("follower should reject writes", err)
+			}
+			if err = follower.RegisterScriptView("user", "names", `({})`); err != ReadOnlyError {
+				t.Fatal("follower should reject script views", err)
+			}
+			if err = follower.RegisterScriptUpcaster("user", "created", 0, `(function(p) { return p; })`); err != ReadOnlyError {
+				t.Fatal("follower should reject script upcasters", err)
+			}
+			positions, err := follower.Positions()
+			if err != nil || len(positions) == 0 {
+				t.Fatal("cannot read positions", positions, err)
+			}
+			late := LogEvent{ID: EventID{Prefix: positions[0].Prefix, Timestamp: positions[0].Timestamp - 1}}
+			if err = follower.Replicate(late); err != OutOfOrderError {
+				t.Fatal("an event before the latest replicated one should be rejected", err)
+			}
+
+			// resume after the replicated events: reading at the
+			// position of the write waits for it to be replicated
+			pos := put("a1")
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				time.Sleep(50 * time.Millisecond)
+				replicate(1)
+			}()
+			if ent, err = follower.GetEntity("user", []byte("a"), 100, pos); err != nil || len(ent.Events) != 2 {
+				t.Fatal("wrong resumed entity", ent, err)
+			}
+			<-done
+
+			// a write never replicated
+			pos = put("a2")
+			if _, err = follower.GetEntity("user", []byte("a"), 100, pos); err != StaleReadError {
+				t.Fatal("read should be stale", err)
+			}
+
+			// schema changes, script views and consumers are replicated
+			renamed := f.NewRecord().SetName("renamed").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+			if _, err = leader.CreateEventType("user", "renamed", renamed.EncodeSchemaNative()); err != nil {
+				t.Fatal("cannot create event type", err)
+			}
+			if _, _, err = leader.LoadSchema(100); err != nil {
+				t.Fatal("cannot load schema", err)
+			}
+			src := `({created_0: function(acc, evt, vsn) { acc['names'] = (acc['names'] || '') + evt['Name']; return acc; }})`
+			if err = leader.RegisterScriptView("user", "names", src); err != nil {
+				t.Fatal("cannot register view", err)
+			}
+			if err = leader.CreateConsumer("mailer", "user", SubscriptionFilter{}); err != nil {
+				t.Fatal("cannot create consumer", err)
+			}
+			if _, pos, err = leader.Put("user", []byte("a"), AnyVSN, "renamed_0", map[string]interface{}{"Name": "r"}); err != nil {
+				t.Fatal("cannot put", err)
+			}
+			// a2, event type, view (2), consumer (2), renamed
+			replicate(7)
+			if ent, err = follower.GetEntity("user", []byte("a"), 100, pos); err != nil || len(ent.Events) != 4 {
+				t.Fatal("the follower should know the new event type", ent, err)
+			}
+			_, state, err := follower.GetView("user", []byte("a"), "names", pos)
+			if err != nil || state.(map[string]interface{})["names"] != "a0a1a2" {
+				t.Fatal("wrong replicated view", state, err)
+			}
+			consumers, err := follower.ListConsumers()
+			if err != nil || len(consumers) != 1 || consumers[0].Name != "mailer" {
+				t.Fatal("wrong replicated consumers", consumers, err)
+			}
+			return nil
+		})
+	})
+}
+
+func TestTypes(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		f := schemaavro.Factory()
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		address := f.NewRecord().SetName("address").SetField("street", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateType("address", address.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create type", err)
+		}
+		if _, err = evt.CreateType("address", address.EncodeSchemaNative()); err != schema.TypeExists {
+			t.Fatal("should not create the type twice", err)
+		}
+		if _, err = evt.CreateType("street", f.SimpleType(schema.String).EncodeSchemaNative()); err != schema.InvalidType {
+			t.Fatal("named types should be records or enums", err)
+		}
+
+		created := f.NewRecord().SetName("created").
+			SetField("Name", f.SimpleType(schema.String)).
+			SetField("Address", f.NewRef("address", 0)).
+			ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", created.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type referring to address", err)
+		}
+
+		// v1 adds a field, created_0 still refers to v0
+		address = f.NewRecord().SetName("address").
+			SetField("street", f.SimpleType(schema.String)).
+			SetField("city", f.SimpleType(schema.String)).
+			ToDataSchema()
+		scmVsn, vsn, err := evt.UpdateType("address", address.EncodeSchemaNative())
+		if err != nil || vsn != 1 {
+			t.Fatal("cannot update type", vsn, err)
+		}
+		if latest, _ := evt.SchemaVSN(); scmVsn != latest {
+			t.Fatal("update type should return the schema version", scmVsn, latest)
+		}
+		if _, _, err = evt.UpdateType("address", f.NewEnum("address", "HOME").EncodeSchemaNative()); err != schema.InvalidType {
+			t.Fatal("named types cannot change kind", err)
+		}
+		moved := f.NewRecord().SetName("moved").SetField("Address", f.NewRef("address", 1)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "moved", moved.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type referring to address v1", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+
+		if _, _, err = evt.Put("user", []byte("a"), AnyVSN, "created_0", map[string]interface{}{
+			"Name": "a", "Address": map[string]interface{}{"street": "main st"},
+		}); err != nil {
+			t.Fatal("cannot put created", err)
+		}
+		_, _, err = evt.Put("user", []byte("a"), AnyVSN, "moved_0", map[string]interface{}{
+			"Address": map[string]interface{}{"street": "side st"},
+		})
+		invalid, ok := err.(InvalidPayloadError)
+		if !ok || len(invalid.Errors) != 1 || invalid.Errors[0].String() != "Address: missing required field city" {
+			t.Fatal("address v1 requires a city", err)
+		}
+		if _, _, err = evt.Put("user", []byte("a"), AnyVSN, "moved_0", map[string]interface{}{
+			"Address": map[string]interface{}{"street": "side st", "city": "rome"},
+		}); err != nil {
+			t.Fatal("cannot put moved", err)
+		}
+		ent, err := evt.GetEntity("user", []byte("a"), 0, EventID{})
+		if err != nil || len(ent.Events) != 2 {
+			t.Fatal("cannot get entity", ent, err)
+		}
+		addr := ent.Events[1].Payload.(map[string]interface{})["Address"].(map[string]interface{})
+		if addr["city"] != "rome" {
+			t.Fatal("wrong address", addr)
+		}
+
+		// deleted types cannot be referred anymore,
+		// the event types already referring them still work
+		if _, err = evt.DeleteType("address"); err != nil {
+			t.Fatal("cannot delete type", err)
+		}
+		if _, err = evt.CreateEventType("user", "deleted", created.EncodeSchemaNative()); err != schema.TypeNotFound {
+			t.Fatal("should not refer a deleted type", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema after type deletion", err)
+		}
+		if _, _, err = evt.Put("user", []byte("a"), AnyVSN, "created_0", map[string]interface{}{
+			"Name": "b", "Address": map[string]interface{}{"street": "main st"},
+		}); err != nil {
+			t.Fatal("cannot put created after type deletion", err)
+		}
+
+		// a type created again does not reuse the deleted versions
+		if _, err = evt.CreateType("address", address.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create type again", err)
+		}
+		if _, err = evt.CreateEventType("user", "deleted", created.EncodeSchemaNative()); err != schema.TypeNotFound {
+			t.Fatal("should not refer a deleted version", err)
+		}
+		if _, vsn, err = evt.UpdateType("address", address.EncodeSchemaNative()); err != nil || vsn != 3 {
+			t.Fatal("should update the type created again after the deleted versions", vsn, err)
+		}
+		return nil
+	})
+}
+
+func TestCompatibility(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		f := schemaavro.Factory()
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		v0 := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", v0.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, err = evt.SetCompatibility("user", "missing", CompatibilityFull); err != schema.EventTypeNotFound {
+			t.Fatal("should not set the compatibility of a missing event type", err)
+		}
+		if _, err = evt.SetCompatibility("user", "", CompatibilityBackward); err != nil {
+			t.Fatal("cannot set entity compatibility", err)
+		}
+
+		// a required field cannot be added backward
+		v1 := f.NewRecord().SetName("created").
+			SetField("Name", f.SimpleType(schema.String)).
+			SetField("Age", f.SimpleType(schema.Int64)).
+			ToDataSchema()
+		_, _, err = evt.UpdateEventType("user", "created", v1.EncodeSchemaNative())
+		incompatible, ok := err.(IncompatibleSchemaError)
+		if !ok || len(incompatible.Incompatibilities) != 1 || incompatible.Incompatibilities[0].Path != "$.Age" {
+			t.Fatal("should reject a required field", err)
+		}
+		v1 = f.NewRecord().SetName("created").
+			SetField("Name", f.SimpleType(schema.String)).
+			SetField("Age", f.NewOptional(f.SimpleType(schema.Int64))).
+			ToDataSchema()
+		_, evtVsn, err := evt.UpdateEventType("user", "created", v1.EncodeSchemaNative())
+		if err != nil || evtVsn != 1 {
+			t.Fatal("should accept an optional field", evtVsn, err)
+		}
+
+		// the event type overrides the entity default
+		if _, err = evt.SetCompatibility("user", "created", CompatibilityForward); err != nil {
+			t.Fatal("cannot set event compatibility", err)
+		}
+		if _, _, err = evt.UpdateEventType("user", "created", v0.EncodeSchemaNative()); err != nil {
+			t.Fatal("removing a field should be forward compatible", err)
+		}
+		if _, err = evt.SetCompatibility("user", "created", CompatibilityNone); err != nil {
+			t.Fatal("cannot set event compatibility", err)
+		}
+		_, evtVsn, err = evt.UpdateEventType("user", "created", f.SimpleType(schema.String).EncodeSchemaNative())
+		if err != nil || evtVsn != 3 {
+			t.Fatal("should accept any update", evtVsn, err)
+		}
+		return nil
+	})
+}
+
+func TestFieldOptions(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		f := schemaavro.Factory()
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		v0 := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", v0.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, err = evt.SetCompatibility("user", "", CompatibilityBackward); err != nil {
+			t.Fatal("cannot set entity compatibility", err)
+		}
+
+		// a renamed field, and a required field with a default
+		v1 := f.NewRecord().SetName("created").
+			SetField("FullName", f.SimpleType(schema.String)).
+			SetFieldOptions("FullName", schema.FieldOptions{Doc: "the full name", Aliases: []string{"Name"}}).
+			SetField("Country", f.SimpleType(schema.String)).
+			SetFieldOptions("Country", schema.FieldOptions{Default: "DK"}).
+			ToDataSchema()
+		if _, evtVsn, err := evt.UpdateEventType("user", "created", v1.EncodeSchemaNative()); err != nil || evtVsn != 1 {
+			t.Fatal("should accept a field with a default", evtVsn, err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		if _, _, err = evt.Put("user", []byte("a"), AnyVSN, "created_1", map[string]interface{}{"FullName": "a"}); err != nil {
+			t.Fatal("cannot put created", err)
+		}
+		ent, err := evt.GetEntity("user", []byte("a"), 0, EventID{})
+		if err != nil || len(ent.Events) != 1 {
+			t.Fatal("cannot get entity", ent, err)
+		}
+		if country := ent.Events[0].Payload.(map[string]interface{})["Country"]; country != "DK" {
+			t.Fatal("country should default to DK", country)
+		}
+		return nil
+	})
+}
+
+func TestSchemaCache(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		f := schemaavro.Factory()
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		if _, err = evt.CreateEventType("user", "created", f.SimpleType(schema.String).EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, _, err = evt.UpdateEventType("user", "created", f.SimpleType(schema.String).EncodeSchemaNative()); err != nil {
+				t.Fatal("cannot update event type", err)
+			}
+		}
+
+		// the historical versions are served by the cache
+		dec := f.Decoder()
+		err = db.View(func(txn *badger.Txn) (err error) {
+			for vsn := uint64(1); vsn <= 12; vsn++ {
+				var scm schema.Schema
+				if scm, err = schema.GetSchema(txn, vsn, dec); err != nil {
+					return
+				}
+				if scm.VSN != vsn || len(scm.Entities["user"].Events) != int(vsn)-1 {
+					t.Fatal("wrong schema version", vsn, scm.VSN, len(scm.Entities["user"].Events))
+				}
+			}
+			return
+		})
+		if err != nil {
+			t.Fatal("cannot get schema", err)
+		}
+
+		// a discarded write is not cached
+		db.Update(func(txn *badger.Txn) error {
+			if err := schema.CreateEntityType(txn, dec, "discarded"); err != nil {
+				t.Fatal("cannot create entity type", err)
+			}
+			if vsn, err := schema.SchemaVSN(txn, dec); err != nil || vsn != 13 {
+				t.Fatal("the write should be seen in its transaction", vsn, err)
+			}
+			return errors.New("discard")
+		})
+		if vsn, _ := evt.SchemaVSN(); vsn != 12 {
+			t.Fatal("discarded write should not be in the schema", vsn)
+		}
+
+		// another db has its own schema
+		withTempDB(func(other *badger.DB) error {
+			otherEvt, err := NewEventino(other, schemaavro.Factory())
+			if err != nil {
+				t.Fatal("cannot start eventino", err)
+			}
+			if vsn, err := otherEvt.CreateEntityType("other"); err != nil || vsn != 1 {
+				t.Fatal("cannot create entity type on another db", vsn, err)
+			}
+			return nil
+		})
+		if vsn, err := evt.CreateEntityType("order"); err != nil || vsn != 13 {
+			t.Fatal("cannot create entity type", vsn, err)
+		}
+		if vsn, err := evt.SetCompatibility("user", "created", schema.CompatibilityBackward); err != nil || vsn != 14 {
+			t.Fatal("cannot set compatibility", vsn, err)
+		}
+		return db.View(func(txn *badger.Txn) (err error) {
+			var scm schema.Schema
+			if scm, err = schema.LatestSchema(txn, dec); err != nil {
+				t.Fatal("cannot get schema", err)
+			}
+			if _, ok := scm.Entities["other"]; ok || len(scm.Entities) != 2 {
+				t.Fatal("schema should not have the other db types", scm.Entities)
+			}
+			// the older versions are rebuilt from their changes
+			if scm, err = schema.GetSchema(txn, 13, dec); err != nil {
+				t.Fatal("cannot get schema", err)
+			}
+			user := scm.Entities["user"]
+			if scm.VSN != 13 || len(scm.Entities) != 2 || len(user.Events) != 11 || user.CompatibilityOf("created") != schema.CompatibilityNone {
+				t.Fatal("wrong schema version", scm.VSN, scm.Entities)
+			}
+			if scm, err = schema.GetSchema(txn, 14, dec); err != nil {
+				t.Fatal("cannot get schema", err)
+			}
+			if scm.Entities["user"].CompatibilityOf("created") != schema.CompatibilityBackward {
+				t.Fatal("wrong compatibility", scm.Entities["user"])
+			}
+			return
+		})
+	})
+}
+
+func TestApplySchema(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		spec := `{
+			"records": {
+				"street_address": {"Complex": {"type": {"RECORD": {"name": "street_address", "fields": {"street": {"Simple": "STRING"}}}}}},
+				"profile": {"Complex": {"type": {"RECORD": {"name": "profile", "fields": {"home": {"Ref": {"typename": "street_address_0"}}}}}}}
+			},
+			"enums": {"color": {"Enum": {"name": "color", "values": ["RED", "GREEN"]}}},
+			"entities": {
+				"user": {
+					"compatibility": "BACKWARD",
+					"events": {
+						"created": {"Complex": {"type": {"RECORD": {"name": "created", "fields": {"Name": {"Simple": "STRING"}, "Profile": {"Ref": {"typename": "profile_0"}}}}}}},
+						"painted": {"Ref": {"typename": "color_0"}}
+					}
+				}
+			}
+		}`
+		vsn, plan, err := evt.ApplySchema([]byte(spec), true)
+		if err != nil || vsn != 0 {
+			t.Fatal("cannot plan", vsn, err)
+		}
+		expected := []string{
+			"create enum color",
+			"create record street_address",
+			"create record profile",
+			"create entity user",
+			"set compatibility user BACKWARD",
+			"create event user.created",
+			"create event user.painted",
+		}
+		if fmt.Sprint(plan) != fmt.Sprint(expected) {
+			t.Fatal("wrong plan", plan)
+		}
+		if vsn, _, err = evt.ApplySchema([]byte(spec), false); err != nil || vsn != 7 {
+			t.Fatal("cannot apply", vsn, err)
+		}
+		if vsn, plan, err = evt.ApplySchema([]byte(spec), false); err != nil || vsn != 7 || len(plan) != 0 {
+			t.Fatal("applying again should not change the schema", vsn, plan, err)
+		}
+
+		// a required field cannot be added backward, and nothing is applied
+		required := strings.Replace(spec, `"Name": {"Simple": "STRING"}`, `"Name": {"Simple": "STRING"}, "Age": {"Simple": "LONG"}`, 1)
+		required = strings.Replace(required, `"painted": {"Ref": {"typename": "color_0"}}`, `"deleted": {"Simple": "NULL"}`, 1)
+		if _, _, err = evt.ApplySchema([]byte(required), false); err == nil {
+			t.Fatal("should not apply an incompatible update")
+		}
+		if vsn, _ = evt.SchemaVSN(); vsn != 7 {
+			t.Fatal("a failed apply should not change the schema", vsn)
+		}
+
+		// the types goavro rejects fail the apply
+		invalid := strings.Replace(spec, `"values": ["RED", "GREEN"]`, `"values": ["RED", "RED"]`, 1)
+		if _, _, err = evt.ApplySchema([]byte(invalid), true); err == nil {
+			t.Fatal("should not plan an invalid enum")
+		}
+
+		optional := strings.Replace(spec, `"Name": {"Simple": "STRING"}`, `"Name": {"Simple": "STRING"}, "Age": {"Complex": {"type": {"OPTIONAL": {"type": {"Simple": "LONG"}}}}}`, 1)
+		optional = strings.Replace(optional, `"painted": {"Ref": {"typename": "color_0"}}`, `"deleted": {"Simple": "NULL"}`, 1)
+		optional = strings.Replace(optional, `"enums": {"color": {"Enum": {"name": "color", "values": ["RED", "GREEN"]}}},`, ``, 1)
+		if vsn, plan, err = evt.ApplySchema([]byte(optional), false); err != nil || vsn != 11 {
+			t.Fatal("cannot apply", vsn, plan, err)
+		}
+		expected = []string{
+			"update event user.created",
+			"create event user.deleted",
+			"delete event user.painted",
+			"delete enum color",
+		}
+		if fmt.Sprint(plan) != fmt.Sprint(expected) {
+			t.Fatal("wrong plan", plan)
+		}
+		return nil
+	})
+}
+
+func TestSchemaHistory(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		f := schemaavro.Factory()
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		v0 := f.NewRecord().SetName("created").SetField("Name", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", v0.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, err = evt.CreateEntityType("order"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		v1 := f.NewRecord().SetName("created").
+			SetField("Name", f.SimpleType(schema.String)).
+			SetField("Age", f.NewOptional(f.SimpleType(schema.Int64))).
+			ToDataSchema()
+		if _, _, err = evt.UpdateEventType("user", "created", v1.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot update event type", err)
+		}
+		if _, err = evt.SetCompatibility("user", "created", CompatibilityFull); err != nil {
+			t.Fatal("cannot set compatibility", err)
+		}
+
+		changes, err := evt.SchemaHistory(1, 4)
+		if err != nil {
+			t.Fatal("cannot get history", err)
+		}
+		expected := []string{"2 EVT:CREATED user.created", "3 ENT:CREATED order", "4 EVT:UPDATED user.created"}
+		if len(changes) != len(expected) {
+			t.Fatal("wrong history", changes)
+		}
+		for i, c := range changes {
+			name := c.Entity
+			if c.Name != "" {
+				name += "." + c.Name
+			}
+			if fmt.Sprintf("%d %s %s", c.VSN, c.Type, name) != expected[i] {
+				t.Fatal("wrong change", i, c)
+			}
+			if c.Timestamp.IsZero() || (i > 0 && c.Timestamp.Before(changes[i-1].Timestamp)) {
+				t.Fatal("wrong change timestamp", c)
+			}
+		}
+		if changes, _ = evt.SchemaHistory(4, 0); len(changes) != 1 || changes[0].Type != "COMPAT:SET" || changes[0].Name != "created" {
+			t.Fatal("wrong latest history", changes)
+		}
+
+		diff, err := evt.DiffSchema(2, 0)
+		if err != nil {
+			t.Fatal("cannot diff", err)
+		}
+		if diff.From != 2 || diff.To != 5 || fmt.Sprint(diff.EntitiesAdded) != "[order]" || len(diff.Entities) != 1 {
+			t.Fatal("wrong diff", diff)
+		}
+		user := diff.Entities[0]
+		if len(user.EventsAdded) != 1 || user.EventsAdded[0] != schema.NewEventSchemaID("created", 1) ||
+			len(user.Events) != 1 || len(user.Events[0].Changes) != 1 || user.Events[0].Changes[0].Path != "$.Age" {
+			t.Fatal("wrong user diff", user)
+		}
+		if diff, _ = evt.DiffSchema(0, 1); fmt.Sprint(diff.EntitiesAdded) != "[user]" {
+			t.Fatal("wrong diff from the empty schema", diff)
+		}
+		return nil
+	})
+}
+
+func TestJSONFactory(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemajson.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		f := schemajson.Factory()
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		address := f.NewRecord().SetName("address").SetField("street", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateType("address", address.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create type", err)
+		}
+		created := f.NewRecord().SetName("created").
+			SetField("Name", f.SimpleType(schema.String)).
+			SetField("Address", f.NewRef("address", 0)).
+			ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", created.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, err = evt.SetCompatibility("user", "", CompatibilityBackward); err != nil {
+			t.Fatal("cannot set entity compatibility", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+
+		if _, _, err = evt.Put("user", []byte("a"), AnyVSN, "created_0", map[string]interface{}{
+			"Name": "a",
+		}); err == nil {
+			t.Fatal("the address is required")
+		}
+		if _, _, err = evt.Put("user", []byte("a"), AnyVSN, "created_0", map[string]interface{}{
+			"Name": "a", "Address": map[string]interface{}{"street": "main st"},
+		}); err != nil {
+			t.Fatal("cannot put created", err)
+		}
+		ent, err := evt.GetEntity("user", []byte("a"), 0, EventID{})
+		if err != nil || len(ent.Events) != 1 {
+			t.Fatal("cannot get entity", ent, err)
+		}
+		addr := ent.Events[0].Payload.(map[string]interface{})["Address"].(map[string]interface{})
+		if addr["street"] != "main st" {
+			t.Fatal("wrong address", addr)
+		}
+
+		// a required field cannot be added backward
+		v1 := f.NewRecord().SetName("created").
+			SetField("Name", f.SimpleType(schema.String)).
+			SetField("Address", f.NewRef("address", 0)).
+			SetField("Age", f.SimpleType(schema.Int64)).
+			ToDataSchema()
+		if _, _, err = evt.UpdateEventType("user", "created", v1.EncodeSchemaNative()); err == nil {
+			t.Fatal("should reject a required field")
+		}
+		return nil
+	})
+}
+
+func TestLogicalTypes(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		f := schemaavro.Factory()
+		if _, err = evt.CreateEntityType("order"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		paid := f.NewRecord().SetName("paid").
+			SetField("At", f.SimpleType(schema.TimestampMillis)).
+			SetField("Amount", f.NewDecimal(10, 2)).
+			ToDataSchema()
+		if _, err = evt.CreateEventType("order", "paid", paid.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		if _, _, err = evt.LoadSchema(100); err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		at := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+		if _, _, err = evt.Put("order", []byte("a"), AnyVSN, "paid_0", map[string]interface{}{
+			"At": at, "Amount": big.NewRat(1250, 100),
+		}); err != nil {
+			t.Fatal("cannot put Go native values", err)
+		}
+		if _, _, err = evt.Put("order", []byte("a"), AnyVSN, "paid_0", map[string]interface{}{
+			"At": at, "Amount": "12.505",
+		}); err == nil {
+			t.Fatal("the amount has 2 decimals")
+		}
+		ent, err := evt.GetEntity("order", []byte("a"), 0, EventID{})
+		if err != nil || len(ent.Events) != 1 {
+			t.Fatal("cannot get entity", ent, err)
+		}
+		payload := ent.Events[0].Payload
+		if payload.(map[string]interface{})["At"] != schema.ToTimestampMillis(at) {
+			t.Fatal("timestamps should be stored as millis", payload)
+		}
+		native := paid.GoNative(payload).(map[string]interface{})
+		if native["At"].(time.Time) != at || native["Amount"].(*big.Rat).FloatString(2) != "12.50" {
+			t.Fatal("wrong Go native values", native)
+		}
+		return nil
+	})
+}
+
+func TestExportSchema(t *testing.T) {
+	withTempDB(func(db *badger.DB) (err error) {
+		evt, err := NewEventino(db, schemaavro.Factory())
+		if err != nil {
+			t.Fatal("cannot start eventino", err)
+		}
+		f := schemaavro.Factory()
+		if _, err = evt.CreateEntityType("user"); err != nil {
+			t.Fatal("cannot create entity type", err)
+		}
+		address := f.NewRecord().SetName("address").SetField("street", f.SimpleType(schema.String)).ToDataSchema()
+		if _, err = evt.CreateType("address", address.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create type", err)
+		}
+		created := f.NewRecord().SetName("created").SetField("Address", f.NewRef("address", 0)).ToDataSchema()
+		if _, err = evt.CreateEventType("user", "created", created.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+		// the network schema has two different address records,
+		// and moved_0 has the same one twice
+		address = f.NewRecord().SetName("address").
+			SetField("street", f.SimpleType(schema.String)).
+			SetField("city", f.SimpleType(schema.String)).
+			ToDataSchema()
+		if _, _, err = evt.UpdateType("address", address.EncodeSchemaNative()); err != nil {
+			t.Fatal("cannot update type", err)
+		}
+		moved := f.NewRecord().SetName("moved").
+			SetField("From", f.NewRef("address", 1)).
+			SetField("To", f.NewRef("address", 1)).
+			ToDataSchema()
+		vsn, err := evt.CreateEventType("user", "moved", moved.EncodeSchemaNative())
+		if err != nil {
+			t.Fatal("cannot create event type", err)
+		}
+
+		exportedVsn, files, err := evt.ExportSchema(vsn)
+		if err != nil || exportedVsn != vsn || len(files) != 2 {
+			t.Fatal("cannot export", exportedVsn, files, err)
+		}
+		if files[0].Name != "eventino.avsc" || files[1].Name != fmt.Sprintf("eventino_%d.avsc", vsn) {
+			t.Fatal("wrong file names", files[0].Name, files[1].Name)
+		}
+		for _, file := range files {
+			canonical, err := common.CanonicalForm(file.Schema)
+			if err != nil || file.Fingerprint != common.Fingerprint64(canonical) {
+				t.Fatal("wrong fingerprint", file.Name, err)
+			}
+		}
+		if common.Fingerprint64([]byte(`"int"`)) != 8247732601305521295 {
+			t.Fatal("wrong CRC-64-AVRO fingerprint")
+		}
+		exported := string(files[1].Schema)
+		for _, expected := range []string{
+			`"namespace": "eventino"`,
+			`"namespace": "eventino.data.entity_event.user"`,
+			`"namespace": "eventino.data.entity_event.user.moved_0"`,
+			`"type": "eventino.data.entity_event.user.moved_0.address_1"`,
+		} {
+			if !strings.Contains(exported, expected) {
+				t.Fatal("missing", expected, exported)
+			}
+		}
+
+		// the exported schema encodes as the network codec
+		_, network, err := evt.LoadSchema(vsn)
+		if err != nil {
+			t.Fatal("cannot load schema", err)
+		}
+		var dataSchema map[string]interface{}
+		if err = json.Unmarshal(network, &dataSchema); err != nil {
+			t.Fatal("invalid network schema", err)
+		}
+		netCodec, err := common.NetCodecWithSchema(dataSchema)
+		if err != nil {
+			t.Fatal("cannot build the network codec", err)
+		}
+		exportedCodec, err := goavro.NewCodec(exported)
+		if err != nil {
+			t.Fatal("cannot build the exported codec", err)
+		}
+		put := map[string]interface{}{"data": map[string]interface{}{
+			"entity_event": map[string]interface{}{"user": map[string]interface{}{
+				"id":           []byte("a"),
+				"expected_vsn": int64(-1),
+				"event": map[string]interface{}{"moved_0": map[string]interface{}{"data": map[string]interface{}{
+					"From": map[string]interface{}{"street": "a", "city": "b"},
+					"To":   map[string]interface{}{"street": "c", "city": "d"},
+				}}},
+				"subscription": int64(0), "vsn": int64(0), "ts": int64(0), "position": []byte{},
+			}},
+			"entity_events": nil,
+			"entity_load":   nil,
+		}}
+		b, err := netCodec.BinaryFromNative(nil, put)
+		if err != nil {
+			t.Fatal("cannot encode", err)
+		}
+		native, _, err := exportedCodec.NativeFromBinary(b)
+		if err != nil {
+			t.Fatal("cannot decode with the exported schema", err)
+		}
+		if b2, err := exportedCodec.BinaryFromNative(nil, native); err != nil || string(b2) != string(b) {
+			t.Fatal("wrong encoding", err)
+		}
+		return nil
+	})
+}
+
+func TestOffset(t *testing.T) {
+	if b := EncodeOffset(EventID{}); len(b) != 0 {
+		t.Fatal("the zero position should encode empty", b)
+	}
+	if offset, err := DecodeOffset(nil); err != nil || offset != (EventID{}) {
+		t.Fatal("empty bytes should decode the zero position", offset, err)
+	}
+	position := EventID{Prefix: 1, Timestamp: 42, Index: 3}
+	if offset, err := DecodeOffset(EncodeOffset(position)); err != nil || offset != position {
+		t.Fatal("cannot decode position", offset, err)
+	}
+	if _, err := DecodeOffset(EncodeOffset(position)[:5]); err == nil {
+		t.Fatal("should not decode a malformed position")
+	}
+}